@@ -5,7 +5,7 @@ NAKAMA_APIGRPC=${NAKAMA}/apigrpc
 NAKAMA_COMMON=../../nakama-common/
 
 go run rest.go ${NAKAMA_APIGRPC}/apigrpc.swagger.json > ../nakama/nakama.lua
-python realtime.py ${NAKAMA_COMMON}  ../nakama/socket.lua
+python realtime.py ${NAKAMA_COMMON} ../nakama/socket.lua --messages ../nakama/socket_messages.lua
 
 pushd ${NAKAMA}
 NAKAMA_GRPC_VERISON=$(git describe --tags --abbrev=0)
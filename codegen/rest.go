@@ -21,9 +21,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"reflect"
+	"regexp"
 	"strings"
 	"text/template"
 	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
 )
 
 const codeTemplate string = `-- Code generated by codegen/main.go. DO NOT EDIT.
@@ -39,14 +45,48 @@ local b64 = require "nakama.util.b64"
 local log = require "nakama.util.log"
 local async = require "nakama.util.async"
 local retries = require "nakama.util.retries"
+local token_bucket = require "nakama.util.token_bucket"
+local json_stream = require "nakama.util.json_stream"
+local time = require "nakama.util.time"
+local response_cache = require "nakama.util.response_cache"
+local deduplicator = require "nakama.util.deduplicator"
+local latency_stats = require "nakama.util.latency_stats"
+local circuit_breaker = require "nakama.util.circuit_breaker"
 local api_session = require "nakama.session"
 local socket = require "nakama.socket"
 
 local uri = require "nakama.util.uri"
 local uri_encode = uri.encode
 
+-- replace a path parameter in a url path with the uri encoded value
+-- a function is used as replacement since the encoded value may contain '%'
+local function replace_path_param(url_path, name, value)
+	local encoded = uri_encode(value)
+	return (url_path:gsub("{" .. name .. "}", function() return encoded end))
+end
+
 local M = {}
 
+-- add an Authorization header for basic auth with the username (server key)
+-- and password of the client config to the options of a call
+-- @return Copy of the options with the header added
+local function with_basic_auth(client, opts)
+	local username = client.config.username
+	local password = client.config.password
+	assert(type(username) == "string" and username ~= "", "You must provide a username (the server key) in the client config to authenticate")
+	assert(type(password) == "string", "You must provide a password (eg \"\") in the client config to authenticate")
+	local auth_opts = {}
+	for name,value in pairs(opts or {}) do
+		auth_opts[name] = value
+	end
+	auth_opts.headers = {}
+	for name,value in pairs(opts and opts.headers or {}) do
+		auth_opts.headers[name] = value
+	end
+	auth_opts.headers["Authorization"] = "Basic " .. b64.encode(username .. ":" .. password)
+	return auth_opts
+end
+
 --
 -- Defines
 --
@@ -60,7 +100,241 @@ local M = {}
 {{- range $i, $enum := $definition.Enum }}
 M.{{ $classname | uppercase }}_{{ $enum }} = "{{ $enum }}"
 {{- end }}
+-- all values in the order of the definition
+M.{{ $classname | uppercase }}_VALUES = { {{- range $i, $enum := $definition.Enum }}{{ if $i }},{{ end }} "{{ $enum }}"{{- end }} }
+{{- end }}
+{{- end }}
+
+--- codes
+-- Well-known error codes (gRPC status codes) and notification codes.
+M.codes = {
+{{- range $name, $code := codes }}
+	{{ $name }} = {{ $code }},
+{{- end }}
+}
+
+--- constants
+-- Well-known values which aren't modeled as enums, eg storage permissions.
+{{- range $name, $value := constants }}
+M.{{ $name }} = {{ $value }}
+{{- end }}
+
+{{- if compatFieldAliases }}
+
+-- the camelCase and snake_case aliases of field names, eg "userId" and "user_id"
+local field_aliases = {}
+
+local function field_alias(key)
+	local alias = field_aliases[key]
+	if alias == nil then
+		if key:find("_") then
+			alias = key:gsub("_(%l)", string.upper)
+		else
+			alias = key:gsub("(%l)(%u)", "%1_%2"):lower()
+		end
+		field_aliases[key] = alias
+	end
+	return alias
+end
+
+-- metatable of results where fields can be accessed using both camelCase and
+-- snake_case names
+local field_aliases_mt = {
+	__index = function(t, key)
+		if type(key) ~= "string" then
+			return nil
+		end
+		local alias = field_alias(key)
+		if alias ~= key then
+			return rawget(t, alias)
+		end
+	end,
+}
+
+-- let the fields of a result and of the tables of the result be accessed
+-- using both camelCase and snake_case names. Tables which already have a
+-- metatable are left as they are.
+local function add_field_aliases(value)
+	if type(value) ~= "table" or getmetatable(value) ~= nil then
+		return value
+	end
+	for _,v in pairs(value) do
+		add_field_aliases(v)
+	end
+	return setmetatable(value, field_aliases_mt)
+end
+{{- end }}
+
+{{- if strictResponses }}
+
+--- strict
+-- Set to true to log a warning when a response has fields which aren't in the
+-- definition of the response, which means that the client is out of date, or
+-- to "error" to fail the request instead. This is meant to be used during
+-- development only.
+M.strict = false
+
+-- the fields of the definitions of the responses, with the definition of the
+-- value of the field if it has one
+local response_fields = {
+{{- range $name, $properties := responseFields }}
+	{{- if $properties }}
+	{{ $name }} = {
+	{{- range $key, $definition := $properties }}
+		{{ $key }} = {{ if $definition }}"{{ $definition }}"{{ else }}true{{ end }},
+	{{- end }}
+	},
+	{{- else }}
+	{{ $name }} = {},
+	{{- end }}
+{{- end }}
+}
+
+-- find the fields of a value (or of the items of a list) which aren't in the
+-- definition of the value
+local function find_unexpected_fields(definition, value, path, unexpected)
+	if type(value) ~= "table" or value == json.null then
+		return unexpected
+	end
+	if value[1] ~= nil then
+		for i,item in ipairs(value) do
+			find_unexpected_fields(definition, item, path .. "[" .. i .. "]", unexpected)
+		end
+		return unexpected
+	end
+	local fields = response_fields[definition]
+	for key,v in pairs(value) do
+		local field = fields[key]
+		if not field then
+			table.insert(unexpected, path .. key)
+		elseif field ~= true then
+			find_unexpected_fields(field, v, path .. key .. ".", unexpected)
+		end
+	end
+	return unexpected
+end
+
+-- check the result of an operation for unexpected fields when M.strict is set
+local function check_response_fields(operation, definition, result)
+	if not M.strict or result.error then
+		return result
+	end
+	local unexpected = find_unexpected_fields(definition, result, "", {})
+	if #unexpected == 0 then
+		return result
+	end
+	table.sort(unexpected)
+	local message = "Unexpected fields in the response of " .. operation .. ": " .. table.concat(unexpected, ", ") .. ". The client may be out of date."
+	if M.strict == "error" then
+		return { error = true, message = message }
+	end
+	log(message)
+	return result
+end
+{{- end }}
+
+{{- if describe }}
+
+--- operations
+-- The names of the generated operations, in alphabetical order.
+M.operations = {
+{{- range $operation := describeOperations }}
+	"{{ $operation.Name }}",
+{{- end }}
+}
+
+-- the method, path, params and body and response definitions of each operation
+local operation_descriptions = {
+{{- range $operation := describeOperations }}
+	{{ $operation.Name }} = {
+		name = "{{ $operation.Name }}",
+		method = "{{ $operation.Method }}",
+		path = "{{ $operation.Path }}",
+		params = {
+		{{- range $parameter := $operation.Parameters }}
+			{ name = "{{ $parameter.Name }}", ["in"] = "{{ $parameter.In }}", type = "{{ $parameter.Type }}", required = {{ $parameter.Required }} },
+		{{- end }}
+		},
+		required = {{ describeNames $operation.Parameters "required" }},
+		body_fields = {{ describeNames $operation.Parameters "body" }},
+		{{- if $operation.Body }}
+		body = "{{ $operation.Body }}",
+		{{- end }}
+		{{- if $operation.Response }}
+		response = "{{ $operation.Response }}",
+		{{- end }}
+	},
+{{- end }}
+}
+
+-- copy a description so that changes made by the caller don't affect it
+local function copy_description(value)
+	if type(value) ~= "table" then
+		return value
+	end
+	local c = {}
+	for k,v in pairs(value) do
+		c[k] = copy_description(v)
+	end
+	return c
+end
+
+--- Describe an operation, eg to build a form to call any operation from a
+-- dev console.
+-- @param name The name of the operation, eg "get_account".
+-- @return Table with the 'name', 'method' and 'path' of the operation, the
+-- 'params' (each with the 'name', 'in' (path, query or body), 'type' and
+-- whether it's 'required'), the names of the 'required' params and of the
+-- 'body_fields', and the names of the 'body' and 'response' definitions if
+-- any. Nil if there is no such operation.
+function M.describe(name)
+	return copy_description(operation_descriptions[name])
+end
+{{- end }}
+
+{{- if stubs }}
+
+-- the operations which can be stubbed
+local stub_operations = {
+{{- range $operation := describeOperations }}
+	{{ $operation.Name }} = true,
 {{- end }}
+}
+
+--- stub
+-- Canned responses of operations, to unit test game code without making
+-- requests. A stubbed operation returns the stub, or the result of the stub
+-- if it is a function, instead of making a request. A stub function is called
+-- with the request ({ operation, method, path, query, body }). The result is
+-- handled the same way as a response, eg
+-- nakama.stub.get_account = { user = { username = "bob" } }
+-- nakama.stub.rpc_func = function(request) return { payload = request.body } end
+M.stub = setmetatable({}, {
+	__newindex = function(t, name, stub)
+		assert(stub_operations[name], ("No operation named '%s' to stub"):format(tostring(name)))
+		assert(type(stub) == "table" or type(stub) == "function", "The stub must be a table or a function")
+		rawset(t, name, stub)
+	end
+})
+
+--- Remove all stubs (see M.stub).
+function M.clear_stubs()
+	for name,_ in pairs(M.stub) do
+		M.stub[name] = nil
+	end
+end
+
+-- copy a stub so that changes made when the result is handled don't affect it
+local function copy_stub(value)
+	if type(value) ~= "table" or value == json.null then
+		return value
+	end
+	local c = {}
+	for k,v in pairs(value) do
+		c[k] = copy_stub(v)
+	end
+	return c
+end
 {{- end }}
 
 --
@@ -69,9 +343,46 @@ M.{{ $classname | uppercase }}_{{ $enum }} = "{{ $enum }}"
 
 local _config = {}
 
+-- engines of the created clients, used for timers in M.sync() when all
+-- clients use the same engine
+local client_engines = setmetatable({}, { __mode = "k" })
+
+--- The default max size of a response in bytes (see config.max_response_bytes).
+M.DEFAULT_MAX_RESPONSE_BYTES = 16 * 1024 * 1024
+
+--- The version of the Nakama server the client was generated for. Only the
+-- major version is compared by check_compatibility().
+M.SERVER_VERSION = "{{ serverVersion }}"
+
+
+--- Config presets per environment, used when config.environment is set and
+-- there is no config.presets, eg { prod = { host = "nakama.example.com", port = 443, use_ssl = true } }.
+M.config_presets = nil
+
+-- get the config with the fields of the preset of config.environment which
+-- aren't set in the config itself
+local function apply_config_preset(config)
+	if config.environment == nil then
+		return config
+	end
+	local presets = config.presets or M.config_presets
+	assert(type(presets) == "table", "You must provide config presets to use an environment")
+	local preset = presets[config.environment]
+	assert(type(preset) == "table", ("There is no config preset for the environment '%s'"):format(tostring(config.environment)))
+	local merged = {}
+	for k,v in pairs(preset) do
+		merged[k] = v
+	end
+	for k,v in pairs(config) do
+		merged[k] = v
+	end
+	return merged
+end
 
 --- Create a Nakama client instance.
 -- @param config A table of configuration options.
+-- config.environment - Environment to use the config preset of, eg "prod". Fields set in the config itself take precedence over the preset.
+-- config.presets - Config presets per environment (defaults to M.config_presets), eg { dev = { host = "127.0.0.1", port = 7350 } }.
 -- config.engine - Engine specific implementations.
 -- config.host
 -- config.port
@@ -80,9 +391,42 @@ local _config = {}
 -- config.bearer_token
 -- config.username
 -- config.password
+-- config.clock_skew_seconds - Tolerance when checking if a session has expired, see is_token_expired(). Defaults to the tolerance set using session.set_clock_skew().
+-- config.log_requests - Log requests (default true). Set to false to not log any requests.
+-- config.max_response_bytes - Max size of a response. Larger responses are rejected before they are decoded (default 16 MB).
+-- config.use_server_time - Correct the device clock using the Date header of responses.
+-- config.retry_policy - Default retry policy.
+-- config.retry_budget - Limit retries using a budget of { tokens, refill_per_second }.
+-- config.fields - Response fields to request per operation, sent as a 'fields' query parameter.
+-- config.cache - Time to live in seconds of cached responses per GET operation, eg { get_leaderboard = 30 }.
+-- config.dedup_window - Seconds to return the result of a completed request to other requests with the same opts.idempotency_key (default 5).
+-- config.collect_stats - Keep latency stats per operation, see get_stats(). Requires the engine to report the duration of requests.
+-- config.stats_window - Number of requests per operation to keep latency stats for (default 100).
+-- config.on_token_refreshed - Function called with the new session when the session has been refreshed.
+-- config.on_auth_lost - Function called when the session can't be refreshed because the refresh token was rejected and the user must authenticate again.
+-- config.compatibility - Set to "refuse" to suspend the client when check_compatibility() finds an incompatible server (default "warn").
+-- config.version_rpc - Id of an rpc returning the server version, used by check_compatibility().
+-- config.verification_rpcs - Ids of the rpcs used by send_verification() and verify_code() (default { send = "send_verification", verify = "verify_code" }).
+-- config.on_banned - Function called with { reason, source, operation, code, message } when the user has been banned or the socket has been kicked.
+-- config.rate_limits - Max request rate per operation, eg { authenticate_email = { per_second = 1 } }.
+-- config.http_key - Server http key used for rpc calls made without a session.
+-- config.sign_request - Function called with each request ({ method, path, query, body, timestamp, headers }) returning headers to add to the request.
+-- config.parse_timestamps - Convert RFC3339 timestamps in responses (eg create_time) to seconds since epoch.
+-- config.auto_resubscribe - Restore joined channels, matches, parties and followed users when a socket reconnects.
+-- config.socket_reconnect - Retry policy used to connect a socket again when it is disconnected, eg retries.exponential_jitter(10, 1, 30). Requires engine support for timers.
+-- config.socket_buffer_on_reconnect - Keep socket messages sent while reconnecting until the socket is connected again or config.timeout has passed.
+-- config.socket_backpressure_threshold - Number of pending socket sends at which socket.on_backpressure() is called (default 20), see socket.pending_sends().
+-- config.socket_heartbeat - Seconds between pings sent on a connected socket. The connection is lost if a ping isn't answered before the next one. Requires engine support for timers.
+-- config.resilient_socket - Enable auto_resubscribe, socket_buffer_on_reconnect, socket_reconnect (retries.exponential_jitter(10, 1, 30)) and socket_heartbeat (15 seconds) unless they are set. Set an option to false to disable it. Requires engine support for timers.
+-- config.status_update_debounce - Seconds during which socket status updates are kept and only the latest status is sent, see socket.status_update_now(). Requires engine support for timers.
+-- config.track_sequence - Detect gaps and out of order socket messages with sequence numbers, see socket.on_sequence_gap().
+-- config.build_only - Return the requests built by the client functions instead of making them, as tables with the operation, method, url, path, query, body, headers and timeout.
+-- config.circuit_breaker - Fail requests immediately after the server failed to respond to a number of requests in a row, eg { failure_threshold = 5, cooldown = 30 }, see circuit_state().
+-- config.on_circuit_state_change - Function called with the new and the previous state when the state of the circuit breaker changes.
 -- @return Nakama Client instance.
 function M.create_client(config)
 	assert(config, "You must provide a configuration")
+	config = apply_config_preset(config)
 	assert(config.host, "You must provide a host")
 	assert(config.port, "You must provide a port")
 	assert(config.engine, "You must provide an engine")
@@ -95,7 +439,9 @@ function M.create_client(config)
 	local client = {}
 	local scheme = config.use_ssl and "https" or "http"
 	client.engine = config.engine
+	client_engines[config.engine] = true
 	client.config = {}
+	client.config.environment = config.environment
 	client.config.host = config.host
 	client.config.port = config.port
 	client.config.http_uri = ("%s://%s:%d"):format(scheme, config.host, config.port)
@@ -103,10 +449,98 @@ function M.create_client(config)
 	client.config.username = config.username
 	client.config.password = config.password
 	client.config.timeout = config.timeout or 10
+	-- timeouts of requests per operation, with a default for other operations
+	client.config.timeouts = config.timeouts or {}
+	for operation,timeout in pairs(client.config.timeouts) do
+		assert(type(timeout) == "number" and timeout > 0, "Timeout for '" .. operation .. "' must be a positive number")
+	end
+	client.config.max_response_bytes = config.max_response_bytes or M.DEFAULT_MAX_RESPONSE_BYTES
 	client.config.use_ssl = config.use_ssl
 	client.config.retry_policy = config.retry_policy or retries.none()
+	if config.retry_budget then
+		client.config.retry_budget = retries.budget(config.retry_budget.tokens, config.retry_budget.refill_per_second)
+	end
+	client.config.use_server_time = config.use_server_time
+	-- clock skew tolerance and server time of the client, used when checking if
+	-- a token has expired
+	client.clock = api_session.create_clock(config.clock_skew_seconds)
+	client.config.log_requests = config.log_requests ~= false
+	client.config.fields = config.fields or {}
+	client.config.cache = config.cache or {}
+	client.response_cache = response_cache.create()
+	-- sockets created by the client, disconnected by logout()
+	client.sockets = setmetatable({}, { __mode = "k" })
+	client.config.dedup_window = config.dedup_window or 5
+	client.deduplicator = deduplicator.create()
+	if config.collect_stats then
+		client.latency_stats = latency_stats.create(config.stats_window or 100)
+	end
+	-- the socket reliability options default to the resilient profile when
+	-- config.resilient_socket is set, and can still be set (or disabled) one by one
+	local function socket_option(name, resilient_default)
+		if config[name] == nil and config.resilient_socket then
+			return resilient_default
+		end
+		return config[name]
+	end
+	client.config.auto_resubscribe = socket_option("auto_resubscribe", true)
+	client.config.track_sequence = config.track_sequence
+	client.config.socket_buffer_on_reconnect = socket_option("socket_buffer_on_reconnect", true)
+	client.config.socket_backpressure_threshold = config.socket_backpressure_threshold or 20
+	client.config.socket_reconnect = socket_option("socket_reconnect", config.resilient_socket and retries.exponential_jitter(10, 1, 30))
+	if client.config.socket_reconnect then
+		assert(type(client.config.socket_reconnect) == "table", "The socket reconnect policy must be a retry policy")
+		assert(type(config.engine.timer_delay) == "function", "The engine must provide the 'timer_delay' function to reconnect sockets")
+	end
+	client.config.socket_heartbeat = socket_option("socket_heartbeat", 15)
+	if client.config.socket_heartbeat then
+		assert(type(client.config.socket_heartbeat) == "number" and client.config.socket_heartbeat > 0, "The socket heartbeat must be a positive number of seconds")
+		assert(type(config.engine.timer_delay) == "function", "The engine must provide the 'timer_delay' function to send socket heartbeats")
+	end
+	if config.status_update_debounce then
+		assert(type(config.status_update_debounce) == "number" and config.status_update_debounce > 0, "The status update debounce must be a positive number of seconds")
+		assert(type(config.engine.timer_delay) == "function", "The engine must provide the 'timer_delay' function to debounce status updates")
+	end
+	client.config.status_update_debounce = config.status_update_debounce
+	client.config.socket_format = config.socket_format
+	assert(not config.socket_path or (type(config.socket_path) == "string" and config.socket_path:sub(1, 1) == "/"), "The socket path must start with '/'")
+	client.config.socket_path = config.socket_path or "/ws"
+	assert(not config.storage_integer_keys or config.storage_integer_keys == "map" or config.storage_integer_keys == "array", "The storage integer keys must be 'map' or 'array'")
+	client.config.storage_integer_keys = config.storage_integer_keys or "map"
+	client.config.parse_timestamps = config.parse_timestamps
+	client.config.http_key = config.http_key
+	client.config.on_token_refreshed = config.on_token_refreshed
+	client.config.on_auth_lost = config.on_auth_lost
+	client.config.on_banned = config.on_banned
+	assert(not config.compatibility or config.compatibility == "warn" or config.compatibility == "refuse", "The compatibility must be 'warn' or 'refuse'")
+	client.config.compatibility = config.compatibility or "warn"
+	client.config.version_rpc = config.version_rpc
+	client.config.verification_rpcs = {
+		send = config.verification_rpcs and config.verification_rpcs.send or "send_verification",
+		verify = config.verification_rpcs and config.verification_rpcs.verify or "verify_code",
+	}
+	client.config.sign_request = config.sign_request
+	client.config.build_only = config.build_only
+	client.config.rate_limits = {}
+	for operation,rate_limit in pairs(config.rate_limits or {}) do
+		assert(type(rate_limit.per_second) == "number" and rate_limit.per_second > 0, "Rate limit for '" .. operation .. "' must have a positive 'per_second' value")
+		client.config.rate_limits[operation] = token_bucket.create(math.max(1, rate_limit.per_second), rate_limit.per_second)
+	end
+	client.config.on_circuit_state_change = config.on_circuit_state_change
+	if config.circuit_breaker then
+		local failure_threshold = config.circuit_breaker.failure_threshold or 5
+		local cooldown = config.circuit_breaker.cooldown or 30
+		assert(type(failure_threshold) == "number" and failure_threshold >= 1, "The circuit breaker failure threshold must be at least 1")
+		assert(type(cooldown) == "number" and cooldown >= 0, "The circuit breaker cooldown must be a positive number")
+		client.circuit_breaker = circuit_breaker.create(failure_threshold, cooldown, function(state, previous_state)
+			log("circuit breaker", previous_state, "->", state)
+			if client.config.on_circuit_state_change then
+				client.config.on_circuit_state_change(state, previous_state)
+			end
+		end, config.engine.time)
+	end
 
-	local ignored_fns = { create_client = true, sync = true }
+	local ignored_fns = { create_client = true, sync = true, wallet_update_local = true, notifications_filter = true, notifications_mark_read = true, debug_pending = true, debug_clear = true, describe = true, clear_stubs = true }
 	for name,fn in pairs(M) do
 		if not ignored_fns[name] and type(fn) == "function" then
 			log("setting " .. name)
@@ -123,7 +557,51 @@ end
 -- @return Socket instance.
 function M.create_socket(client)
 	assert(client, "You must provide a client")
-	return socket.create(client)
+	local s = socket.create(client)
+	client.sockets[s] = true
+	return s
+end
+
+--- Check whether a session token has expired, using the clock skew tolerance
+-- and the server time of the client (see config.clock_skew_seconds and
+-- config.use_server_time).
+-- @param client Nakama client.
+-- @param session The session object created with session.create().
+-- @return A boolean if the token has expired or not.
+function M.is_token_expired(client, session)
+	assert(client, "You must provide a client")
+	return api_session.is_token_expired(session, client.clock)
+end
+
+--- Check whether a session token is about to expire (within 24 hours), using
+-- the clock skew tolerance and the server time of the client.
+-- @param client Nakama client.
+-- @param session The session object created with session.create().
+-- @return A boolean if the token is about to expire or not.
+function M.is_token_expired_soon(client, session)
+	assert(client, "You must provide a client")
+	return api_session.is_token_expired_soon(session, client.clock)
+end
+
+--- Check whether a session refresh token has expired, using the clock skew
+-- tolerance and the server time of the client.
+-- @param client Nakama client.
+-- @param session The session object created with session.create().
+-- @return A boolean if the refresh token has expired or not.
+function M.is_refresh_token_expired(client, session)
+	assert(client, "You must provide a client")
+	return api_session.is_refresh_token_expired(session, client.clock)
+end
+
+--- Check that a token is a well formed JWT which hasn't expired, using the
+-- clock skew tolerance and the server time of the client, see session.validate().
+-- @param client Nakama client.
+-- @param token The token, eg session.token.
+-- @return true if the token is valid, otherwise false and the reason
+-- ("malformed" or "expired").
+function M.validate_token(client, token)
+	assert(client, "You must provide a client")
+	return api_session.validate(token, client.clock)
 end
 
 --- Set Nakama client bearer token.
@@ -134,14 +612,132 @@ function M.set_bearer_token(client, bearer_token)
 	client.config.bearer_token = bearer_token
 end
 
+--- Suspend the client, for instance when the app is sent to the background.
+-- While the client is suspended:
+-- * Failed requests are not retried.
+-- * New requests fail immediately with an error result with code "suspended"
+-- if opts.fail_requests is set, except for operations listed in opts.allow.
+-- Requests which have already been sent are not cancelled and sockets are not
+-- affected.
+-- @param client Nakama client.
+-- @param opts Optional table of options:
+-- opts.fail_requests - Fail new requests while suspended.
+-- opts.allow - List of operations which are allowed while suspended, eg { "session_refresh" }.
+function M.suspend(client, opts)
+	assert(client, "You must provide a client")
+	opts = opts or {}
+	assert(not opts.allow or type(opts.allow) == "table", "Argument 'opts.allow' must be 'nil' or of type 'table'")
+	local allow = {}
+	for _,operation in ipairs(opts.allow or {}) do
+		allow[operation] = true
+	end
+	client.config.suspended = {
+		fail_requests = opts.fail_requests,
+		allow = allow,
+	}
+end
+
+--- Resume a suspended client.
+-- @param client Nakama client.
+function M.resume(client)
+	assert(client, "You must provide a client")
+	client.config.suspended = nil
+end
+
+--- Remove cached responses (see config.cache).
+-- @param client Nakama client.
+-- @param pattern Optional Lua pattern matched against the url path and query
+-- of the cached responses to remove, eg "^/v2/leaderboard/". All cached
+-- responses are removed if no pattern is provided.
+function M.cache_invalidate(client, pattern)
+	assert(client, "You must provide a client")
+	assert(not pattern or type(pattern) == "string", "Argument 'pattern' must be 'nil' or of type 'string'")
+	client.response_cache.invalidate(pattern)
+end
+
+--- Get the latency stats of each operation (see config.collect_stats).
+-- The stats are based on the durations of the most recent requests of each
+-- operation (see config.stats_window) as reported by the engine.
+-- @param client Nakama client.
+-- @return Table with the stats of each operation, eg { get_account = { count,
+-- p50, p95, max } }, with durations in seconds. Empty if stats aren't collected.
+function M.get_stats(client)
+	assert(client, "You must provide a client")
+	if not client.latency_stats then
+		return {}
+	end
+	return client.latency_stats.get()
+end
+
+--- Get the state of the circuit breaker (see config.circuit_breaker).
+-- @param client Nakama client.
+-- @return "closed" if requests are made, "open" if requests fail without
+-- being made, or "half_open" if a request is made to test if the server has
+-- recovered. Always "closed" if the circuit breaker isn't configured.
+function M.circuit_state(client)
+	assert(client, "You must provide a client")
+	if not client.circuit_breaker then
+		return circuit_breaker.CLOSED
+	end
+	return client.circuit_breaker.state
+end
+
+--- Create a client which streams the items of an array in responses.
+-- Requests made with the returned client pass each item of the array field
+-- of the response to the item callback instead of including them in the
+-- result. The items are decoded one at a time as they are received if the
+-- engine supports streaming (see engine.http_stream).
+-- @param client Nakama client.
+-- @param field Name of the array field in the response, eg "objects".
+-- @param on_item Function to call with each array item.
+-- @return Streaming Nakama client.
+function M.stream(client, field, on_item)
+	assert(client, "You must provide a client")
+	assert(type(field) == "string", "You must provide a field")
+	assert(type(on_item) == "function", "You must provide an item callback")
+	local stream_client = setmetatable({}, { __index = client })
+	stream_client.response_stream = { field = field, on_item = on_item }
+	for name,fn in pairs(M) do
+		if type(client[name]) == "function" then
+			stream_client[name] = function(...) return fn(stream_client, ...) end
+		end
+	end
+	return stream_client
+end
+
 
--- cancellation tokens associated with a coroutine
-local cancellation_tokens = {}
+-- cancellation tokens associated with a coroutine, shared with the socket
+local cancellation_tokens = async.cancellation_tokens
+
+-- functions stopping the timeout timer of a coroutine run using nakama.sync()
+local sync_timers = setmetatable({}, { __mode = "k" })
+
+-- stop tracking a coroutine which has finished or failed
+local function release_coroutine(co)
+	cancellation_tokens[co] = nil
+	local stop_timer = sync_timers[co]
+	if stop_timer then
+		sync_timers[co] = nil
+		stop_timer()
+	end
+end
 
 -- cancel a cancellation token
+-- any functions in token.on_cancel are called when the token is cancelled
 function M.cancel(token)
 	assert(token)
+	if token.cancelled then
+		return
+	end
 	token.cancelled = true
+	-- the functions may remove themselves from the list when called
+	local on_cancel = {}
+	for i,fn in ipairs(token.on_cancel or {}) do
+		on_cancel[i] = fn
+	end
+	for _,fn in ipairs(on_cancel) do
+		fn()
+	end
 end
 
 -- create a cancellation token
@@ -149,30 +745,110 @@ end
 -- @return token Pass the token to a call to nakama.sync() or to any of the API calls
 function M.cancellation_token()
 	local token = {
-		cancelled = false
+		cancelled = false,
+		on_cancel = {},
 	}
 	function token.cancel()
-		token.cancelled = true
+		M.cancel(token)
 	end
 	return token
 end
 
+--- Get the coroutines tracked with a cancellation token, to debug leaks.
+-- A coroutine running nakama.sync() with a cancellation token is tracked until
+-- it has finished. A coroutine which is "dead" failed without being removed.
+-- @return Table with the 'count' of tracked coroutines and a list of
+-- 'coroutines', each with the 'status' of the coroutine (see
+-- coroutine.status()) and whether the token has been 'cancelled'.
+function M.debug_pending()
+	local pending = { count = 0, coroutines = {} }
+	for co,token in pairs(cancellation_tokens) do
+		pending.count = pending.count + 1
+		table.insert(pending.coroutines, { status = coroutine.status(co), cancelled = token.cancelled })
+	end
+	return pending
+end
+
+--- Stop tracking coroutines with a cancellation token, to work around leaks.
+-- Only coroutines which are dead are removed by default, which doesn't affect
+-- running calls.
+-- @param all Optional. Remove all coroutines. Calls which are still running
+-- can then no longer be cancelled using their cancellation token.
+-- @return The number of coroutines which were removed.
+function M.debug_clear(all)
+	local removed = 0
+	for co,_ in pairs(cancellation_tokens) do
+		if all or coroutine.status(co) == "dead" then
+			cancellation_tokens[co] = nil
+			removed = removed + 1
+		end
+	end
+	return removed
+end
+
 -- Private
 -- Run code within a coroutine
 -- @param fn The code to run
 -- @param cancellation_token Optional cancellation token to cancel the running code
-function M.sync(fn, cancellation_token)
+-- @param opts Optional table of options:
+-- opts.timeout - Cancel the running code after this many seconds. Requires engine support for timers.
+-- opts.on_timeout - Optional function to call when the running code was cancelled after the timeout.
+-- opts.engine - Optional engine to use for the timeout timer.
+-- opts.client - Optional client whose engine to use for the timeout timer.
+-- The engine or the client is required for a timeout when clients with
+-- different engines have been created.
+function M.sync(fn, cancellation_token, opts)
 	assert(fn)
+	assert(not opts or type(opts) == "table", "Argument 'opts' must be 'nil' or of type 'table'")
+	opts = opts or {}
+	assert(not opts.timeout or type(opts.timeout) == "number", "The timeout must be a number")
+
+	local finished = false
+	local engine = opts.engine or (opts.client and opts.client.engine)
+	if opts.timeout and not engine then
+		for client_engine,_ in pairs(client_engines) do
+			assert(not engine, "Clients with different engines exist, pass 'opts.engine' or 'opts.client' to use a timeout")
+			engine = client_engine
+		end
+	end
+	local timer_handle = nil
+	local function stop_timer()
+		finished = true
+		if timer_handle and engine.timer_cancel then
+			engine.timer_cancel(timer_handle)
+		end
+		timer_handle = nil
+	end
+	if opts.timeout then
+		assert(engine and engine.timer_delay, "The engine must provide the 'timer_delay' function to use a timeout")
+		cancellation_token = cancellation_token or M.cancellation_token()
+		timer_handle = engine.timer_delay(opts.timeout, function()
+			timer_handle = nil
+			if finished or cancellation_token.cancelled then
+				return
+			end
+			log("sync() timed out")
+			M.cancel(cancellation_token)
+			if opts.on_timeout then
+				opts.on_timeout()
+			end
+		end)
+	end
+
 	local co = nil
 	co = coroutine.create(function()
-		cancellation_tokens[co] = cancellation_token
 		fn()
-		cancellation_tokens[co] = nil
+		release_coroutine(co)
 	end)
+	cancellation_tokens[co] = cancellation_token
+	sync_timers[co] = stop_timer
+	-- release the coroutine if it fails after being resumed by a response or
+	-- a socket event
+	async.on_error(co, release_coroutine)
 	local ok, err = coroutine.resume(co)
 	if not ok then
 		log(err)
-		cancellation_tokens[co] = nil
+		release_coroutine(co)
 	end
 end
 
@@ -180,110 +856,660 @@ end
 -- Nakama REST API
 --
 
--- http request helper used to reduce code duplication in all API functions below
-local function http(client, callback, url_path, query_params, method, post_data, retry_policy, cancellation_token, handler_fn)
-	if callback then
-		log(url_path, "with callback")
-		client.engine.http(client.config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result)
-			if not cancellation_token or not cancellation_token.cancelled then
-				callback(handler_fn(result))
-			end
-		end)
-	else
-		log(url_path, "with coroutine")
-		local co = coroutine.running()
-		assert(co, "You must be running this from withing a coroutine")
-
-		-- get cancellation token associated with this coroutine
-		cancellation_token = cancellation_tokens[co]
-		if cancellation_token and cancellation_token.cancelled then
-			cancellation_tokens[co] = nil
-			return
-		end
-
-		return async(function(done)
-			client.engine.http(client.config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result)
-				if cancellation_token and cancellation_token.cancelled then
-					cancellation_tokens[co] = nil
-					return
-				end
-				done(handler_fn(result))
-			end)
-		end)
+-- check the keys and values of a map argument
+-- @return The map or nil if it is empty, since an empty table would be encoded as a JSON array
+local function map_arg(name, map, value_type)
+	if map == json.null then
+		return map
+	end
+	if map == nil or next(map) == nil then
+		return nil
 	end
+	for k,v in pairs(map) do
+		assert(type(k) == "string", ("Argument '%s' must only have keys of type 'string'"):format(name))
+		assert(type(v) == value_type, ("Argument '%s' must only have values of type '%s'"):format(name, value_type))
+	end
+	return map
 end
 
+-- encode the body of a request, where the fields which are nil have been
+-- omitted and fields set to json.null are encoded as null
+-- @return The JSON object, "{}" if all fields were omitted since an empty table
+-- would be encoded as a JSON array
+local function encode_body(body)
+	if next(body) == nil then
+		return "{}"
+	end
+	return json.encode(body)
+end
 
-{{- range $url, $path := .Paths }}
-	{{- range $method, $operation := $path}}
+{{- if hasByteParams }}
 
---- {{ $operation.OperationId | pascalToSnake | removePrefix }}
--- {{ $operation.Summary | stripNewlines }}
--- @param client Nakama client.
-{{- range $i, $parameter := $operation.Parameters }}
-{{- $luaType := luaType $parameter.Type $parameter.Schema.Ref }}
-{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
-{{- $varName := $varName | pascalToSnake }}
-{{- $varComment := varComment $parameter.Name $parameter.Type $parameter.Schema.Ref $parameter.Items.Type }}
-{{- if and (eq $parameter.In "body") $parameter.Schema.Ref }}
-{{- bodyFunctionArgsDocs $parameter.Schema.Ref }}
-{{- end }}
-{{- if and (eq $parameter.In "body") $parameter.Schema.Type }}
--- @param body ({{ $parameter.Schema.Type }}) {{ $parameter.Description | stripNewlines }}
-{{- end }}
-{{- if ne $parameter.In "body" }}
--- @param {{ $varName }} ({{ $parameter.Schema.Type }}) {{ $parameter.Description | stripNewlines }}
+-- base64 encode the bytes of a param or body field with the format "byte"
+local function encode_bytes(value)
+	if type(value) == "string" then
+		return b64.encode(value)
+	end
+	return value
+end
 {{- end }}
 
-{{- end }}
--- @param callback Optional callback function
--- A coroutine is used and the result is returned if no callback function is provided.
--- @param retry_policy Optional retry policy used specifically for this call or nil
--- @param cancellation_token Optional cancellation token for this call
--- @return The result.
-function M.{{ $operation.OperationId | pascalToSnake | removePrefix }}(client
-	{{- range $i, $parameter := $operation.Parameters }}
-	{{- $luaType := luaType $parameter.Type $parameter.Schema.Ref }}
-	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
-	{{- $varName := $varName | pascalToSnake }}
-	{{- $varComment := varComment $parameter.Name $parameter.Type $parameter.Schema.Ref $parameter.Items.Type }}
-	{{- if and (eq $parameter.In "body") $parameter.Schema.Ref }}
-	{{- bodyFunctionArgs $parameter.Schema.Ref}}
-	{{- end }}
-	{{- if and (eq $parameter.In "body") $parameter.Schema.Type }}, {{ $parameter.Name }} {{- end }}
-	{{- if ne $parameter.In "body" }}, {{ $varName }} {{- end }}
-	{{- end }}, callback, retry_policy, cancellation_token)
-	assert(client, "You must provide a client")
-	{{- range $parameter := $operation.Parameters }}
-	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
-	{{- if eq $parameter.In "body" }}
-	{{- bodyFunctionArgsAssert $parameter.Schema.Ref}}
-	{{- end }}
-	{{- if and (eq $parameter.In "body") $parameter.Schema.Type }}
-	assert({{- if $parameter.Required }}body and {{ end }}type(body) == "{{ $parameter.Schema.Type }}", "Argument 'body' must be of type '{{ $parameter.Schema.Type }}'")
-	{{- end }}
+{{- if byteFields }}
 
+-- the fields of the definitions of the responses which are base64 encoded
+-- bytes, or the definition of the fields which have such fields
+local byte_fields = {
+{{- range $name, $properties := byteFields }}
+	{{ $name }} = {
+	{{- range $key, $definition := $properties }}
+		{{ $key }} = {{ if $definition }}"{{ $definition }}"{{ else }}true{{ end }},
 	{{- end }}
+	},
+{{- end }}
+}
 
-	{{- if $operation.OperationId | isAuthenticateMethod }}
-	-- unset the token so username+password credentials will be used
-	client.config.bearer_token = nil
-
-	{{- end}}
-
-	local url_path = "{{- $url }}"
-	{{- range $parameter := $operation.Parameters }}
-	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
-	{{- if eq $parameter.In "path" }}
-	url_path = url_path:gsub("{{- print "{" $parameter.Name "}"}}", uri_encode({{ $varName | pascalToSnake }}))
+-- base64 decode the bytes of the fields of a value (or of the items of a
+-- list) with the format "byte"
+local function decode_byte_fields(definition, value)
+	if type(value) ~= "table" or value == json.null then
+		return value
+	end
+	if value[1] ~= nil then
+		for _,item in ipairs(value) do
+			decode_byte_fields(definition, item)
+		end
+		return value
+	end
+	for key,field in pairs(byte_fields[definition]) do
+		if field == true then
+			if type(value[key]) == "string" then
+				value[key] = b64.decode(value[key])
+			end
+		else
+			decode_byte_fields(field, value[key])
+		end
+	end
+	return value
+end
+{{- end }}
+
+-- update the server time using the Date header of a response
+local function update_server_time(client, response_info)
+	if client.config.use_server_time and response_info and response_info.headers then
+		local date = response_info.headers["date"] or response_info.headers["Date"]
+		if date then
+			api_session.set_server_time(date, client.clock)
+		end
+	end
+end
+
+-- call the session refresh hooks with the result of a session refresh, before
+-- the result is returned (see config.on_token_refreshed and config.on_auth_lost)
+local function notify_session_refresh(client, result, response_info)
+	if result and not result.error then
+		if client.config.on_token_refreshed then
+			client.config.on_token_refreshed(result)
+		end
+	elseif result and (result.code == M.codes.UNAUTHENTICATED or (response_info and response_info.status == 401)) then
+		if client.config.on_auth_lost then
+			client.config.on_auth_lost()
+		end
+	end
+end
+
+-- check if the result of a request means that the user has been banned, in
+-- which case other requests are rejected without being made until the user
+-- authenticates again (see config.on_banned)
+local function detect_ban(client, operation, result)
+	if not result then
+		return
+	end
+	if not result.error then
+		if operation:find("^authenticate") then
+			client.config.banned = nil
+		end
+		return
+	end
+	if result.code ~= M.codes.PERMISSION_DENIED or not tostring(result.message):lower():find("banned") then
+		return
+	end
+	local info = { reason = "banned", source = "http", operation = operation, code = result.code, message = result.message }
+	client.config.banned = info
+	if client.config.on_banned then
+		client.config.on_banned(info)
+	end
+end
+
+-- add the duration of a request reported by the engine to the latency stats
+-- of the operation (see config.collect_stats)
+local function update_stats(client, operation, response_info)
+	if client.latency_stats and response_info and response_info.duration then
+		client.latency_stats.add(operation, response_info.duration)
+	end
+end
+
+-- request a partial response if fields have been configured for the operation
+-- (see config.fields)
+local function add_fields(client, operation, query_params)
+	local fields = client.config.fields[operation]
+	if fields and query_params.fields == nil then
+		query_params.fields = fields
+	end
+end
+
+-- get the timeout of a request or of the operation (see config.timeouts), or
+-- nil to use the timeout of the client
+local function request_timeout(client, operation, opts)
+	return opts and opts.timeout or client.config.timeouts[operation] or client.config.timeouts.default
+end
+
+-- get the extra headers of a request, with the correlation id, the headers of
+-- the call and the headers added by the request signing hook
+local function request_headers(client, correlation_id, opts, url_path, query_params, method, post_data)
+	local headers = { ["X-Correlation-Id"] = correlation_id }
+	for name,value in pairs(opts and opts.headers or {}) do
+		headers[name] = value
+	end
+	if client.config.sign_request then
+		local request = {
+			method = method,
+			path = url_path,
+			query = query_params,
+			body = post_data,
+			timestamp = os.time(),
+			headers = headers,
+		}
+		headers = client.config.sign_request(request) or request.headers
+		headers["X-Correlation-Id"] = correlation_id
+	end
+	return headers
+end
+
+-- build a request instead of making it (see config.build_only), with the
+-- headers and url which the engine would use
+local function build_request(client, operation, url_path, query_params, method, post_data, opts, correlation_id)
+	add_fields(client, operation, query_params)
+	local headers = {
+		["Accept"] = "application/json",
+		["Content-Type"] = "application/json",
+	}
+	if client.config.bearer_token then
+		headers["Authorization"] = "Bearer " .. client.config.bearer_token
+	elseif client.config.username then
+		headers["Authorization"] = "Basic " .. b64.encode(client.config.username .. ":" .. (client.config.password or ""))
+	end
+	for name,value in pairs(request_headers(client, correlation_id, opts, url_path, query_params, method, post_data)) do
+		headers[name] = value
+	end
+
+	local query = {}
+	for name,value in pairs(query_params) do
+		for _,v in ipairs(type(value) == "table" and value or { value }) do
+			table.insert(query, name .. "=" .. uri.encode_component(tostring(v)))
+		end
+	end
+	table.sort(query)
+	local query_string = #query > 0 and ("?" .. table.concat(query, "&")) or ""
+
+	return {
+		operation = operation,
+		method = method,
+		url = client.config.http_uri .. url_path .. query_string,
+		path = url_path,
+		query = query_params,
+		body = post_data,
+		headers = headers,
+		timeout = request_timeout(client, operation, opts) or client.config.timeout,
+	}
+end
+
+-- update the circuit breaker with the result of a request (see
+-- config.circuit_breaker). Only requests which the server failed to respond
+-- to, or failed to handle with a 5xx status, count as failures.
+local function update_circuit_breaker(client, result, response_info)
+	local breaker = client.circuit_breaker
+	if not breaker then
+		return
+	end
+	if not result then
+		breaker.cancel()
+		return
+	end
+	local status = response_info and response_info.status
+	if result.error and (not status or status == 0 or status >= 500) then
+		breaker.failure()
+	else
+		breaker.success()
+	end
+end
+
+-- http request helper used to reduce code duplication in all API functions below
+-- make a request using the engine
+-- the items of the array field of a streaming client (see M.stream) are passed
+-- to the item callback and removed from the result. The items are decoded
+-- incrementally if the engine supports streaming.
+local function engine_http(client, config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback, headers)
+	local stream = client.response_stream
+	if not stream then
+		client.engine.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback, headers)
+	elseif client.engine.http_stream then
+		local decoder = json_stream.create(stream.field, stream.on_item)
+		-- stop decoding a response which is larger than the max size
+		local size = 0
+		local function feed(chunk)
+			size = size + #chunk
+			if size <= config.max_response_bytes then
+				decoder.feed(chunk)
+			end
+		end
+		client.engine.http_stream(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, feed, function(result, response_info)
+			if not result and size > config.max_response_bytes then
+				result = { error = true, code = "response_too_large", message = ("The response is larger than %d bytes"):format(config.max_response_bytes) }
+			end
+			callback(result or decoder.finish(), response_info)
+		end, headers)
+	else
+		client.engine.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result, response_info)
+			if result and not result.error and type(result[stream.field]) == "table" then
+				for _,item in ipairs(result[stream.field]) do
+					stream.on_item(item)
+				end
+				result[stream.field] = {}
+			end
+			callback(result, response_info)
+		end, headers)
+	end
+end
+
+-- operations which accept the server http key instead of a session, with the
+-- name of the query param of the operation for the key if it has one
+local http_key_operations = {
+	rpc = true,
+{{- range $url, $path := .Paths }}
+	{{- range $method, $operation := $path }}
+	{{- if $operation.Security | usesHttpKeyAuth }}
+	{{- $keyParam := "" }}
+	{{- range $parameter := $operation.Parameters }}
+	{{- if and (eq $parameter.In "query") (eq ($parameter.Name | pascalToSnake) "http_key") }}
+	{{- $keyParam = $parameter.Name }}
+	{{- end }}
+	{{- end }}
+	{{ $operation.OperationId | pascalToSnake | removePrefix }} = {{ if $keyParam }}"{{ $keyParam }}"{{ else }}true{{ end }},
+	{{- end }}
+	{{- end }}
+{{- end }}
+}
+
+-- add the server http key to the query params of an operation which accepts
+-- it (or of a request with opts.http_key_auth set), using opts.http_key or
+-- config.http_key when there is no session, for instance when calling an rpc
+-- before authenticating
+local function add_http_key(client, operation, query_params, opts)
+	local key_param = http_key_operations[operation]
+	if not key_param and not (opts and opts.http_key_auth) then
+		return
+	end
+	-- the key was passed as a param of the operation
+	if type(key_param) == "string" and query_params[key_param] then
+		return
+	end
+	local http_key = opts and opts.http_key
+	if not http_key and not client.config.bearer_token then
+		http_key = client.config.http_key
+	end
+	if http_key then
+		query_params["http_key"] = http_key
+	end
+end
+
+local function http(client, operation, callback, url_path, query_params, method, post_data, retry_policy, cancellation_token, opts, handler_fn)
+	add_http_key(client, operation, query_params, opts)
+
+	-- log the request unless logging is disabled for the client or for this call
+	local log = (client.config.log_requests and not (opts and opts.log == false)) and log or function() end
+
+	-- the correlation id is sent with the request, logged and added to error
+	-- results to make it possible to trace the request in the server logs
+	local correlation_id = opts and opts.correlation_id or client.engine.uuid()
+	local function handle_result(result, response_info)
+		if result and result.error then
+			result.correlation_id = correlation_id
+		end
+		result = handler_fn(result, response_info)
+		{{- if compatFieldAliases }}
+		if result and not result.error then
+			add_field_aliases(result)
+		end
+		{{- end }}
+		detect_ban(client, operation, result)
+		if operation == "session_refresh" then
+			notify_session_refresh(client, result, response_info)
+		end
+		return result
+	end
+
+	{{- if stubs }}
+	-- return the stub of the operation instead of making a request (see M.stub)
+	local stub = rawget(M.stub, operation)
+	if stub ~= nil then
+		log(url_path, correlation_id, "stubbed")
+		local result
+		if type(stub) == "function" then
+			result = stub({ operation = operation, method = method, path = url_path, query = query_params, body = post_data })
+		else
+			result = copy_stub(stub)
+		end
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+	{{- end }}
+
+	-- return the request instead of making it (see config.build_only)
+	if client.config.build_only then
+		local request = build_request(client, operation, url_path, query_params, method, post_data, opts, correlation_id)
+		if callback then
+			callback(request)
+			return
+		end
+		return request
+	end
+
+	-- serve the response from the cache if it has been cached (see config.cache)
+	local cache_ttl = method == "GET" and not client.response_stream and client.config.cache[operation]
+	local cache_key = cache_ttl and response_cache.key(url_path, query_params)
+	local cached = cache_key and client.response_cache.get(cache_key, client.config.bearer_token)
+	if cached then
+		log(url_path, correlation_id, "cached")
+		if client.config.parse_timestamps then
+			time.convert_timestamps(cached)
+		end
+		if callback then
+			callback(handle_result(cached))
+			return
+		end
+		return handle_result(cached)
+	end
+	-- cache a successful response using the configured time to live or the
+	-- max-age of the response
+	local function cache_response(result, response_info)
+		if cache_key and result and not result.error then
+			local ttl = response_cache.max_age(response_info and response_info.headers) or cache_ttl
+			client.response_cache.set(cache_key, client.config.bearer_token, result, ttl)
+		end
+	end
+
+	-- return the result of a request with the same idempotency key instead of
+	-- making the request again while it is in flight or if it has recently
+	-- completed (see config.dedup_window)
+	local dedup_key = method ~= "GET" and opts and opts.idempotency_key and (operation .. ":" .. opts.idempotency_key)
+	if dedup_key and client.deduplicator.started(dedup_key) then
+		log(url_path, correlation_id, "deduplicated")
+		if callback then
+			client.deduplicator.wait(dedup_key, function(result)
+				callback(handle_result(result))
+			end)
+			return
+		end
+		return handle_result(async(function(done)
+			client.deduplicator.wait(dedup_key, done)
+		end))
+	end
+	local function finish_dedup(result)
+		if dedup_key then
+			client.deduplicator.finish(dedup_key, result, client.config.dedup_window)
+		end
+	end
+
+	-- fail without making a request if the configured rate for the operation is exceeded
+	local rate_limit = client.config.rate_limits[operation]
+	if rate_limit and not rate_limit.consume() then
+		log(url_path, correlation_id, "rate limited")
+		local result = { error = true, code = "rate_limited_local", message = "Rate limit exceeded for " .. operation }
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+
+	-- fail without making a request if the client is suspended and the operation isn't allowed
+	local suspended = client.config.suspended
+	if suspended and suspended.fail_requests and not suspended.allow[operation] then
+		log(url_path, correlation_id, "suspended")
+		local result = { error = true, code = "suspended", message = "The client is suspended" }
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+
+	-- fail without making a request if the user has been banned, unless authenticating again
+	local banned = client.config.banned
+	if banned and not operation:find("^authenticate") then
+		log(url_path, correlation_id, "banned")
+		local result = { error = true, code = "banned", message = "The user has been banned" }
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+
+	-- fail without making a request while the circuit breaker is open
+	if client.circuit_breaker and not client.circuit_breaker.allow() then
+		log(url_path, correlation_id, "circuit open")
+		local result = { error = true, code = "circuit_open", message = "The server is unavailable, requests to " .. client.config.host .. " are failing" }
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+
+	-- request a partial response if fields have been configured for the operation
+	add_fields(client, operation, query_params)
+
+	-- use the timeout of this request or of the operation (see config.timeouts)
+	-- instead of the timeout of the client
+	local config = client.config
+	local timeout = request_timeout(client, operation, opts)
+	if timeout then
+		config = setmetatable({ timeout = timeout }, { __index = client.config })
+	end
+
+	-- let the request signing hook add headers to the request
+	local headers = request_headers(client, correlation_id, opts, url_path, query_params, method, post_data)
+
+	if callback then
+		log(url_path, correlation_id, "with callback")
+		if dedup_key then
+			client.deduplicator.start(dedup_key)
+		end
+		engine_http(client, config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result, response_info)
+			update_server_time(client, response_info)
+			update_stats(client, operation, response_info)
+			update_circuit_breaker(client, result, response_info)
+			cache_response(result, response_info)
+			if client.config.parse_timestamps then
+				time.convert_timestamps(result)
+			end
+			finish_dedup(result)
+			if not cancellation_token or not cancellation_token.cancelled then
+				callback(handle_result(result, response_info))
+			end
+		end, headers)
+	else
+		log(url_path, correlation_id, "with coroutine")
+		local co = coroutine.running()
+		assert(co, "You must be running this from withing a coroutine")
+
+		-- get cancellation token associated with this coroutine
+		cancellation_token = cancellation_tokens[co]
+		if cancellation_token and cancellation_token.cancelled then
+			release_coroutine(co)
+			if client.circuit_breaker then
+				client.circuit_breaker.cancel()
+			end
+			return
+		end
+
+		if dedup_key then
+			client.deduplicator.start(dedup_key)
+		end
+		return async(function(done)
+			engine_http(client, config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result, response_info)
+				update_server_time(client, response_info)
+				update_stats(client, operation, response_info)
+				update_circuit_breaker(client, result, response_info)
+				cache_response(result, response_info)
+				if client.config.parse_timestamps then
+					time.convert_timestamps(result)
+				end
+				finish_dedup(result)
+				if cancellation_token and cancellation_token.cancelled then
+					release_coroutine(co)
+					return
+				end
+				done(handle_result(result, response_info))
+				-- the coroutine is resumed by done() and is dead if it failed
+				-- instead of finishing nakama.sync(), which would have removed it
+				if coroutine.status(co) == "dead" then
+					release_coroutine(co)
+				end
+			end, headers)
+		end)
+	end
+end
+
+
+{{- range $url, $path := .Paths }}
+	{{- range $method, $operation := $path}}
+
+--- {{ $operation.OperationId | pascalToSnake | removePrefix }}
+-- {{ $operation.Summary | stripNewlines }}
+-- @param client Nakama client.
+{{- range $i, $parameter := $operation.Parameters }}
+{{- $luaType := luaType $parameter.Type $parameter.Schema.Ref }}
+{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
+{{- $varName := $varName | pascalToSnake }}
+{{- $varComment := varComment $parameter.Name $parameter.Type $parameter.Schema.Ref $parameter.Items.Type }}
+{{- if and (eq $parameter.In "body") $parameter.Schema.Ref }}
+{{- bodyFunctionArgsDocs $parameter.Schema.Ref }}
+{{- end }}
+{{- if and (eq $parameter.In "body") $parameter.Schema.Type }}
+-- @param {{ $parameter.Name }} ({{ $parameter.Schema.Type }}) {{ $parameter.Description | stripNewlines }}
+{{- end }}
+{{- if ne $parameter.In "body" }}
+-- @param {{ $varName }} ({{ $parameter.Schema.Type }}) {{ $parameter.Description | stripNewlines }}
+{{- end }}
+
+{{- end }}
+{{- if optsTrailer }}
+-- @param opts Optional table of options for this call, or the callback
+-- function followed by the retry policy, cancellation token and options:
+-- opts.callback - Optional callback function. A coroutine is used and the result is returned if no callback function is provided.
+-- opts.retry_policy - Optional retry policy used specifically for this call.
+-- opts.cancellation_token - Optional cancellation token for this call.
+{{- else }}
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+{{- end }}
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
+-- @return The result.
+{{- if annotations }}
+{{ overloads ($operation.OperationId | pascalToSnake | removePrefix) }}
+{{- end }}
+function M.{{ $operation.OperationId | pascalToSnake | removePrefix }}(client
+	{{- range $i, $parameter := $operation.Parameters }}
+	{{- $luaType := luaType $parameter.Type $parameter.Schema.Ref }}
+	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
+	{{- $varName := $varName | pascalToSnake }}
+	{{- $varComment := varComment $parameter.Name $parameter.Type $parameter.Schema.Ref $parameter.Items.Type }}
+	{{- if and (eq $parameter.In "body") $parameter.Schema.Ref }}
+	{{- bodyFunctionArgs $parameter.Schema.Ref}}
+	{{- end }}
+	{{- if and (eq $parameter.In "body") $parameter.Schema.Type }}, {{ $parameter.Name }} {{- end }}
+	{{- if ne $parameter.In "body" }}, {{ $varName }} {{- end }}
+	{{- end }}, callback, retry_policy, cancellation_token, opts)
+	assert(client, "You must provide a client")
+	{{- if optsTrailer }}
+	if type(callback) == "table" then
+		-- options table instead of the callback, retry policy and cancellation token
+		opts = callback
+		callback, retry_policy, cancellation_token = opts.callback, opts.retry_policy, opts.cancellation_token
+	end
+	{{- end }}
+	{{- range $parameter := $operation.Parameters }}
+	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
+	{{- if eq $parameter.In "body" }}
+	{{- bodyFunctionArgsAssert $parameter.Schema.Ref}}
+	{{- end }}
+	{{- if and (eq $parameter.In "body") $parameter.Schema.Type }}
+	assert({{- if $parameter.Required }}{{ $parameter.Name }} and {{ end }}type({{ $parameter.Name }}) == "{{ luaType $parameter.Schema.Type "" }}", "Argument '{{ $parameter.Name }}' must be of type '{{ luaType $parameter.Schema.Type "" }}'")
+	{{- end }}
+
+	{{- end }}
+
+	{{- if lenientParams }}
+	{{- range $parameter := $operation.Parameters }}
+	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref | pascalToSnake }}
+	{{- if or (eq $parameter.In "path") (eq $parameter.In "query") }}
+	{{- if eq $parameter.Type "string" }}
+	if type({{ $varName }}) == "number" then {{ $varName }} = tostring({{ $varName }}) end
+	{{- end }}
+	{{- if eq $parameter.Type "integer" }}
+	if type({{ $varName }}) == "string" then {{ $varName }} = tonumber({{ $varName }}) or {{ $varName }} end
+	{{- end }}
+	{{- end }}
+	{{- end }}
+	{{- end }}
+
+	{{- if $operation.OperationId | isAuthenticateMethod }}
+	-- unset the token and authenticate using basic auth with the username and password of the config
+	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
+
+	{{- end}}
+
+	local url_path = "{{- $url }}"
+	{{- range $parameter := $operation.Parameters }}
+	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
+	{{- if eq $parameter.In "path" }}
+	{{- if eq $parameter.Format "byte" }}
+	url_path = replace_path_param(url_path, "{{ $parameter.Name }}", encode_bytes({{ $varName | pascalToSnake }}))
+	{{- else }}
+	url_path = replace_path_param(url_path, "{{ $parameter.Name }}", {{ $varName | pascalToSnake }})
+	{{- end }}
 	{{- end }}
 	{{- end }}
 
 	local query_params = {}
 	{{- range $parameter := $operation.Parameters}}
-	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
+	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref | pascalToSnake }}
 	{{- if eq $parameter.In "query"}}
-	query_params["{{- $parameter.Name }}"] = {{ $varName | pascalToSnake }}
+	{{- $value := $varName }}
+	{{- if eq $parameter.Format "byte" }}
+	{{- $value = printf "encode_bytes(%s)" $varName }}
+	{{- end }}
+	{{- if $parameter.Required }}
+	assert({{ $varName }} ~= nil, "Argument '{{ $varName }}' is required")
+	query_params["{{- $parameter.Name }}"] = {{ $value }}
+	{{- else }}
+	if {{ $varName }} ~= nil then
+		query_params["{{- $parameter.Name }}"] = {{ $value }}
+	end
+	{{- end}}
 	{{- end}}
 	{{- end}}
 
@@ -292,17 +1518,58 @@ function M.{{ $operation.OperationId | pascalToSnake | removePrefix }}(client
 	{{- $varName := varName $parameter.Name $parameter.Type $parameter.Schema.Ref }}
 	{{- if eq $parameter.In "body" }}
 	{{- if $parameter.Schema.Ref }}
-	post_data = json.encode({
+	post_data = encode_body({
 		{{- bodyFunctionArgsTable $parameter.Schema.Ref}}	})
 	{{- end }}
 	{{- if $parameter.Schema.Type }}
-	post_data = json.encode(body)
+	post_data = json.encode({{ $parameter.Name }})
 	{{- end }}
 		{{- end }}
 	{{- end }}
 
-	return http(client, callback, url_path, query_params, "{{- $method | uppercase }}", post_data, retry_policy, cancellation_token, function(result)
+	{{- $otherResponses := otherResponses $operation.Responses }}
+
+	return http(client, "{{ $operation.OperationId | pascalToSnake | removePrefix }}", callback, url_path, query_params, "{{- $method | uppercase }}", post_data, retry_policy, cancellation_token, opts, function(result{{ if $otherResponses }}, response_info{{ end }})
+		{{- if $otherResponses }}
+		-- use the schema of the returned status code
+		local status = response_info and response_info.status
+		{{- range $otherResponses }}
+		{{- if and strictResponses (responseDefinition .Schema.Ref) }}
+		if status == {{ .Code }} then
+			result = check_response_fields("{{ $operation.OperationId | pascalToSnake | removePrefix }}", "{{ responseDefinition .Schema.Ref }}", result)
+		end
+		{{- end }}
+		{{- if byteDefinition .Schema.Ref }}
+		if not result.error and status == {{ .Code }} then
+			result = decode_byte_fields("{{ byteDefinition .Schema.Ref }}", result)
+		end
+		{{- end }}
+		if not result.error and status == {{ .Code }} and {{ .Schema.Ref | cleanRef | pascalToSnake }} then
+			return {{ .Schema.Ref | cleanRef | pascalToSnake }}.create(result)
+		end
+		{{- end }}
+		{{- end }}
 		{{- if $operation.Responses.Ok.Schema.Ref }}
+		{{- if and strictResponses (responseDefinition $operation.Responses.Ok.Schema.Ref) }}
+		{{- if $otherResponses }}
+		if not ({{ range $i, $response := $otherResponses }}{{ if $i }} or {{ end }}status == {{ $response.Code }}{{ end }}) then
+			result = check_response_fields("{{ $operation.OperationId | pascalToSnake | removePrefix }}", "{{ responseDefinition $operation.Responses.Ok.Schema.Ref }}", result)
+		end
+		{{- else }}
+		result = check_response_fields("{{ $operation.OperationId | pascalToSnake | removePrefix }}", "{{ responseDefinition $operation.Responses.Ok.Schema.Ref }}", result)
+		{{- end }}
+		{{- end }}
+		{{- if byteDefinition $operation.Responses.Ok.Schema.Ref }}
+		{{- if $otherResponses }}
+		if not result.error and not ({{ range $i, $response := $otherResponses }}{{ if $i }} or {{ end }}status == {{ $response.Code }}{{ end }}) then
+			result = decode_byte_fields("{{ byteDefinition $operation.Responses.Ok.Schema.Ref }}", result)
+		end
+		{{- else }}
+		if not result.error then
+			result = decode_byte_fields("{{ byteDefinition $operation.Responses.Ok.Schema.Ref }}", result)
+		end
+		{{- end }}
+		{{- end }}
 		if not result.error and {{ $operation.Responses.Ok.Schema.Ref | cleanRef | pascalToSnake }} then
 			result = {{ $operation.Responses.Ok.Schema.Ref | cleanRef | pascalToSnake }}.create(result)
 		end
@@ -313,20 +1580,1660 @@ end
 	{{- end }}
 {{- end }}
 
-return M
+{{- if aliases }}
+
+--
+-- Aliases of renamed functions
+--
+
+local deprecation_logged = {}
+
+-- log a deprecation message the first time an alias is called
+local function deprecated(old_name, new_name)
+	if not deprecation_logged[old_name] then
+		deprecation_logged[old_name] = true
+		log(old_name .. "() is deprecated, use " .. new_name .. "() instead")
+	end
+end
+{{- range aliases }}
+
+--- {{ .Old }}
+-- Deprecated, use {{ .New }}() instead.
+function M.{{ .Old }}(...)
+	deprecated("{{ .Old }}", "{{ .New }}")
+	return M.{{ .New }}(...)
+end
+{{- end }}
+{{- end }}
+
+--
+-- Helpers
+--
+
+local unpack = _G.unpack or table.unpack
+
+-- call an API function and pass the result through a transform function
+-- before it is returned or passed to the callback
+-- @param api_fn The API function to call
+-- @param transform_fn Function to transform the result with
+-- @param callback Optional callback function
+-- @param retry_policy Optional retry policy
+-- @param cancellation_token Optional cancellation token
+-- @param ... Arguments to the API function (including the client)
+local function call_and_transform(api_fn, transform_fn, callback, retry_policy, cancellation_token, ...)
+	local args = { ... }
+	local count = select("#", ...)
+	if callback then
+		args[count + 1] = function(result) callback(transform_fn(result)) end
+	end
+	args[count + 2] = retry_policy
+	args[count + 3] = cancellation_token
+	if callback then
+		return api_fn(unpack(args, 1, count + 3))
+	end
+	return transform_fn(api_fn(unpack(args, 1, count + 3)))
+end
+
+-- run a function making a sequence of requests, eg in batches, so that the
+-- requests are stopped when the cancellation token is cancelled. The function
+-- is run in a coroutine using nakama.sync() with the token, the same as a
+-- sequence of requests of the user. The callback isn't called when the token
+-- has been cancelled, while nil is returned to a calling coroutine.
+-- @param fn The function making the requests and returning the result.
+-- @param callback Optional callback function, or nil to return the result to
+-- the running coroutine.
+-- @param cancellation_token Optional cancellation token.
+-- @return The result when called without a callback.
+local function run_cancellable(fn, callback, cancellation_token)
+	local function cancelled()
+		return cancellation_token and cancellation_token.cancelled
+	end
+	if callback then
+		M.sync(function()
+			local result = fn()
+			if not cancelled() then
+				callback(result)
+			end
+		end, cancellation_token)
+		return
+	end
+	assert(coroutine.running(), "You must be running this from within a coroutine")
+	-- the requests use the token of the running coroutine without a token
+	if not cancellation_token then
+		return fn()
+	end
+	if cancelled() then
+		return nil
+	end
+	return async(function(done)
+		local finished = false
+		local on_cancel
+		local function finish(result)
+			if finished then return end
+			finished = true
+			for i,f in ipairs(cancellation_token.on_cancel) do
+				if f == on_cancel then
+					table.remove(cancellation_token.on_cancel, i)
+					break
+				end
+			end
+			done(result)
+		end
+		on_cancel = function() finish(nil) end
+		table.insert(cancellation_token.on_cancel, on_cancel)
+		M.sync(function()
+			finish(fn())
+		end, cancellation_token)
+	end)
+end
+
+-- decode the JSON metadata of a leaderboard or tournament record
+local function decode_record_metadata(record)
+	if record and type(record.metadata) == "string" and record.metadata ~= "" then
+		local ok, metadata = pcall(json.decode, record.metadata)
+		if ok then
+			record.metadata = metadata
+		end
+	end
+	return record
+end
+
+-- decode the JSON metadata of all records in a record list
+local function decode_record_list_metadata(result)
+	if result and not result.error then
+		for _,record in ipairs(result.records or {}) do
+			decode_record_metadata(record)
+		end
+		for _,record in ipairs(result.owner_records or {}) do
+			decode_record_metadata(record)
+		end
+	end
+	return result
+end
+
+--- rpc_httpkey
+-- Execute a function on the server using the http key instead of a session.
+-- @param client Nakama client.
+-- @param id (string) The identifier of the function.
+-- @param payload (table|string) Optional payload of the function. Tables are JSON encoded.
+-- @param http_key (string) Optional http key. Defaults to config.http_key.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.rpc_httpkey(client, id, payload, http_key, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(id) == "string", "Argument 'id' must be of type 'string'")
+	assert(not payload or type(payload) == "table" or type(payload) == "string", "Argument 'payload' must be 'nil' or of type 'table' or 'string'")
+	http_key = http_key or client.config.http_key
+	assert(type(http_key) == "string", "You must provide an http key or set config.http_key")
+	if type(payload) == "table" then
+		payload = json.encode(payload)
+	end
+	return M.rpc_func2(client, id, payload, nil, callback, retry_policy, cancellation_token, { http_key = http_key })
+end
+
+--- rpc
+-- Execute a function on the server with a payload of any content type.
+-- JSON payloads are sent the same way as by rpc_func(). Other payloads are
+-- sent as they are, with the content type of the payload, and the response
+-- is passed on as it is unless it has a JSON content type.
+-- @param client Nakama client.
+-- @param id (string) The identifier of the function.
+-- @param payload (table|string) Optional payload of the function. Tables are JSON encoded.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @param opts (table) Optional table of options: content_type (default
+-- "application/json") and the options of the generated functions (eg log).
+-- @return The result, with the response in result.payload.
+function M.rpc(client, id, payload, callback, retry_policy, cancellation_token, opts)
+	assert(client, "You must provide a client")
+	assert(type(id) == "string", "Argument 'id' must be of type 'string'")
+	assert(not payload or type(payload) == "table" or type(payload) == "string", "Argument 'payload' must be 'nil' or of type 'table' or 'string'")
+	assert(not opts or type(opts) == "table", "Argument 'opts' must be 'nil' or of type 'table'")
+	opts = opts or {}
+	local content_type = opts.content_type or "application/json"
+	local is_json = content_type:find("json") ~= nil
+	assert(is_json or type(payload) ~= "table", "A table payload must be sent with a JSON content type")
+
+	local url_path = replace_path_param("/v2/rpc/{id}", "id", id)
+	local query_params = {}
+	local post_data = nil
+	if is_json then
+		-- the server expects the JSON payload as a JSON encoded string
+		if type(payload) == "table" then
+			payload = json.encode(payload)
+		end
+		post_data = json.encode(payload or "")
+	else
+		-- let the server pass the payload on as it is
+		query_params["unwrap"] = "true"
+		post_data = payload or ""
+	end
+	local request_opts = {}
+	for name,value in pairs(opts) do
+		request_opts[name] = value
+	end
+	request_opts.headers = {}
+	for name,value in pairs(opts.headers or {}) do
+		request_opts.headers[name] = value
+	end
+	request_opts.headers["Content-Type"] = content_type
+
+	return http(client, "rpc", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, request_opts, function(result)
+		-- a response which isn't JSON is passed on as a string by the engine
+		if type(result) == "string" or (not is_json and not result.error) then
+			return { id = id, payload = result }
+		end
+		return result
+	end)
+end
+
+--- tournament_join
+-- Join a tournament.
+-- @param client Nakama client.
+-- @param tournament_id (string) The ID of the tournament to join.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.tournament_join(client, tournament_id, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(tournament_id) == "string", "Argument 'tournament_id' must be of type 'string'")
+	return M.join_tournament(client, tournament_id, callback, retry_policy, cancellation_token)
+end
+
+--- tournament_list
+-- List tournaments. Defaults to a limit of 10 tournaments.
+-- @param client Nakama client.
+-- @param category_start (number) Optional start of the category range.
+-- @param category_end (number) Optional end of the category range.
+-- @param start_time (number) Optional start time (seconds since epoch).
+-- @param end_time (number) Optional end time (seconds since epoch).
+-- @param limit (number) Optional max number of tournaments to return.
+-- @param cursor (string) Optional next page cursor.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.tournament_list(client, category_start, category_end, start_time, end_time, limit, cursor, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(not category_start or type(category_start) == "number", "Argument 'category_start' must be 'nil' or of type 'number'")
+	assert(not category_end or type(category_end) == "number", "Argument 'category_end' must be 'nil' or of type 'number'")
+	assert(not start_time or type(start_time) == "number", "Argument 'start_time' must be 'nil' or of type 'number'")
+	assert(not end_time or type(end_time) == "number", "Argument 'end_time' must be 'nil' or of type 'number'")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not cursor or type(cursor) == "string", "Argument 'cursor' must be 'nil' or of type 'string'")
+	return M.list_tournaments(client, category_start, category_end, start_time, end_time, limit or 10, cursor, callback, retry_policy, cancellation_token)
+end
+
+--- tournament_record_write
+-- Write a record to a tournament. The metadata is JSON encoded before it is
+-- sent and decoded again in the returned record.
+-- @param client Nakama client.
+-- @param tournament_id (string) The ID of the tournament to write the record for.
+-- @param score (number) The score value to submit. Must be an integer.
+-- @param subscore (number) Optional secondary value. Must be an integer.
+-- @param metadata (table) Optional record metadata.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.tournament_record_write(client, tournament_id, score, subscore, metadata, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(tournament_id) == "string", "Argument 'tournament_id' must be of type 'string'")
+	assert(type(score) == "number" and math.floor(score) == score, "Argument 'score' must be an integer")
+	assert(not subscore or (type(subscore) == "number" and math.floor(subscore) == subscore), "Argument 'subscore' must be 'nil' or an integer")
+	assert(not metadata or type(metadata) == "table", "Argument 'metadata' must be 'nil' or of type 'table'")
+	local encoded_metadata = metadata and json.encode(metadata) or nil
+	-- tostring() would use an exponent for large scores
+	local encoded_subscore = subscore and ("%d"):format(subscore) or nil
+	return call_and_transform(M.write_tournament_record, decode_record_metadata, callback, retry_policy, cancellation_token,
+		client, tournament_id, encoded_metadata, nil, ("%d"):format(score), encoded_subscore)
+end
+
+--- tournament_records_list
+-- List tournament records with the record metadata decoded. Use the
+-- next_cursor of the result to fetch the next page. Defaults to a limit of
+-- 10 records.
+-- @param client Nakama client.
+-- @param tournament_id (string) The ID of the tournament to list records for.
+-- @param owner_ids (table) Optional list of owners to retrieve records for.
+-- @param limit (number) Optional max number of records to return.
+-- @param cursor (string) Optional next or previous page cursor.
+-- @param expiry (number) Optional expiry in seconds (since epoch) to begin fetching records from.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.tournament_records_list(client, tournament_id, owner_ids, limit, cursor, expiry, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(tournament_id) == "string", "Argument 'tournament_id' must be of type 'string'")
+	assert(not owner_ids or type(owner_ids) == "table", "Argument 'owner_ids' must be 'nil' or of type 'table'")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not cursor or type(cursor) == "string", "Argument 'cursor' must be 'nil' or of type 'string'")
+	assert(not expiry or type(expiry) == "number", "Argument 'expiry' must be 'nil' or of type 'number'")
+	local encoded_expiry = expiry and tostring(expiry) or nil
+	return call_and_transform(M.list_tournament_records, decode_record_list_metadata, callback, retry_policy, cancellation_token,
+		client, tournament_id, owner_ids, limit or 10, cursor, encoded_expiry)
+end
+
+--- tournament_records_iter
+-- Iterate over the records of a tournament, getting the pages of records
+-- using the next_cursor of the previous page, with the record metadata
+-- decoded. Must be called from a coroutine, eg using nakama.sync(). The
+-- iteration stops when there are no more records, when a request fails or
+-- when the cancellation token is cancelled.
+-- @param client Nakama client.
+-- @param tournament_id (string) The ID of the tournament to list records for.
+-- @param limit (number) Optional number of records per page. Defaults to 10.
+-- @param opts (table) Optional options with any of cursor (string, the cursor
+-- to start from), expiry (number, expiry in seconds since epoch to begin
+-- fetching records from), on_error (function called with the error result of
+-- a failed request), retry_policy and cancellation_token.
+-- @return Iterator function returning the next record.
+function M.tournament_records_iter(client, tournament_id, limit, opts)
+	assert(client, "You must provide a client")
+	assert(type(tournament_id) == "string", "Argument 'tournament_id' must be of type 'string'")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not opts or type(opts) == "table", "Argument 'opts' must be 'nil' or of type 'table'")
+	opts = opts or {}
+	local co = coroutine.running()
+	assert(co, "You must be running this from within a coroutine")
+
+	local cursor = opts.cursor
+	local records = {}
+	local index = 0
+	local done = false
+
+	local function cancelled()
+		local token = opts.cancellation_token or cancellation_tokens[co]
+		return token and token.cancelled
+	end
+
+	-- get the next page, returns false if there are no more records
+	local function next_page()
+		if cancelled() then
+			return false
+		end
+		local result = M.tournament_records_list(client, tournament_id, nil, limit, cursor, opts.expiry, nil, opts.retry_policy, opts.cancellation_token)
+		if not result or cancelled() then
+			return false
+		end
+		if result.error then
+			log("tournament_records_iter()", result.message)
+			if opts.on_error then
+				opts.on_error(result)
+			end
+			return false
+		end
+		records = result.records or {}
+		index = 0
+		local next_cursor = result.next_cursor
+		-- stop after this page if there is no cursor to get the next one
+		if not next_cursor or next_cursor == "" or next_cursor == cursor then
+			done = true
+		end
+		cursor = next_cursor
+		return #records > 0
+	end
+
+	return function()
+		if cancelled() then
+			return nil
+		end
+		index = index + 1
+		if index > #records then
+			if done or not next_page() then
+				records = {}
+				done = true
+				return nil
+			end
+			index = 1
+		end
+		return records[index]
+	end
+end
+
+--- The max number of owners to list leaderboard records for per request, see
+-- leaderboard_records_by_owners().
+M.LEADERBOARD_OWNERS_PER_REQUEST = 100
+
+--- leaderboard_records_by_owners
+-- List the leaderboard records of a set of owners, eg the members of a guild,
+-- with the record metadata decoded. The owners are listed in batches of
+-- M.LEADERBOARD_OWNERS_PER_REQUEST, one request at a time, and the records of
+-- all batches are merged. Owners without a record are left out.
+-- @param client Nakama client.
+-- @param leaderboard_id (string) The ID of the leaderboard to list records for.
+-- @param owner_ids (table) List of owners to retrieve records for.
+-- @param expiry (number) Optional expiry in seconds (since epoch) to begin fetching records from.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return Table with the 'records' of the owners ordered by rank, or the
+-- error result of the first batch which failed.
+function M.leaderboard_records_by_owners(client, leaderboard_id, owner_ids, expiry, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(leaderboard_id) == "string", "Argument 'leaderboard_id' must be of type 'string'")
+	assert(type(owner_ids) == "table", "Argument 'owner_ids' must be of type 'table'")
+	assert(not expiry or type(expiry) == "number", "Argument 'expiry' must be 'nil' or of type 'number'")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+
+	-- split the owners into batches, without duplicates
+	local batches = {}
+	local seen = {}
+	for i,owner_id in ipairs(owner_ids) do
+		assert(type(owner_id) == "string" and owner_id ~= "", ("Owner id %d must be a non-empty string"):format(i))
+		if not seen[owner_id] then
+			seen[owner_id] = true
+			local batch = batches[#batches]
+			if not batch or #batch == M.LEADERBOARD_OWNERS_PER_REQUEST then
+				batch = {}
+				table.insert(batches, batch)
+			end
+			table.insert(batch, owner_id)
+		end
+	end
+	local encoded_expiry = expiry and tostring(expiry) or nil
+
+	local function list()
+		local records = {}
+		for _,batch in ipairs(batches) do
+			if cancellation_token and cancellation_token.cancelled then
+				return nil
+			end
+			-- without a limit only the records of the owners are listed
+			local result = M.list_leaderboard_records(client, leaderboard_id, batch, nil, nil, encoded_expiry, nil, retry_policy, cancellation_token)
+			if not result or result.error then
+				return result
+			end
+			for _,record in ipairs(result.owner_records or {}) do
+				table.insert(records, decode_record_metadata(record))
+			end
+		end
+		table.sort(records, function(a, b)
+			return (tonumber(a.rank) or math.huge) < (tonumber(b.rank) or math.huge)
+		end)
+		return { records = records }
+	end
+
+	return run_cancellable(list, callback, cancellation_token)
+end
+
+-- check that a storage object id has a collection and key
+local function assert_storage_object_id(object_id, i)
+	assert(type(object_id) == "table", ("Storage object %d must be a table"):format(i))
+	assert(type(object_id.collection) == "string", ("Storage object %d must have a 'collection' of type 'string'"):format(i))
+	assert(type(object_id.key) == "string", ("Storage object %d must have a 'key' of type 'string'"):format(i))
+	assert(not object_id.version or type(object_id.version) == "string", ("Storage object %d must have a 'version' of type 'nil' or 'string'"):format(i))
+end
+
+-- get the value of a storage permission provided as a number or as a name,
+-- eg "public" or "STORAGE_PERMISSION_READ_PUBLIC" for M.STORAGE_PERMISSION_READ_PUBLIC
+local function storage_permission(permission, access, name, i)
+	if type(permission) ~= "string" then
+		assert(not permission or type(permission) == "number", ("Storage object %d must have a '%s' of type 'nil', 'number' or 'string'"):format(i, name))
+		return permission
+	end
+	local prefix = "STORAGE_PERMISSION_" .. access .. "_"
+	local suffix = permission:upper():gsub("^" .. prefix, "")
+	local value = M[prefix .. suffix]
+	assert(value, ("Storage object %d has an unknown '%s' '%s'"):format(i, name, permission))
+	return value
+end
+
+--- storage_write_many
+-- Write multiple storage objects in a single request.
+-- @param client Nakama client.
+-- @param objects (table) List of objects to write. Each object must have a
+-- collection, key and value (table or JSON string) and may have a version,
+-- permission_read and permission_write. The permissions are numbers or names,
+-- eg M.STORAGE_PERMISSION_READ_PUBLIC, "STORAGE_PERMISSION_READ_PUBLIC" or
+-- "public".
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.storage_write_many(client, objects, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(objects) == "table" and #objects > 0, "Argument 'objects' must be a non-empty list")
+	local write_objects = {}
+	for i,object in ipairs(objects) do
+		assert_storage_object_id(object, i)
+		assert(type(object.value) == "table" or type(object.value) == "string", ("Storage object %d must have a 'value' of type 'table' or 'string'"):format(i))
+		write_objects[i] = {
+			collection = object.collection,
+			key = object.key,
+			value = type(object.value) == "table" and json.encode(object.value) or object.value,
+			version = object.version,
+			permissionRead = storage_permission(object.permission_read, "READ", "permission_read", i),
+			permissionWrite = storage_permission(object.permission_write, "WRITE", "permission_write", i),
+		}
+	end
+	return M.write_storage_objects(client, write_objects, callback, retry_policy, cancellation_token)
+end
+
+--- storage_delete_many
+-- Delete multiple storage objects in a single request.
+-- @param client Nakama client.
+-- @param object_ids (table) List of object ids to delete. Each object id must
+-- have a collection and key and may have a version.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.storage_delete_many(client, object_ids, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(object_ids) == "table" and #object_ids > 0, "Argument 'object_ids' must be a non-empty list")
+	local delete_object_ids = {}
+	for i,object_id in ipairs(object_ids) do
+		assert_storage_object_id(object_id, i)
+		delete_object_ids[i] = {
+			collection = object_id.collection,
+			key = object_id.key,
+			version = object_id.version,
+		}
+	end
+	return M.delete_storage_objects(client, delete_object_ids, callback, retry_policy, cancellation_token)
+end
+
+-- check if a storage write was rejected because the object has been changed
+-- since it was read
+local function is_version_conflict(result)
+	if not result.error then
+		return false
+	end
+	return result.code == M.codes.ABORTED or tostring(result.message):find("version check failed") ~= nil
+end
+
+--- storage_update
+-- Update a storage object of the user with a read-modify-write. The current
+-- value is read and passed to an update function and the new value is written
+-- with the version which was read. If the object has been changed by another
+-- write in the meantime the read-modify-write is retried.
+-- @param client Nakama client.
+-- @param collection (string) The collection of the object.
+-- @param key (string) The key of the object.
+-- @param update_fn (function) Function called with the current value (table)
+-- or nil if the object doesn't exist. Must return the new value (table).
+-- Objects with integer keys in the value have number keys if
+-- config.storage_integer_keys is "array".
+-- @param max_retries (number) Optional max number of retries when there is a
+-- conflict. Defaults to 3.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result of the write. An error result with code "storage_conflict"
+-- is returned if the object was changed on every attempt.
+function M.storage_update(client, collection, key, update_fn, max_retries, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(collection) == "string", "Argument 'collection' must be of type 'string'")
+	assert(type(key) == "string", "Argument 'key' must be of type 'string'")
+	assert(type(update_fn) == "function", "Argument 'update_fn' must be of type 'function'")
+	assert(not max_retries or type(max_retries) == "number", "Argument 'max_retries' must be 'nil' or of type 'number'")
+	max_retries = max_retries or 3
+
+	local function update()
+		local user_id = client.config.bearer_token and api_session.create({ token = client.config.bearer_token }).user_id
+		for _=0,max_retries do
+			if cancellation_token and cancellation_token.cancelled then
+				return nil
+			end
+			local result = M.read_storage_objects(client, { { collection = collection, key = key, userId = user_id } }, nil, retry_policy, cancellation_token)
+			if not result or result.error then
+				return result
+			end
+			local object = result.objects and result.objects[1]
+			local value = object and object.value and json.decode(object.value, { integer_keys = client.config.storage_integer_keys })
+			local new_value = update_fn(value)
+			assert(type(new_value) == "table", "The update function must return a table")
+			result = M.storage_write_many(client, { {
+				collection = collection,
+				key = key,
+				value = new_value,
+				-- "*" only writes the object if it doesn't exist
+				version = object and object.version or "*",
+				permission_read = object and object.permission_read,
+				permission_write = object and object.permission_write,
+			} }, nil, retry_policy, cancellation_token)
+			if not result or not is_version_conflict(result) then
+				return result
+			end
+			log("storage_update() conflict", collection, key)
+		end
+		return { error = true, code = "storage_conflict", message = ("Unable to update %s/%s, the object was changed on every attempt"):format(collection, key) }
+	end
+
+	return run_cancellable(update, callback, cancellation_token)
+end
+
+--- The default chunk size in bytes of storage_write_large().
+M.DEFAULT_STORAGE_CHUNK_SIZE = 256 * 1024
+
+-- call an rpc of the chunked upload protocol of storage_write_large() and
+-- decode the JSON payload of the response
+local function storage_upload_rpc(client, rpc_id, payload, retry_policy, cancellation_token)
+	local result = M.rpc_func(client, rpc_id, json.encode(payload), nil, nil, retry_policy, cancellation_token, { log = false })
+	if not result or result.error then
+		return result
+	end
+	local ok, decoded = pcall(json.decode, result.payload or "")
+	if not ok or type(decoded) ~= "table" then
+		return { error = true, message = "Invalid response of storage upload rpc " .. rpc_id }
+	end
+	return decoded
+end
+
+--- storage_write_large
+-- Write a large storage object of the user, in chunks which can be resumed if
+-- an rpc implementing the chunked upload protocol is given, or else as a
+-- single write which is retried with the retry policy.
+--
+-- The chunked upload protocol is a server rpc called with a JSON payload with
+-- an 'action', and which responds with a JSON payload:
+--
+-- * { action = "begin", collection, key, size, version, permission_read,
+-- permission_write, upload_id } starts an upload session, or resumes the
+-- session with the upload_id if given and still known by the server. Responds
+-- with { upload_id, offset } where offset is the number of bytes received.
+-- * { action = "chunk", upload_id, offset, data } adds the base64 encoded
+-- bytes of the JSON value from the offset. A chunk which has already been
+-- received must be accepted again. Responds with { offset }.
+-- * { action = "commit", upload_id } writes the object when all bytes have
+-- been received. Responds with the ack of the object { collection, key,
+-- version, user_id }.
+-- @param client Nakama client.
+-- @param collection (string) The collection of the object.
+-- @param key (string) The key of the object.
+-- @param value (table|string) The value of the object (table or JSON string).
+-- @param opts Optional table of options:
+-- opts.rpc - Id of the rpc implementing the chunked upload protocol.
+-- opts.chunk_size - Max number of bytes per chunk (default M.DEFAULT_STORAGE_CHUNK_SIZE).
+-- Values up to the chunk size are written as a single write.
+-- opts.upload_id - Id of an upload session to resume, from the error result of an earlier call.
+-- opts.on_progress - Function called with the bytes sent and the total bytes.
+-- opts.version, opts.permission_read, opts.permission_write - As in storage_write_many().
+-- opts.callback - Optional callback function. A coroutine is used and the
+-- result is returned if no callback function is provided.
+-- opts.retry_policy - Optional retry policy used for each request.
+-- opts.cancellation_token - Optional cancellation token for this call.
+-- @return The result with the 'acks' of the written object. Error results of
+-- chunked uploads have the 'upload_id' and 'offset' of the session to resume.
+function M.storage_write_large(client, collection, key, value, opts)
+	assert(client, "You must provide a client")
+	assert(type(collection) == "string", "Argument 'collection' must be of type 'string'")
+	assert(type(key) == "string", "Argument 'key' must be of type 'string'")
+	assert(type(value) == "table" or type(value) == "string", "Argument 'value' must be of type 'table' or 'string'")
+	opts = opts or {}
+	assert(not opts.rpc or type(opts.rpc) == "string", "Option 'rpc' must be 'nil' or of type 'string'")
+	assert(not opts.chunk_size or (type(opts.chunk_size) == "number" and opts.chunk_size >= 1), "Option 'chunk_size' must be 'nil' or a positive number")
+	assert(not opts.on_progress or type(opts.on_progress) == "function", "Option 'on_progress' must be 'nil' or of type 'function'")
+
+	local data = type(value) == "table" and json.encode(value) or value
+	local chunk_size = opts.chunk_size or M.DEFAULT_STORAGE_CHUNK_SIZE
+	local retry_policy = opts.retry_policy
+	local cancellation_token = opts.cancellation_token
+	local on_progress = opts.on_progress or function() end
+	local function cancelled()
+		return cancellation_token and cancellation_token.cancelled
+	end
+
+	local function write_single()
+		on_progress(0, #data)
+		local result = M.storage_write_many(client, { {
+			collection = collection,
+			key = key,
+			value = data,
+			version = opts.version,
+			permission_read = opts.permission_read,
+			permission_write = opts.permission_write,
+		} }, nil, retry_policy, cancellation_token)
+		if result and not result.error then
+			on_progress(#data, #data)
+		end
+		return result
+	end
+
+	local function write_chunks()
+		local session = storage_upload_rpc(client, opts.rpc, {
+			action = "begin",
+			collection = collection,
+			key = key,
+			size = #data,
+			version = opts.version,
+			permission_read = storage_permission(opts.permission_read, "READ", "permission_read", 1),
+			permission_write = storage_permission(opts.permission_write, "WRITE", "permission_write", 1),
+			upload_id = opts.upload_id,
+		}, retry_policy, cancellation_token)
+		if not session or session.error then
+			return session
+		end
+		local upload_id = session.upload_id
+		local offset = session.offset or 0
+		if cancelled() then
+			return nil
+		end
+		on_progress(offset, #data)
+		while offset < #data do
+			local chunk = data:sub(offset + 1, offset + chunk_size)
+			local result = storage_upload_rpc(client, opts.rpc, {
+				action = "chunk",
+				upload_id = upload_id,
+				offset = offset,
+				data = b64.encode(chunk),
+			}, retry_policy, cancellation_token)
+			if not result or result.error then
+				result = result or { error = true }
+				result.upload_id = upload_id
+				result.offset = offset
+				return result
+			end
+			offset = result.offset or (offset + #chunk)
+			if cancelled() then
+				return nil
+			end
+			on_progress(offset, #data)
+		end
+		local ack = storage_upload_rpc(client, opts.rpc, { action = "commit", upload_id = upload_id }, retry_policy, cancellation_token)
+		if not ack or ack.error then
+			ack = ack or { error = true }
+			ack.upload_id = upload_id
+			ack.offset = offset
+			return ack
+		end
+		return { acks = { ack } }
+	end
+
+	local function write()
+		if opts.rpc and #data > chunk_size then
+			return write_chunks()
+		end
+		return write_single()
+	end
+
+	return run_cancellable(write, opts.callback, cancellation_token)
+end
+
+-- decode the JSON wallet of an account into a table of currencies and amounts
+local function decode_wallet(result)
+	if not result or result.error then
+		return result
+	end
+	local wallet = {}
+	if type(result.wallet) == "string" and result.wallet ~= "" then
+		local ok, decoded = pcall(json.decode, result.wallet)
+		if ok and type(decoded) == "table" then
+			for currency,amount in pairs(decoded) do
+				wallet[currency] = tonumber(amount)
+			end
+		end
+	end
+	return wallet
+end
+
+--- get_wallet
+-- Get the wallet of the current user as a table of currencies and amounts.
+-- @param client Nakama client.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The wallet, eg { gold = 100, gems = 5 }, or an error result.
+function M.get_wallet(client, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	return call_and_transform(M.get_account, function(result)
+		return decode_wallet(result)
+	end, callback, retry_policy, cancellation_token, client)
+end
+
+--- wallet_update_local
+-- Apply a changeset to the wallet cached in a session, without fetching the
+-- account again. Currencies missing from the wallet start at 0 and negative
+-- amounts in the changeset are subtracted.
+-- @param session The session with the cached wallet (session.wallet). The
+-- wallet is created if the session doesn't have one.
+-- @param changeset (table) Currencies and amounts to add, eg { gold = -10, gems = 1 }.
+-- @return The updated wallet.
+function M.wallet_update_local(session, changeset)
+	assert(type(session) == "table", "You must provide a session")
+	assert(type(changeset) == "table", "Argument 'changeset' must be of type 'table'")
+	session.wallet = session.wallet or {}
+	for currency,amount in pairs(changeset) do
+		assert(type(amount) == "number", ("The amount of '%s' must be a number"):format(tostring(currency)))
+		session.wallet[currency] = (session.wallet[currency] or 0) + amount
+	end
+	return session.wallet
+end
+
+-- decode the JSON content of the notifications in a notification list
+local function decode_notification_list(result)
+	if result and not result.error then
+		for _,notification in ipairs(result.notifications or {}) do
+			if type(notification.content) == "string" and notification.content ~= "" then
+				local ok, content = pcall(json.decode, notification.content)
+				if ok then
+					notification.content = content
+				end
+			end
+		end
+	end
+	return result
+end
+
+--- notifications_list
+-- List notifications of the current user with the JSON content of each
+-- notification decoded.
+-- @param client Nakama client.
+-- @param limit (number) Optional number of notifications to get. Between 1 and 100.
+-- @param cacheable_cursor (string) Optional cursor to get notifications from.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.notifications_list(client, limit, cacheable_cursor, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	return call_and_transform(M.list_notifications, decode_notification_list, callback, retry_policy, cancellation_token, client, limit, cacheable_cursor)
+end
+
+-- decode the JSON label of the matches in a match list, keeping labels which
+-- aren't valid JSON as they are
+local function decode_match_list(result)
+	if result and not result.error then
+		for _,match in ipairs(result.matches or {}) do
+			if type(match.label) == "string" and match.label ~= "" then
+				local ok, label = pcall(json.decode, match.label)
+				if ok then
+					match.label = label
+				end
+			end
+		end
+	end
+	return result
+end
+
+--- match_list
+-- List running matches with the JSON label of each match decoded. Labels
+-- which aren't valid JSON are returned as they are.
+-- @param client Nakama client.
+-- @param limit (number) Optional max number of matches to list.
+-- @param authoritative (boolean) Optional authoritative or relayed matches only.
+-- @param label (string) Optional label to filter the matches by.
+-- @param min_size (number) Optional min number of players in a match.
+-- @param max_size (number) Optional max number of players in a match.
+-- @param query (string) Optional query of the match label, eg "+label.mode:ranked".
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.match_list(client, limit, authoritative, label, min_size, max_size, query, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	return call_and_transform(M.list_matches, decode_match_list, callback, retry_policy, cancellation_token,
+		client, limit, authoritative, label, min_size, max_size, query)
+end
+
+--- logout
+-- Log out the user. The session is invalidated on the server, including its
+-- refresh token if a session is provided, and the sockets of the client are
+-- disconnected. The bearer token and the cached responses of the client are
+-- cleared, as well as the session stored using session.store() when running
+-- in Defold, and config.on_auth_lost is called, also when the server failed to
+-- invalidate the session. A session with a token which has expired is already
+-- logged out and is not an error.
+-- @param client Nakama client.
+-- @param session (table) Optional session to log out, eg a restored session.
+-- Defaults to the bearer token of the client.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.logout(client, session, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(not session or type(session) == "table", "Argument 'session' must be 'nil' or of type 'table'")
+	local token = session and session.token or client.config.bearer_token
+	local refresh_token = session and session.refresh_token
+
+	-- check if the token has expired, in which case the server rejects it
+	local function token_expired()
+		if session and session.expires then
+			return api_session.is_token_expired(session, client.clock)
+		end
+		local _, reason = api_session.validate(token, client.clock)
+		return reason == "expired"
+	end
+
+	local function clear(result)
+		for s,_ in pairs(client.sockets) do
+			s.disconnect()
+		end
+		client.config.bearer_token = nil
+		client.response_cache.invalidate()
+		if sys then
+			api_session.clear()
+		end
+		if client.config.on_auth_lost then
+			client.config.on_auth_lost()
+		end
+		if result and result.error and result.code == M.codes.UNAUTHENTICATED and token_expired() then
+			return {}
+		end
+		return result
+	end
+
+	if not token then
+		local result = clear({})
+		if callback then
+			callback(result)
+			return
+		end
+		return result
+	end
+	-- authenticate the request using the token of the session to log out
+	client.config.bearer_token = token
+	return call_and_transform(M.session_logout, clear, callback, retry_policy, cancellation_token,
+		client, refresh_token, token)
+end
+
+--- notifications_delete
+-- Delete multiple notifications in a single request.
+-- @param client Nakama client.
+-- @param notification_ids (table) List of ids of the notifications to delete.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.notifications_delete(client, notification_ids, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(notification_ids) == "table" and #notification_ids > 0, "Argument 'notification_ids' must be a non-empty list")
+	for i,id in ipairs(notification_ids) do
+		assert(type(id) == "string", ("Notification id %d must be of type 'string'"):format(i))
+	end
+	return M.delete_notifications(client, notification_ids, callback, retry_policy, cancellation_token)
+end
+
+--- notifications_filter
+-- Filter a list of notifications without making a request.
+-- @param notifications (table) List of notifications, eg from notifications_list().
+-- @param filter (table) Optional filter with any of code (number), sender_id
+-- (string) and unread (boolean, only include notifications which haven't
+-- been marked as read using notifications_mark_read()).
+-- @return List of the notifications matching the filter.
+function M.notifications_filter(notifications, filter)
+	assert(type(notifications) == "table", "Argument 'notifications' must be of type 'table'")
+	filter = filter or {}
+	local filtered = {}
+	for _,notification in ipairs(notifications) do
+		if (filter.code == nil or tonumber(notification.code) == filter.code)
+		and (filter.sender_id == nil or notification.sender_id == filter.sender_id)
+		and (not filter.unread or not notification.read) then
+			table.insert(filtered, notification)
+		end
+	end
+	return filtered
+end
+
+--- notifications_mark_read
+-- Mark notifications as read, without making a request. Read notifications
+-- have the field read set to true. The server doesn't keep track of read
+-- notifications.
+-- @param notifications (table) List of notifications.
+-- @param notification_ids (table) Optional list of ids of the notifications to
+-- mark. All notifications are marked if no ids are provided.
+-- @return The notifications.
+function M.notifications_mark_read(notifications, notification_ids)
+	assert(type(notifications) == "table", "Argument 'notifications' must be of type 'table'")
+	local ids = nil
+	if notification_ids then
+		ids = {}
+		for _,id in ipairs(notification_ids) do
+			ids[id] = true
+		end
+	end
+	for _,notification in ipairs(notifications) do
+		if not ids or ids[notification.id] then
+			notification.read = true
+		end
+	end
+	return notifications
+end
+
+--- notifications_iter
+-- Iterate over the notifications of the current user, getting the pages of
+-- notifications using the cursor of the previous page, with the JSON content
+-- of each notification decoded. Must be called from a coroutine, eg using
+-- nakama.sync(). The iteration stops when there are no more notifications,
+-- when a request fails or when the cancellation token is cancelled.
+-- @param client Nakama client.
+-- @param limit (number) Optional number of notifications per page. Between 1 and 100.
+-- @param opts (table) Optional options with any of cacheable_cursor (string,
+-- the cursor to start from), mark_read (boolean, mark each notification as
+-- read using notifications_mark_read()), delete (boolean, delete the
+-- notifications of a page in a single request once they have all been
+-- iterated over), on_error (function called with the error result of a
+-- failed request), retry_policy and cancellation_token.
+-- @return Iterator function returning the next notification.
+function M.notifications_iter(client, limit, opts)
+	assert(client, "You must provide a client")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not opts or type(opts) == "table", "Argument 'opts' must be 'nil' or of type 'table'")
+	opts = opts or {}
+	local co = coroutine.running()
+	assert(co, "You must be running this from within a coroutine")
+
+	local cursor = opts.cacheable_cursor
+	local notifications = {}
+	local index = 0
+	local done = false
+
+	local function cancelled()
+		local token = opts.cancellation_token or cancellation_tokens[co]
+		return token and token.cancelled
+	end
+
+	-- delete the notifications of the current page
+	local function delete_page()
+		if not opts.delete or #notifications == 0 then
+			return true
+		end
+		local ids = {}
+		for i,notification in ipairs(notifications) do
+			ids[i] = notification.id
+		end
+		local result = M.notifications_delete(client, ids, nil, opts.retry_policy, opts.cancellation_token)
+		if result and result.error and opts.on_error then
+			opts.on_error(result)
+		end
+		return result and not result.error
+	end
+
+	-- get the next page, returns false if there are no more notifications
+	local function next_page()
+		if not delete_page() or cancelled() then
+			return false
+		end
+		local result = M.notifications_list(client, limit, cursor, nil, opts.retry_policy, opts.cancellation_token)
+		if not result or cancelled() then
+			return false
+		end
+		if result.error then
+			log("notifications_iter()", result.message)
+			if opts.on_error then
+				opts.on_error(result)
+			end
+			return false
+		end
+		notifications = result.notifications or {}
+		index = 0
+		local next_cursor = result.cacheable_cursor
+		-- stop after this page if there is no cursor to get the next one
+		if not next_cursor or next_cursor == "" or next_cursor == cursor then
+			done = true
+		end
+		cursor = next_cursor
+		return #notifications > 0
+	end
+
+	return function()
+		if cancelled() then
+			return nil
+		end
+		index = index + 1
+		if index > #notifications then
+			if done then
+				delete_page()
+				notifications = {}
+				return nil
+			end
+			if not next_page() then
+				notifications = {}
+				done = true
+				return nil
+			end
+			index = 1
+		end
+		local notification = notifications[index]
+		if opts.mark_read then
+			notification.read = true
+		end
+		return notification
+	end
+end
+
+-- the arguments of the link and unlink functions for each type of account,
+-- created from the options passed to M.link() and M.unlink()
+local account_link_args = {
+	apple = function(opts) return { opts.apple, opts.vars }, 2 end,
+	custom = function(opts) return { opts.custom, opts.vars }, 2 end,
+	device = function(opts) return { opts.device, opts.vars }, 2 end,
+	email = function(opts) return { opts.email, opts.password, opts.vars }, 3 end,
+	facebook = function(opts, link)
+		if link then
+			return { opts.facebook, opts.vars, opts.sync }, 3
+		end
+		return { opts.facebook, opts.vars }, 2
+	end,
+	facebook_instant_game = function(opts) return { opts.facebook_instant_game, opts.vars }, 2 end,
+	game_center = function(opts)
+		local gc = opts.game_center
+		assert(type(gc) == "table", "Option 'game_center' must be of type 'table'")
+		return { gc.bundle_id, gc.player_id, gc.public_key_url, gc.salt, gc.signature, gc.timestamp_seconds, opts.vars }, 7
+	end,
+	google = function(opts) return { opts.google, opts.vars }, 2 end,
+	steam = function(opts, link)
+		if link then
+			return { { token = opts.steam, vars = opts.vars }, opts.sync }, 2
+		end
+		return { opts.steam, opts.vars }, 2
+	end,
+}
+
+-- call the link or unlink function for the type of account in the options
+local function account_link(client, action, opts, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(opts) == "table", "Argument 'opts' must be of type 'table'")
+	assert(client.config.bearer_token, ("You must have a session to %s an account"):format(action))
+	local account_type = nil
+	for name,_ in pairs(account_link_args) do
+		if opts[name] ~= nil then
+			assert(not account_type, ("Only one account can be %sed at a time, got '%s' and '%s'"):format(action, tostring(account_type), name))
+			account_type = name
+		end
+	end
+	assert(account_type, ("You must provide an account to %s"):format(action))
+	local args, count = account_link_args[account_type](opts, action == "link")
+	args[count + 1] = callback
+	args[count + 2] = retry_policy
+	args[count + 3] = cancellation_token
+	return M[action .. "_" .. account_type](client, unpack(args, 1, count + 3))
+end
+
+--- link
+-- Link an account to the account of the current user. The type of account is
+-- selected using the options, eg { device = id } or { email = email, password = password }.
+-- @param client Nakama client.
+-- @param opts (table) The account to link, with one of 'apple', 'custom',
+-- 'device', 'email' (and 'password'), 'facebook', 'facebook_instant_game',
+-- 'game_center' (table with 'bundle_id', 'player_id', 'public_key_url',
+-- 'salt', 'signature' and 'timestamp_seconds'), 'google' or 'steam', and
+-- optional 'vars' and 'sync' (import friends for facebook and steam).
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.link(client, opts, callback, retry_policy, cancellation_token)
+	return account_link(client, "link", opts, callback, retry_policy, cancellation_token)
+end
+
+--- unlink
+-- Unlink an account from the account of the current user. The type of account
+-- is selected using the options, see M.link().
+-- @param client Nakama client.
+-- @param opts (table) The account to unlink, see M.link().
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.unlink(client, opts, callback, retry_policy, cancellation_token)
+	return account_link(client, "unlink", opts, callback, retry_policy, cancellation_token)
+end
+
+--- import_friends
+-- Import the friends of the user on a social platform and list the friends of
+-- the user, including the imported friends.
+-- @param client Nakama client.
+-- @param provider (string) The social platform, "facebook" or "steam".
+-- @param token (string) The platform token, the Facebook access token or the
+-- Steam session ticket.
+-- @param reset (boolean) Optional. Reset the friends of the user, replacing
+-- them with the imported friends.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The friends of the user, see M.list_friends(), or an error result.
+function M.import_friends(client, provider, token, reset, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(provider == "facebook" or provider == "steam", "Argument 'provider' must be 'facebook' or 'steam'")
+	assert(type(token) == "string" and token ~= "", "You must provide a platform token")
+	assert(reset == nil or type(reset) == "boolean", "Argument 'reset' must be 'nil' or of type 'boolean'")
+
+	local function import()
+		local result = M["import_" .. provider .. "_friends"](client, token, nil, reset, nil, retry_policy, cancellation_token)
+		if not result or result.error then
+			return result
+		end
+		return M.list_friends(client, nil, nil, nil, nil, retry_policy, cancellation_token)
+	end
+
+	if callback then
+		coroutine.wrap(function()
+			callback(import())
+		end)()
+		return
+	end
+	return import()
+end
+
+--- warm_up
+-- Establish the connection to the server ahead of the first request, for
+-- instance on a login screen, to resolve the host and make the TCP and TLS
+-- handshakes before they are needed. The engine warms up the connection if it
+-- provides engine.warm_up(), otherwise a request is made to the healthcheck
+-- endpoint. Errors are ignored. Calls made while a warm-up is in progress
+-- wait for it instead of starting another one.
+-- @param client Nakama client.
+-- @param callback Optional callback function, called with true if the
+-- connection has been established and false otherwise.
+function M.warm_up(client, callback)
+	assert(client, "You must provide a client")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+	callback = callback or function() end
+	if client.warm_up_callbacks then
+		table.insert(client.warm_up_callbacks, callback)
+		return
+	end
+	client.warm_up_callbacks = { callback }
+
+	local function done(connected)
+		local callbacks = client.warm_up_callbacks
+		client.warm_up_callbacks = nil
+		log("warm_up()", connected and "connected" or "failed")
+		for _,fn in ipairs(callbacks) do
+			fn(connected)
+		end
+	end
+
+	if client.engine.warm_up then
+		client.engine.warm_up(client.config, function(connected)
+			done(connected == true)
+		end)
+		return
+	end
+	-- any response from the server, including an error response, means that
+	-- the connection has been established
+	local status
+	http(client, "warm_up", function()
+		done(status ~= nil)
+	end, "/healthcheck", {}, "GET", nil, retries.none(), nil, { log = false }, function(result, response_info)
+		status = response_info and response_info.status
+		return result
+	end)
+end
+
+-- get the major, minor and patch numbers of a version such as "3.17.1",
+-- "v3.17.1+7a3b2e4" or "3"
+local function parse_version(version)
+	local major, minor, patch = tostring(version or ""):match("^v?(%d+)%.?(%d*)%.?(%d*)")
+	if not major then
+		return nil
+	end
+	return tonumber(major), tonumber(minor) or 0, tonumber(patch) or 0
+end
+
+--- check_compatibility
+-- Check if the version of the server is compatible with the version the client
+-- was generated for (M.SERVER_VERSION). The versions are compatible if the
+-- major versions are the same. The minor and patch versions may differ.
+--
+-- Nakama doesn't report its version by default. The version is read from the
+-- JSON payload ({ version }) of the rpc config.version_rpc if it is set, or else
+-- from the 'version' of the healthcheck response or its X-Nakama-Version header,
+-- which can be added by a proxy.
+--
+-- An incompatible server is logged. If config.compatibility is "refuse" the
+-- client is also suspended and new requests fail, see M.suspend().
+-- @param client Nakama client.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @return Table with 'compatible' (true, false or nil if the server version is
+-- unknown), the 'server_version' and the 'client_version'.
+function M.check_compatibility(client, callback)
+	assert(client, "You must provide a client")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+
+	local function check(result, response_info)
+		local server_version
+		if client.config.version_rpc then
+			local ok, payload = pcall(json.decode, result and not result.error and result.payload or "")
+			server_version = ok and type(payload) == "table" and payload.version or nil
+		else
+			server_version = result and not result.error and result.version
+			for name,value in pairs(response_info and response_info.headers or {}) do
+				if not server_version and name:lower() == "x-nakama-version" then
+					server_version = value
+				end
+			end
+		end
+		local compatibility = { server_version = server_version, client_version = M.SERVER_VERSION }
+		local server_major = parse_version(server_version)
+		if not server_major then
+			log("check_compatibility() unable to get the server version")
+			return compatibility
+		end
+		compatibility.compatible = server_major == parse_version(M.SERVER_VERSION)
+		if not compatibility.compatible then
+			log("check_compatibility() the server version", server_version, "is incompatible with the client version", M.SERVER_VERSION)
+			if client.config.compatibility == "refuse" then
+				M.suspend(client, { fail_requests = true, allow = { "check_compatibility" } })
+			end
+		end
+		return compatibility
+	end
+
+	local url_path, query_params, method, post_data = "/healthcheck", {}, "GET", nil
+	if client.config.version_rpc then
+		url_path = replace_path_param("/v2/rpc/{id}", "id", client.config.version_rpc)
+		method, post_data = "POST", json.encode("{}")
+	end
+	-- the version rpc may be called before authenticating
+	local opts = { log = false, http_key_auth = client.config.version_rpc ~= nil }
+	return http(client, "check_compatibility", callback, url_path, query_params, method, post_data, retries.none(), nil, opts, check)
+end
+
+--- The states of an email or multi-factor verification, see send_verification()
+-- and verify_code().
+M.VERIFICATION_SENT = "sent"
+M.VERIFICATION_VERIFIED = "verified"
+M.VERIFICATION_INVALID = "invalid"
+M.VERIFICATION_EXPIRED = "expired"
+M.VERIFICATION_RATE_LIMITED = "rate_limited"
+M.VERIFICATION_ERROR = "error"
+
+local verification_states = {
+	[M.VERIFICATION_SENT] = true,
+	[M.VERIFICATION_VERIFIED] = true,
+	[M.VERIFICATION_INVALID] = true,
+	[M.VERIFICATION_EXPIRED] = true,
+}
+
+-- call a verification rpc and map the result to a verification state
+local function verification_rpc(client, rpc_id, payload, success_state, callback, retry_policy, cancellation_token)
+	local function verify()
+		-- an empty table would be encoded as a JSON array
+		local data = next(payload) == nil and "{}" or json.encode(payload)
+		local result = M.rpc_func(client, rpc_id, data, nil, nil, retry_policy, cancellation_token)
+		if not result then
+			return result
+		end
+		if result.error then
+			if result.code == M.codes.RESOURCE_EXHAUSTED or result.code == "rate_limited_local" then
+				return { error = true, state = M.VERIFICATION_RATE_LIMITED, code = "rate_limited", message = result.message }
+			elseif result.code == M.codes.INVALID_ARGUMENT then
+				return { state = M.VERIFICATION_INVALID, message = result.message }
+			elseif result.code == M.codes.FAILED_PRECONDITION then
+				return { state = M.VERIFICATION_EXPIRED, message = result.message }
+			end
+			result.state = M.VERIFICATION_ERROR
+			return result
+		end
+		local ok, decoded = pcall(json.decode, result.payload or "")
+		decoded = ok and type(decoded) == "table" and decoded or {}
+		local state = verification_states[decoded.state] and decoded.state or success_state
+		return { state = state, payload = decoded }
+	end
+
+	if callback then
+		coroutine.wrap(function()
+			callback(verify())
+		end)()
+		return
+	end
+	return verify()
+end
+
+--- send_verification
+-- Send a verification code to the user, eg by email, using the rpc
+-- config.verification_rpcs.send (default "send_verification"). The rpc is
+-- called with the http key if there is no session (see config.http_key).
+--
+-- Nakama doesn't provide verification, the rpc is implemented by the server of
+-- the game. The states are mapped from the result of the rpc:
+--
+-- * The 'state' of the JSON payload of the response if it is one of "sent",
+-- "verified", "invalid" or "expired", or "sent" for other successful responses
+-- * "invalid" for an INVALID_ARGUMENT error
+-- * "expired" for a FAILED_PRECONDITION error
+-- * "rate_limited" for a RESOURCE_EXHAUSTED error, as verification rpcs are
+-- commonly throttled, or if the request was rate limited by the client (see
+-- config.rate_limits)
+-- * "error" for other errors
+-- @param client Nakama client.
+-- @param payload (table) Optional payload of the rpc, eg { email = "..." }.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return Table with the 'state' and the decoded 'payload' of the response, or
+-- an error result with the 'state' "rate_limited" or "error".
+function M.send_verification(client, payload, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(not payload or type(payload) == "table", "Argument 'payload' must be 'nil' or of type 'table'")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+	return verification_rpc(client, client.config.verification_rpcs.send, payload or {}, M.VERIFICATION_SENT, callback, retry_policy, cancellation_token)
+end
+
+--- verify_code
+-- Verify a code sent to the user by send_verification(), using the rpc
+-- config.verification_rpcs.verify (default "verify_code") called with the
+-- payload { code }. The states are mapped from the result of the rpc in the
+-- same way as for send_verification(), with "verified" for successful
+-- responses without a state.
+-- @param client Nakama client.
+-- @param code (string|number) The verification code.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return Table with the 'state' and the decoded 'payload' of the response, or
+-- an error result with the 'state' "rate_limited" or "error".
+function M.verify_code(client, code, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(code) == "string" or type(code) == "number", "Argument 'code' must be of type 'string' or 'number'")
+	code = tostring(code):match("^%s*(.-)%s*$")
+	assert(code ~= "", "Argument 'code' must not be empty")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+	return verification_rpc(client, client.config.verification_rpcs.verify, { code = code }, M.VERIFICATION_VERIFIED, callback, retry_policy, cancellation_token)
+end
+
+--- friends_with_status
+-- List the friends of the current user with their online status and keep the
+-- status updated. The statuses of the friends are followed using the socket,
+-- if it is connected. Friends have the online status of the listed users
+-- otherwise, which isn't updated.
+-- @param client Nakama client.
+-- @param socket Nakama socket or nil.
+-- @param limit (number) Optional max number of friends.
+-- @param on_change Optional function called with the friends when the status
+-- of a friend has changed.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return A table with a list of 'friends', each with the 'user', the friend
+-- 'state', an 'online' flag and the 'status' of the user if it is followed,
+-- and a 'stop' function which stops following the statuses, or an error result.
+function M.friends_with_status(client, socket, limit, on_change, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not on_change or type(on_change) == "function", "Argument 'on_change' must be 'nil' or of type 'function'")
+
+	local function list()
+		local result = M.list_friends(client, limit, nil, nil, nil, retry_policy, cancellation_token)
+		if not result or result.error then
+			return result
+		end
+		local view = { friends = {}, stop = function() end }
+		local by_user_id = {}
+		local user_ids = {}
+		for _,friend in ipairs(result.friends or {}) do
+			local user = friend.user or {}
+			local item = { user = user, state = friend.state, online = user.online == true }
+			table.insert(view.friends, item)
+			if user.id then
+				by_user_id[user.id] = item
+				table.insert(user_ids, user.id)
+			end
+		end
+		-- the statuses can't be followed without a connected socket
+		if not socket or not socket.has_connected or socket.reconnecting or #user_ids == 0 then
+			return view
+		end
+
+		local function update(presences, online)
+			for _,presence in ipairs(presences or {}) do
+				local item = by_user_id[presence.user_id]
+				if item then
+					item.online = online
+					item.status = online and presence.status or nil
+				end
+			end
+		end
+		local remove_handler = socket.on("status_presence_event", function(message)
+			local event = message.status_presence_event
+			-- a changed status is a leave followed by a join
+			update(event.leaves, false)
+			update(event.joins, true)
+			if on_change then
+				on_change(view.friends)
+			end
+		end)
+		view.stop = function()
+			remove_handler()
+			socket.status_unfollow(user_ids, function() end)
+		end
+
+		local follow = socket.status_follow(user_ids)
+		if follow and follow.status then
+			-- friends without a presence are offline
+			for _,item in pairs(by_user_id) do
+				item.online = false
+			end
+			update(follow.status.presences, true)
+		end
+		return view
+	end
+
+	if callback then
+		coroutine.wrap(function()
+			callback(list())
+		end)()
+		return
+	end
+	return list()
+end
+
+-- names of the states of a user in a group
+local group_state_names = {
+	[M.GROUP_STATE_SUPERADMIN] = "superadmin",
+	[M.GROUP_STATE_ADMIN] = "admin",
+	[M.GROUP_STATE_MEMBER] = "member",
+	[M.GROUP_STATE_JOIN_REQUEST] = "join_request",
+}
+
+-- get the state of a user in a group from a state or the name of a state
+local function group_state(state)
+	if type(state) == "string" then
+		for value,name in pairs(group_state_names) do
+			if name == state then
+				return value
+			end
+		end
+		error(("Unknown group state '%s'"):format(state))
+	end
+	return state
+end
+
+-- decode the JSON metadata of the groups of a user group list and add the
+-- name of the state of the user in each group
+local function decode_user_group_list(result)
+	if result and not result.error then
+		for _,user_group in ipairs(result.user_groups or {}) do
+			local group = user_group.group
+			if group and type(group.metadata) == "string" and group.metadata ~= "" then
+				local ok, metadata = pcall(json.decode, group.metadata)
+				if ok then
+					group.metadata = metadata
+				end
+			end
+			user_group.state = tonumber(user_group.state)
+			user_group.state_name = group_state_names[user_group.state]
+		end
+	end
+	return result
+end
+
+--- user_groups
+-- List the groups of a user with the metadata of each group decoded and the
+-- name of the state of the user in each group (eg "member") as state_name.
+-- Use the cursor of the result to get the next page. Defaults to a limit of
+-- 100 groups in any state.
+-- @param client Nakama client.
+-- @param user_id (string) The ID of the user.
+-- @param state (number|string) Optional state of the user in the groups, eg
+-- M.GROUP_STATE_MEMBER or "member".
+-- @param limit (number) Optional max number of groups to return. Between 1 and 100.
+-- @param cursor (string) Optional next page cursor.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.user_groups(client, user_id, state, limit, cursor, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(user_id) == "string" and user_id ~= "", "Argument 'user_id' must be a non-empty string")
+	assert(not state or type(state) == "number" or type(state) == "string", "Argument 'state' must be 'nil' or of type 'number' or 'string'")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not cursor or type(cursor) == "string", "Argument 'cursor' must be 'nil' or of type 'string'")
+	return call_and_transform(M.list_user_groups, decode_user_group_list, callback, retry_policy, cancellation_token,
+		client, user_id, limit or 100, group_state(state), cursor)
+end
+
+--- group_join
+-- Join a group, or request to join it if the group is private.
+-- @param client Nakama client.
+-- @param group_id (string) The ID of the group to join.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.group_join(client, group_id, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(group_id) == "string" and group_id ~= "", "Argument 'group_id' must be a non-empty string")
+	return M.join_group(client, group_id, callback, retry_policy, cancellation_token)
+end
+
+--- group_leave
+-- Leave a group.
+-- @param client Nakama client.
+-- @param group_id (string) The ID of the group to leave.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.group_leave(client, group_id, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(group_id) == "string" and group_id ~= "", "Argument 'group_id' must be a non-empty string")
+	return M.leave_group(client, group_id, callback, retry_policy, cancellation_token)
+end
+
+return M
 `
 
-var schema struct {
+// response is the response of an operation for a status code.
+type response struct {
+	Code   int `json:"-"`
+	Schema struct {
+		Ref string `json:"$ref"`
+	}
+}
+
+// responses are the responses of an operation by status code.
+type responses map[string]response
+
+// Ok is the response for status code 200.
+func (r responses) Ok() response {
+	return r["200"]
+}
+
+// otherResponses are the successful responses for status codes other than
+// 200 which have a schema, ordered by status code.
+func otherResponses(r responses) (others []response) {
+	for code, response := range r {
+		status, err := strconv.Atoi(code)
+		if err != nil || status == 200 || status < 200 || status > 299 || response.Schema.Ref == "" {
+			continue
+		}
+		response.Code = status
+		others = append(others, response)
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Code < others[j].Code })
+	return
+}
+
+type swaggerSchema struct {
 	Paths map[string]map[string]struct {
 		Summary     string
 		OperationId string
-		Responses   struct {
-			Ok struct {
-				Schema struct {
-					Ref string `json:"$ref"`
-				}
-			} `json:"200"`
-		}
+		Responses   responses
 		Parameters []struct {
 			Name     	string
 			Description	string
@@ -336,34 +3243,162 @@ var schema struct {
 			Items    	struct { // used with type "array"
 				Type string
 			}
-			Schema struct { // used with http body
-				Type string
-				Ref  string `json:"$ref"`
+			Schema struct { // used with http body
+				Type string
+				Ref  string `json:"$ref"`
+			}
+			Format   string // used with type "boolean"
+			Nullable bool   // not supported, see collectWarnings()
+		}
+		Security []map[string][]struct {
+		}
+	}
+	Definitions map[string]struct {
+		Properties map[string]struct {
+			Type  string
+			Ref   string   `json:"$ref"` // used with object
+			Items struct { // used with type "array"
+				Type string
+				Ref  string `json:"$ref"`
+			}
+			AdditionalProperties struct {
+				Type string // used with type "map"
+				Ref  string `json:"$ref"` // not supported, see collectWarnings()
+			}
+			Format      string // used with type "boolean"
+			Description string
+			// the value may be null, see isNullable()
+			Nullable  bool
+			XNullable bool `json:"x-nullable"`
+			// not supported, see collectWarnings()
+			AllOf []json.RawMessage
+			OneOf []json.RawMessage
+			AnyOf []json.RawMessage
+		}
+		// not supported, see collectWarnings()
+		AllOf       []json.RawMessage
+		OneOf       []json.RawMessage
+		AnyOf       []json.RawMessage
+		Required    []string
+		Enum        []string
+		Description string
+		// used only by enums
+		Title string
+	}
+}
+
+var schema swaggerSchema
+
+// mergeSchema adds the operations and definitions of a schema read from an
+// input file to the schema. An operation with the same path and method as an
+// existing operation or a definition with the same name as a different
+// existing definition is a conflict. Conflicts are an error unless lastWins
+// is set, in which case the operation or definition of the input is used.
+func mergeSchema(part swaggerSchema, input string, lastWins bool) error {
+	if schema.Paths == nil {
+		schema.Paths = part.Paths
+		schema.Definitions = part.Definitions
+		return nil
+	}
+	for url, methods := range part.Paths {
+		if schema.Paths[url] == nil {
+			schema.Paths[url] = methods
+			continue
+		}
+		for method, operation := range methods {
+			if _, ok := schema.Paths[url][method]; ok && !lastWins {
+				return fmt.Errorf("operation %s %s in %s is already defined", strings.ToUpper(method), url, input)
+			}
+			schema.Paths[url][method] = operation
+		}
+	}
+	if schema.Definitions == nil {
+		schema.Definitions = part.Definitions
+		return nil
+	}
+	for name, definition := range part.Definitions {
+		if existing, ok := schema.Definitions[name]; ok && !lastWins && !reflect.DeepEqual(existing, definition) {
+			return fmt.Errorf("definition %s in %s is different from the existing definition", name, input)
+		}
+		schema.Definitions[name] = definition
+	}
+	return nil
+}
+
+// isYAML checks if an input file is a YAML spec using the extension of the
+// file, or the content of the file if it isn't a .json file.
+func isYAML(input string, content []byte) bool {
+	switch strings.ToLower(path.Ext(input)) {
+	case ".yaml", ".yml":
+		return true
+	case ".json":
+		return false
+	}
+	trimmed := strings.TrimSpace(string(content))
+	return len(trimmed) > 0 && trimmed[0] != '{'
+}
+
+// yamlToJSON converts a YAML spec to JSON, to decode it the same way as a JSON
+// spec. The keys of mappings are kept in order.
+func yamlToJSON(content []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if err := writeYAMLNode(&b, &document); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+func writeYAMLNode(b *strings.Builder, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			b.WriteString("null")
+			return nil
+		}
+		return writeYAMLNode(b, node.Content[0])
+	case yaml.AliasNode:
+		return writeYAMLNode(b, node.Alias)
+	case yaml.MappingNode:
+		b.WriteString("{")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			key, _ := json.Marshal(node.Content[i].Value)
+			b.Write(key)
+			b.WriteString(":")
+			if err := writeYAMLNode(b, node.Content[i+1]); err != nil {
+				return err
 			}
-			Format   string // used with type "boolean"
-		}
-		Security []map[string][]struct {
 		}
-	}
-	Definitions map[string]struct {
-		Properties map[string]struct {
-			Type  string
-			Ref   string   `json:"$ref"` // used with object
-			Items struct { // used with type "array"
-				Type string
-				Ref  string `json:"$ref"`
+		b.WriteString("}")
+	case yaml.SequenceNode:
+		b.WriteString("[")
+		for i, item := range node.Content {
+			if i > 0 {
+				b.WriteString(",")
 			}
-			AdditionalProperties struct {
-				Type string // used with type "map"
+			if err := writeYAMLNode(b, item); err != nil {
+				return err
 			}
-			Format      string // used with type "boolean"
-			Description string
 		}
-		Enum        []string
-		Description string
-		// used only by enums
-		Title string
+		b.WriteString("]")
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return fmt.Errorf("line %d: %s", node.Line, err)
+		}
+		scalar, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", node.Line, err)
+		}
+		b.Write(scalar)
 	}
+	return nil
 }
 
 func convertRefToClassName(input string) (className string) {
@@ -415,6 +3450,637 @@ func removePrefix(input string) (output string) {
 	return
 }
 
+// splitPatterns splits a comma separated list of operation name patterns.
+func splitPatterns(input string) (patterns []string) {
+	for _, pattern := range strings.Split(input, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return
+}
+
+// matchPattern checks if an operation name matches a glob pattern.
+func matchPattern(pattern string, name string) bool {
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+// filterOperations removes operations which don't match the include patterns
+// or which match the exclude patterns. Operations are matched using their
+// generated function names. Definitions are removed separately, see
+// pruneDefinitions().
+func filterOperations(include []string, exclude []string) error {
+	for _, pattern := range append(include, exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+		}
+	}
+
+	includeMatches := make(map[string]bool)
+	for url, methods := range schema.Paths {
+		for method, operation := range methods {
+			name := removePrefix(pascalToSnake(operation.OperationId))
+			included := len(include) == 0
+			for _, pattern := range include {
+				if matchPattern(pattern, name) {
+					includeMatches[pattern] = true
+					included = true
+				}
+			}
+			for _, pattern := range exclude {
+				if matchPattern(pattern, name) {
+					included = false
+				}
+			}
+			if !included {
+				delete(methods, method)
+			}
+		}
+		if len(methods) == 0 {
+			delete(schema.Paths, url)
+		}
+	}
+
+	for _, pattern := range include {
+		if !includeMatches[pattern] {
+			return fmt.Errorf("include pattern '%s' does not match any operation", pattern)
+		}
+	}
+	return nil
+}
+
+// definitionRef finds the definition of a ref, eg "#/definitions/apiSession",
+// allowing for the inconsistent casing of definition names (see isEnum).
+func definitionRef(ref string) (string, bool) {
+	name := strings.TrimPrefix(ref, "#/definitions/")
+	for _, candidate := range []string{name, pascalToCamel(name), camelToPascal(name)} {
+		if _, ok := schema.Definitions[candidate]; ok {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// referencedDefinitions finds the definitions referenced by the parameters and
+// responses of the operations, and transitively by the properties of those
+// definitions.
+func referencedDefinitions() map[string]bool {
+	referenced := make(map[string]bool)
+	var visit func(ref string)
+	visit = func(ref string) {
+		name, ok := definitionRef(ref)
+		if !ok || referenced[name] {
+			return
+		}
+		referenced[name] = true
+		for _, property := range schema.Definitions[name].Properties {
+			visit(property.Ref)
+			visit(property.Items.Ref)
+		}
+	}
+	for _, methods := range schema.Paths {
+		for _, operation := range methods {
+			for _, parameter := range operation.Parameters {
+				visit(parameter.Schema.Ref)
+			}
+			for _, response := range operation.Responses {
+				visit(response.Schema.Ref)
+			}
+		}
+	}
+	return referenced
+}
+
+// responseFields finds the properties of the definitions of the responses,
+// and transitively of the definitions of their properties, mapped to the
+// definition of the property value or of the items of an array, if any. Enums
+// aren't included since their values aren't objects.
+func responseFields() map[string]map[string]string {
+	fields := make(map[string]map[string]string)
+	var visit func(ref string) string
+	visit = func(ref string) string {
+		name, ok := definitionRef(ref)
+		if !ok || len(schema.Definitions[name].Enum) > 0 {
+			return ""
+		}
+		if _, ok := fields[name]; ok {
+			return name
+		}
+		properties := make(map[string]string)
+		fields[name] = properties
+		for key, property := range schema.Definitions[name].Properties {
+			properties[key] = visit(property.Ref)
+			if properties[key] == "" {
+				properties[key] = visit(property.Items.Ref)
+			}
+		}
+		return name
+	}
+	for _, methods := range schema.Paths {
+		for _, operation := range methods {
+			for _, response := range operation.Responses {
+				visit(response.Schema.Ref)
+			}
+		}
+	}
+	return fields
+}
+
+// byteFields finds the fields of the definitions of the responses which are
+// base64 encoded bytes (format "byte"), or which have a definition with such
+// fields, to decode them. Definitions without any such fields are left out.
+func byteFields() map[string]map[string]string {
+	fields := responseFields()
+	// find the definitions with byte fields, directly or in the definitions of
+	// their fields, until no more are found
+	hasBytes := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for name, properties := range fields {
+			if hasBytes[name] {
+				continue
+			}
+			for key, definition := range properties {
+				if schema.Definitions[name].Properties[key].Format == "byte" || hasBytes[definition] {
+					hasBytes[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	byteFields := make(map[string]map[string]string)
+	for name := range hasBytes {
+		byteFields[name] = make(map[string]string)
+		for key, definition := range fields[name] {
+			if schema.Definitions[name].Properties[key].Format == "byte" {
+				byteFields[name][key] = ""
+			} else if hasBytes[definition] {
+				byteFields[name][key] = definition
+			}
+		}
+	}
+	return byteFields
+}
+
+// hasByteParams checks if any parameter or body property of the operations is
+// base64 encoded bytes (format "byte").
+func hasByteParams() bool {
+	for _, methods := range schema.Paths {
+		for _, operation := range methods {
+			for _, parameter := range operation.Parameters {
+				if parameter.Format == "byte" {
+					return true
+				}
+				if name, ok := definitionRef(parameter.Schema.Ref); ok {
+					for _, property := range schema.Definitions[name].Properties {
+						if property.Format == "byte" {
+							return true
+						}
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// pruneDefinitions removes definitions which aren't referenced by any of the
+// remaining operations, to only generate what the operations need when they
+// have been filtered.
+func pruneDefinitions() {
+	referenced := referencedDefinitions()
+	for name := range schema.Definitions {
+		if !referenced[name] {
+			delete(schema.Definitions, name)
+		}
+	}
+}
+
+// reservedParamNames are the names used by the generated functions for other
+// arguments and the Lua keywords, which can't be used as parameter names.
+var reservedParamNames = map[string]bool{
+	"client": true, "callback": true, "retry_policy": true, "cancellation_token": true, "opts": true,
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+	"false": true, "for": true, "function": true, "if": true, "in": true, "local": true,
+	"nil": true, "not": true, "or": true, "repeat": true, "return": true, "then": true,
+	"true": true, "until": true, "while": true,
+}
+
+// paramNameCollisions finds the arguments of the generated functions which
+// have the same name as another argument or a reserved name, for instance a
+// path param and a body property which only differed by the type suffix
+// before it was dropped with cleanParamNames.
+func paramNameCollisions() (collisions []string) {
+	for _, methods := range schema.Paths {
+		for _, operation := range methods {
+			name := removePrefix(pascalToSnake(operation.OperationId))
+			seen := make(map[string]string)
+			add := func(argument string, origin string) {
+				if reservedParamNames[argument] {
+					collisions = append(collisions, fmt.Sprintf("%s: %s is named '%s', which is reserved", name, origin, argument))
+				} else if other, ok := seen[argument]; ok {
+					collisions = append(collisions, fmt.Sprintf("%s: %s and %s are both named '%s'", name, other, origin, argument))
+				}
+				seen[argument] = origin
+			}
+			for _, parameter := range operation.Parameters {
+				if parameter.In == "body" && parameter.Schema.Ref != "" {
+					ref := strings.TrimPrefix(parameter.Schema.Ref, "#/definitions/")
+					for key := range schema.Definitions[ref].Properties {
+						add(key, fmt.Sprintf("body property '%s'", key))
+					}
+				} else if parameter.In == "body" {
+					add(parameter.Name, fmt.Sprintf("body param '%s'", parameter.Name))
+				} else {
+					add(pascalToSnake(varName(parameter.Name, parameter.Type, parameter.Schema.Ref)), fmt.Sprintf("%s param '%s'", parameter.In, parameter.Name))
+				}
+			}
+		}
+	}
+	sort.Strings(collisions)
+	return
+}
+
+// handledFormats are the formats of parameters and properties which are
+// generated correctly. Other formats may need conversions which aren't made.
+var handledFormats = map[string]bool{
+	"":          true,
+	"int32":     true,
+	"int64":     true,
+	"uint32":    true,
+	"uint64":    true,
+	"float":     true,
+	"double":    true,
+	"date-time": true,
+	"byte":      true,
+}
+
+// warning is an unhandled swagger construct used by an operation or definition.
+type warning struct {
+	Name   string
+	Detail string
+}
+
+// collectWarnings finds the swagger constructs used by the operations and
+// definitions which are ignored by the template, meaning that the generated
+// code may be incomplete or wrong for them.
+func collectWarnings() (warnings []warning) {
+	add := func(name string, format string, args ...interface{}) {
+		warnings = append(warnings, warning{name, fmt.Sprintf(format, args...)})
+	}
+	for _, methods := range schema.Paths {
+		for _, operation := range methods {
+			for _, parameter := range operation.Parameters {
+				if parameter.In == "formData" || parameter.Type == "file" {
+					add(operation.OperationId, "form and file parameters are not supported (parameter '%s')", parameter.Name)
+				} else if parameter.In == "header" {
+					add(operation.OperationId, "header parameters are not supported (parameter '%s')", parameter.Name)
+				}
+				if parameter.Nullable {
+					add(operation.OperationId, "nullable is not supported (parameter '%s')", parameter.Name)
+				}
+				if !handledFormats[parameter.Format] {
+					add(operation.OperationId, "format '%s' is not supported (parameter '%s')", parameter.Format, parameter.Name)
+				}
+			}
+		}
+	}
+	for name, definition := range schema.Definitions {
+		if len(definition.AllOf) > 0 || len(definition.OneOf) > 0 || len(definition.AnyOf) > 0 {
+			add(name, "allOf, oneOf and anyOf are not supported")
+		}
+		for key, property := range definition.Properties {
+			if len(property.AllOf) > 0 || len(property.OneOf) > 0 || len(property.AnyOf) > 0 {
+				add(name, "allOf, oneOf and anyOf are not supported (property '%s')", key)
+			}
+			if property.AdditionalProperties.Ref != "" {
+				add(name, "additionalProperties with a $ref is not supported (property '%s')", key)
+			}
+			if !handledFormats[property.Format] {
+				add(name, "format '%s' is not supported (property '%s')", property.Format, key)
+			}
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Name != warnings[j].Name {
+			return warnings[i].Name < warnings[j].Name
+		}
+		return warnings[i].Detail < warnings[j].Detail
+	})
+	return
+}
+
+// printWarnings prints the names of the operations and definitions using
+// unhandled swagger constructs to stderr, and each construct if verbose.
+func printWarnings(warnings []warning, verbose bool) {
+	if len(warnings) == 0 {
+		return
+	}
+	if verbose {
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", w.Name, w.Detail)
+		}
+		return
+	}
+	names := []string{}
+	for i, w := range warnings {
+		if i == 0 || warnings[i-1].Name != w.Name {
+			names = append(names, w.Name)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Warning: the generated code may be incomplete for %s (use -strict for details)\n", strings.Join(names, ", "))
+}
+
+// wellKnownCodes are the gRPC status codes returned as the 'code' of errors
+// and the codes of notifications sent by the server itself. They are not
+// included in the swagger definition.
+var wellKnownCodes = map[string]int{
+	"OK":                  0,
+	"CANCELLED":           1,
+	"UNKNOWN":             2,
+	"INVALID_ARGUMENT":    3,
+	"DEADLINE_EXCEEDED":   4,
+	"NOT_FOUND":           5,
+	"ALREADY_EXISTS":      6,
+	"PERMISSION_DENIED":   7,
+	"RESOURCE_EXHAUSTED":  8,
+	"FAILED_PRECONDITION": 9,
+	"ABORTED":             10,
+	"OUT_OF_RANGE":        11,
+	"UNIMPLEMENTED":       12,
+	"INTERNAL":            13,
+	"UNAVAILABLE":         14,
+	"DATA_LOSS":           15,
+	"UNAUTHENTICATED":     16,
+
+	"NOTIFICATION_DM_REQUEST":         -1,
+	"NOTIFICATION_FRIEND_REQUEST":     -2,
+	"NOTIFICATION_FRIEND_ACCEPT":      -3,
+	"NOTIFICATION_GROUP_ADD":          -4,
+	"NOTIFICATION_GROUP_JOIN_REQUEST": -5,
+	"NOTIFICATION_FRIEND_JOIN_GAME":   -6,
+	"NOTIFICATION_SINGLE_SOCKET":      -7,
+	"NOTIFICATION_USER_BANNED":        -8,
+}
+
+// wellKnownConstants are integer values used by the API which aren't modeled
+// as enums in the swagger definition.
+var wellKnownConstants = map[string]int{
+	"STORAGE_PERMISSION_READ_NONE":   0,
+	"STORAGE_PERMISSION_READ_OWNER":  1,
+	"STORAGE_PERMISSION_READ_PUBLIC": 2,
+	"STORAGE_PERMISSION_WRITE_NONE":  0,
+	"STORAGE_PERMISSION_WRITE_OWNER": 1,
+	"GROUP_STATE_SUPERADMIN":         0,
+	"GROUP_STATE_ADMIN":              1,
+	"GROUP_STATE_MEMBER":             2,
+	"GROUP_STATE_JOIN_REQUEST":       3,
+}
+
+var luaIdentifier = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// readCodes adds codes from a JSON file with an object of code names and
+// values, eg { "NOTIFICATION_REWARD": 100 }, to the well-known codes.
+func readCodes(filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	codes := make(map[string]int)
+	if err := json.Unmarshal(content, &codes); err != nil {
+		return err
+	}
+	for name, code := range codes {
+		if !luaIdentifier.MatchString(name) {
+			return fmt.Errorf("invalid code name '%s'", name)
+		}
+		wellKnownCodes[name] = code
+	}
+	return nil
+}
+
+// alias is a function generated for an operation which has been renamed.
+type alias struct {
+	Old string
+	New string
+}
+
+// readAliases reads a JSON file with an object of old and new generated
+// function names, eg { "fetch_account": "get_account" }. An alias is skipped
+// with a warning if the old name is still a generated function, since the
+// generated function takes precedence, or if the new name isn't a generated
+// function, for instance when it has been excluded.
+func readAliases(filename string) ([]alias, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	if err := json.Unmarshal(content, &names); err != nil {
+		return nil, err
+	}
+
+	operations := make(map[string]bool)
+	for _, methods := range schema.Paths {
+		for _, operation := range methods {
+			operations[removePrefix(pascalToSnake(operation.OperationId))] = true
+		}
+	}
+
+	aliases := []alias{}
+	for old, new := range names {
+		if !luaIdentifier.MatchString(old) {
+			return nil, fmt.Errorf("invalid alias name '%s'", old)
+		}
+		if !luaIdentifier.MatchString(new) {
+			return nil, fmt.Errorf("invalid function name '%s'", new)
+		}
+		if operations[old] {
+			fmt.Fprintf(os.Stderr, "Warning: alias %s skipped, it is a generated function\n", old)
+			continue
+		}
+		if !operations[new] {
+			fmt.Fprintf(os.Stderr, "Warning: alias %s skipped, %s is not a generated function\n", old, new)
+			continue
+		}
+		aliases = append(aliases, alias{Old: old, New: new})
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Old < aliases[j].Old })
+	return aliases, nil
+}
+
+// manifestParameter describes a generated function argument.
+type manifestParameter struct {
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	In       string `json:"in"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// manifestOperation describes a generated API function.
+type manifestOperation struct {
+	Name        string              `json:"name"`
+	OperationId string              `json:"operation_id"`
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	Summary     string              `json:"summary"`
+	Parameters  []manifestParameter `json:"parameters"`
+	Body        string              `json:"body,omitempty"`
+	Response    string              `json:"response,omitempty"`
+}
+
+// overloads returns the ---@overload annotations of a generated operation, one
+// for the callback form which returns nothing and one for the coroutine form
+// which returns the result, for the Lua Language Server.
+func overloads(operation manifestOperation, optsTrailer bool) string {
+	params := []string{"client: table"}
+	for _, parameter := range operation.Parameters {
+		optional := "?"
+		if parameter.Required {
+			optional = ""
+		}
+		params = append(params, fmt.Sprintf("%s%s: %s", parameter.Name, optional, parameter.Type))
+	}
+	args := strings.Join(params, ", ")
+	callbackType := "fun(result: table)"
+	if optsTrailer {
+		callbackType = "fun(result: table)|table"
+	}
+	trailer := "retry_policy?: table, cancellation_token?: table, opts?: table"
+	return fmt.Sprintf("---@overload fun(%s, callback: %s, %s)\n---@overload fun(%s, callback?: nil, %s): table", args, callbackType, trailer, args, trailer)
+}
+
+// manifestProperty describes a field of a definition.
+type manifestProperty struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Ref      string `json:"ref,omitempty"`
+	Nullable bool   `json:"nullable,omitempty"`
+}
+
+// manifestDefinition describes a definition referenced by an operation.
+type manifestDefinition struct {
+	Name       string             `json:"name"`
+	Source     string             `json:"source"`
+	Properties []manifestProperty `json:"properties"`
+}
+
+type manifest struct {
+	Operations  []manifestOperation  `json:"operations"`
+	Definitions []manifestDefinition `json:"definitions"`
+}
+
+// definitionName is the name of a definition as used in the generated code,
+// eg "#/definitions/apiSession" becomes "api_session".
+func definitionName(ref string) string {
+	return pascalToSnake(convertRefToClassName(ref))
+}
+
+// buildManifest describes the generated operations and the definitions they
+// reference, using the same names as the generated Lua code.
+func buildManifest() manifest {
+	m := manifest{Operations: []manifestOperation{}, Definitions: []manifestDefinition{}}
+	refs := make(map[string]bool)
+	for url, methods := range schema.Paths {
+		for method, operation := range methods {
+			op := manifestOperation{
+				Name:        removePrefix(pascalToSnake(operation.OperationId)),
+				OperationId: operation.OperationId,
+				Method:      strings.ToUpper(method),
+				Path:        url,
+				Summary:     operation.Summary,
+				Parameters:  []manifestParameter{},
+			}
+			for _, parameter := range operation.Parameters {
+				if parameter.In == "body" && parameter.Schema.Ref != "" {
+					ref := strings.TrimPrefix(parameter.Schema.Ref, "#/definitions/")
+					definition := schema.Definitions[ref]
+					required := make(map[string]bool)
+					for _, key := range definition.Required {
+						required[key] = true
+					}
+					keys := make([]string, 0, len(definition.Properties))
+					for key := range definition.Properties {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						info := definition.Properties[key]
+						op.Parameters = append(op.Parameters, manifestParameter{key, key, "body", luaType(info.Type, info.Ref), required[key]})
+					}
+					op.Body = definitionName(parameter.Schema.Ref)
+					refs[ref] = true
+				} else if parameter.In == "body" {
+					op.Parameters = append(op.Parameters, manifestParameter{parameter.Name, parameter.Name, "body", luaType(parameter.Schema.Type, ""), parameter.Required})
+				} else {
+					name := pascalToSnake(varName(parameter.Name, parameter.Type, parameter.Schema.Ref))
+					op.Parameters = append(op.Parameters, manifestParameter{name, parameter.Name, parameter.In, luaType(parameter.Type, parameter.Schema.Ref), parameter.Required})
+				}
+			}
+			if operation.Responses.Ok().Schema.Ref != "" {
+				op.Response = definitionName(operation.Responses.Ok().Schema.Ref)
+				refs[strings.TrimPrefix(operation.Responses.Ok().Schema.Ref, "#/definitions/")] = true
+			}
+			m.Operations = append(m.Operations, op)
+		}
+	}
+	sort.Slice(m.Operations, func(i, j int) bool { return m.Operations[i].Name < m.Operations[j].Name })
+
+	for ref := range refs {
+		source, ok := schema.Definitions[ref]
+		if !ok {
+			continue
+		}
+		definition := manifestDefinition{Name: definitionName(ref), Source: ref, Properties: []manifestProperty{}}
+		keys := make([]string, 0, len(source.Properties))
+		for key := range source.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			info := source.Properties[key]
+			property := manifestProperty{Name: key, Type: luaType(info.Type, info.Ref), Nullable: isNullable(info.Nullable, info.XNullable)}
+			if info.Ref != "" {
+				property.Ref = definitionName(info.Ref)
+			} else if info.Items.Ref != "" {
+				property.Ref = definitionName(info.Items.Ref)
+			}
+			definition.Properties = append(definition.Properties, property)
+		}
+		m.Definitions = append(m.Definitions, definition)
+	}
+	sort.Slice(m.Definitions, func(i, j int) bool { return m.Definitions[i].Name < m.Definitions[j].Name })
+	return m
+}
+
+// describeNames is a Lua list of the names of the required parameters, or of
+// the body parameters, as generated for M.describe().
+func describeNames(parameters []manifestParameter, kind string) string {
+	names := []string{}
+	for _, parameter := range parameters {
+		if (kind == "required" && parameter.Required) || (kind == "body" && parameter.In == "body") {
+			names = append(names, "\""+parameter.Name+"\"")
+		}
+	}
+	if len(names) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(names, ", ") + " }"
+}
+
+// writeManifest writes the manifest of the generated API as JSON.
+func writeManifest(filename string) error {
+	content, err := json.MarshalIndent(buildManifest(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(content, '\n'), 0644)
+}
+
 func isEnum(ref string) bool {
 	// swagger schema definition keys have inconsistent casing
 	var camelOk bool
@@ -456,21 +4122,16 @@ func luaType(p_type string, p_ref string) (out string) {
 	return
 }
 
-// Default value for Lua types
-func luaDef(p_type string, p_ref string) (out string) {
-	switch(p_type) {
-		case "integer": out = "0"
-		case "string": out = "\"\""
-		case "boolean": out = "false"
-		case "array": out = "{}"
-		case "object": out = "{ _ = '' }"
-		default: out = "M.create_" + pascalToSnake(convertRefToClassName(p_ref)) + "()"
-	}
-	return
-}
-
 // Lua variable name from name, type and ref
+// cleanParamNames drops the type suffix from the names of path and query
+// params, see varName().
+var cleanParamNames bool
+
 func varName(p_name string, p_type string, p_ref string) (out string) {
+	if cleanParamNames {
+		out = p_name
+		return
+	}
 	switch(p_type) {
 		case "integer": out = p_name + "_int"
 		case "string": out = p_name + "_str"
@@ -494,6 +4155,22 @@ func varComment(p_name string, p_type string, p_ref string, p_item_type string)
 	return
 }
 
+// usesHttpKeyAuth checks if an operation accepts the server http key.
+func usesHttpKeyAuth(security []map[string][]struct{}) bool {
+	for _, scheme := range security {
+		if _, ok := scheme["HttpKeyAuth"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isNullable checks if a property may be null, using either the OpenAPI 3
+// 'nullable' or the swagger 2 'x-nullable' extension.
+func isNullable(nullable bool, xNullable bool) bool {
+	return nullable || xNullable
+}
+
 func isAuthenticateMethod(input string) (output bool) {
 	output = strings.HasPrefix(input, "Nakama_Authenticate")
 	return
@@ -502,6 +4179,22 @@ func isAuthenticateMethod(input string) (output bool) {
 func main() {
 	// Argument flags
 	var output = flag.String("output", "", "The output for generated code.")
+	var include = flag.String("include", "", "Comma separated list of operations to generate, eg 'authenticate_*,get_account'.")
+	var exclude = flag.String("exclude", "", "Comma separated list of operations to not generate, eg 'list_*'.")
+	var codesFile = flag.String("codes", "", "JSON file with additional codes to include in M.codes.")
+	var optsTrailer = flag.Bool("opts-trailer", false, "Let functions take a trailing table of options with the callback, retry policy and cancellation token instead of positional arguments.")
+	var lenientParams = flag.Bool("lenient-params", false, "Convert between numbers and strings for path and query params.")
+	var emitManifest = flag.String("emit-manifest", "", "Write a JSON description of the generated operations and definitions to a file.")
+	var strict = flag.Bool("strict", false, "List each unhandled swagger construct and exit with an error if any are used.")
+	var lastWins = flag.Bool("last-wins", false, "Use the operations and definitions of later inputs when inputs conflict instead of failing.")
+	var strictResponses = flag.Bool("strict-responses", false, "Check responses for fields which aren't in the definition when M.strict is set.")
+	flag.BoolVar(&cleanParamNames, "clean-param-names", false, "Name path and query params without the type suffix, eg 'limit' instead of 'limit_int'.")
+	var serverVersion = flag.String("server-version", "3", "The version of the Nakama server the client is generated for, eg '3.17.1'.")
+	var compatFieldAliases = flag.Bool("compat-field-aliases", false, "Let the fields of results be accessed using both camelCase and snake_case names.")
+	var annotations = flag.Bool("annotations", false, "Generate ---@overload annotations for the callback and coroutine forms of the generated functions.")
+	var stubs = flag.Bool("stubs", false, "Generate M.stub to return canned responses of operations instead of making requests, for unit tests.")
+	var describe = flag.Bool("describe", false, "Generate M.operations and M.describe() with the method, path, params and body fields of each operation.")
+	var aliasesFile = flag.String("aliases", "", "JSON file with old and new function names of renamed operations to generate aliases for.")
 	flag.Parse()
 
 	inputs := flag.Args()
@@ -512,17 +4205,74 @@ func main() {
 		return
 	}
 
-	input := inputs[0]
-	content, err := ioutil.ReadFile(input)
-	if err != nil {
-		fmt.Printf("Unable to read file: %s\n", err)
-		return
+	var err error
+	for _, input := range inputs {
+		content, err := ioutil.ReadFile(input)
+		if err != nil {
+			fmt.Printf("Unable to read file: %s\n", err)
+			return
+		}
+
+		if isYAML(input, content) {
+			if content, err = yamlToJSON(content); err != nil {
+				fmt.Printf("Unable to decode input %s : %s\n", input, err)
+				os.Exit(1)
+			}
+		}
+
+		var part swaggerSchema
+		if err := json.Unmarshal(content, &part); err != nil {
+			fmt.Printf("Unable to decode input %s : %s\n", input, err)
+			os.Exit(1)
+		}
+		if err := mergeSchema(part, input, *lastWins); err != nil {
+			fmt.Printf("Unable to merge input %s : %s\n", input, err)
+			os.Exit(1)
+		}
 	}
 
+	if len(*codesFile) > 0 {
+		if err := readCodes(*codesFile); err != nil {
+			fmt.Printf("Unable to read codes %s : %s\n", *codesFile, err)
+			os.Exit(1)
+		}
+	}
 
-	if err := json.Unmarshal(content, &schema); err != nil {
-		fmt.Printf("Unable to decode input %s : %s\n", input, err)
-		return
+	if err := filterOperations(splitPatterns(*include), splitPatterns(*exclude)); err != nil {
+		fmt.Printf("Unable to filter operations: %s\n", err)
+		os.Exit(1)
+	}
+	if len(*include) > 0 || len(*exclude) > 0 {
+		pruneDefinitions()
+	}
+
+	aliases := []alias{}
+	if len(*aliasesFile) > 0 {
+		aliases, err = readAliases(*aliasesFile)
+		if err != nil {
+			fmt.Printf("Unable to read aliases %s : %s\n", *aliasesFile, err)
+			os.Exit(1)
+		}
+	}
+
+	if collisions := paramNameCollisions(); len(collisions) > 0 {
+		for _, collision := range collisions {
+			fmt.Fprintf(os.Stderr, "Parameter name collision in %s\n", collision)
+		}
+		os.Exit(1)
+	}
+
+	warnings := collectWarnings()
+	printWarnings(warnings, *strict)
+	if *strict && len(warnings) > 0 {
+		os.Exit(1)
+	}
+
+	if len(*emitManifest) > 0 {
+		if err := writeManifest(*emitManifest); err != nil {
+			fmt.Printf("Unable to write manifest %s : %s\n", *emitManifest, err)
+			os.Exit(1)
+		}
 	}
 
 
@@ -553,7 +4303,18 @@ func main() {
 		sort.Strings(keys)
 		for _,key := range keys {
 			info := props[key]
-			output = output + "-- @param " + key + " (" + info.Type + ") " + stripNewlines(info.Description) + "\n"
+			if info.AdditionalProperties.Type != "" {
+				valueType := luaType(info.AdditionalProperties.Type, "")
+				output = output + "-- @param " + key + " (table) Map with values of type '" + valueType + "'. " + stripNewlines(info.Description) + "\n"
+			} else {
+				output = output + "-- @param " + key + " (" + info.Type + ") " + stripNewlines(info.Description) + "\n"
+			}
+			if isNullable(info.Nullable, info.XNullable) {
+				output = strings.TrimSuffix(output, "\n") + " May be json.null.\n"
+			}
+			if info.Format == "byte" {
+				output = strings.TrimSuffix(output, "\n") + " Raw bytes, base64 encoded when sent.\n"
+			}
 		}
 		return
 	}
@@ -568,10 +4329,34 @@ func main() {
 			keys = append(keys, prop)
 		}
 		sort.Strings(keys)
+		required := make(map[string]bool)
+		for _, key := range schema.Definitions[ref].Required {
+			required[key] = true
+		}
 		for _,key := range keys {
 			info := props[key]
 			luaType := luaType(info.Type, info.Ref)
-			output = output + "\tassert(not " + key + " or type(" + key + ") == \"" + luaType + "\", \"Argument '" + key + "' must be 'nil' or of type '" + luaType + "'\")\n"
+			check := "type(" + key + ") == \"" + luaType + "\""
+			if isNullable(info.Nullable, info.XNullable) {
+				// json.null is accepted for nullable fields
+				if required[key] {
+					output = output + "\tassert(" + key + " == json.null or " + check + ", \"Argument '" + key + "' is required and must be json.null or of type '" + luaType + "'\")\n"
+				} else {
+					output = output + "\tassert(not " + key + " or " + key + " == json.null or " + check + ", \"Argument '" + key + "' must be 'nil', json.null or of type '" + luaType + "'\")\n"
+				}
+				continue
+			}
+			optionalCheck := check
+			if luaType == "table" {
+				// json.null is a table and is rejected for other fields
+				check = check + " and " + key + " ~= json.null"
+				optionalCheck = "(" + check + ")"
+			}
+			if required[key] {
+				output = output + "\tassert(" + check + ", \"Argument '" + key + "' is required and must be of type '" + luaType + "'\")\n"
+			} else {
+				output = output + "\tassert(not " + key + " or " + optionalCheck + ", \"Argument '" + key + "' must be 'nil' or of type '" + luaType + "'\")\n"
+			}
 		}
 		return
 	}
@@ -587,7 +4372,15 @@ func main() {
 		}
 		sort.Strings(keys)
 		for _,key := range keys {
-			output = output + "\t" + key + " = " + key + ",\n"
+			info := props[key]
+			if info.AdditionalProperties.Type != "" {
+				valueType := luaType(info.AdditionalProperties.Type, "")
+				output = output + "\t" + key + " = map_arg(\"" + key + "\", " + key + ", \"" + valueType + "\"),\n"
+			} else if info.Format == "byte" {
+				output = output + "\t" + key + " = encode_bytes(" + key + "),\n"
+			} else {
+				output = output + "\t" + key + " = " + key + ",\n"
+			}
 		}
 		return
 	}
@@ -599,7 +4392,6 @@ func main() {
 		"uppercase": strings.ToUpper,
 		"pascalToSnake": pascalToSnake,
 		"luaType": luaType,
-		"luaDef": luaDef,
 		"varName": varName,
 		"varComment": varComment,
 		"bodyFunctionArgsDocs": bodyFunctionArgsDocs,
@@ -608,9 +4400,46 @@ func main() {
 		"bodyFunctionArgsTable": bodyFunctionArgsTable,
 		"isEnum": isEnum,
 		"isAuthenticateMethod": isAuthenticateMethod,
+		"usesHttpKeyAuth": usesHttpKeyAuth,
+		"otherResponses": otherResponses,
 		"removePrefix": removePrefix,
+		"lenientParams": func() bool { return *lenientParams },
+		"optsTrailer": func() bool { return *optsTrailer },
+		"codes": func() map[string]int { return wellKnownCodes },
+		"constants": func() map[string]int { return wellKnownConstants },
+		"aliases": func() []alias { return aliases },
+		"strictResponses": func() bool { return *strictResponses },
+		"serverVersion": func() string { return *serverVersion },
+		"describe": func() bool { return *describe },
+		"stubs": func() bool { return *stubs },
+		"annotations": func() bool { return *annotations },
+		"byteFields": byteFields,
+		"hasByteParams": hasByteParams,
+		"byteDefinition": func(ref string) string {
+			name, _ := definitionRef(ref)
+			if _, ok := byteFields()[name]; ok {
+				return name
+			}
+			return ""
+		},
+		"overloads": func(name string) string {
+			for _, operation := range buildManifest().Operations {
+				if operation.Name == name {
+					return overloads(operation, *optsTrailer)
+				}
+			}
+			return ""
+		},
+		"compatFieldAliases": func() bool { return *compatFieldAliases },
+		"describeNames": describeNames,
+		"describeOperations": func() []manifestOperation { return buildManifest().Operations },
+		"responseFields": responseFields,
+		"responseDefinition": func(ref string) string {
+			name, _ := definitionRef(ref)
+			return name
+		},
 	}
-	tmpl, err := template.New(input).Funcs(fmap).Parse(codeTemplate)
+	tmpl, err := template.New(inputs[0]).Funcs(fmap).Parse(codeTemplate)
 	if err != nil {
 		fmt.Printf("Template parse error: %s\n", err)
 		return
@@ -9,6 +9,7 @@ local b64 = require "nakama.util.b64"
 local uri = require "nakama.util.uri"
 local json = require "nakama.util.json"
 local uuid = require "nakama.util.uuid"
+local frame_codec = require "nakama.util.frame_codec"
 
 b64.encode = _G.crypt and _G.crypt.encode_base64 or b64.encode
 b64.decode = _G.crypt and _G.crypt.decode_base64 or b64.decode
@@ -25,8 +26,35 @@ uuid.seed()
 -- replace Lua based json.encode and decode with native Defold functions
 -- native json.encode function was added in Defold 1.3.7
 -- native json.decode function has been included in Defold "forever"
-json.encode = _G.json and _G.json.encode or json.encode
-json.decode = _G.json and _G.json.decode or json.decode
+-- the native functions don't know about tables with integer keys encoded as
+-- objects (see json.object()), so the keys are converted before and after
+-- the native encode function doesn't know about json.null either, which is
+-- replaced by the native null value, or encoded by the Lua based function
+-- if there is no native null value
+if _G.json and _G.json.encode then
+	local lua_encode = json.encode
+	local native_encode = _G.json.encode
+	local native_null = _G.json.null
+	json.encode = function(value)
+		value = json.integer_keys_to_strings(value)
+		if native_null ~= nil then
+			value = json.replace_null(value, native_null)
+		elseif json.contains_null(value) then
+			return lua_encode(value)
+		end
+		return native_encode(value)
+	end
+end
+if _G.json and _G.json.decode then
+	local native_decode = _G.json.decode
+	json.decode = function(str, opts)
+		local value = native_decode(str)
+		if opts and opts.integer_keys == "array" then
+			return json.integer_keys_to_numbers(value)
+		end
+		return value
+	end
+end
 
 local M = {}
 
@@ -42,52 +70,74 @@ local function get_mac_address()
 	return nil
 end
 
+-- the mac address of the device, looked up once since a uuid is created for
+-- each request, or false if there is none
+local mac_address = nil
+
 --- Returns a UUID from the device's mac address.
 -- @return The UUID string.
 function M.uuid()
-	local mac = get_mac_address()
-	if not mac then
-		log("Unable to get hardware mac address for UUID")
+	if mac_address == nil then
+		mac_address = get_mac_address() or false
+		if not mac_address then
+			log("Unable to get hardware mac address for UUID")
+		end
 	end
-	return uuid(mac)
+	return uuid(mac_address or nil)
 end
 
 
 local make_http_request
-make_http_request = function(url, method, callback, headers, post_data, options, retry_intervals, retry_count, cancellation_token)
+make_http_request = function(url, method, callback, headers, post_data, options, retry_intervals, retry_count, cancellation_token, config)
 	if cancellation_token and cancellation_token.cancelled then
 		callback(nil)
 		return
 	end
+	local start_time = socket.gettime()
 	http.request(url, method, function(self, id, result)
 		if cancellation_token and cancellation_token.cancelled then
 			callback(nil)
 			return
 		end
-		log(result.response)
+		if config.log_requests ~= false then
+			log(result.response)
+		end
+		local response_info = { status = result.status, headers = result.headers, duration = socket.gettime() - start_time }
+		-- reject a response which is too large before decoding it
+		if config.max_response_bytes and result.response and #result.response > config.max_response_bytes then
+			callback({ error = true, code = "response_too_large", message = ("The response is larger than %d bytes"):format(config.max_response_bytes) }, response_info)
+			return
+		end
+		-- return a response which isn't JSON as it is, eg from an rpc with a text payload
+		local content_type = result.headers and (result.headers["content-type"] or result.headers["Content-Type"])
+		if content_type and not content_type:find("json") and result.status >= 200 and result.status <= 299 then
+			callback(result.response, response_info)
+			return
+		end
+
 		local ok, decoded = pcall(json.decode, result.response)
 		-- return result if everything is ok
 		if ok and result.status >= 200 and result.status <= 299 then
 			result.response = decoded
-			callback(result.response)
+			callback(result.response, response_info)
 			return
 		end
 
-		-- return the error if there are no more retries
-		if retry_count > #retry_intervals then
+		-- return the error if there are no more retries, if the client is suspended or if the retry budget is exhausted
+		if retry_count > #retry_intervals or config.suspended or (config.retry_budget and not config.retry_budget.consume()) then
 			if not ok then
 				result.response = { error = true, message = "Unable to decode response" }
 			else
 				result.response = { error = decoded.error or true, message = decoded.message, code = decoded.code }
 			end
-			callback(result.response)
+			callback(result.response, response_info)
 			return
 		end
 
 		-- retry!
 		local retry_interval = retry_intervals[retry_count]
 		timer.delay(retry_interval, false, function()
-			make_http_request(url, method, callback, headers, post_data, options, retry_intervals, retry_count + 1, cancellation_token)
+			make_http_request(url, method, callback, headers, post_data, options, retry_intervals, retry_count + 1, cancellation_token, config)
 		end)
 	end, headers, post_data, options)
 
@@ -101,9 +151,11 @@ end
 -- @param query_params Query params string.
 -- @param method The HTTP method string.
 -- @param post_data String of post data.
--- @param callback The callback function.
+-- @param callback The callback function. Called with the response and a
+-- table with the response status, headers and duration in seconds.
+-- @param extra_headers Optional table of headers to add to the request.
 -- @return The mac address string.
-function M.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback)
+function M.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback, extra_headers)
 	local query_string = ""
 	if next(query_params) then
 		for query_key,query_value in pairs(query_params) do
@@ -127,14 +179,34 @@ function M.http(config, url_path, query_params, method, post_data, retry_policy,
 		local credentials = b64_encode(config.username .. ":" .. config.password)
 		headers["Authorization"] = ("Basic %s"):format(credentials)
 	end
+	for name,value in pairs(extra_headers or {}) do
+		headers[name] = value
+	end
 
 	local options = {
 		timeout = config.timeout
 	}
 
-	log("HTTP", method, url)
-	log("DATA", post_data)
-	make_http_request(url, method, callback, headers, post_data, options, retry_policy or config.retry_policy, 1, cancellation_token)
+	if config.log_requests ~= false then
+		log("HTTP", method, url)
+		log("DATA", post_data)
+	end
+	make_http_request(url, method, callback, headers, post_data, options, retry_policy or config.retry_policy, 1, cancellation_token, config)
+end
+
+--- Establish the connection to the server ahead of the first request.
+-- Makes a HEAD request to the healthcheck endpoint. The connection is kept
+-- alive and reused by the following requests.
+-- @param config The http config table, see Defold docs.
+-- @param callback Function to call with true if the connection has been
+-- established and false otherwise.
+function M.warm_up(config, callback)
+	local url = ("%s/healthcheck"):format(config.http_uri)
+	http.request(url, "HEAD", function(self, id, result)
+		-- any response from the server, including an error response, means
+		-- that the connection has been established
+		callback(result.status ~= nil and result.status > 0)
+	end, nil, nil, { timeout = config.timeout })
 end
 
 --- Create a new socket with message handler.
@@ -152,13 +224,16 @@ function M.socket_create(config, on_message)
 	socket.cid = 0
 	socket.requests = {}
 	socket.on_message = on_message
+	-- codec of the frames, json unless another config.socket_format is used
+	socket.format = config.socket_format or "json"
+	socket.codec = frame_codec.get(socket.format)
 
 	return socket
 end
 
 -- internal on_message, calls user defined socket.on_message function
 local function on_message(socket, message)
-	message = json.decode(message)
+	message = socket.codec.decode(message)
 	if not message.cid then
 		socket.on_message(socket, message)
 		return
@@ -180,23 +255,52 @@ function M.socket_connect(socket, callback)
 	assert(socket)
 	assert(callback)
 
-	local url = ("%s://%s:%d/ws?token=%s"):format(socket.scheme, socket.config.host, socket.config.port, uri.encode_component(socket.config.bearer_token))
+	local path = socket.config.socket_path or "/ws"
+	local query_params = { token = socket.config.bearer_token }
+	if socket.format ~= "json" then
+		query_params.format = socket.format
+	end
+	local headers = nil
+	-- let the request signing hook add query params and headers to the connect request
+	if socket.config.sign_request then
+		local request = {
+			method = "GET",
+			path = path,
+			query = query_params,
+			body = nil,
+			timestamp = os.time(),
+			headers = {},
+		}
+		local signed_headers = socket.config.sign_request(request) or request.headers
+		for name,value in pairs(signed_headers) do
+			headers = ("%s%s: %s\r\n"):format(headers or "", name, value)
+		end
+	end
+	local query_string = ""
+	for query_key,query_value in pairs(query_params) do
+		query_string = ("%s%s%s=%s"):format(query_string, (#query_string == 0 and "?" or "&"), query_key, uri_encode_component(tostring(query_value)))
+	end
+	local url = ("%s://%s:%d%s%s"):format(socket.scheme, socket.config.host, socket.config.port, path, query_string)
 	--const url = `${scheme}${this.host}:${this.port}/ws?lang=en&status=${encodeURIComponent(createStatus.toString())}&token=${encodeURIComponent(session.token)}`;
 
 	log(url)
 
 	local params = {
 		protocol = nil,
-		headers = nil,
+		headers = headers,
 		timeout = (socket.config.timeout or 0) * 1000,
 	}
 	socket.connection = websocket.connect(url, params, function(self, conn, data)
+		-- ignore the events of a connection closed using socket_disconnect()
+		if conn ~= socket.connection then
+			return
+		end
 		if data.event == websocket.EVENT_CONNECTED then
 			log("EVENT_CONNECTED")
 			callback(true)
 		elseif data.event == websocket.EVENT_DISCONNECTED then
 			log("EVENT_DISCONNECTED: ", data.message)
-			if socket.on_disconnect then socket.on_disconnect() end
+			if socket.handle_disconnect then socket.handle_disconnect(data.message) end
 		elseif data.event == websocket.EVENT_ERROR then
 			log("EVENT_ERROR: ", data.message or data.error)
 			callback(false, data.message or data.error)
@@ -218,16 +322,52 @@ function M.socket_send(socket, message, callback)
 	message.cid = tostring(socket.cid)
 	socket.requests[message.cid] = callback
 
-	local data = json.encode(message)
-	-- Fix encoding of match_create and status_update messages to send {} instead of []
-	if message.match_create ~= nil or message.status_update ~= nil then
-		data = string.gsub(data, "%[%]", "{}")
-	end
-
+	local data = socket.codec.encode(message)
 	local options = {
-		type = websocket.DATA_TYPE_TEXT
+		type = socket.codec.binary and websocket.DATA_TYPE_BINARY or websocket.DATA_TYPE_TEXT
 	}
 	websocket.send(socket.connection, data, options)
 end
 
+--- Close the connection of a socket.
+-- The disconnect handler of the socket isn't called.
+-- @param socket The socket table, see socket_create.
+function M.socket_disconnect(socket)
+	assert(socket, "You must provide a socket")
+	local connection = socket.connection
+	socket.connection = nil
+	if connection then
+		websocket.disconnect(connection)
+	end
+end
+
+--- Call a function after a delay.
+-- @param delay The delay in seconds.
+-- @param callback The function to call.
+-- @return A timer handle.
+function M.timer_delay(delay, callback)
+	return timer.delay(delay, false, function()
+		callback()
+	end)
+end
+
+--- Cancel a timer.
+-- @param handle The timer handle returned by timer_delay.
+function M.timer_cancel(handle)
+	timer.cancel(handle)
+end
+
+--- Get the current time.
+-- @return The time in seconds.
+function M.time()
+	return socket.gettime()
+end
+
+--- Hash a string, see nakama.util.id.
+-- @param s The string.
+-- @return The hash.
+function M.hash(s)
+	return hash(s)
+end
+
 return M
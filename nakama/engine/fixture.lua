@@ -0,0 +1,214 @@
+--[[--
+ Nakama fixture engine. Replays recorded server responses to make it possible
+ to run deterministic tests without a running Nakama server.
+
+ Fixtures are stored as JSON:
+
+	{
+		"http": [
+			{
+				"method": "POST",
+				"url_path": "/v2/account/authenticate/email",
+				"query_params": { "create": true },
+				"post_data": { "email": "super@heroes.com", "password": "batsignal" },
+				"status": 200,
+				"headers": {},
+				"response": { "token": "..." }
+			}
+		]
+	}
+
+ A request is served by the first unused fixture with the same method and url
+ path. The query params and post data are only compared if they are included
+ in the fixture. Each fixture is used once. An error is raised if a request
+ does not match any fixture.
+
+ Use record mode to capture the responses of another engine and create fixtures:
+
+	fixture.record(defold)
+	-- make requests using a client created with the fixture engine
+	fixture.save("fixtures.json")
+
+ @module nakama.engine.fixture
+]]
+
+local json = require "nakama.util.json"
+local uuid = require "nakama.util.uuid"
+
+local M = {}
+
+local fixtures = {}
+local recording_engine = nil
+
+--- Check if two values are equal. Tables are compared by value and scalar
+-- values are compared as strings since query params are sent as strings.
+local function equal(a, b)
+	if type(a) == "table" and type(b) == "table" then
+		for k,v in pairs(a) do
+			if not equal(v, b[k]) then
+				return false
+			end
+		end
+		for k,v in pairs(b) do
+			if a[k] == nil then
+				return false
+			end
+		end
+		return true
+	end
+	return tostring(a) == tostring(b)
+end
+
+local function copy(t)
+	local c = {}
+	for k,v in pairs(t or {}) do
+		c[k] = v
+	end
+	return c
+end
+
+local function decode_post_data(post_data)
+	if post_data then
+		return json.decode(post_data)
+	end
+	return nil
+end
+
+local function find_fixture(url_path, query_params, method, post_data)
+	for _,fixture in ipairs(fixtures) do
+		if not fixture.used
+		and fixture.method == method
+		and fixture.url_path == url_path
+		and (fixture.query_params == nil or equal(fixture.query_params, query_params))
+		and (fixture.post_data == nil or equal(fixture.post_data, decode_post_data(post_data))) then
+			return fixture
+		end
+	end
+	return nil
+end
+
+
+--- Load fixtures
+-- @param fixtures_json The fixtures as a JSON string.
+function M.load(fixtures_json)
+	assert(type(fixtures_json) == "string", "You must provide fixtures as a JSON string")
+	local data = json.decode(fixtures_json)
+	assert(type(data) == "table" and type(data.http) == "table", "Fixtures must contain an 'http' list")
+	fixtures = data.http
+	recording_engine = nil
+end
+
+--- Load fixtures from a file
+-- @param path Path to the fixture file.
+function M.load_file(path)
+	local f = assert(io.open(path, "rb"))
+	local fixtures_json = f:read("*a")
+	f:close()
+	M.load(fixtures_json)
+end
+
+--- Record the requests made through another engine
+-- @param engine The engine to forward all calls to, eg nakama.engine.defold.
+function M.record(engine)
+	assert(engine, "You must provide an engine to record")
+	fixtures = {}
+	recording_engine = engine
+end
+
+--- Get the loaded or recorded fixtures
+-- @return The fixtures as a JSON string.
+function M.get_fixtures()
+	local http = {}
+	for _,fixture in ipairs(fixtures) do
+		local f = copy(fixture)
+		f.used = nil
+		table.insert(http, f)
+	end
+	return json.encode({ http = http })
+end
+
+--- Save the loaded or recorded fixtures to a file
+-- @param path Path to the fixture file.
+function M.save(path)
+	local f = assert(io.open(path, "wb"))
+	f:write(M.get_fixtures())
+	f:close()
+end
+
+--- Get the number of fixtures which have not been used
+-- @return Number of unused fixtures.
+function M.get_unused_count()
+	local count = 0
+	for _,fixture in ipairs(fixtures) do
+		if not fixture.used then
+			count = count + 1
+		end
+	end
+	return count
+end
+
+function M.reset()
+	fixtures = {}
+	recording_engine = nil
+end
+
+----------------
+-- ENGINE API --
+----------------
+
+function M.uuid()
+	if recording_engine then
+		return recording_engine.uuid()
+	end
+	return uuid()
+end
+
+function M.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback, headers)
+	if recording_engine then
+		recording_engine.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result, response_info)
+			response_info = response_info or {}
+			table.insert(fixtures, {
+				method = method,
+				url_path = url_path,
+				query_params = copy(query_params),
+				post_data = decode_post_data(post_data),
+				status = response_info.status,
+				headers = response_info.headers,
+				response = result,
+			})
+			callback(result, response_info)
+		end, headers)
+		return
+	end
+
+	local fixture = find_fixture(url_path, query_params, method, post_data)
+	if not fixture then
+		error(("No fixture for request %s %s %s"):format(method, url_path, post_data or ""))
+	end
+	fixture.used = true
+	callback(fixture.response, { status = fixture.status or 200, headers = fixture.headers or {} })
+end
+
+function M.socket_create(config, on_message)
+	if recording_engine then
+		return recording_engine.socket_create(config, on_message)
+	end
+	return { on_message = on_message }
+end
+
+function M.socket_connect(socket, callback)
+	if recording_engine then
+		return recording_engine.socket_connect(socket, callback)
+	end
+	callback(false, "The fixture engine does not replay socket connections")
+end
+
+function M.socket_send(socket, message, callback)
+	if recording_engine then
+		return recording_engine.socket_send(socket, message, callback)
+	end
+	error("The fixture engine does not replay socket messages")
+end
+
+
+return M
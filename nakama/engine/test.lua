@@ -1,4 +1,8 @@
 local uuid = require "nakama.util.uuid"
+local json = require "nakama.util.json"
+local frame_codec = require "nakama.util.frame_codec"
+
+local unpack = _G.unpack or table.unpack
 
 local M = {}
 
@@ -7,30 +11,118 @@ local M = {}
 -----------------
 
 local http_request_response = {}
+local http_response_headers = {}
+local http_response_status = {}
 local http_request_queue = {}
+local http_deferred_responses = nil
 local socket_send_queue = {}
+local socket_send_frames = {}
+local socket_send_results = {}
+local socket_connect_result = { true }
+local timers = {}
+local now = 0
 
-function M.set_http_response(path, response)
+function M.set_http_response(path, response, headers, status)
 	assert(path, response)
 	http_request_response[path] = response
+	http_response_headers[path] = headers
+	http_response_status[path] = status
 end
 
 function M.get_http_request()
 	return table.remove(http_request_queue)
 end
 
+-- defer http responses until send_deferred_http_responses() is called, to
+-- test requests which are in flight
+function M.defer_http_responses()
+	http_deferred_responses = {}
+end
+
+-- send deferred http responses and stop deferring responses
+function M.send_deferred_http_responses()
+	local deferred = http_deferred_responses or {}
+	http_deferred_responses = nil
+	for _,fn in ipairs(deferred) do
+		fn()
+	end
+end
+
+-- set the result of sending socket messages of a specific type (eg "match_join")
+function M.set_socket_send_result(message_type, result)
+	socket_send_results[message_type] = result
+end
+
+-- set the result of connecting a socket using a websocket
+function M.set_socket_connect_result(result, err)
+	socket_connect_result = { result, err }
+end
+
 function M.get_socket_message()
 	return table.remove(socket_send_queue)
 end
 
+-- get the frame data of the last socket message, encoded by the codec of the
+-- socket as it would be sent to the server
+function M.get_socket_frame()
+	return table.remove(socket_send_frames)
+end
+
 function M.receive_socket_message(socket, message)
+	if socket.format ~= "json" then
+		message = socket.codec.decode(socket.codec.encode(message))
+	end
 	socket.on_message(socket, message)
 end
 
+-- disconnect a socket the same way as when the connection is lost
+function M.disconnect_socket(socket, close_reason)
+	socket.handle_disconnect(close_reason)
+end
+
+-- advance time and trigger any timers that have expired
+function M.advance_time(seconds)
+	now = now + seconds
+	for _,t in ipairs({ unpack(timers) }) do
+		if not t.cancelled and t.time <= now then
+			t.cancelled = true
+			t.callback()
+		end
+	end
+end
+
+local function http_stream(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, on_chunk, callback, headers)
+	-- the size of streamed responses is checked by the client
+	config = setmetatable({ max_response_bytes = false }, { __index = config })
+	M.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(response, response_info)
+		local body = json.encode(response)
+		for i=1,#body,M.http_stream_chunk_size do
+			on_chunk(body:sub(i, i + M.http_stream_chunk_size - 1))
+		end
+		callback(nil, response_info)
+	end, headers)
+end
+
+-- enable the optional http_stream engine function, delivering responses in
+-- chunks of the specified size
+function M.enable_http_stream(chunk_size)
+	M.http_stream_chunk_size = chunk_size
+	M.http_stream = http_stream
+end
+
 function M.reset()
+	M.http_stream = nil
 	http_request_response = {}
+	http_response_headers = {}
+	http_response_status = {}
 	http_request_queue = {}
+	http_deferred_responses = nil
 	socket_send_queue = {}
+	socket_send_frames = {}
+	socket_send_results = {}
+	socket_connect_result = { true }
+	timers = {}
+	now = 0
 end
 
 ----------------
@@ -38,40 +130,91 @@ end
 ----------------
 
 function M.uuid()
-	return uuid("")
+	return uuid()
 end
 
-function M.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback)
+function M.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback, headers)
 	local request = {
 		config = config,
 		url_path = url_path,
 		query_params = query_params,
 		method = method,
-		post_data = post_data
+		post_data = post_data,
+		headers = headers,
 	}
 	table.insert(http_request_queue, request)
 
+	-- the response can be a function to respond differently to each request
 	local response = http_request_response[url_path]
-	callback(response)
+	if type(response) == "function" then
+		response = response(request)
+	end
+	local response_info = { status = http_response_status[url_path] or 200, headers = http_response_headers[url_path] or {}, duration = 0 }
+	if config.max_response_bytes and #json.encode(response) > config.max_response_bytes then
+		response = { error = true, code = "response_too_large", message = "The response is too large" }
+	end
+	if http_deferred_responses then
+		-- the duration of a deferred request is the time advanced until the response is sent
+		local start_time = now
+		table.insert(http_deferred_responses, function()
+			response_info.duration = now - start_time
+			callback(response, response_info)
+		end)
+		return
+	end
+	callback(response, response_info)
 end
 
 function M.socket_create(config, on_message)
 	local socket = {
-		on_message = on_message
+		on_message = on_message,
+		format = config.socket_format or "json",
+		codec = frame_codec.get(config.socket_format),
 	}
 	return socket
 end
 
 function M.socket_connect(socket, callback)
-	local result = true
-	callback(result)
+	callback(unpack(socket_connect_result))
 end
 
 function M.socket_send(socket, message, callback)
+	local frame = socket.codec.encode(message)
+	table.insert(socket_send_frames, frame)
+	-- messages are encoded and decoded by the codec of other formats than json
+	-- as they would be when sent to the server
+	if socket.format ~= "json" then
+		message = socket.codec.decode(frame)
+	end
 	table.insert(socket_send_queue, message)
-	local result = {}
+	local result = socket_send_results[next(message)] or {}
 	callback(result)
 end
 
+function M.socket_disconnect(socket)
+	socket.closed = true
+end
+
+function M.timer_delay(delay, callback)
+	local t = {
+		time = now + delay,
+		callback = callback,
+	}
+	table.insert(timers, t)
+	return t
+end
+
+function M.timer_cancel(t)
+	t.cancelled = true
+end
+
+function M.time()
+	return now
+end
+
+function M.hash(s)
+	return "hash: [" .. s .. "]"
+end
+
 
 return M
@@ -11,14 +11,48 @@ local b64 = require "nakama.util.b64"
 local log = require "nakama.util.log"
 local async = require "nakama.util.async"
 local retries = require "nakama.util.retries"
+local token_bucket = require "nakama.util.token_bucket"
+local json_stream = require "nakama.util.json_stream"
+local time = require "nakama.util.time"
+local response_cache = require "nakama.util.response_cache"
+local deduplicator = require "nakama.util.deduplicator"
+local latency_stats = require "nakama.util.latency_stats"
+local circuit_breaker = require "nakama.util.circuit_breaker"
 local api_session = require "nakama.session"
 local socket = require "nakama.socket"
 
 local uri = require "nakama.util.uri"
 local uri_encode = uri.encode
 
+-- replace a path parameter in a url path with the uri encoded value
+-- a function is used as replacement since the encoded value may contain '%'
+local function replace_path_param(url_path, name, value)
+	local encoded = uri_encode(value)
+	return (url_path:gsub("{" .. name .. "}", function() return encoded end))
+end
+
 local M = {}
 
+-- add an Authorization header for basic auth with the username (server key)
+-- and password of the client config to the options of a call
+-- @return Copy of the options with the header added
+local function with_basic_auth(client, opts)
+	local username = client.config.username
+	local password = client.config.password
+	assert(type(username) == "string" and username ~= "", "You must provide a username (the server key) in the client config to authenticate")
+	assert(type(password) == "string", "You must provide a password (eg \"\") in the client config to authenticate")
+	local auth_opts = {}
+	for name,value in pairs(opts or {}) do
+		auth_opts[name] = value
+	end
+	auth_opts.headers = {}
+	for name,value in pairs(opts and opts.headers or {}) do
+		auth_opts.headers[name] = value
+	end
+	auth_opts.headers["Authorization"] = "Basic " .. b64.encode(username .. ":" .. password)
+	return auth_opts
+end
+
 --
 -- Defines
 --
@@ -36,6 +70,8 @@ M.APIOPERATOR_BEST = "BEST"
 M.APIOPERATOR_SET = "SET"
 M.APIOPERATOR_INCREMENT = "INCREMENT"
 M.APIOPERATOR_DECREMENT = "DECREMENT"
+-- all values in the order of the definition
+M.APIOPERATOR_VALUES = { "NO_OVERRIDE", "BEST", "SET", "INCREMENT", "DECREMENT" }
 
 --- api_store_environment
 -- - UNKNOWN: Unknown environment.
@@ -44,6 +80,8 @@ M.APIOPERATOR_DECREMENT = "DECREMENT"
 M.APISTOREENVIRONMENT_UNKNOWN = "UNKNOWN"
 M.APISTOREENVIRONMENT_SANDBOX = "SANDBOX"
 M.APISTOREENVIRONMENT_PRODUCTION = "PRODUCTION"
+-- all values in the order of the definition
+M.APISTOREENVIRONMENT_VALUES = { "UNKNOWN", "SANDBOX", "PRODUCTION" }
 
 --- api_store_provider
 -- - APPLE_APP_STORE: Apple App Store
@@ -54,6 +92,50 @@ M.APISTOREPROVIDER_APPLE_APP_STORE = "APPLE_APP_STORE"
 M.APISTOREPROVIDER_GOOGLE_PLAY_STORE = "GOOGLE_PLAY_STORE"
 M.APISTOREPROVIDER_HUAWEI_APP_GALLERY = "HUAWEI_APP_GALLERY"
 M.APISTOREPROVIDER_FACEBOOK_INSTANT_STORE = "FACEBOOK_INSTANT_STORE"
+-- all values in the order of the definition
+M.APISTOREPROVIDER_VALUES = { "APPLE_APP_STORE", "GOOGLE_PLAY_STORE", "HUAWEI_APP_GALLERY", "FACEBOOK_INSTANT_STORE" }
+
+--- codes
+-- Well-known error codes (gRPC status codes) and notification codes.
+M.codes = {
+	ABORTED = 10,
+	ALREADY_EXISTS = 6,
+	CANCELLED = 1,
+	DATA_LOSS = 15,
+	DEADLINE_EXCEEDED = 4,
+	FAILED_PRECONDITION = 9,
+	INTERNAL = 13,
+	INVALID_ARGUMENT = 3,
+	NOTIFICATION_DM_REQUEST = -1,
+	NOTIFICATION_FRIEND_ACCEPT = -3,
+	NOTIFICATION_FRIEND_JOIN_GAME = -6,
+	NOTIFICATION_FRIEND_REQUEST = -2,
+	NOTIFICATION_GROUP_ADD = -4,
+	NOTIFICATION_GROUP_JOIN_REQUEST = -5,
+	NOTIFICATION_SINGLE_SOCKET = -7,
+	NOTIFICATION_USER_BANNED = -8,
+	NOT_FOUND = 5,
+	OK = 0,
+	OUT_OF_RANGE = 11,
+	PERMISSION_DENIED = 7,
+	RESOURCE_EXHAUSTED = 8,
+	UNAUTHENTICATED = 16,
+	UNAVAILABLE = 14,
+	UNIMPLEMENTED = 12,
+	UNKNOWN = 2,
+}
+
+--- constants
+-- Well-known values which aren't modeled as enums, eg storage permissions.
+M.GROUP_STATE_ADMIN = 1
+M.GROUP_STATE_JOIN_REQUEST = 3
+M.GROUP_STATE_MEMBER = 2
+M.GROUP_STATE_SUPERADMIN = 0
+M.STORAGE_PERMISSION_READ_NONE = 0
+M.STORAGE_PERMISSION_READ_OWNER = 1
+M.STORAGE_PERMISSION_READ_PUBLIC = 2
+M.STORAGE_PERMISSION_WRITE_NONE = 0
+M.STORAGE_PERMISSION_WRITE_OWNER = 1
 
 --
 -- The low level client for the Nakama API.
@@ -61,9 +143,46 @@ M.APISTOREPROVIDER_FACEBOOK_INSTANT_STORE = "FACEBOOK_INSTANT_STORE"
 
 local _config = {}
 
+-- engines of the created clients, used for timers in M.sync() when all
+-- clients use the same engine
+local client_engines = setmetatable({}, { __mode = "k" })
+
+--- The default max size of a response in bytes (see config.max_response_bytes).
+M.DEFAULT_MAX_RESPONSE_BYTES = 16 * 1024 * 1024
+
+--- The version of the Nakama server the client was generated for. Only the
+-- major version is compared by check_compatibility().
+M.SERVER_VERSION = "3"
+
+
+--- Config presets per environment, used when config.environment is set and
+-- there is no config.presets, eg { prod = { host = "nakama.example.com", port = 443, use_ssl = true } }.
+M.config_presets = nil
+
+-- get the config with the fields of the preset of config.environment which
+-- aren't set in the config itself
+local function apply_config_preset(config)
+	if config.environment == nil then
+		return config
+	end
+	local presets = config.presets or M.config_presets
+	assert(type(presets) == "table", "You must provide config presets to use an environment")
+	local preset = presets[config.environment]
+	assert(type(preset) == "table", ("There is no config preset for the environment '%s'"):format(tostring(config.environment)))
+	local merged = {}
+	for k,v in pairs(preset) do
+		merged[k] = v
+	end
+	for k,v in pairs(config) do
+		merged[k] = v
+	end
+	return merged
+end
 
 --- Create a Nakama client instance.
 -- @param config A table of configuration options.
+-- config.environment - Environment to use the config preset of, eg "prod". Fields set in the config itself take precedence over the preset.
+-- config.presets - Config presets per environment (defaults to M.config_presets), eg { dev = { host = "127.0.0.1", port = 7350 } }.
 -- config.engine - Engine specific implementations.
 -- config.host
 -- config.port
@@ -72,9 +191,42 @@ local _config = {}
 -- config.bearer_token
 -- config.username
 -- config.password
+-- config.clock_skew_seconds - Tolerance when checking if a session has expired, see is_token_expired(). Defaults to the tolerance set using session.set_clock_skew().
+-- config.log_requests - Log requests (default true). Set to false to not log any requests.
+-- config.max_response_bytes - Max size of a response. Larger responses are rejected before they are decoded (default 16 MB).
+-- config.use_server_time - Correct the device clock using the Date header of responses.
+-- config.retry_policy - Default retry policy.
+-- config.retry_budget - Limit retries using a budget of { tokens, refill_per_second }.
+-- config.fields - Response fields to request per operation, sent as a 'fields' query parameter.
+-- config.cache - Time to live in seconds of cached responses per GET operation, eg { get_leaderboard = 30 }.
+-- config.dedup_window - Seconds to return the result of a completed request to other requests with the same opts.idempotency_key (default 5).
+-- config.collect_stats - Keep latency stats per operation, see get_stats(). Requires the engine to report the duration of requests.
+-- config.stats_window - Number of requests per operation to keep latency stats for (default 100).
+-- config.on_token_refreshed - Function called with the new session when the session has been refreshed.
+-- config.on_auth_lost - Function called when the session can't be refreshed because the refresh token was rejected and the user must authenticate again.
+-- config.compatibility - Set to "refuse" to suspend the client when check_compatibility() finds an incompatible server (default "warn").
+-- config.version_rpc - Id of an rpc returning the server version, used by check_compatibility().
+-- config.verification_rpcs - Ids of the rpcs used by send_verification() and verify_code() (default { send = "send_verification", verify = "verify_code" }).
+-- config.on_banned - Function called with { reason, source, operation, code, message } when the user has been banned or the socket has been kicked.
+-- config.rate_limits - Max request rate per operation, eg { authenticate_email = { per_second = 1 } }.
+-- config.http_key - Server http key used for rpc calls made without a session.
+-- config.sign_request - Function called with each request ({ method, path, query, body, timestamp, headers }) returning headers to add to the request.
+-- config.parse_timestamps - Convert RFC3339 timestamps in responses (eg create_time) to seconds since epoch.
+-- config.auto_resubscribe - Restore joined channels, matches, parties and followed users when a socket reconnects.
+-- config.socket_reconnect - Retry policy used to connect a socket again when it is disconnected, eg retries.exponential_jitter(10, 1, 30). Requires engine support for timers.
+-- config.socket_buffer_on_reconnect - Keep socket messages sent while reconnecting until the socket is connected again or config.timeout has passed.
+-- config.socket_backpressure_threshold - Number of pending socket sends at which socket.on_backpressure() is called (default 20), see socket.pending_sends().
+-- config.socket_heartbeat - Seconds between pings sent on a connected socket. The connection is lost if a ping isn't answered before the next one. Requires engine support for timers.
+-- config.resilient_socket - Enable auto_resubscribe, socket_buffer_on_reconnect, socket_reconnect (retries.exponential_jitter(10, 1, 30)) and socket_heartbeat (15 seconds) unless they are set. Set an option to false to disable it. Requires engine support for timers.
+-- config.status_update_debounce - Seconds during which socket status updates are kept and only the latest status is sent, see socket.status_update_now(). Requires engine support for timers.
+-- config.track_sequence - Detect gaps and out of order socket messages with sequence numbers, see socket.on_sequence_gap().
+-- config.build_only - Return the requests built by the client functions instead of making them, as tables with the operation, method, url, path, query, body, headers and timeout.
+-- config.circuit_breaker - Fail requests immediately after the server failed to respond to a number of requests in a row, eg { failure_threshold = 5, cooldown = 30 }, see circuit_state().
+-- config.on_circuit_state_change - Function called with the new and the previous state when the state of the circuit breaker changes.
 -- @return Nakama Client instance.
 function M.create_client(config)
 	assert(config, "You must provide a configuration")
+	config = apply_config_preset(config)
 	assert(config.host, "You must provide a host")
 	assert(config.port, "You must provide a port")
 	assert(config.engine, "You must provide an engine")
@@ -87,7 +239,9 @@ function M.create_client(config)
 	local client = {}
 	local scheme = config.use_ssl and "https" or "http"
 	client.engine = config.engine
+	client_engines[config.engine] = true
 	client.config = {}
+	client.config.environment = config.environment
 	client.config.host = config.host
 	client.config.port = config.port
 	client.config.http_uri = ("%s://%s:%d"):format(scheme, config.host, config.port)
@@ -95,10 +249,98 @@ function M.create_client(config)
 	client.config.username = config.username
 	client.config.password = config.password
 	client.config.timeout = config.timeout or 10
+	-- timeouts of requests per operation, with a default for other operations
+	client.config.timeouts = config.timeouts or {}
+	for operation,timeout in pairs(client.config.timeouts) do
+		assert(type(timeout) == "number" and timeout > 0, "Timeout for '" .. operation .. "' must be a positive number")
+	end
+	client.config.max_response_bytes = config.max_response_bytes or M.DEFAULT_MAX_RESPONSE_BYTES
 	client.config.use_ssl = config.use_ssl
 	client.config.retry_policy = config.retry_policy or retries.none()
+	if config.retry_budget then
+		client.config.retry_budget = retries.budget(config.retry_budget.tokens, config.retry_budget.refill_per_second)
+	end
+	client.config.use_server_time = config.use_server_time
+	-- clock skew tolerance and server time of the client, used when checking if
+	-- a token has expired
+	client.clock = api_session.create_clock(config.clock_skew_seconds)
+	client.config.log_requests = config.log_requests ~= false
+	client.config.fields = config.fields or {}
+	client.config.cache = config.cache or {}
+	client.response_cache = response_cache.create()
+	-- sockets created by the client, disconnected by logout()
+	client.sockets = setmetatable({}, { __mode = "k" })
+	client.config.dedup_window = config.dedup_window or 5
+	client.deduplicator = deduplicator.create()
+	if config.collect_stats then
+		client.latency_stats = latency_stats.create(config.stats_window or 100)
+	end
+	-- the socket reliability options default to the resilient profile when
+	-- config.resilient_socket is set, and can still be set (or disabled) one by one
+	local function socket_option(name, resilient_default)
+		if config[name] == nil and config.resilient_socket then
+			return resilient_default
+		end
+		return config[name]
+	end
+	client.config.auto_resubscribe = socket_option("auto_resubscribe", true)
+	client.config.track_sequence = config.track_sequence
+	client.config.socket_buffer_on_reconnect = socket_option("socket_buffer_on_reconnect", true)
+	client.config.socket_backpressure_threshold = config.socket_backpressure_threshold or 20
+	client.config.socket_reconnect = socket_option("socket_reconnect", config.resilient_socket and retries.exponential_jitter(10, 1, 30))
+	if client.config.socket_reconnect then
+		assert(type(client.config.socket_reconnect) == "table", "The socket reconnect policy must be a retry policy")
+		assert(type(config.engine.timer_delay) == "function", "The engine must provide the 'timer_delay' function to reconnect sockets")
+	end
+	client.config.socket_heartbeat = socket_option("socket_heartbeat", 15)
+	if client.config.socket_heartbeat then
+		assert(type(client.config.socket_heartbeat) == "number" and client.config.socket_heartbeat > 0, "The socket heartbeat must be a positive number of seconds")
+		assert(type(config.engine.timer_delay) == "function", "The engine must provide the 'timer_delay' function to send socket heartbeats")
+	end
+	if config.status_update_debounce then
+		assert(type(config.status_update_debounce) == "number" and config.status_update_debounce > 0, "The status update debounce must be a positive number of seconds")
+		assert(type(config.engine.timer_delay) == "function", "The engine must provide the 'timer_delay' function to debounce status updates")
+	end
+	client.config.status_update_debounce = config.status_update_debounce
+	client.config.socket_format = config.socket_format
+	assert(not config.socket_path or (type(config.socket_path) == "string" and config.socket_path:sub(1, 1) == "/"), "The socket path must start with '/'")
+	client.config.socket_path = config.socket_path or "/ws"
+	assert(not config.storage_integer_keys or config.storage_integer_keys == "map" or config.storage_integer_keys == "array", "The storage integer keys must be 'map' or 'array'")
+	client.config.storage_integer_keys = config.storage_integer_keys or "map"
+	client.config.parse_timestamps = config.parse_timestamps
+	client.config.http_key = config.http_key
+	client.config.on_token_refreshed = config.on_token_refreshed
+	client.config.on_auth_lost = config.on_auth_lost
+	client.config.on_banned = config.on_banned
+	assert(not config.compatibility or config.compatibility == "warn" or config.compatibility == "refuse", "The compatibility must be 'warn' or 'refuse'")
+	client.config.compatibility = config.compatibility or "warn"
+	client.config.version_rpc = config.version_rpc
+	client.config.verification_rpcs = {
+		send = config.verification_rpcs and config.verification_rpcs.send or "send_verification",
+		verify = config.verification_rpcs and config.verification_rpcs.verify or "verify_code",
+	}
+	client.config.sign_request = config.sign_request
+	client.config.build_only = config.build_only
+	client.config.rate_limits = {}
+	for operation,rate_limit in pairs(config.rate_limits or {}) do
+		assert(type(rate_limit.per_second) == "number" and rate_limit.per_second > 0, "Rate limit for '" .. operation .. "' must have a positive 'per_second' value")
+		client.config.rate_limits[operation] = token_bucket.create(math.max(1, rate_limit.per_second), rate_limit.per_second)
+	end
+	client.config.on_circuit_state_change = config.on_circuit_state_change
+	if config.circuit_breaker then
+		local failure_threshold = config.circuit_breaker.failure_threshold or 5
+		local cooldown = config.circuit_breaker.cooldown or 30
+		assert(type(failure_threshold) == "number" and failure_threshold >= 1, "The circuit breaker failure threshold must be at least 1")
+		assert(type(cooldown) == "number" and cooldown >= 0, "The circuit breaker cooldown must be a positive number")
+		client.circuit_breaker = circuit_breaker.create(failure_threshold, cooldown, function(state, previous_state)
+			log("circuit breaker", previous_state, "->", state)
+			if client.config.on_circuit_state_change then
+				client.config.on_circuit_state_change(state, previous_state)
+			end
+		end, config.engine.time)
+	end
 
-	local ignored_fns = { create_client = true, sync = true }
+	local ignored_fns = { create_client = true, sync = true, wallet_update_local = true, notifications_filter = true, notifications_mark_read = true, debug_pending = true, debug_clear = true, describe = true, clear_stubs = true }
 	for name,fn in pairs(M) do
 		if not ignored_fns[name] and type(fn) == "function" then
 			log("setting " .. name)
@@ -115,7 +357,51 @@ end
 -- @return Socket instance.
 function M.create_socket(client)
 	assert(client, "You must provide a client")
-	return socket.create(client)
+	local s = socket.create(client)
+	client.sockets[s] = true
+	return s
+end
+
+--- Check whether a session token has expired, using the clock skew tolerance
+-- and the server time of the client (see config.clock_skew_seconds and
+-- config.use_server_time).
+-- @param client Nakama client.
+-- @param session The session object created with session.create().
+-- @return A boolean if the token has expired or not.
+function M.is_token_expired(client, session)
+	assert(client, "You must provide a client")
+	return api_session.is_token_expired(session, client.clock)
+end
+
+--- Check whether a session token is about to expire (within 24 hours), using
+-- the clock skew tolerance and the server time of the client.
+-- @param client Nakama client.
+-- @param session The session object created with session.create().
+-- @return A boolean if the token is about to expire or not.
+function M.is_token_expired_soon(client, session)
+	assert(client, "You must provide a client")
+	return api_session.is_token_expired_soon(session, client.clock)
+end
+
+--- Check whether a session refresh token has expired, using the clock skew
+-- tolerance and the server time of the client.
+-- @param client Nakama client.
+-- @param session The session object created with session.create().
+-- @return A boolean if the refresh token has expired or not.
+function M.is_refresh_token_expired(client, session)
+	assert(client, "You must provide a client")
+	return api_session.is_refresh_token_expired(session, client.clock)
+end
+
+--- Check that a token is a well formed JWT which hasn't expired, using the
+-- clock skew tolerance and the server time of the client, see session.validate().
+-- @param client Nakama client.
+-- @param token The token, eg session.token.
+-- @return true if the token is valid, otherwise false and the reason
+-- ("malformed" or "expired").
+function M.validate_token(client, token)
+	assert(client, "You must provide a client")
+	return api_session.validate(token, client.clock)
 end
 
 --- Set Nakama client bearer token.
@@ -126,14 +412,132 @@ function M.set_bearer_token(client, bearer_token)
 	client.config.bearer_token = bearer_token
 end
 
+--- Suspend the client, for instance when the app is sent to the background.
+-- While the client is suspended:
+-- * Failed requests are not retried.
+-- * New requests fail immediately with an error result with code "suspended"
+-- if opts.fail_requests is set, except for operations listed in opts.allow.
+-- Requests which have already been sent are not cancelled and sockets are not
+-- affected.
+-- @param client Nakama client.
+-- @param opts Optional table of options:
+-- opts.fail_requests - Fail new requests while suspended.
+-- opts.allow - List of operations which are allowed while suspended, eg { "session_refresh" }.
+function M.suspend(client, opts)
+	assert(client, "You must provide a client")
+	opts = opts or {}
+	assert(not opts.allow or type(opts.allow) == "table", "Argument 'opts.allow' must be 'nil' or of type 'table'")
+	local allow = {}
+	for _,operation in ipairs(opts.allow or {}) do
+		allow[operation] = true
+	end
+	client.config.suspended = {
+		fail_requests = opts.fail_requests,
+		allow = allow,
+	}
+end
+
+--- Resume a suspended client.
+-- @param client Nakama client.
+function M.resume(client)
+	assert(client, "You must provide a client")
+	client.config.suspended = nil
+end
+
+--- Remove cached responses (see config.cache).
+-- @param client Nakama client.
+-- @param pattern Optional Lua pattern matched against the url path and query
+-- of the cached responses to remove, eg "^/v2/leaderboard/". All cached
+-- responses are removed if no pattern is provided.
+function M.cache_invalidate(client, pattern)
+	assert(client, "You must provide a client")
+	assert(not pattern or type(pattern) == "string", "Argument 'pattern' must be 'nil' or of type 'string'")
+	client.response_cache.invalidate(pattern)
+end
+
+--- Get the latency stats of each operation (see config.collect_stats).
+-- The stats are based on the durations of the most recent requests of each
+-- operation (see config.stats_window) as reported by the engine.
+-- @param client Nakama client.
+-- @return Table with the stats of each operation, eg { get_account = { count,
+-- p50, p95, max } }, with durations in seconds. Empty if stats aren't collected.
+function M.get_stats(client)
+	assert(client, "You must provide a client")
+	if not client.latency_stats then
+		return {}
+	end
+	return client.latency_stats.get()
+end
+
+--- Get the state of the circuit breaker (see config.circuit_breaker).
+-- @param client Nakama client.
+-- @return "closed" if requests are made, "open" if requests fail without
+-- being made, or "half_open" if a request is made to test if the server has
+-- recovered. Always "closed" if the circuit breaker isn't configured.
+function M.circuit_state(client)
+	assert(client, "You must provide a client")
+	if not client.circuit_breaker then
+		return circuit_breaker.CLOSED
+	end
+	return client.circuit_breaker.state
+end
+
+--- Create a client which streams the items of an array in responses.
+-- Requests made with the returned client pass each item of the array field
+-- of the response to the item callback instead of including them in the
+-- result. The items are decoded one at a time as they are received if the
+-- engine supports streaming (see engine.http_stream).
+-- @param client Nakama client.
+-- @param field Name of the array field in the response, eg "objects".
+-- @param on_item Function to call with each array item.
+-- @return Streaming Nakama client.
+function M.stream(client, field, on_item)
+	assert(client, "You must provide a client")
+	assert(type(field) == "string", "You must provide a field")
+	assert(type(on_item) == "function", "You must provide an item callback")
+	local stream_client = setmetatable({}, { __index = client })
+	stream_client.response_stream = { field = field, on_item = on_item }
+	for name,fn in pairs(M) do
+		if type(client[name]) == "function" then
+			stream_client[name] = function(...) return fn(stream_client, ...) end
+		end
+	end
+	return stream_client
+end
+
+
+-- cancellation tokens associated with a coroutine, shared with the socket
+local cancellation_tokens = async.cancellation_tokens
+
+-- functions stopping the timeout timer of a coroutine run using nakama.sync()
+local sync_timers = setmetatable({}, { __mode = "k" })
 
--- cancellation tokens associated with a coroutine
-local cancellation_tokens = {}
+-- stop tracking a coroutine which has finished or failed
+local function release_coroutine(co)
+	cancellation_tokens[co] = nil
+	local stop_timer = sync_timers[co]
+	if stop_timer then
+		sync_timers[co] = nil
+		stop_timer()
+	end
+end
 
 -- cancel a cancellation token
+-- any functions in token.on_cancel are called when the token is cancelled
 function M.cancel(token)
 	assert(token)
+	if token.cancelled then
+		return
+	end
 	token.cancelled = true
+	-- the functions may remove themselves from the list when called
+	local on_cancel = {}
+	for i,fn in ipairs(token.on_cancel or {}) do
+		on_cancel[i] = fn
+	end
+	for _,fn in ipairs(on_cancel) do
+		fn()
+	end
 end
 
 -- create a cancellation token
@@ -141,30 +545,110 @@ end
 -- @return token Pass the token to a call to nakama.sync() or to any of the API calls
 function M.cancellation_token()
 	local token = {
-		cancelled = false
+		cancelled = false,
+		on_cancel = {},
 	}
 	function token.cancel()
-		token.cancelled = true
+		M.cancel(token)
 	end
 	return token
 end
 
+--- Get the coroutines tracked with a cancellation token, to debug leaks.
+-- A coroutine running nakama.sync() with a cancellation token is tracked until
+-- it has finished. A coroutine which is "dead" failed without being removed.
+-- @return Table with the 'count' of tracked coroutines and a list of
+-- 'coroutines', each with the 'status' of the coroutine (see
+-- coroutine.status()) and whether the token has been 'cancelled'.
+function M.debug_pending()
+	local pending = { count = 0, coroutines = {} }
+	for co,token in pairs(cancellation_tokens) do
+		pending.count = pending.count + 1
+		table.insert(pending.coroutines, { status = coroutine.status(co), cancelled = token.cancelled })
+	end
+	return pending
+end
+
+--- Stop tracking coroutines with a cancellation token, to work around leaks.
+-- Only coroutines which are dead are removed by default, which doesn't affect
+-- running calls.
+-- @param all Optional. Remove all coroutines. Calls which are still running
+-- can then no longer be cancelled using their cancellation token.
+-- @return The number of coroutines which were removed.
+function M.debug_clear(all)
+	local removed = 0
+	for co,_ in pairs(cancellation_tokens) do
+		if all or coroutine.status(co) == "dead" then
+			cancellation_tokens[co] = nil
+			removed = removed + 1
+		end
+	end
+	return removed
+end
+
 -- Private
 -- Run code within a coroutine
 -- @param fn The code to run
 -- @param cancellation_token Optional cancellation token to cancel the running code
-function M.sync(fn, cancellation_token)
+-- @param opts Optional table of options:
+-- opts.timeout - Cancel the running code after this many seconds. Requires engine support for timers.
+-- opts.on_timeout - Optional function to call when the running code was cancelled after the timeout.
+-- opts.engine - Optional engine to use for the timeout timer.
+-- opts.client - Optional client whose engine to use for the timeout timer.
+-- The engine or the client is required for a timeout when clients with
+-- different engines have been created.
+function M.sync(fn, cancellation_token, opts)
 	assert(fn)
+	assert(not opts or type(opts) == "table", "Argument 'opts' must be 'nil' or of type 'table'")
+	opts = opts or {}
+	assert(not opts.timeout or type(opts.timeout) == "number", "The timeout must be a number")
+
+	local finished = false
+	local engine = opts.engine or (opts.client and opts.client.engine)
+	if opts.timeout and not engine then
+		for client_engine,_ in pairs(client_engines) do
+			assert(not engine, "Clients with different engines exist, pass 'opts.engine' or 'opts.client' to use a timeout")
+			engine = client_engine
+		end
+	end
+	local timer_handle = nil
+	local function stop_timer()
+		finished = true
+		if timer_handle and engine.timer_cancel then
+			engine.timer_cancel(timer_handle)
+		end
+		timer_handle = nil
+	end
+	if opts.timeout then
+		assert(engine and engine.timer_delay, "The engine must provide the 'timer_delay' function to use a timeout")
+		cancellation_token = cancellation_token or M.cancellation_token()
+		timer_handle = engine.timer_delay(opts.timeout, function()
+			timer_handle = nil
+			if finished or cancellation_token.cancelled then
+				return
+			end
+			log("sync() timed out")
+			M.cancel(cancellation_token)
+			if opts.on_timeout then
+				opts.on_timeout()
+			end
+		end)
+	end
+
 	local co = nil
 	co = coroutine.create(function()
-		cancellation_tokens[co] = cancellation_token
 		fn()
-		cancellation_tokens[co] = nil
+		release_coroutine(co)
 	end)
+	cancellation_tokens[co] = cancellation_token
+	sync_timers[co] = stop_timer
+	-- release the coroutine if it fails after being resumed by a response or
+	-- a socket event
+	async.on_error(co, release_coroutine)
 	local ok, err = coroutine.resume(co)
 	if not ok then
 		log(err)
-		cancellation_tokens[co] = nil
+		release_coroutine(co)
 	end
 end
 
@@ -172,35 +656,446 @@ end
 -- Nakama REST API
 --
 
+-- check the keys and values of a map argument
+-- @return The map or nil if it is empty, since an empty table would be encoded as a JSON array
+local function map_arg(name, map, value_type)
+	if map == json.null then
+		return map
+	end
+	if map == nil or next(map) == nil then
+		return nil
+	end
+	for k,v in pairs(map) do
+		assert(type(k) == "string", ("Argument '%s' must only have keys of type 'string'"):format(name))
+		assert(type(v) == value_type, ("Argument '%s' must only have values of type '%s'"):format(name, value_type))
+	end
+	return map
+end
+
+-- encode the body of a request, where the fields which are nil have been
+-- omitted and fields set to json.null are encoded as null
+-- @return The JSON object, "{}" if all fields were omitted since an empty table
+-- would be encoded as a JSON array
+local function encode_body(body)
+	if next(body) == nil then
+		return "{}"
+	end
+	return json.encode(body)
+end
+
+-- update the server time using the Date header of a response
+local function update_server_time(client, response_info)
+	if client.config.use_server_time and response_info and response_info.headers then
+		local date = response_info.headers["date"] or response_info.headers["Date"]
+		if date then
+			api_session.set_server_time(date, client.clock)
+		end
+	end
+end
+
+-- call the session refresh hooks with the result of a session refresh, before
+-- the result is returned (see config.on_token_refreshed and config.on_auth_lost)
+local function notify_session_refresh(client, result, response_info)
+	if result and not result.error then
+		if client.config.on_token_refreshed then
+			client.config.on_token_refreshed(result)
+		end
+	elseif result and (result.code == M.codes.UNAUTHENTICATED or (response_info and response_info.status == 401)) then
+		if client.config.on_auth_lost then
+			client.config.on_auth_lost()
+		end
+	end
+end
+
+-- check if the result of a request means that the user has been banned, in
+-- which case other requests are rejected without being made until the user
+-- authenticates again (see config.on_banned)
+local function detect_ban(client, operation, result)
+	if not result then
+		return
+	end
+	if not result.error then
+		if operation:find("^authenticate") then
+			client.config.banned = nil
+		end
+		return
+	end
+	if result.code ~= M.codes.PERMISSION_DENIED or not tostring(result.message):lower():find("banned") then
+		return
+	end
+	local info = { reason = "banned", source = "http", operation = operation, code = result.code, message = result.message }
+	client.config.banned = info
+	if client.config.on_banned then
+		client.config.on_banned(info)
+	end
+end
+
+-- add the duration of a request reported by the engine to the latency stats
+-- of the operation (see config.collect_stats)
+local function update_stats(client, operation, response_info)
+	if client.latency_stats and response_info and response_info.duration then
+		client.latency_stats.add(operation, response_info.duration)
+	end
+end
+
+-- request a partial response if fields have been configured for the operation
+-- (see config.fields)
+local function add_fields(client, operation, query_params)
+	local fields = client.config.fields[operation]
+	if fields and query_params.fields == nil then
+		query_params.fields = fields
+	end
+end
+
+-- get the timeout of a request or of the operation (see config.timeouts), or
+-- nil to use the timeout of the client
+local function request_timeout(client, operation, opts)
+	return opts and opts.timeout or client.config.timeouts[operation] or client.config.timeouts.default
+end
+
+-- get the extra headers of a request, with the correlation id, the headers of
+-- the call and the headers added by the request signing hook
+local function request_headers(client, correlation_id, opts, url_path, query_params, method, post_data)
+	local headers = { ["X-Correlation-Id"] = correlation_id }
+	for name,value in pairs(opts and opts.headers or {}) do
+		headers[name] = value
+	end
+	if client.config.sign_request then
+		local request = {
+			method = method,
+			path = url_path,
+			query = query_params,
+			body = post_data,
+			timestamp = os.time(),
+			headers = headers,
+		}
+		headers = client.config.sign_request(request) or request.headers
+		headers["X-Correlation-Id"] = correlation_id
+	end
+	return headers
+end
+
+-- build a request instead of making it (see config.build_only), with the
+-- headers and url which the engine would use
+local function build_request(client, operation, url_path, query_params, method, post_data, opts, correlation_id)
+	add_fields(client, operation, query_params)
+	local headers = {
+		["Accept"] = "application/json",
+		["Content-Type"] = "application/json",
+	}
+	if client.config.bearer_token then
+		headers["Authorization"] = "Bearer " .. client.config.bearer_token
+	elseif client.config.username then
+		headers["Authorization"] = "Basic " .. b64.encode(client.config.username .. ":" .. (client.config.password or ""))
+	end
+	for name,value in pairs(request_headers(client, correlation_id, opts, url_path, query_params, method, post_data)) do
+		headers[name] = value
+	end
+
+	local query = {}
+	for name,value in pairs(query_params) do
+		for _,v in ipairs(type(value) == "table" and value or { value }) do
+			table.insert(query, name .. "=" .. uri.encode_component(tostring(v)))
+		end
+	end
+	table.sort(query)
+	local query_string = #query > 0 and ("?" .. table.concat(query, "&")) or ""
+
+	return {
+		operation = operation,
+		method = method,
+		url = client.config.http_uri .. url_path .. query_string,
+		path = url_path,
+		query = query_params,
+		body = post_data,
+		headers = headers,
+		timeout = request_timeout(client, operation, opts) or client.config.timeout,
+	}
+end
+
+-- update the circuit breaker with the result of a request (see
+-- config.circuit_breaker). Only requests which the server failed to respond
+-- to, or failed to handle with a 5xx status, count as failures.
+local function update_circuit_breaker(client, result, response_info)
+	local breaker = client.circuit_breaker
+	if not breaker then
+		return
+	end
+	if not result then
+		breaker.cancel()
+		return
+	end
+	local status = response_info and response_info.status
+	if result.error and (not status or status == 0 or status >= 500) then
+		breaker.failure()
+	else
+		breaker.success()
+	end
+end
+
 -- http request helper used to reduce code duplication in all API functions below
-local function http(client, callback, url_path, query_params, method, post_data, retry_policy, cancellation_token, handler_fn)
+-- make a request using the engine
+-- the items of the array field of a streaming client (see M.stream) are passed
+-- to the item callback and removed from the result. The items are decoded
+-- incrementally if the engine supports streaming.
+local function engine_http(client, config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback, headers)
+	local stream = client.response_stream
+	if not stream then
+		client.engine.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, callback, headers)
+	elseif client.engine.http_stream then
+		local decoder = json_stream.create(stream.field, stream.on_item)
+		-- stop decoding a response which is larger than the max size
+		local size = 0
+		local function feed(chunk)
+			size = size + #chunk
+			if size <= config.max_response_bytes then
+				decoder.feed(chunk)
+			end
+		end
+		client.engine.http_stream(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, feed, function(result, response_info)
+			if not result and size > config.max_response_bytes then
+				result = { error = true, code = "response_too_large", message = ("The response is larger than %d bytes"):format(config.max_response_bytes) }
+			end
+			callback(result or decoder.finish(), response_info)
+		end, headers)
+	else
+		client.engine.http(config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result, response_info)
+			if result and not result.error and type(result[stream.field]) == "table" then
+				for _,item in ipairs(result[stream.field]) do
+					stream.on_item(item)
+				end
+				result[stream.field] = {}
+			end
+			callback(result, response_info)
+		end, headers)
+	end
+end
+
+-- operations which accept the server http key instead of a session, with the
+-- name of the query param of the operation for the key if it has one
+local http_key_operations = {
+	rpc = true,
+	rpc_func2 = "httpKey",
+	rpc_func = "httpKey",
+}
+
+-- add the server http key to the query params of an operation which accepts
+-- it (or of a request with opts.http_key_auth set), using opts.http_key or
+-- config.http_key when there is no session, for instance when calling an rpc
+-- before authenticating
+local function add_http_key(client, operation, query_params, opts)
+	local key_param = http_key_operations[operation]
+	if not key_param and not (opts and opts.http_key_auth) then
+		return
+	end
+	-- the key was passed as a param of the operation
+	if type(key_param) == "string" and query_params[key_param] then
+		return
+	end
+	local http_key = opts and opts.http_key
+	if not http_key and not client.config.bearer_token then
+		http_key = client.config.http_key
+	end
+	if http_key then
+		query_params["http_key"] = http_key
+	end
+end
+
+local function http(client, operation, callback, url_path, query_params, method, post_data, retry_policy, cancellation_token, opts, handler_fn)
+	add_http_key(client, operation, query_params, opts)
+
+	-- log the request unless logging is disabled for the client or for this call
+	local log = (client.config.log_requests and not (opts and opts.log == false)) and log or function() end
+
+	-- the correlation id is sent with the request, logged and added to error
+	-- results to make it possible to trace the request in the server logs
+	local correlation_id = opts and opts.correlation_id or client.engine.uuid()
+	local function handle_result(result, response_info)
+		if result and result.error then
+			result.correlation_id = correlation_id
+		end
+		result = handler_fn(result, response_info)
+		detect_ban(client, operation, result)
+		if operation == "session_refresh" then
+			notify_session_refresh(client, result, response_info)
+		end
+		return result
+	end
+
+	-- return the request instead of making it (see config.build_only)
+	if client.config.build_only then
+		local request = build_request(client, operation, url_path, query_params, method, post_data, opts, correlation_id)
+		if callback then
+			callback(request)
+			return
+		end
+		return request
+	end
+
+	-- serve the response from the cache if it has been cached (see config.cache)
+	local cache_ttl = method == "GET" and not client.response_stream and client.config.cache[operation]
+	local cache_key = cache_ttl and response_cache.key(url_path, query_params)
+	local cached = cache_key and client.response_cache.get(cache_key, client.config.bearer_token)
+	if cached then
+		log(url_path, correlation_id, "cached")
+		if client.config.parse_timestamps then
+			time.convert_timestamps(cached)
+		end
+		if callback then
+			callback(handle_result(cached))
+			return
+		end
+		return handle_result(cached)
+	end
+	-- cache a successful response using the configured time to live or the
+	-- max-age of the response
+	local function cache_response(result, response_info)
+		if cache_key and result and not result.error then
+			local ttl = response_cache.max_age(response_info and response_info.headers) or cache_ttl
+			client.response_cache.set(cache_key, client.config.bearer_token, result, ttl)
+		end
+	end
+
+	-- return the result of a request with the same idempotency key instead of
+	-- making the request again while it is in flight or if it has recently
+	-- completed (see config.dedup_window)
+	local dedup_key = method ~= "GET" and opts and opts.idempotency_key and (operation .. ":" .. opts.idempotency_key)
+	if dedup_key and client.deduplicator.started(dedup_key) then
+		log(url_path, correlation_id, "deduplicated")
+		if callback then
+			client.deduplicator.wait(dedup_key, function(result)
+				callback(handle_result(result))
+			end)
+			return
+		end
+		return handle_result(async(function(done)
+			client.deduplicator.wait(dedup_key, done)
+		end))
+	end
+	local function finish_dedup(result)
+		if dedup_key then
+			client.deduplicator.finish(dedup_key, result, client.config.dedup_window)
+		end
+	end
+
+	-- fail without making a request if the configured rate for the operation is exceeded
+	local rate_limit = client.config.rate_limits[operation]
+	if rate_limit and not rate_limit.consume() then
+		log(url_path, correlation_id, "rate limited")
+		local result = { error = true, code = "rate_limited_local", message = "Rate limit exceeded for " .. operation }
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+
+	-- fail without making a request if the client is suspended and the operation isn't allowed
+	local suspended = client.config.suspended
+	if suspended and suspended.fail_requests and not suspended.allow[operation] then
+		log(url_path, correlation_id, "suspended")
+		local result = { error = true, code = "suspended", message = "The client is suspended" }
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+
+	-- fail without making a request if the user has been banned, unless authenticating again
+	local banned = client.config.banned
+	if banned and not operation:find("^authenticate") then
+		log(url_path, correlation_id, "banned")
+		local result = { error = true, code = "banned", message = "The user has been banned" }
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+
+	-- fail without making a request while the circuit breaker is open
+	if client.circuit_breaker and not client.circuit_breaker.allow() then
+		log(url_path, correlation_id, "circuit open")
+		local result = { error = true, code = "circuit_open", message = "The server is unavailable, requests to " .. client.config.host .. " are failing" }
+		if callback then
+			callback(handle_result(result))
+			return
+		end
+		return handle_result(result)
+	end
+
+	-- request a partial response if fields have been configured for the operation
+	add_fields(client, operation, query_params)
+
+	-- use the timeout of this request or of the operation (see config.timeouts)
+	-- instead of the timeout of the client
+	local config = client.config
+	local timeout = request_timeout(client, operation, opts)
+	if timeout then
+		config = setmetatable({ timeout = timeout }, { __index = client.config })
+	end
+
+	-- let the request signing hook add headers to the request
+	local headers = request_headers(client, correlation_id, opts, url_path, query_params, method, post_data)
+
 	if callback then
-		log(url_path, "with callback")
-		client.engine.http(client.config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result)
+		log(url_path, correlation_id, "with callback")
+		if dedup_key then
+			client.deduplicator.start(dedup_key)
+		end
+		engine_http(client, config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result, response_info)
+			update_server_time(client, response_info)
+			update_stats(client, operation, response_info)
+			update_circuit_breaker(client, result, response_info)
+			cache_response(result, response_info)
+			if client.config.parse_timestamps then
+				time.convert_timestamps(result)
+			end
+			finish_dedup(result)
 			if not cancellation_token or not cancellation_token.cancelled then
-				callback(handler_fn(result))
+				callback(handle_result(result, response_info))
 			end
-		end)
+		end, headers)
 	else
-		log(url_path, "with coroutine")
+		log(url_path, correlation_id, "with coroutine")
 		local co = coroutine.running()
 		assert(co, "You must be running this from withing a coroutine")
 
 		-- get cancellation token associated with this coroutine
 		cancellation_token = cancellation_tokens[co]
 		if cancellation_token and cancellation_token.cancelled then
-			cancellation_tokens[co] = nil
+			release_coroutine(co)
+			if client.circuit_breaker then
+				client.circuit_breaker.cancel()
+			end
 			return
 		end
 
+		if dedup_key then
+			client.deduplicator.start(dedup_key)
+		end
 		return async(function(done)
-			client.engine.http(client.config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result)
+			engine_http(client, config, url_path, query_params, method, post_data, retry_policy, cancellation_token, function(result, response_info)
+				update_server_time(client, response_info)
+				update_stats(client, operation, response_info)
+				update_circuit_breaker(client, result, response_info)
+				cache_response(result, response_info)
+				if client.config.parse_timestamps then
+					time.convert_timestamps(result)
+				end
+				finish_dedup(result)
 				if cancellation_token and cancellation_token.cancelled then
-					cancellation_tokens[co] = nil
+					release_coroutine(co)
 					return
 				end
-				done(handler_fn(result))
-			end)
+				done(handle_result(result, response_info))
+				-- the coroutine is resumed by done() and is dead if it failed
+				-- instead of finishing nakama.sync(), which would have removed it
+				if coroutine.status(co) == "dead" then
+					release_coroutine(co)
+				end
+			end, headers)
 		end)
 	end
 end
@@ -212,8 +1107,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.healthcheck(client, callback, retry_policy, cancellation_token)
+function M.healthcheck(client, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/healthcheck"
@@ -222,7 +1123,7 @@ function M.healthcheck(client, callback, retry_policy, cancellation_token)
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "healthcheck", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -234,8 +1135,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.delete_account(client, callback, retry_policy, cancellation_token)
+function M.delete_account(client, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/account"
@@ -244,7 +1151,7 @@ function M.delete_account(client, callback, retry_policy, cancellation_token)
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "delete_account", callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -256,8 +1163,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.get_account(client, callback, retry_policy, cancellation_token)
+function M.get_account(client, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/account"
@@ -266,7 +1179,7 @@ function M.get_account(client, callback, retry_policy, cancellation_token)
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "get_account", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_account then
 			result = api_account.create(result)
 		end
@@ -288,8 +1201,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.update_account(client, avatarUrl, displayName, langTag, location, timezone, username, callback, retry_policy, cancellation_token)
+function M.update_account(client, avatarUrl, displayName, langTag, location, timezone, username, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not avatarUrl or type(avatarUrl) == "string", "Argument 'avatarUrl' must be 'nil' or of type 'string'")
 	assert(not displayName or type(displayName) == "string", "Argument 'displayName' must be 'nil' or of type 'string'")
@@ -304,7 +1223,7 @@ function M.update_account(client, avatarUrl, displayName, langTag, location, tim
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	avatarUrl = avatarUrl,
 	displayName = displayName,
 	langTag = langTag,
@@ -313,7 +1232,7 @@ function M.update_account(client, avatarUrl, displayName, langTag, location, tim
 	username = username,
 	})
 
-	return http(client, callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "update_account", callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -322,7 +1241,7 @@ end
 -- Authenticate a user with an Apple ID against the server.
 -- @param client Nakama client.
 -- @param token (string) The ID token received from Apple to validate.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -330,28 +1249,39 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_apple(client, token, vars, create_bool, username_str, callback, retry_policy, cancellation_token)
+function M.authenticate_apple(client, token, vars, create_bool, username_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/apple"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_apple", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -363,7 +1293,7 @@ end
 -- Authenticate a user with a custom id against the server.
 -- @param client Nakama client.
 -- @param id (string) A custom identifier.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -371,28 +1301,39 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_custom(client, id, vars, create_bool, username_str, callback, retry_policy, cancellation_token)
+function M.authenticate_custom(client, id, vars, create_bool, username_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not id or type(id) == "string", "Argument 'id' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/custom"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	id = id,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_custom", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -404,7 +1345,7 @@ end
 -- Authenticate a user with a device id against the server.
 -- @param client Nakama client.
 -- @param id (string) A device identifier. Should be obtained by a platform-specific device API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -412,28 +1353,39 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_device(client, id, vars, create_bool, username_str, callback, retry_policy, cancellation_token)
+function M.authenticate_device(client, id, vars, create_bool, username_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not id or type(id) == "string", "Argument 'id' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/device"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	id = id,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_device", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -448,7 +1400,7 @@ end
 -- @param password (string) A password for the user account.
 --
 --Ignored with unlink operations.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -456,30 +1408,41 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_email(client, email, password, vars, create_bool, username_str, callback, retry_policy, cancellation_token)
+function M.authenticate_email(client, email, password, vars, create_bool, username_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not email or type(email) == "string", "Argument 'email' must be 'nil' or of type 'string'")
 	assert(not password or type(password) == "string", "Argument 'password' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/email"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	email = email,
 	password = password,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_email", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -491,7 +1454,7 @@ end
 -- Authenticate a user with a Facebook OAuth token against the server.
 -- @param client Nakama client.
 -- @param token (string) The OAuth token received from Facebook to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -500,29 +1463,42 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_facebook(client, token, vars, create_bool, username_str, sync_bool, callback, retry_policy, cancellation_token)
+function M.authenticate_facebook(client, token, vars, create_bool, username_str, sync_bool, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/facebook"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
-	query_params["sync"] = sync_bool
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
+	if sync_bool ~= nil then
+		query_params["sync"] = sync_bool
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_facebook", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -534,7 +1510,7 @@ end
 -- Authenticate a user with a Facebook Instant Game token against the server.
 -- @param client Nakama client.
 -- @param signedPlayerInfo (string) 
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -542,28 +1518,39 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_facebook_instant_game(client, signedPlayerInfo, vars, create_bool, username_str, callback, retry_policy, cancellation_token)
+function M.authenticate_facebook_instant_game(client, signedPlayerInfo, vars, create_bool, username_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not signedPlayerInfo or type(signedPlayerInfo) == "string", "Argument 'signedPlayerInfo' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/facebookinstantgame"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	signedPlayerInfo = signedPlayerInfo,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_facebook_instant_game", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -580,7 +1567,7 @@ end
 -- @param salt (string) A random "NSString" used to compute the hash and keep it randomized.
 -- @param signature (string) The verification signature data generated.
 -- @param timestampSeconds (string) Time since UNIX epoch when the signature was created.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -588,8 +1575,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_game_center(client, bundleId, playerId, publicKeyUrl, salt, signature, timestampSeconds, vars, create_bool, username_str, callback, retry_policy, cancellation_token)
+function M.authenticate_game_center(client, bundleId, playerId, publicKeyUrl, salt, signature, timestampSeconds, vars, create_bool, username_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not bundleId or type(bundleId) == "string", "Argument 'bundleId' must be 'nil' or of type 'string'")
 	assert(not playerId or type(playerId) == "string", "Argument 'playerId' must be 'nil' or of type 'string'")
@@ -597,29 +1590,34 @@ function M.authenticate_game_center(client, bundleId, playerId, publicKeyUrl, sa
 	assert(not salt or type(salt) == "string", "Argument 'salt' must be 'nil' or of type 'string'")
 	assert(not signature or type(signature) == "string", "Argument 'signature' must be 'nil' or of type 'string'")
 	assert(not timestampSeconds or type(timestampSeconds) == "string", "Argument 'timestampSeconds' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/gamecenter"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	bundleId = bundleId,
 	playerId = playerId,
 	publicKeyUrl = publicKeyUrl,
 	salt = salt,
 	signature = signature,
 	timestampSeconds = timestampSeconds,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_game_center", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -631,7 +1629,7 @@ end
 -- Authenticate a user with Google against the server.
 -- @param client Nakama client.
 -- @param token (string) The OAuth token received from Google to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -639,28 +1637,39 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_google(client, token, vars, create_bool, username_str, callback, retry_policy, cancellation_token)
+function M.authenticate_google(client, token, vars, create_bool, username_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/google"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_google", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -672,7 +1681,7 @@ end
 -- Authenticate a user with Steam against the server.
 -- @param client Nakama client.
 -- @param token (string) The account token received from Steam to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param create_bool () Register the account if the user does not already exist.
 -- @param username_str () Set the username on the account at register. Must be unique.
@@ -681,29 +1690,42 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.authenticate_steam(client, token, vars, create_bool, username_str, sync_bool, callback, retry_policy, cancellation_token)
+function M.authenticate_steam(client, token, vars, create_bool, username_str, sync_bool, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
-	-- unset the token so username+password credentials will be used
+	-- unset the token and authenticate using basic auth with the username and password of the config
 	client.config.bearer_token = nil
+	opts = with_basic_auth(client, opts)
 
 	local url_path = "/v2/account/authenticate/steam"
 
 	local query_params = {}
-	query_params["create"] = create_bool
-	query_params["username"] = username_str
-	query_params["sync"] = sync_bool
+	if create_bool ~= nil then
+		query_params["create"] = create_bool
+	end
+	if username_str ~= nil then
+		query_params["username"] = username_str
+	end
+	if sync_bool ~= nil then
+		query_params["sync"] = sync_bool
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "authenticate_steam", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -715,17 +1737,23 @@ end
 -- Add an Apple ID to the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param token (string) The ID token received from Apple to validate.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_apple(client, token, vars, callback, retry_policy, cancellation_token)
+function M.link_apple(client, token, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/link/apple"
@@ -733,12 +1761,12 @@ function M.link_apple(client, token, vars, callback, retry_policy, cancellation_
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_apple", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -747,17 +1775,23 @@ end
 -- Add a custom ID to the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param id (string) A custom identifier.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_custom(client, id, vars, callback, retry_policy, cancellation_token)
+function M.link_custom(client, id, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not id or type(id) == "string", "Argument 'id' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/link/custom"
@@ -765,12 +1799,12 @@ function M.link_custom(client, id, vars, callback, retry_policy, cancellation_to
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	id = id,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_custom", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -779,17 +1813,23 @@ end
 -- Add a device ID to the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param id (string) A device identifier. Should be obtained by a platform-specific device API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_device(client, id, vars, callback, retry_policy, cancellation_token)
+function M.link_device(client, id, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not id or type(id) == "string", "Argument 'id' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/link/device"
@@ -797,12 +1837,12 @@ function M.link_device(client, id, vars, callback, retry_policy, cancellation_to
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	id = id,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_device", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -814,18 +1854,24 @@ end
 -- @param password (string) A password for the user account.
 --
 --Ignored with unlink operations.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_email(client, email, password, vars, callback, retry_policy, cancellation_token)
+function M.link_email(client, email, password, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not email or type(email) == "string", "Argument 'email' must be 'nil' or of type 'string'")
 	assert(not password or type(password) == "string", "Argument 'password' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/link/email"
@@ -833,13 +1879,13 @@ function M.link_email(client, email, password, vars, callback, retry_policy, can
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	email = email,
 	password = password,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_email", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -848,32 +1894,40 @@ end
 -- Add Facebook to the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param token (string) The OAuth token received from Facebook to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param sync_bool () Import Facebook friends for the user.
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_facebook(client, token, vars, sync_bool, callback, retry_policy, cancellation_token)
+function M.link_facebook(client, token, vars, sync_bool, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/link/facebook"
 
 	local query_params = {}
-	query_params["sync"] = sync_bool
+	if sync_bool ~= nil then
+		query_params["sync"] = sync_bool
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_facebook", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -882,17 +1936,23 @@ end
 -- Add Facebook Instant Game to the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param signedPlayerInfo (string) 
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_facebook_instant_game(client, signedPlayerInfo, vars, callback, retry_policy, cancellation_token)
+function M.link_facebook_instant_game(client, signedPlayerInfo, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not signedPlayerInfo or type(signedPlayerInfo) == "string", "Argument 'signedPlayerInfo' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/link/facebookinstantgame"
@@ -900,12 +1960,12 @@ function M.link_facebook_instant_game(client, signedPlayerInfo, vars, callback,
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	signedPlayerInfo = signedPlayerInfo,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_facebook_instant_game", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -919,14 +1979,20 @@ end
 -- @param salt (string) A random "NSString" used to compute the hash and keep it randomized.
 -- @param signature (string) The verification signature data generated.
 -- @param timestampSeconds (string) Time since UNIX epoch when the signature was created.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_game_center(client, bundleId, playerId, publicKeyUrl, salt, signature, timestampSeconds, vars, callback, retry_policy, cancellation_token)
+function M.link_game_center(client, bundleId, playerId, publicKeyUrl, salt, signature, timestampSeconds, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not bundleId or type(bundleId) == "string", "Argument 'bundleId' must be 'nil' or of type 'string'")
 	assert(not playerId or type(playerId) == "string", "Argument 'playerId' must be 'nil' or of type 'string'")
@@ -934,7 +2000,7 @@ function M.link_game_center(client, bundleId, playerId, publicKeyUrl, salt, sign
 	assert(not salt or type(salt) == "string", "Argument 'salt' must be 'nil' or of type 'string'")
 	assert(not signature or type(signature) == "string", "Argument 'signature' must be 'nil' or of type 'string'")
 	assert(not timestampSeconds or type(timestampSeconds) == "string", "Argument 'timestampSeconds' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/link/gamecenter"
@@ -942,17 +2008,17 @@ function M.link_game_center(client, bundleId, playerId, publicKeyUrl, salt, sign
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	bundleId = bundleId,
 	playerId = playerId,
 	publicKeyUrl = publicKeyUrl,
 	salt = salt,
 	signature = signature,
 	timestampSeconds = timestampSeconds,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_game_center", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -961,17 +2027,23 @@ end
 -- Add Google to the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param token (string) The OAuth token received from Google to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_google(client, token, vars, callback, retry_policy, cancellation_token)
+function M.link_google(client, token, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/link/google"
@@ -979,12 +2051,12 @@ function M.link_google(client, token, vars, callback, retry_policy, cancellation
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_google", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -999,10 +2071,16 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.link_steam(client, account, sync, callback, retry_policy, cancellation_token)
+function M.link_steam(client, account, sync, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
-	assert(not account or type(account) == "table", "Argument 'account' must be 'nil' or of type 'table'")
+	assert(not account or (type(account) == "table" and account ~= json.null), "Argument 'account' must be 'nil' or of type 'table'")
 	assert(not sync or type(sync) == "boolean", "Argument 'sync' must be 'nil' or of type 'boolean'")
 
 
@@ -1011,12 +2089,12 @@ function M.link_steam(client, account, sync, callback, retry_policy, cancellatio
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	account = account,
 	sync = sync,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "link_steam", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1025,17 +2103,23 @@ end
 -- Refresh a user's session using a refresh token retrieved from a previous authentication request.
 -- @param client Nakama client.
 -- @param token (string) Refresh token.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.session_refresh(client, token, vars, callback, retry_policy, cancellation_token)
+function M.session_refresh(client, token, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/session/refresh"
@@ -1043,12 +2127,12 @@ function M.session_refresh(client, token, vars, callback, retry_policy, cancella
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "session_refresh", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_session then
 			result = api_session.create(result)
 		end
@@ -1060,17 +2144,23 @@ end
 -- Remove the Apple ID from the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param token (string) The ID token received from Apple to validate.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_apple(client, token, vars, callback, retry_policy, cancellation_token)
+function M.unlink_apple(client, token, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/apple"
@@ -1078,12 +2168,12 @@ function M.unlink_apple(client, token, vars, callback, retry_policy, cancellatio
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_apple", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1092,17 +2182,23 @@ end
 -- Remove the custom ID from the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param id (string) A custom identifier.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_custom(client, id, vars, callback, retry_policy, cancellation_token)
+function M.unlink_custom(client, id, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not id or type(id) == "string", "Argument 'id' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/custom"
@@ -1110,12 +2206,12 @@ function M.unlink_custom(client, id, vars, callback, retry_policy, cancellation_
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	id = id,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_custom", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1124,17 +2220,23 @@ end
 -- Remove the device ID from the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param id (string) A device identifier. Should be obtained by a platform-specific device API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_device(client, id, vars, callback, retry_policy, cancellation_token)
+function M.unlink_device(client, id, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not id or type(id) == "string", "Argument 'id' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/device"
@@ -1142,12 +2244,12 @@ function M.unlink_device(client, id, vars, callback, retry_policy, cancellation_
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	id = id,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_device", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1159,18 +2261,24 @@ end
 -- @param password (string) A password for the user account.
 --
 --Ignored with unlink operations.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_email(client, email, password, vars, callback, retry_policy, cancellation_token)
+function M.unlink_email(client, email, password, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not email or type(email) == "string", "Argument 'email' must be 'nil' or of type 'string'")
 	assert(not password or type(password) == "string", "Argument 'password' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/email"
@@ -1178,13 +2286,13 @@ function M.unlink_email(client, email, password, vars, callback, retry_policy, c
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	email = email,
 	password = password,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_email", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1193,17 +2301,23 @@ end
 -- Remove Facebook from the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param token (string) The OAuth token received from Facebook to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_facebook(client, token, vars, callback, retry_policy, cancellation_token)
+function M.unlink_facebook(client, token, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/facebook"
@@ -1211,12 +2325,12 @@ function M.unlink_facebook(client, token, vars, callback, retry_policy, cancella
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_facebook", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1225,17 +2339,23 @@ end
 -- Remove Facebook Instant Game profile from the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param signedPlayerInfo (string) 
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_facebook_instant_game(client, signedPlayerInfo, vars, callback, retry_policy, cancellation_token)
+function M.unlink_facebook_instant_game(client, signedPlayerInfo, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not signedPlayerInfo or type(signedPlayerInfo) == "string", "Argument 'signedPlayerInfo' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/facebookinstantgame"
@@ -1243,12 +2363,12 @@ function M.unlink_facebook_instant_game(client, signedPlayerInfo, vars, callback
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	signedPlayerInfo = signedPlayerInfo,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_facebook_instant_game", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1262,14 +2382,20 @@ end
 -- @param salt (string) A random "NSString" used to compute the hash and keep it randomized.
 -- @param signature (string) The verification signature data generated.
 -- @param timestampSeconds (string) Time since UNIX epoch when the signature was created.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_game_center(client, bundleId, playerId, publicKeyUrl, salt, signature, timestampSeconds, vars, callback, retry_policy, cancellation_token)
+function M.unlink_game_center(client, bundleId, playerId, publicKeyUrl, salt, signature, timestampSeconds, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not bundleId or type(bundleId) == "string", "Argument 'bundleId' must be 'nil' or of type 'string'")
 	assert(not playerId or type(playerId) == "string", "Argument 'playerId' must be 'nil' or of type 'string'")
@@ -1277,7 +2403,7 @@ function M.unlink_game_center(client, bundleId, playerId, publicKeyUrl, salt, si
 	assert(not salt or type(salt) == "string", "Argument 'salt' must be 'nil' or of type 'string'")
 	assert(not signature or type(signature) == "string", "Argument 'signature' must be 'nil' or of type 'string'")
 	assert(not timestampSeconds or type(timestampSeconds) == "string", "Argument 'timestampSeconds' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/gamecenter"
@@ -1285,17 +2411,17 @@ function M.unlink_game_center(client, bundleId, playerId, publicKeyUrl, salt, si
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	bundleId = bundleId,
 	playerId = playerId,
 	publicKeyUrl = publicKeyUrl,
 	salt = salt,
 	signature = signature,
 	timestampSeconds = timestampSeconds,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_game_center", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1304,17 +2430,23 @@ end
 -- Remove Google from the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param token (string) The OAuth token received from Google to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_google(client, token, vars, callback, retry_policy, cancellation_token)
+function M.unlink_google(client, token, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/google"
@@ -1322,12 +2454,12 @@ function M.unlink_google(client, token, vars, callback, retry_policy, cancellati
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_google", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1336,17 +2468,23 @@ end
 -- Remove Steam from the social profiles on the current user's account.
 -- @param client Nakama client.
 -- @param token (string) The account token received from Steam to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.unlink_steam(client, token, vars, callback, retry_policy, cancellation_token)
+function M.unlink_steam(client, token, vars, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/account/unlink/steam"
@@ -1354,12 +2492,12 @@ function M.unlink_steam(client, token, vars, callback, retry_policy, cancellatio
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "unlink_steam", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1375,21 +2513,33 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_channel_messages(client, channel_id_str, limit_int, forward_bool, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_channel_messages(client, channel_id_str, limit_int, forward_bool, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/channel/{channelId}"
-	url_path = url_path:gsub("{channelId}", uri_encode(channel_id_str))
+	url_path = replace_path_param(url_path, "channelId", channel_id_str)
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["forward"] = forward_bool
-	query_params["cursor"] = cursor_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if forward_bool ~= nil then
+		query_params["forward"] = forward_bool
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_channel_messages", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_channel_message_list then
 			result = api_channel_message_list.create(result)
 		end
@@ -1402,19 +2552,25 @@ end
 -- @param client Nakama client.
 -- @param external (boolean) True if the event came directly from a client call, false otherwise.
 -- @param name (string) An event name, type, category, or identifier.
--- @param properties (object) Arbitrary event property values.
+-- @param properties (table) Map with values of type 'string'. Arbitrary event property values.
 -- @param timestamp (string) The time when the event was triggered.
 
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.event(client, external, name, properties, timestamp, callback, retry_policy, cancellation_token)
+function M.event(client, external, name, properties, timestamp, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not external or type(external) == "boolean", "Argument 'external' must be 'nil' or of type 'boolean'")
 	assert(not name or type(name) == "string", "Argument 'name' must be 'nil' or of type 'string'")
-	assert(not properties or type(properties) == "table", "Argument 'properties' must be 'nil' or of type 'table'")
+	assert(not properties or (type(properties) == "table" and properties ~= json.null), "Argument 'properties' must be 'nil' or of type 'table'")
 	assert(not timestamp or type(timestamp) == "string", "Argument 'timestamp' must be 'nil' or of type 'string'")
 
 
@@ -1423,14 +2579,14 @@ function M.event(client, external, name, properties, timestamp, callback, retry_
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	external = external,
 	name = name,
-	properties = properties,
+	properties = map_arg("properties", properties, "string"),
 	timestamp = timestamp,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "event", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1444,19 +2600,29 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.delete_friends(client, ids_arr, usernames_arr, callback, retry_policy, cancellation_token)
+function M.delete_friends(client, ids_arr, usernames_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/friend"
 
 	local query_params = {}
-	query_params["ids"] = ids_arr
-	query_params["usernames"] = usernames_arr
+	if ids_arr ~= nil then
+		query_params["ids"] = ids_arr
+	end
+	if usernames_arr ~= nil then
+		query_params["usernames"] = usernames_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "delete_friends", callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1471,20 +2637,32 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_friends(client, limit_int, state_int, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_friends(client, limit_int, state_int, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/friend"
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["state"] = state_int
-	query_params["cursor"] = cursor_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if state_int ~= nil then
+		query_params["state"] = state_int
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_friends", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_friend_list then
 			result = api_friend_list.create(result)
 		end
@@ -1501,19 +2679,29 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.add_friends(client, ids_arr, usernames_arr, callback, retry_policy, cancellation_token)
+function M.add_friends(client, ids_arr, usernames_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/friend"
 
 	local query_params = {}
-	query_params["ids"] = ids_arr
-	query_params["usernames"] = usernames_arr
+	if ids_arr ~= nil then
+		query_params["ids"] = ids_arr
+	end
+	if usernames_arr ~= nil then
+		query_params["usernames"] = usernames_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "add_friends", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1527,19 +2715,29 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.block_friends(client, ids_arr, usernames_arr, callback, retry_policy, cancellation_token)
+function M.block_friends(client, ids_arr, usernames_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/friend/block"
 
 	local query_params = {}
-	query_params["ids"] = ids_arr
-	query_params["usernames"] = usernames_arr
+	if ids_arr ~= nil then
+		query_params["ids"] = ids_arr
+	end
+	if usernames_arr ~= nil then
+		query_params["usernames"] = usernames_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "block_friends", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1548,32 +2746,40 @@ end
 -- Import Facebook friends and add them to a user's account.
 -- @param client Nakama client.
 -- @param token (string) The OAuth token received from Facebook to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param reset_bool () Reset the current user's friends list.
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.import_facebook_friends(client, token, vars, reset_bool, callback, retry_policy, cancellation_token)
+function M.import_facebook_friends(client, token, vars, reset_bool, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/friend/facebook"
 
 	local query_params = {}
-	query_params["reset"] = reset_bool
+	if reset_bool ~= nil then
+		query_params["reset"] = reset_bool
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "import_facebook_friends", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1582,32 +2788,40 @@ end
 -- Import Steam friends and add them to a user's account.
 -- @param client Nakama client.
 -- @param token (string) The account token received from Steam to access their profile API.
--- @param vars (object) Extra information that will be bundled in the session token.
+-- @param vars (table) Map with values of type 'string'. Extra information that will be bundled in the session token.
 
 -- @param reset_bool () Reset the current user's friends list.
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.import_steam_friends(client, token, vars, reset_bool, callback, retry_policy, cancellation_token)
+function M.import_steam_friends(client, token, vars, reset_bool, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
-	assert(not vars or type(vars) == "table", "Argument 'vars' must be 'nil' or of type 'table'")
+	assert(not vars or (type(vars) == "table" and vars ~= json.null), "Argument 'vars' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/friend/steam"
 
 	local query_params = {}
-	query_params["reset"] = reset_bool
+	if reset_bool ~= nil then
+		query_params["reset"] = reset_bool
+	end
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	token = token,
-	vars = vars,
+	vars = map_arg("vars", vars, "string"),
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "import_steam_friends", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1625,23 +2839,41 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_groups(client, name_str, cursor_str, limit_int, lang_tag_str, members_int, open_bool, callback, retry_policy, cancellation_token)
+function M.list_groups(client, name_str, cursor_str, limit_int, lang_tag_str, members_int, open_bool, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group"
 
 	local query_params = {}
-	query_params["name"] = name_str
-	query_params["cursor"] = cursor_str
-	query_params["limit"] = limit_int
-	query_params["langTag"] = lang_tag_str
-	query_params["members"] = members_int
-	query_params["open"] = open_bool
-
-	local post_data = nil
+	if name_str ~= nil then
+		query_params["name"] = name_str
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if lang_tag_str ~= nil then
+		query_params["langTag"] = lang_tag_str
+	end
+	if members_int ~= nil then
+		query_params["members"] = members_int
+	end
+	if open_bool ~= nil then
+		query_params["open"] = open_bool
+	end
+
+	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_groups", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_group_list then
 			result = api_group_list.create(result)
 		end
@@ -1663,8 +2895,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.create_group(client, avatarUrl, description, langTag, maxCount, name, open, callback, retry_policy, cancellation_token)
+function M.create_group(client, avatarUrl, description, langTag, maxCount, name, open, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not avatarUrl or type(avatarUrl) == "string", "Argument 'avatarUrl' must be 'nil' or of type 'string'")
 	assert(not description or type(description) == "string", "Argument 'description' must be 'nil' or of type 'string'")
@@ -1679,7 +2917,7 @@ function M.create_group(client, avatarUrl, description, langTag, maxCount, name,
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	avatarUrl = avatarUrl,
 	description = description,
 	langTag = langTag,
@@ -1688,7 +2926,7 @@ function M.create_group(client, avatarUrl, description, langTag, maxCount, name,
 	open = open,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "create_group", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_group then
 			result = api_group.create(result)
 		end
@@ -1704,18 +2942,24 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.delete_group(client, group_id_str, callback, retry_policy, cancellation_token)
+function M.delete_group(client, group_id_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "delete_group", callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1729,21 +2973,27 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.update_group(client, group_id_str, body, callback, retry_policy, cancellation_token)
+function M.update_group(client, group_id_str, body, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
-	assert(body and type(body) == "object", "Argument 'body' must be of type 'object'")
+	assert(body and type(body) == "table", "Argument 'body' must be of type 'table'")
 
 	local url_path = "/v2/group/{groupId}"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
 	post_data = json.encode(body)
 
-	return http(client, callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "update_group", callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1757,19 +3007,27 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.add_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token)
+function M.add_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}/add"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
-	query_params["userIds"] = user_ids_arr
+	if user_ids_arr ~= nil then
+		query_params["userIds"] = user_ids_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "add_group_users", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1783,19 +3041,27 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.ban_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token)
+function M.ban_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}/ban"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
-	query_params["userIds"] = user_ids_arr
+	if user_ids_arr ~= nil then
+		query_params["userIds"] = user_ids_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "ban_group_users", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1809,19 +3075,27 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.demote_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token)
+function M.demote_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}/demote"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
-	query_params["userIds"] = user_ids_arr
+	if user_ids_arr ~= nil then
+		query_params["userIds"] = user_ids_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "demote_group_users", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1834,18 +3108,24 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.join_group(client, group_id_str, callback, retry_policy, cancellation_token)
+function M.join_group(client, group_id_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}/join"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "join_group", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1859,19 +3139,27 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.kick_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token)
+function M.kick_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}/kick"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
-	query_params["userIds"] = user_ids_arr
+	if user_ids_arr ~= nil then
+		query_params["userIds"] = user_ids_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "kick_group_users", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1884,18 +3172,24 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.leave_group(client, group_id_str, callback, retry_policy, cancellation_token)
+function M.leave_group(client, group_id_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}/leave"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "leave_group", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1909,19 +3203,27 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.promote_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token)
+function M.promote_group_users(client, group_id_str, user_ids_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}/promote"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
-	query_params["userIds"] = user_ids_arr
+	if user_ids_arr ~= nil then
+		query_params["userIds"] = user_ids_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "promote_group_users", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -1937,21 +3239,33 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_group_users(client, group_id_str, limit_int, state_int, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_group_users(client, group_id_str, limit_int, state_int, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/group/{groupId}/user"
-	url_path = url_path:gsub("{groupId}", uri_encode(group_id_str))
+	url_path = replace_path_param(url_path, "groupId", group_id_str)
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["state"] = state_int
-	query_params["cursor"] = cursor_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if state_int ~= nil then
+		query_params["state"] = state_int
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_group_users", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_group_user_list then
 			result = api_group_user_list.create(result)
 		end
@@ -1969,8 +3283,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.validate_purchase_apple(client, persist, receipt, callback, retry_policy, cancellation_token)
+function M.validate_purchase_apple(client, persist, receipt, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not persist or type(persist) == "boolean", "Argument 'persist' must be 'nil' or of type 'boolean'")
 	assert(not receipt or type(receipt) == "string", "Argument 'receipt' must be 'nil' or of type 'string'")
@@ -1981,12 +3301,12 @@ function M.validate_purchase_apple(client, persist, receipt, callback, retry_pol
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	persist = persist,
 	receipt = receipt,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "validate_purchase_apple", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_validate_purchase_response then
 			result = api_validate_purchase_response.create(result)
 		end
@@ -2004,8 +3324,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.validate_purchase_facebook_instant(client, persist, signedRequest, callback, retry_policy, cancellation_token)
+function M.validate_purchase_facebook_instant(client, persist, signedRequest, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not persist or type(persist) == "boolean", "Argument 'persist' must be 'nil' or of type 'boolean'")
 	assert(not signedRequest or type(signedRequest) == "string", "Argument 'signedRequest' must be 'nil' or of type 'string'")
@@ -2016,12 +3342,12 @@ function M.validate_purchase_facebook_instant(client, persist, signedRequest, ca
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	persist = persist,
 	signedRequest = signedRequest,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "validate_purchase_facebook_instant", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_validate_purchase_response then
 			result = api_validate_purchase_response.create(result)
 		end
@@ -2039,8 +3365,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.validate_purchase_google(client, persist, purchase, callback, retry_policy, cancellation_token)
+function M.validate_purchase_google(client, persist, purchase, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not persist or type(persist) == "boolean", "Argument 'persist' must be 'nil' or of type 'boolean'")
 	assert(not purchase or type(purchase) == "string", "Argument 'purchase' must be 'nil' or of type 'string'")
@@ -2051,12 +3383,12 @@ function M.validate_purchase_google(client, persist, purchase, callback, retry_p
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	persist = persist,
 	purchase = purchase,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "validate_purchase_google", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_validate_purchase_response then
 			result = api_validate_purchase_response.create(result)
 		end
@@ -2075,8 +3407,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.validate_purchase_huawei(client, persist, purchase, signature, callback, retry_policy, cancellation_token)
+function M.validate_purchase_huawei(client, persist, purchase, signature, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not persist or type(persist) == "boolean", "Argument 'persist' must be 'nil' or of type 'boolean'")
 	assert(not purchase or type(purchase) == "string", "Argument 'purchase' must be 'nil' or of type 'string'")
@@ -2088,13 +3426,13 @@ function M.validate_purchase_huawei(client, persist, purchase, signature, callba
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	persist = persist,
 	purchase = purchase,
 	signature = signature,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "validate_purchase_huawei", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_validate_purchase_response then
 			result = api_validate_purchase_response.create(result)
 		end
@@ -2112,8 +3450,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_subscriptions(client, cursor, limit, callback, retry_policy, cancellation_token)
+function M.list_subscriptions(client, cursor, limit, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not cursor or type(cursor) == "string", "Argument 'cursor' must be 'nil' or of type 'string'")
 	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
@@ -2124,12 +3468,12 @@ function M.list_subscriptions(client, cursor, limit, callback, retry_policy, can
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	cursor = cursor,
 	limit = limit,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_subscriptions", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_subscription_list then
 			result = api_subscription_list.create(result)
 		end
@@ -2147,8 +3491,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.validate_subscription_apple(client, persist, receipt, callback, retry_policy, cancellation_token)
+function M.validate_subscription_apple(client, persist, receipt, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not persist or type(persist) == "boolean", "Argument 'persist' must be 'nil' or of type 'boolean'")
 	assert(not receipt or type(receipt) == "string", "Argument 'receipt' must be 'nil' or of type 'string'")
@@ -2159,12 +3509,12 @@ function M.validate_subscription_apple(client, persist, receipt, callback, retry
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	persist = persist,
 	receipt = receipt,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "validate_subscription_apple", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_validate_subscription_response then
 			result = api_validate_subscription_response.create(result)
 		end
@@ -2182,8 +3532,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.validate_subscription_google(client, persist, receipt, callback, retry_policy, cancellation_token)
+function M.validate_subscription_google(client, persist, receipt, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not persist or type(persist) == "boolean", "Argument 'persist' must be 'nil' or of type 'boolean'")
 	assert(not receipt or type(receipt) == "string", "Argument 'receipt' must be 'nil' or of type 'string'")
@@ -2194,12 +3550,12 @@ function M.validate_subscription_google(client, persist, receipt, callback, retr
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	persist = persist,
 	receipt = receipt,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "validate_subscription_google", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_validate_subscription_response then
 			result = api_validate_subscription_response.create(result)
 		end
@@ -2215,18 +3571,24 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.get_subscription(client, product_id_str, callback, retry_policy, cancellation_token)
+function M.get_subscription(client, product_id_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/iap/subscription/{productId}"
-	url_path = url_path:gsub("{productId}", uri_encode(product_id_str))
+	url_path = replace_path_param(url_path, "productId", product_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "get_subscription", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_validated_subscription then
 			result = api_validated_subscription.create(result)
 		end
@@ -2242,18 +3604,24 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.delete_leaderboard_record(client, leaderboard_id_str, callback, retry_policy, cancellation_token)
+function M.delete_leaderboard_record(client, leaderboard_id_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/leaderboard/{leaderboardId}"
-	url_path = url_path:gsub("{leaderboardId}", uri_encode(leaderboard_id_str))
+	url_path = replace_path_param(url_path, "leaderboardId", leaderboard_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "delete_leaderboard_record", callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -2270,22 +3638,36 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_leaderboard_records(client, leaderboard_id_str, owner_ids_arr, limit_int, cursor_str, expiry_str, callback, retry_policy, cancellation_token)
+function M.list_leaderboard_records(client, leaderboard_id_str, owner_ids_arr, limit_int, cursor_str, expiry_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/leaderboard/{leaderboardId}"
-	url_path = url_path:gsub("{leaderboardId}", uri_encode(leaderboard_id_str))
+	url_path = replace_path_param(url_path, "leaderboardId", leaderboard_id_str)
 
 	local query_params = {}
-	query_params["ownerIds"] = owner_ids_arr
-	query_params["limit"] = limit_int
-	query_params["cursor"] = cursor_str
-	query_params["expiry"] = expiry_str
+	if owner_ids_arr ~= nil then
+		query_params["ownerIds"] = owner_ids_arr
+	end
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
+	if expiry_str ~= nil then
+		query_params["expiry"] = expiry_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_leaderboard_records", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_leaderboard_record_list then
 			result = api_leaderboard_record_list.create(result)
 		end
@@ -2306,8 +3688,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.write_leaderboard_record(client, leaderboard_id_str, metadata, operator, score, subscore, callback, retry_policy, cancellation_token)
+function M.write_leaderboard_record(client, leaderboard_id_str, metadata, operator, score, subscore, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not metadata or type(metadata) == "string", "Argument 'metadata' must be 'nil' or of type 'string'")
 	assert(not operator or type(operator) == "string", "Argument 'operator' must be 'nil' or of type 'string'")
@@ -2316,19 +3704,19 @@ function M.write_leaderboard_record(client, leaderboard_id_str, metadata, operat
 
 
 	local url_path = "/v2/leaderboard/{leaderboardId}"
-	url_path = url_path:gsub("{leaderboardId}", uri_encode(leaderboard_id_str))
+	url_path = replace_path_param(url_path, "leaderboardId", leaderboard_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	metadata = metadata,
 	operator = operator,
 	score = score,
 	subscore = subscore,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "write_leaderboard_record", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_leaderboard_record then
 			result = api_leaderboard_record.create(result)
 		end
@@ -2348,22 +3736,34 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_leaderboard_records_around_owner(client, leaderboard_id_str, owner_id_str, limit_int, expiry_str, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_leaderboard_records_around_owner(client, leaderboard_id_str, owner_id_str, limit_int, expiry_str, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/leaderboard/{leaderboardId}/owner/{ownerId}"
-	url_path = url_path:gsub("{leaderboardId}", uri_encode(leaderboard_id_str))
-	url_path = url_path:gsub("{ownerId}", uri_encode(owner_id_str))
+	url_path = replace_path_param(url_path, "leaderboardId", leaderboard_id_str)
+	url_path = replace_path_param(url_path, "ownerId", owner_id_str)
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["expiry"] = expiry_str
-	query_params["cursor"] = cursor_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if expiry_str ~= nil then
+		query_params["expiry"] = expiry_str
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_leaderboard_records_around_owner", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_leaderboard_record_list then
 			result = api_leaderboard_record_list.create(result)
 		end
@@ -2384,23 +3784,41 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_matches(client, limit_int, authoritative_bool, label_str, min_size_int, max_size_int, query_str, callback, retry_policy, cancellation_token)
+function M.list_matches(client, limit_int, authoritative_bool, label_str, min_size_int, max_size_int, query_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/match"
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["authoritative"] = authoritative_bool
-	query_params["label"] = label_str
-	query_params["minSize"] = min_size_int
-	query_params["maxSize"] = max_size_int
-	query_params["query"] = query_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if authoritative_bool ~= nil then
+		query_params["authoritative"] = authoritative_bool
+	end
+	if label_str ~= nil then
+		query_params["label"] = label_str
+	end
+	if min_size_int ~= nil then
+		query_params["minSize"] = min_size_int
+	end
+	if max_size_int ~= nil then
+		query_params["maxSize"] = max_size_int
+	end
+	if query_str ~= nil then
+		query_params["query"] = query_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_matches", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_match_list then
 			result = api_match_list.create(result)
 		end
@@ -2416,18 +3834,26 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.delete_notifications(client, ids_arr, callback, retry_policy, cancellation_token)
+function M.delete_notifications(client, ids_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/notification"
 
 	local query_params = {}
-	query_params["ids"] = ids_arr
+	if ids_arr ~= nil then
+		query_params["ids"] = ids_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "delete_notifications", callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -2443,19 +3869,29 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_notifications(client, limit_int, cacheable_cursor_str, callback, retry_policy, cancellation_token)
+function M.list_notifications(client, limit_int, cacheable_cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/notification"
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["cacheableCursor"] = cacheable_cursor_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if cacheable_cursor_str ~= nil then
+		query_params["cacheableCursor"] = cacheable_cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_notifications", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_notification_list then
 			result = api_notification_list.create(result)
 		end
@@ -2473,20 +3909,30 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.rpc_func2(client, id_str, payload_str, http_key_str, callback, retry_policy, cancellation_token)
+function M.rpc_func2(client, id_str, payload_str, http_key_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/rpc/{id}"
-	url_path = url_path:gsub("{id}", uri_encode(id_str))
+	url_path = replace_path_param(url_path, "id", id_str)
 
 	local query_params = {}
-	query_params["payload"] = payload_str
-	query_params["httpKey"] = http_key_str
+	if payload_str ~= nil then
+		query_params["payload"] = payload_str
+	end
+	if http_key_str ~= nil then
+		query_params["httpKey"] = http_key_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "rpc_func2", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_rpc then
 			result = api_rpc.create(result)
 		end
@@ -2498,28 +3944,36 @@ end
 -- Execute a Lua function on the server.
 -- @param client Nakama client.
 -- @param id_str () The identifier of the function.
--- @param body (string) The payload of the function which must be a JSON object.
+-- @param payload (string) The payload of the function which must be a JSON object.
 -- @param http_key_str () The authentication key used when executed as a non-client HTTP request.
 -- @param callback Optional callback function
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.rpc_func(client, id_str, payload, http_key_str, callback, retry_policy, cancellation_token)
+function M.rpc_func(client, id_str, payload, http_key_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
-	assert(body and type(body) == "string", "Argument 'body' must be of type 'string'")
+	assert(payload and type(payload) == "string", "Argument 'payload' must be of type 'string'")
 
 	local url_path = "/v2/rpc/{id}"
-	url_path = url_path:gsub("{id}", uri_encode(id_str))
+	url_path = replace_path_param(url_path, "id", id_str)
 
 	local query_params = {}
-	query_params["httpKey"] = http_key_str
+	if http_key_str ~= nil then
+		query_params["httpKey"] = http_key_str
+	end
 
 	local post_data = nil
-	post_data = json.encode(body)
+	post_data = json.encode(payload)
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "rpc_func", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_rpc then
 			result = api_rpc.create(result)
 		end
@@ -2537,8 +3991,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.session_logout(client, refreshToken, token, callback, retry_policy, cancellation_token)
+function M.session_logout(client, refreshToken, token, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not refreshToken or type(refreshToken) == "string", "Argument 'refreshToken' must be 'nil' or of type 'string'")
 	assert(not token or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
@@ -2549,12 +4009,12 @@ function M.session_logout(client, refreshToken, token, callback, retry_policy, c
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	refreshToken = refreshToken,
 	token = token,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "session_logout", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -2568,10 +4028,16 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.read_storage_objects(client, objectIds, callback, retry_policy, cancellation_token)
+function M.read_storage_objects(client, objectIds, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
-	assert(not objectIds or type(objectIds) == "table", "Argument 'objectIds' must be 'nil' or of type 'table'")
+	assert(not objectIds or (type(objectIds) == "table" and objectIds ~= json.null), "Argument 'objectIds' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/storage"
@@ -2579,11 +4045,11 @@ function M.read_storage_objects(client, objectIds, callback, retry_policy, cance
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	objectIds = objectIds,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "read_storage_objects", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_storage_objects then
 			result = api_storage_objects.create(result)
 		end
@@ -2600,10 +4066,16 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.write_storage_objects(client, objects, callback, retry_policy, cancellation_token)
+function M.write_storage_objects(client, objects, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
-	assert(not objects or type(objects) == "table", "Argument 'objects' must be 'nil' or of type 'table'")
+	assert(not objects or (type(objects) == "table" and objects ~= json.null), "Argument 'objects' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/storage"
@@ -2611,11 +4083,11 @@ function M.write_storage_objects(client, objects, callback, retry_policy, cancel
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	objects = objects,
 	})
 
-	return http(client, callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "write_storage_objects", callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_storage_object_acks then
 			result = api_storage_object_acks.create(result)
 		end
@@ -2632,10 +4104,16 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.delete_storage_objects(client, objectIds, callback, retry_policy, cancellation_token)
+function M.delete_storage_objects(client, objectIds, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
-	assert(not objectIds or type(objectIds) == "table", "Argument 'objectIds' must be 'nil' or of type 'table'")
+	assert(not objectIds or (type(objectIds) == "table" and objectIds ~= json.null), "Argument 'objectIds' must be 'nil' or of type 'table'")
 
 
 	local url_path = "/v2/storage/delete"
@@ -2643,11 +4121,11 @@ function M.delete_storage_objects(client, objectIds, callback, retry_policy, can
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	objectIds = objectIds,
 	})
 
-	return http(client, callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "delete_storage_objects", callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -2665,21 +4143,33 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_storage_objects(client, collection_str, user_id_str, limit_int, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_storage_objects(client, collection_str, user_id_str, limit_int, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/storage/{collection}"
-	url_path = url_path:gsub("{collection}", uri_encode(collection_str))
+	url_path = replace_path_param(url_path, "collection", collection_str)
 
 	local query_params = {}
-	query_params["userId"] = user_id_str
-	query_params["limit"] = limit_int
-	query_params["cursor"] = cursor_str
+	if user_id_str ~= nil then
+		query_params["userId"] = user_id_str
+	end
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_storage_objects", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_storage_object_list then
 			result = api_storage_object_list.create(result)
 		end
@@ -2700,21 +4190,31 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_storage_objects2(client, collection_str, user_id_str, limit_int, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_storage_objects2(client, collection_str, user_id_str, limit_int, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/storage/{collection}/{userId}"
-	url_path = url_path:gsub("{collection}", uri_encode(collection_str))
-	url_path = url_path:gsub("{userId}", uri_encode(user_id_str))
+	url_path = replace_path_param(url_path, "collection", collection_str)
+	url_path = replace_path_param(url_path, "userId", user_id_str)
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["cursor"] = cursor_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_storage_objects2", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_storage_object_list then
 			result = api_storage_object_list.create(result)
 		end
@@ -2735,23 +4235,41 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_tournaments(client, category_start_int, category_end_int, start_time_int, end_time_int, limit_int, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_tournaments(client, category_start_int, category_end_int, start_time_int, end_time_int, limit_int, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/tournament"
 
 	local query_params = {}
-	query_params["categoryStart"] = category_start_int
-	query_params["categoryEnd"] = category_end_int
-	query_params["startTime"] = start_time_int
-	query_params["endTime"] = end_time_int
-	query_params["limit"] = limit_int
-	query_params["cursor"] = cursor_str
+	if category_start_int ~= nil then
+		query_params["categoryStart"] = category_start_int
+	end
+	if category_end_int ~= nil then
+		query_params["categoryEnd"] = category_end_int
+	end
+	if start_time_int ~= nil then
+		query_params["startTime"] = start_time_int
+	end
+	if end_time_int ~= nil then
+		query_params["endTime"] = end_time_int
+	end
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_tournaments", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_tournament_list then
 			result = api_tournament_list.create(result)
 		end
@@ -2767,18 +4285,24 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.delete_tournament_record(client, tournament_id_str, callback, retry_policy, cancellation_token)
+function M.delete_tournament_record(client, tournament_id_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/tournament/{tournamentId}"
-	url_path = url_path:gsub("{tournamentId}", uri_encode(tournament_id_str))
+	url_path = replace_path_param(url_path, "tournamentId", tournament_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "delete_tournament_record", callback, url_path, query_params, "DELETE", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -2795,22 +4319,36 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_tournament_records(client, tournament_id_str, owner_ids_arr, limit_int, cursor_str, expiry_str, callback, retry_policy, cancellation_token)
+function M.list_tournament_records(client, tournament_id_str, owner_ids_arr, limit_int, cursor_str, expiry_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/tournament/{tournamentId}"
-	url_path = url_path:gsub("{tournamentId}", uri_encode(tournament_id_str))
+	url_path = replace_path_param(url_path, "tournamentId", tournament_id_str)
 
 	local query_params = {}
-	query_params["ownerIds"] = owner_ids_arr
-	query_params["limit"] = limit_int
-	query_params["cursor"] = cursor_str
-	query_params["expiry"] = expiry_str
+	if owner_ids_arr ~= nil then
+		query_params["ownerIds"] = owner_ids_arr
+	end
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
+	if expiry_str ~= nil then
+		query_params["expiry"] = expiry_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_tournament_records", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_tournament_record_list then
 			result = api_tournament_record_list.create(result)
 		end
@@ -2831,8 +4369,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.write_tournament_record2(client, tournament_id_str, metadata, operator, score, subscore, callback, retry_policy, cancellation_token)
+function M.write_tournament_record2(client, tournament_id_str, metadata, operator, score, subscore, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not metadata or type(metadata) == "string", "Argument 'metadata' must be 'nil' or of type 'string'")
 	assert(not operator or type(operator) == "string", "Argument 'operator' must be 'nil' or of type 'string'")
@@ -2841,19 +4385,19 @@ function M.write_tournament_record2(client, tournament_id_str, metadata, operato
 
 
 	local url_path = "/v2/tournament/{tournamentId}"
-	url_path = url_path:gsub("{tournamentId}", uri_encode(tournament_id_str))
+	url_path = replace_path_param(url_path, "tournamentId", tournament_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	metadata = metadata,
 	operator = operator,
 	score = score,
 	subscore = subscore,
 	})
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "write_tournament_record2", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_leaderboard_record then
 			result = api_leaderboard_record.create(result)
 		end
@@ -2874,8 +4418,14 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.write_tournament_record(client, tournament_id_str, metadata, operator, score, subscore, callback, retry_policy, cancellation_token)
+function M.write_tournament_record(client, tournament_id_str, metadata, operator, score, subscore, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 	assert(not metadata or type(metadata) == "string", "Argument 'metadata' must be 'nil' or of type 'string'")
 	assert(not operator or type(operator) == "string", "Argument 'operator' must be 'nil' or of type 'string'")
@@ -2884,19 +4434,19 @@ function M.write_tournament_record(client, tournament_id_str, metadata, operator
 
 
 	local url_path = "/v2/tournament/{tournamentId}"
-	url_path = url_path:gsub("{tournamentId}", uri_encode(tournament_id_str))
+	url_path = replace_path_param(url_path, "tournamentId", tournament_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
-	post_data = json.encode({
+	post_data = encode_body({
 	metadata = metadata,
 	operator = operator,
 	score = score,
 	subscore = subscore,
 	})
 
-	return http(client, callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "write_tournament_record", callback, url_path, query_params, "PUT", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_leaderboard_record then
 			result = api_leaderboard_record.create(result)
 		end
@@ -2912,18 +4462,24 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.join_tournament(client, tournament_id_str, callback, retry_policy, cancellation_token)
+function M.join_tournament(client, tournament_id_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/tournament/{tournamentId}/join"
-	url_path = url_path:gsub("{tournamentId}", uri_encode(tournament_id_str))
+	url_path = replace_path_param(url_path, "tournamentId", tournament_id_str)
 
 	local query_params = {}
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "join_tournament", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, opts, function(result)
 		return result
 	end)
 end
@@ -2940,22 +4496,34 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_tournament_records_around_owner(client, tournament_id_str, owner_id_str, limit_int, expiry_str, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_tournament_records_around_owner(client, tournament_id_str, owner_id_str, limit_int, expiry_str, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/tournament/{tournamentId}/owner/{ownerId}"
-	url_path = url_path:gsub("{tournamentId}", uri_encode(tournament_id_str))
-	url_path = url_path:gsub("{ownerId}", uri_encode(owner_id_str))
+	url_path = replace_path_param(url_path, "tournamentId", tournament_id_str)
+	url_path = replace_path_param(url_path, "ownerId", owner_id_str)
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["expiry"] = expiry_str
-	query_params["cursor"] = cursor_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if expiry_str ~= nil then
+		query_params["expiry"] = expiry_str
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_tournament_records_around_owner", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_tournament_record_list then
 			result = api_tournament_record_list.create(result)
 		end
@@ -2973,20 +4541,32 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.get_users(client, ids_arr, usernames_arr, facebook_ids_arr, callback, retry_policy, cancellation_token)
+function M.get_users(client, ids_arr, usernames_arr, facebook_ids_arr, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/user"
 
 	local query_params = {}
-	query_params["ids"] = ids_arr
-	query_params["usernames"] = usernames_arr
-	query_params["facebookIds"] = facebook_ids_arr
+	if ids_arr ~= nil then
+		query_params["ids"] = ids_arr
+	end
+	if usernames_arr ~= nil then
+		query_params["usernames"] = usernames_arr
+	end
+	if facebook_ids_arr ~= nil then
+		query_params["facebookIds"] = facebook_ids_arr
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "get_users", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_users then
 			result = api_users.create(result)
 		end
@@ -3005,21 +4585,33 @@ end
 -- A coroutine is used and the result is returned if no callback function is provided.
 -- @param retry_policy Optional retry policy used specifically for this call or nil
 -- @param cancellation_token Optional cancellation token for this call
+-- @param opts Optional table of options for this call:
+-- opts.timeout - Timeout in seconds for this request instead of config.timeout.
+-- opts.log - Set to false to not log this request.
+-- opts.correlation_id - Correlation id to send with this request instead of a generated one.
+-- opts.idempotency_key - Key identifying a mutation, to return the result of an earlier request with the same key instead of making it again.
+-- opts.headers - Table of additional headers to send with this request.
 -- @return The result.
-function M.list_user_groups(client, user_id_str, limit_int, state_int, cursor_str, callback, retry_policy, cancellation_token)
+function M.list_user_groups(client, user_id_str, limit_int, state_int, cursor_str, callback, retry_policy, cancellation_token, opts)
 	assert(client, "You must provide a client")
 
 	local url_path = "/v2/user/{userId}/group"
-	url_path = url_path:gsub("{userId}", uri_encode(user_id_str))
+	url_path = replace_path_param(url_path, "userId", user_id_str)
 
 	local query_params = {}
-	query_params["limit"] = limit_int
-	query_params["state"] = state_int
-	query_params["cursor"] = cursor_str
+	if limit_int ~= nil then
+		query_params["limit"] = limit_int
+	end
+	if state_int ~= nil then
+		query_params["state"] = state_int
+	end
+	if cursor_str ~= nil then
+		query_params["cursor"] = cursor_str
+	end
 
 	local post_data = nil
 
-	return http(client, callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, function(result)
+	return http(client, "list_user_groups", callback, url_path, query_params, "GET", post_data, retry_policy, cancellation_token, opts, function(result)
 		if not result.error and api_user_group_list then
 			result = api_user_group_list.create(result)
 		end
@@ -3027,4 +4619,1593 @@ function M.list_user_groups(client, user_id_str, limit_int, state_int, cursor_st
 	end)
 end
 
+--
+-- Helpers
+--
+
+local unpack = _G.unpack or table.unpack
+
+-- call an API function and pass the result through a transform function
+-- before it is returned or passed to the callback
+-- @param api_fn The API function to call
+-- @param transform_fn Function to transform the result with
+-- @param callback Optional callback function
+-- @param retry_policy Optional retry policy
+-- @param cancellation_token Optional cancellation token
+-- @param ... Arguments to the API function (including the client)
+local function call_and_transform(api_fn, transform_fn, callback, retry_policy, cancellation_token, ...)
+	local args = { ... }
+	local count = select("#", ...)
+	if callback then
+		args[count + 1] = function(result) callback(transform_fn(result)) end
+	end
+	args[count + 2] = retry_policy
+	args[count + 3] = cancellation_token
+	if callback then
+		return api_fn(unpack(args, 1, count + 3))
+	end
+	return transform_fn(api_fn(unpack(args, 1, count + 3)))
+end
+
+-- run a function making a sequence of requests, eg in batches, so that the
+-- requests are stopped when the cancellation token is cancelled. The function
+-- is run in a coroutine using nakama.sync() with the token, the same as a
+-- sequence of requests of the user. The callback isn't called when the token
+-- has been cancelled, while nil is returned to a calling coroutine.
+-- @param fn The function making the requests and returning the result.
+-- @param callback Optional callback function, or nil to return the result to
+-- the running coroutine.
+-- @param cancellation_token Optional cancellation token.
+-- @return The result when called without a callback.
+local function run_cancellable(fn, callback, cancellation_token)
+	local function cancelled()
+		return cancellation_token and cancellation_token.cancelled
+	end
+	if callback then
+		M.sync(function()
+			local result = fn()
+			if not cancelled() then
+				callback(result)
+			end
+		end, cancellation_token)
+		return
+	end
+	assert(coroutine.running(), "You must be running this from within a coroutine")
+	-- the requests use the token of the running coroutine without a token
+	if not cancellation_token then
+		return fn()
+	end
+	if cancelled() then
+		return nil
+	end
+	return async(function(done)
+		local finished = false
+		local on_cancel
+		local function finish(result)
+			if finished then return end
+			finished = true
+			for i,f in ipairs(cancellation_token.on_cancel) do
+				if f == on_cancel then
+					table.remove(cancellation_token.on_cancel, i)
+					break
+				end
+			end
+			done(result)
+		end
+		on_cancel = function() finish(nil) end
+		table.insert(cancellation_token.on_cancel, on_cancel)
+		M.sync(function()
+			finish(fn())
+		end, cancellation_token)
+	end)
+end
+
+-- decode the JSON metadata of a leaderboard or tournament record
+local function decode_record_metadata(record)
+	if record and type(record.metadata) == "string" and record.metadata ~= "" then
+		local ok, metadata = pcall(json.decode, record.metadata)
+		if ok then
+			record.metadata = metadata
+		end
+	end
+	return record
+end
+
+-- decode the JSON metadata of all records in a record list
+local function decode_record_list_metadata(result)
+	if result and not result.error then
+		for _,record in ipairs(result.records or {}) do
+			decode_record_metadata(record)
+		end
+		for _,record in ipairs(result.owner_records or {}) do
+			decode_record_metadata(record)
+		end
+	end
+	return result
+end
+
+--- rpc_httpkey
+-- Execute a function on the server using the http key instead of a session.
+-- @param client Nakama client.
+-- @param id (string) The identifier of the function.
+-- @param payload (table|string) Optional payload of the function. Tables are JSON encoded.
+-- @param http_key (string) Optional http key. Defaults to config.http_key.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.rpc_httpkey(client, id, payload, http_key, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(id) == "string", "Argument 'id' must be of type 'string'")
+	assert(not payload or type(payload) == "table" or type(payload) == "string", "Argument 'payload' must be 'nil' or of type 'table' or 'string'")
+	http_key = http_key or client.config.http_key
+	assert(type(http_key) == "string", "You must provide an http key or set config.http_key")
+	if type(payload) == "table" then
+		payload = json.encode(payload)
+	end
+	return M.rpc_func2(client, id, payload, nil, callback, retry_policy, cancellation_token, { http_key = http_key })
+end
+
+--- rpc
+-- Execute a function on the server with a payload of any content type.
+-- JSON payloads are sent the same way as by rpc_func(). Other payloads are
+-- sent as they are, with the content type of the payload, and the response
+-- is passed on as it is unless it has a JSON content type.
+-- @param client Nakama client.
+-- @param id (string) The identifier of the function.
+-- @param payload (table|string) Optional payload of the function. Tables are JSON encoded.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @param opts (table) Optional table of options: content_type (default
+-- "application/json") and the options of the generated functions (eg log).
+-- @return The result, with the response in result.payload.
+function M.rpc(client, id, payload, callback, retry_policy, cancellation_token, opts)
+	assert(client, "You must provide a client")
+	assert(type(id) == "string", "Argument 'id' must be of type 'string'")
+	assert(not payload or type(payload) == "table" or type(payload) == "string", "Argument 'payload' must be 'nil' or of type 'table' or 'string'")
+	assert(not opts or type(opts) == "table", "Argument 'opts' must be 'nil' or of type 'table'")
+	opts = opts or {}
+	local content_type = opts.content_type or "application/json"
+	local is_json = content_type:find("json") ~= nil
+	assert(is_json or type(payload) ~= "table", "A table payload must be sent with a JSON content type")
+
+	local url_path = replace_path_param("/v2/rpc/{id}", "id", id)
+	local query_params = {}
+	local post_data = nil
+	if is_json then
+		-- the server expects the JSON payload as a JSON encoded string
+		if type(payload) == "table" then
+			payload = json.encode(payload)
+		end
+		post_data = json.encode(payload or "")
+	else
+		-- let the server pass the payload on as it is
+		query_params["unwrap"] = "true"
+		post_data = payload or ""
+	end
+	local request_opts = {}
+	for name,value in pairs(opts) do
+		request_opts[name] = value
+	end
+	request_opts.headers = {}
+	for name,value in pairs(opts.headers or {}) do
+		request_opts.headers[name] = value
+	end
+	request_opts.headers["Content-Type"] = content_type
+
+	return http(client, "rpc", callback, url_path, query_params, "POST", post_data, retry_policy, cancellation_token, request_opts, function(result)
+		-- a response which isn't JSON is passed on as a string by the engine
+		if type(result) == "string" or (not is_json and not result.error) then
+			return { id = id, payload = result }
+		end
+		return result
+	end)
+end
+
+--- tournament_join
+-- Join a tournament.
+-- @param client Nakama client.
+-- @param tournament_id (string) The ID of the tournament to join.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.tournament_join(client, tournament_id, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(tournament_id) == "string", "Argument 'tournament_id' must be of type 'string'")
+	return M.join_tournament(client, tournament_id, callback, retry_policy, cancellation_token)
+end
+
+--- tournament_list
+-- List tournaments. Defaults to a limit of 10 tournaments.
+-- @param client Nakama client.
+-- @param category_start (number) Optional start of the category range.
+-- @param category_end (number) Optional end of the category range.
+-- @param start_time (number) Optional start time (seconds since epoch).
+-- @param end_time (number) Optional end time (seconds since epoch).
+-- @param limit (number) Optional max number of tournaments to return.
+-- @param cursor (string) Optional next page cursor.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.tournament_list(client, category_start, category_end, start_time, end_time, limit, cursor, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(not category_start or type(category_start) == "number", "Argument 'category_start' must be 'nil' or of type 'number'")
+	assert(not category_end or type(category_end) == "number", "Argument 'category_end' must be 'nil' or of type 'number'")
+	assert(not start_time or type(start_time) == "number", "Argument 'start_time' must be 'nil' or of type 'number'")
+	assert(not end_time or type(end_time) == "number", "Argument 'end_time' must be 'nil' or of type 'number'")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not cursor or type(cursor) == "string", "Argument 'cursor' must be 'nil' or of type 'string'")
+	return M.list_tournaments(client, category_start, category_end, start_time, end_time, limit or 10, cursor, callback, retry_policy, cancellation_token)
+end
+
+--- tournament_record_write
+-- Write a record to a tournament. The metadata is JSON encoded before it is
+-- sent and decoded again in the returned record.
+-- @param client Nakama client.
+-- @param tournament_id (string) The ID of the tournament to write the record for.
+-- @param score (number) The score value to submit. Must be an integer.
+-- @param subscore (number) Optional secondary value. Must be an integer.
+-- @param metadata (table) Optional record metadata.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.tournament_record_write(client, tournament_id, score, subscore, metadata, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(tournament_id) == "string", "Argument 'tournament_id' must be of type 'string'")
+	assert(type(score) == "number" and math.floor(score) == score, "Argument 'score' must be an integer")
+	assert(not subscore or (type(subscore) == "number" and math.floor(subscore) == subscore), "Argument 'subscore' must be 'nil' or an integer")
+	assert(not metadata or type(metadata) == "table", "Argument 'metadata' must be 'nil' or of type 'table'")
+	local encoded_metadata = metadata and json.encode(metadata) or nil
+	-- tostring() would use an exponent for large scores
+	local encoded_subscore = subscore and ("%d"):format(subscore) or nil
+	return call_and_transform(M.write_tournament_record, decode_record_metadata, callback, retry_policy, cancellation_token,
+		client, tournament_id, encoded_metadata, nil, ("%d"):format(score), encoded_subscore)
+end
+
+--- tournament_records_list
+-- List tournament records with the record metadata decoded. Use the
+-- next_cursor of the result to fetch the next page. Defaults to a limit of
+-- 10 records.
+-- @param client Nakama client.
+-- @param tournament_id (string) The ID of the tournament to list records for.
+-- @param owner_ids (table) Optional list of owners to retrieve records for.
+-- @param limit (number) Optional max number of records to return.
+-- @param cursor (string) Optional next or previous page cursor.
+-- @param expiry (number) Optional expiry in seconds (since epoch) to begin fetching records from.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.tournament_records_list(client, tournament_id, owner_ids, limit, cursor, expiry, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(tournament_id) == "string", "Argument 'tournament_id' must be of type 'string'")
+	assert(not owner_ids or type(owner_ids) == "table", "Argument 'owner_ids' must be 'nil' or of type 'table'")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not cursor or type(cursor) == "string", "Argument 'cursor' must be 'nil' or of type 'string'")
+	assert(not expiry or type(expiry) == "number", "Argument 'expiry' must be 'nil' or of type 'number'")
+	local encoded_expiry = expiry and tostring(expiry) or nil
+	return call_and_transform(M.list_tournament_records, decode_record_list_metadata, callback, retry_policy, cancellation_token,
+		client, tournament_id, owner_ids, limit or 10, cursor, encoded_expiry)
+end
+
+--- tournament_records_iter
+-- Iterate over the records of a tournament, getting the pages of records
+-- using the next_cursor of the previous page, with the record metadata
+-- decoded. Must be called from a coroutine, eg using nakama.sync(). The
+-- iteration stops when there are no more records, when a request fails or
+-- when the cancellation token is cancelled.
+-- @param client Nakama client.
+-- @param tournament_id (string) The ID of the tournament to list records for.
+-- @param limit (number) Optional number of records per page. Defaults to 10.
+-- @param opts (table) Optional options with any of cursor (string, the cursor
+-- to start from), expiry (number, expiry in seconds since epoch to begin
+-- fetching records from), on_error (function called with the error result of
+-- a failed request), retry_policy and cancellation_token.
+-- @return Iterator function returning the next record.
+function M.tournament_records_iter(client, tournament_id, limit, opts)
+	assert(client, "You must provide a client")
+	assert(type(tournament_id) == "string", "Argument 'tournament_id' must be of type 'string'")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not opts or type(opts) == "table", "Argument 'opts' must be 'nil' or of type 'table'")
+	opts = opts or {}
+	local co = coroutine.running()
+	assert(co, "You must be running this from within a coroutine")
+
+	local cursor = opts.cursor
+	local records = {}
+	local index = 0
+	local done = false
+
+	local function cancelled()
+		local token = opts.cancellation_token or cancellation_tokens[co]
+		return token and token.cancelled
+	end
+
+	-- get the next page, returns false if there are no more records
+	local function next_page()
+		if cancelled() then
+			return false
+		end
+		local result = M.tournament_records_list(client, tournament_id, nil, limit, cursor, opts.expiry, nil, opts.retry_policy, opts.cancellation_token)
+		if not result or cancelled() then
+			return false
+		end
+		if result.error then
+			log("tournament_records_iter()", result.message)
+			if opts.on_error then
+				opts.on_error(result)
+			end
+			return false
+		end
+		records = result.records or {}
+		index = 0
+		local next_cursor = result.next_cursor
+		-- stop after this page if there is no cursor to get the next one
+		if not next_cursor or next_cursor == "" or next_cursor == cursor then
+			done = true
+		end
+		cursor = next_cursor
+		return #records > 0
+	end
+
+	return function()
+		if cancelled() then
+			return nil
+		end
+		index = index + 1
+		if index > #records then
+			if done or not next_page() then
+				records = {}
+				done = true
+				return nil
+			end
+			index = 1
+		end
+		return records[index]
+	end
+end
+
+--- The max number of owners to list leaderboard records for per request, see
+-- leaderboard_records_by_owners().
+M.LEADERBOARD_OWNERS_PER_REQUEST = 100
+
+--- leaderboard_records_by_owners
+-- List the leaderboard records of a set of owners, eg the members of a guild,
+-- with the record metadata decoded. The owners are listed in batches of
+-- M.LEADERBOARD_OWNERS_PER_REQUEST, one request at a time, and the records of
+-- all batches are merged. Owners without a record are left out.
+-- @param client Nakama client.
+-- @param leaderboard_id (string) The ID of the leaderboard to list records for.
+-- @param owner_ids (table) List of owners to retrieve records for.
+-- @param expiry (number) Optional expiry in seconds (since epoch) to begin fetching records from.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return Table with the 'records' of the owners ordered by rank, or the
+-- error result of the first batch which failed.
+function M.leaderboard_records_by_owners(client, leaderboard_id, owner_ids, expiry, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(leaderboard_id) == "string", "Argument 'leaderboard_id' must be of type 'string'")
+	assert(type(owner_ids) == "table", "Argument 'owner_ids' must be of type 'table'")
+	assert(not expiry or type(expiry) == "number", "Argument 'expiry' must be 'nil' or of type 'number'")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+
+	-- split the owners into batches, without duplicates
+	local batches = {}
+	local seen = {}
+	for i,owner_id in ipairs(owner_ids) do
+		assert(type(owner_id) == "string" and owner_id ~= "", ("Owner id %d must be a non-empty string"):format(i))
+		if not seen[owner_id] then
+			seen[owner_id] = true
+			local batch = batches[#batches]
+			if not batch or #batch == M.LEADERBOARD_OWNERS_PER_REQUEST then
+				batch = {}
+				table.insert(batches, batch)
+			end
+			table.insert(batch, owner_id)
+		end
+	end
+	local encoded_expiry = expiry and tostring(expiry) or nil
+
+	local function list()
+		local records = {}
+		for _,batch in ipairs(batches) do
+			if cancellation_token and cancellation_token.cancelled then
+				return nil
+			end
+			-- without a limit only the records of the owners are listed
+			local result = M.list_leaderboard_records(client, leaderboard_id, batch, nil, nil, encoded_expiry, nil, retry_policy, cancellation_token)
+			if not result or result.error then
+				return result
+			end
+			for _,record in ipairs(result.owner_records or {}) do
+				table.insert(records, decode_record_metadata(record))
+			end
+		end
+		table.sort(records, function(a, b)
+			return (tonumber(a.rank) or math.huge) < (tonumber(b.rank) or math.huge)
+		end)
+		return { records = records }
+	end
+
+	return run_cancellable(list, callback, cancellation_token)
+end
+
+-- check that a storage object id has a collection and key
+local function assert_storage_object_id(object_id, i)
+	assert(type(object_id) == "table", ("Storage object %d must be a table"):format(i))
+	assert(type(object_id.collection) == "string", ("Storage object %d must have a 'collection' of type 'string'"):format(i))
+	assert(type(object_id.key) == "string", ("Storage object %d must have a 'key' of type 'string'"):format(i))
+	assert(not object_id.version or type(object_id.version) == "string", ("Storage object %d must have a 'version' of type 'nil' or 'string'"):format(i))
+end
+
+-- get the value of a storage permission provided as a number or as a name,
+-- eg "public" or "STORAGE_PERMISSION_READ_PUBLIC" for M.STORAGE_PERMISSION_READ_PUBLIC
+local function storage_permission(permission, access, name, i)
+	if type(permission) ~= "string" then
+		assert(not permission or type(permission) == "number", ("Storage object %d must have a '%s' of type 'nil', 'number' or 'string'"):format(i, name))
+		return permission
+	end
+	local prefix = "STORAGE_PERMISSION_" .. access .. "_"
+	local suffix = permission:upper():gsub("^" .. prefix, "")
+	local value = M[prefix .. suffix]
+	assert(value, ("Storage object %d has an unknown '%s' '%s'"):format(i, name, permission))
+	return value
+end
+
+--- storage_write_many
+-- Write multiple storage objects in a single request.
+-- @param client Nakama client.
+-- @param objects (table) List of objects to write. Each object must have a
+-- collection, key and value (table or JSON string) and may have a version,
+-- permission_read and permission_write. The permissions are numbers or names,
+-- eg M.STORAGE_PERMISSION_READ_PUBLIC, "STORAGE_PERMISSION_READ_PUBLIC" or
+-- "public".
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.storage_write_many(client, objects, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(objects) == "table" and #objects > 0, "Argument 'objects' must be a non-empty list")
+	local write_objects = {}
+	for i,object in ipairs(objects) do
+		assert_storage_object_id(object, i)
+		assert(type(object.value) == "table" or type(object.value) == "string", ("Storage object %d must have a 'value' of type 'table' or 'string'"):format(i))
+		write_objects[i] = {
+			collection = object.collection,
+			key = object.key,
+			value = type(object.value) == "table" and json.encode(object.value) or object.value,
+			version = object.version,
+			permissionRead = storage_permission(object.permission_read, "READ", "permission_read", i),
+			permissionWrite = storage_permission(object.permission_write, "WRITE", "permission_write", i),
+		}
+	end
+	return M.write_storage_objects(client, write_objects, callback, retry_policy, cancellation_token)
+end
+
+--- storage_delete_many
+-- Delete multiple storage objects in a single request.
+-- @param client Nakama client.
+-- @param object_ids (table) List of object ids to delete. Each object id must
+-- have a collection and key and may have a version.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.storage_delete_many(client, object_ids, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(object_ids) == "table" and #object_ids > 0, "Argument 'object_ids' must be a non-empty list")
+	local delete_object_ids = {}
+	for i,object_id in ipairs(object_ids) do
+		assert_storage_object_id(object_id, i)
+		delete_object_ids[i] = {
+			collection = object_id.collection,
+			key = object_id.key,
+			version = object_id.version,
+		}
+	end
+	return M.delete_storage_objects(client, delete_object_ids, callback, retry_policy, cancellation_token)
+end
+
+-- check if a storage write was rejected because the object has been changed
+-- since it was read
+local function is_version_conflict(result)
+	if not result.error then
+		return false
+	end
+	return result.code == M.codes.ABORTED or tostring(result.message):find("version check failed") ~= nil
+end
+
+--- storage_update
+-- Update a storage object of the user with a read-modify-write. The current
+-- value is read and passed to an update function and the new value is written
+-- with the version which was read. If the object has been changed by another
+-- write in the meantime the read-modify-write is retried.
+-- @param client Nakama client.
+-- @param collection (string) The collection of the object.
+-- @param key (string) The key of the object.
+-- @param update_fn (function) Function called with the current value (table)
+-- or nil if the object doesn't exist. Must return the new value (table).
+-- Objects with integer keys in the value have number keys if
+-- config.storage_integer_keys is "array".
+-- @param max_retries (number) Optional max number of retries when there is a
+-- conflict. Defaults to 3.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result of the write. An error result with code "storage_conflict"
+-- is returned if the object was changed on every attempt.
+function M.storage_update(client, collection, key, update_fn, max_retries, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(collection) == "string", "Argument 'collection' must be of type 'string'")
+	assert(type(key) == "string", "Argument 'key' must be of type 'string'")
+	assert(type(update_fn) == "function", "Argument 'update_fn' must be of type 'function'")
+	assert(not max_retries or type(max_retries) == "number", "Argument 'max_retries' must be 'nil' or of type 'number'")
+	max_retries = max_retries or 3
+
+	local function update()
+		local user_id = client.config.bearer_token and api_session.create({ token = client.config.bearer_token }).user_id
+		for _=0,max_retries do
+			if cancellation_token and cancellation_token.cancelled then
+				return nil
+			end
+			local result = M.read_storage_objects(client, { { collection = collection, key = key, userId = user_id } }, nil, retry_policy, cancellation_token)
+			if not result or result.error then
+				return result
+			end
+			local object = result.objects and result.objects[1]
+			local value = object and object.value and json.decode(object.value, { integer_keys = client.config.storage_integer_keys })
+			local new_value = update_fn(value)
+			assert(type(new_value) == "table", "The update function must return a table")
+			result = M.storage_write_many(client, { {
+				collection = collection,
+				key = key,
+				value = new_value,
+				-- "*" only writes the object if it doesn't exist
+				version = object and object.version or "*",
+				permission_read = object and object.permission_read,
+				permission_write = object and object.permission_write,
+			} }, nil, retry_policy, cancellation_token)
+			if not result or not is_version_conflict(result) then
+				return result
+			end
+			log("storage_update() conflict", collection, key)
+		end
+		return { error = true, code = "storage_conflict", message = ("Unable to update %s/%s, the object was changed on every attempt"):format(collection, key) }
+	end
+
+	return run_cancellable(update, callback, cancellation_token)
+end
+
+--- The default chunk size in bytes of storage_write_large().
+M.DEFAULT_STORAGE_CHUNK_SIZE = 256 * 1024
+
+-- call an rpc of the chunked upload protocol of storage_write_large() and
+-- decode the JSON payload of the response
+local function storage_upload_rpc(client, rpc_id, payload, retry_policy, cancellation_token)
+	local result = M.rpc_func(client, rpc_id, json.encode(payload), nil, nil, retry_policy, cancellation_token, { log = false })
+	if not result or result.error then
+		return result
+	end
+	local ok, decoded = pcall(json.decode, result.payload or "")
+	if not ok or type(decoded) ~= "table" then
+		return { error = true, message = "Invalid response of storage upload rpc " .. rpc_id }
+	end
+	return decoded
+end
+
+--- storage_write_large
+-- Write a large storage object of the user, in chunks which can be resumed if
+-- an rpc implementing the chunked upload protocol is given, or else as a
+-- single write which is retried with the retry policy.
+--
+-- The chunked upload protocol is a server rpc called with a JSON payload with
+-- an 'action', and which responds with a JSON payload:
+--
+-- * { action = "begin", collection, key, size, version, permission_read,
+-- permission_write, upload_id } starts an upload session, or resumes the
+-- session with the upload_id if given and still known by the server. Responds
+-- with { upload_id, offset } where offset is the number of bytes received.
+-- * { action = "chunk", upload_id, offset, data } adds the base64 encoded
+-- bytes of the JSON value from the offset. A chunk which has already been
+-- received must be accepted again. Responds with { offset }.
+-- * { action = "commit", upload_id } writes the object when all bytes have
+-- been received. Responds with the ack of the object { collection, key,
+-- version, user_id }.
+-- @param client Nakama client.
+-- @param collection (string) The collection of the object.
+-- @param key (string) The key of the object.
+-- @param value (table|string) The value of the object (table or JSON string).
+-- @param opts Optional table of options:
+-- opts.rpc - Id of the rpc implementing the chunked upload protocol.
+-- opts.chunk_size - Max number of bytes per chunk (default M.DEFAULT_STORAGE_CHUNK_SIZE).
+-- Values up to the chunk size are written as a single write.
+-- opts.upload_id - Id of an upload session to resume, from the error result of an earlier call.
+-- opts.on_progress - Function called with the bytes sent and the total bytes.
+-- opts.version, opts.permission_read, opts.permission_write - As in storage_write_many().
+-- opts.callback - Optional callback function. A coroutine is used and the
+-- result is returned if no callback function is provided.
+-- opts.retry_policy - Optional retry policy used for each request.
+-- opts.cancellation_token - Optional cancellation token for this call.
+-- @return The result with the 'acks' of the written object. Error results of
+-- chunked uploads have the 'upload_id' and 'offset' of the session to resume.
+function M.storage_write_large(client, collection, key, value, opts)
+	assert(client, "You must provide a client")
+	assert(type(collection) == "string", "Argument 'collection' must be of type 'string'")
+	assert(type(key) == "string", "Argument 'key' must be of type 'string'")
+	assert(type(value) == "table" or type(value) == "string", "Argument 'value' must be of type 'table' or 'string'")
+	opts = opts or {}
+	assert(not opts.rpc or type(opts.rpc) == "string", "Option 'rpc' must be 'nil' or of type 'string'")
+	assert(not opts.chunk_size or (type(opts.chunk_size) == "number" and opts.chunk_size >= 1), "Option 'chunk_size' must be 'nil' or a positive number")
+	assert(not opts.on_progress or type(opts.on_progress) == "function", "Option 'on_progress' must be 'nil' or of type 'function'")
+
+	local data = type(value) == "table" and json.encode(value) or value
+	local chunk_size = opts.chunk_size or M.DEFAULT_STORAGE_CHUNK_SIZE
+	local retry_policy = opts.retry_policy
+	local cancellation_token = opts.cancellation_token
+	local on_progress = opts.on_progress or function() end
+	local function cancelled()
+		return cancellation_token and cancellation_token.cancelled
+	end
+
+	local function write_single()
+		on_progress(0, #data)
+		local result = M.storage_write_many(client, { {
+			collection = collection,
+			key = key,
+			value = data,
+			version = opts.version,
+			permission_read = opts.permission_read,
+			permission_write = opts.permission_write,
+		} }, nil, retry_policy, cancellation_token)
+		if result and not result.error then
+			on_progress(#data, #data)
+		end
+		return result
+	end
+
+	local function write_chunks()
+		local session = storage_upload_rpc(client, opts.rpc, {
+			action = "begin",
+			collection = collection,
+			key = key,
+			size = #data,
+			version = opts.version,
+			permission_read = storage_permission(opts.permission_read, "READ", "permission_read", 1),
+			permission_write = storage_permission(opts.permission_write, "WRITE", "permission_write", 1),
+			upload_id = opts.upload_id,
+		}, retry_policy, cancellation_token)
+		if not session or session.error then
+			return session
+		end
+		local upload_id = session.upload_id
+		local offset = session.offset or 0
+		if cancelled() then
+			return nil
+		end
+		on_progress(offset, #data)
+		while offset < #data do
+			local chunk = data:sub(offset + 1, offset + chunk_size)
+			local result = storage_upload_rpc(client, opts.rpc, {
+				action = "chunk",
+				upload_id = upload_id,
+				offset = offset,
+				data = b64.encode(chunk),
+			}, retry_policy, cancellation_token)
+			if not result or result.error then
+				result = result or { error = true }
+				result.upload_id = upload_id
+				result.offset = offset
+				return result
+			end
+			offset = result.offset or (offset + #chunk)
+			if cancelled() then
+				return nil
+			end
+			on_progress(offset, #data)
+		end
+		local ack = storage_upload_rpc(client, opts.rpc, { action = "commit", upload_id = upload_id }, retry_policy, cancellation_token)
+		if not ack or ack.error then
+			ack = ack or { error = true }
+			ack.upload_id = upload_id
+			ack.offset = offset
+			return ack
+		end
+		return { acks = { ack } }
+	end
+
+	local function write()
+		if opts.rpc and #data > chunk_size then
+			return write_chunks()
+		end
+		return write_single()
+	end
+
+	return run_cancellable(write, opts.callback, cancellation_token)
+end
+
+-- decode the JSON wallet of an account into a table of currencies and amounts
+local function decode_wallet(result)
+	if not result or result.error then
+		return result
+	end
+	local wallet = {}
+	if type(result.wallet) == "string" and result.wallet ~= "" then
+		local ok, decoded = pcall(json.decode, result.wallet)
+		if ok and type(decoded) == "table" then
+			for currency,amount in pairs(decoded) do
+				wallet[currency] = tonumber(amount)
+			end
+		end
+	end
+	return wallet
+end
+
+--- get_wallet
+-- Get the wallet of the current user as a table of currencies and amounts.
+-- @param client Nakama client.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The wallet, eg { gold = 100, gems = 5 }, or an error result.
+function M.get_wallet(client, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	return call_and_transform(M.get_account, function(result)
+		return decode_wallet(result)
+	end, callback, retry_policy, cancellation_token, client)
+end
+
+--- wallet_update_local
+-- Apply a changeset to the wallet cached in a session, without fetching the
+-- account again. Currencies missing from the wallet start at 0 and negative
+-- amounts in the changeset are subtracted.
+-- @param session The session with the cached wallet (session.wallet). The
+-- wallet is created if the session doesn't have one.
+-- @param changeset (table) Currencies and amounts to add, eg { gold = -10, gems = 1 }.
+-- @return The updated wallet.
+function M.wallet_update_local(session, changeset)
+	assert(type(session) == "table", "You must provide a session")
+	assert(type(changeset) == "table", "Argument 'changeset' must be of type 'table'")
+	session.wallet = session.wallet or {}
+	for currency,amount in pairs(changeset) do
+		assert(type(amount) == "number", ("The amount of '%s' must be a number"):format(tostring(currency)))
+		session.wallet[currency] = (session.wallet[currency] or 0) + amount
+	end
+	return session.wallet
+end
+
+-- decode the JSON content of the notifications in a notification list
+local function decode_notification_list(result)
+	if result and not result.error then
+		for _,notification in ipairs(result.notifications or {}) do
+			if type(notification.content) == "string" and notification.content ~= "" then
+				local ok, content = pcall(json.decode, notification.content)
+				if ok then
+					notification.content = content
+				end
+			end
+		end
+	end
+	return result
+end
+
+--- notifications_list
+-- List notifications of the current user with the JSON content of each
+-- notification decoded.
+-- @param client Nakama client.
+-- @param limit (number) Optional number of notifications to get. Between 1 and 100.
+-- @param cacheable_cursor (string) Optional cursor to get notifications from.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.notifications_list(client, limit, cacheable_cursor, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	return call_and_transform(M.list_notifications, decode_notification_list, callback, retry_policy, cancellation_token, client, limit, cacheable_cursor)
+end
+
+-- decode the JSON label of the matches in a match list, keeping labels which
+-- aren't valid JSON as they are
+local function decode_match_list(result)
+	if result and not result.error then
+		for _,match in ipairs(result.matches or {}) do
+			if type(match.label) == "string" and match.label ~= "" then
+				local ok, label = pcall(json.decode, match.label)
+				if ok then
+					match.label = label
+				end
+			end
+		end
+	end
+	return result
+end
+
+--- match_list
+-- List running matches with the JSON label of each match decoded. Labels
+-- which aren't valid JSON are returned as they are.
+-- @param client Nakama client.
+-- @param limit (number) Optional max number of matches to list.
+-- @param authoritative (boolean) Optional authoritative or relayed matches only.
+-- @param label (string) Optional label to filter the matches by.
+-- @param min_size (number) Optional min number of players in a match.
+-- @param max_size (number) Optional max number of players in a match.
+-- @param query (string) Optional query of the match label, eg "+label.mode:ranked".
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.match_list(client, limit, authoritative, label, min_size, max_size, query, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	return call_and_transform(M.list_matches, decode_match_list, callback, retry_policy, cancellation_token,
+		client, limit, authoritative, label, min_size, max_size, query)
+end
+
+--- logout
+-- Log out the user. The session is invalidated on the server, including its
+-- refresh token if a session is provided, and the sockets of the client are
+-- disconnected. The bearer token and the cached responses of the client are
+-- cleared, as well as the session stored using session.store() when running
+-- in Defold, and config.on_auth_lost is called, also when the server failed to
+-- invalidate the session. A session with a token which has expired is already
+-- logged out and is not an error.
+-- @param client Nakama client.
+-- @param session (table) Optional session to log out, eg a restored session.
+-- Defaults to the bearer token of the client.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.logout(client, session, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(not session or type(session) == "table", "Argument 'session' must be 'nil' or of type 'table'")
+	local token = session and session.token or client.config.bearer_token
+	local refresh_token = session and session.refresh_token
+
+	-- check if the token has expired, in which case the server rejects it
+	local function token_expired()
+		if session and session.expires then
+			return api_session.is_token_expired(session, client.clock)
+		end
+		local _, reason = api_session.validate(token, client.clock)
+		return reason == "expired"
+	end
+
+	local function clear(result)
+		for s,_ in pairs(client.sockets) do
+			s.disconnect()
+		end
+		client.config.bearer_token = nil
+		client.response_cache.invalidate()
+		if sys then
+			api_session.clear()
+		end
+		if client.config.on_auth_lost then
+			client.config.on_auth_lost()
+		end
+		if result and result.error and result.code == M.codes.UNAUTHENTICATED and token_expired() then
+			return {}
+		end
+		return result
+	end
+
+	if not token then
+		local result = clear({})
+		if callback then
+			callback(result)
+			return
+		end
+		return result
+	end
+	-- authenticate the request using the token of the session to log out
+	client.config.bearer_token = token
+	return call_and_transform(M.session_logout, clear, callback, retry_policy, cancellation_token,
+		client, refresh_token, token)
+end
+
+--- notifications_delete
+-- Delete multiple notifications in a single request.
+-- @param client Nakama client.
+-- @param notification_ids (table) List of ids of the notifications to delete.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.notifications_delete(client, notification_ids, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(notification_ids) == "table" and #notification_ids > 0, "Argument 'notification_ids' must be a non-empty list")
+	for i,id in ipairs(notification_ids) do
+		assert(type(id) == "string", ("Notification id %d must be of type 'string'"):format(i))
+	end
+	return M.delete_notifications(client, notification_ids, callback, retry_policy, cancellation_token)
+end
+
+--- notifications_filter
+-- Filter a list of notifications without making a request.
+-- @param notifications (table) List of notifications, eg from notifications_list().
+-- @param filter (table) Optional filter with any of code (number), sender_id
+-- (string) and unread (boolean, only include notifications which haven't
+-- been marked as read using notifications_mark_read()).
+-- @return List of the notifications matching the filter.
+function M.notifications_filter(notifications, filter)
+	assert(type(notifications) == "table", "Argument 'notifications' must be of type 'table'")
+	filter = filter or {}
+	local filtered = {}
+	for _,notification in ipairs(notifications) do
+		if (filter.code == nil or tonumber(notification.code) == filter.code)
+		and (filter.sender_id == nil or notification.sender_id == filter.sender_id)
+		and (not filter.unread or not notification.read) then
+			table.insert(filtered, notification)
+		end
+	end
+	return filtered
+end
+
+--- notifications_mark_read
+-- Mark notifications as read, without making a request. Read notifications
+-- have the field read set to true. The server doesn't keep track of read
+-- notifications.
+-- @param notifications (table) List of notifications.
+-- @param notification_ids (table) Optional list of ids of the notifications to
+-- mark. All notifications are marked if no ids are provided.
+-- @return The notifications.
+function M.notifications_mark_read(notifications, notification_ids)
+	assert(type(notifications) == "table", "Argument 'notifications' must be of type 'table'")
+	local ids = nil
+	if notification_ids then
+		ids = {}
+		for _,id in ipairs(notification_ids) do
+			ids[id] = true
+		end
+	end
+	for _,notification in ipairs(notifications) do
+		if not ids or ids[notification.id] then
+			notification.read = true
+		end
+	end
+	return notifications
+end
+
+--- notifications_iter
+-- Iterate over the notifications of the current user, getting the pages of
+-- notifications using the cursor of the previous page, with the JSON content
+-- of each notification decoded. Must be called from a coroutine, eg using
+-- nakama.sync(). The iteration stops when there are no more notifications,
+-- when a request fails or when the cancellation token is cancelled.
+-- @param client Nakama client.
+-- @param limit (number) Optional number of notifications per page. Between 1 and 100.
+-- @param opts (table) Optional options with any of cacheable_cursor (string,
+-- the cursor to start from), mark_read (boolean, mark each notification as
+-- read using notifications_mark_read()), delete (boolean, delete the
+-- notifications of a page in a single request once they have all been
+-- iterated over), on_error (function called with the error result of a
+-- failed request), retry_policy and cancellation_token.
+-- @return Iterator function returning the next notification.
+function M.notifications_iter(client, limit, opts)
+	assert(client, "You must provide a client")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not opts or type(opts) == "table", "Argument 'opts' must be 'nil' or of type 'table'")
+	opts = opts or {}
+	local co = coroutine.running()
+	assert(co, "You must be running this from within a coroutine")
+
+	local cursor = opts.cacheable_cursor
+	local notifications = {}
+	local index = 0
+	local done = false
+
+	local function cancelled()
+		local token = opts.cancellation_token or cancellation_tokens[co]
+		return token and token.cancelled
+	end
+
+	-- delete the notifications of the current page
+	local function delete_page()
+		if not opts.delete or #notifications == 0 then
+			return true
+		end
+		local ids = {}
+		for i,notification in ipairs(notifications) do
+			ids[i] = notification.id
+		end
+		local result = M.notifications_delete(client, ids, nil, opts.retry_policy, opts.cancellation_token)
+		if result and result.error and opts.on_error then
+			opts.on_error(result)
+		end
+		return result and not result.error
+	end
+
+	-- get the next page, returns false if there are no more notifications
+	local function next_page()
+		if not delete_page() or cancelled() then
+			return false
+		end
+		local result = M.notifications_list(client, limit, cursor, nil, opts.retry_policy, opts.cancellation_token)
+		if not result or cancelled() then
+			return false
+		end
+		if result.error then
+			log("notifications_iter()", result.message)
+			if opts.on_error then
+				opts.on_error(result)
+			end
+			return false
+		end
+		notifications = result.notifications or {}
+		index = 0
+		local next_cursor = result.cacheable_cursor
+		-- stop after this page if there is no cursor to get the next one
+		if not next_cursor or next_cursor == "" or next_cursor == cursor then
+			done = true
+		end
+		cursor = next_cursor
+		return #notifications > 0
+	end
+
+	return function()
+		if cancelled() then
+			return nil
+		end
+		index = index + 1
+		if index > #notifications then
+			if done then
+				delete_page()
+				notifications = {}
+				return nil
+			end
+			if not next_page() then
+				notifications = {}
+				done = true
+				return nil
+			end
+			index = 1
+		end
+		local notification = notifications[index]
+		if opts.mark_read then
+			notification.read = true
+		end
+		return notification
+	end
+end
+
+-- the arguments of the link and unlink functions for each type of account,
+-- created from the options passed to M.link() and M.unlink()
+local account_link_args = {
+	apple = function(opts) return { opts.apple, opts.vars }, 2 end,
+	custom = function(opts) return { opts.custom, opts.vars }, 2 end,
+	device = function(opts) return { opts.device, opts.vars }, 2 end,
+	email = function(opts) return { opts.email, opts.password, opts.vars }, 3 end,
+	facebook = function(opts, link)
+		if link then
+			return { opts.facebook, opts.vars, opts.sync }, 3
+		end
+		return { opts.facebook, opts.vars }, 2
+	end,
+	facebook_instant_game = function(opts) return { opts.facebook_instant_game, opts.vars }, 2 end,
+	game_center = function(opts)
+		local gc = opts.game_center
+		assert(type(gc) == "table", "Option 'game_center' must be of type 'table'")
+		return { gc.bundle_id, gc.player_id, gc.public_key_url, gc.salt, gc.signature, gc.timestamp_seconds, opts.vars }, 7
+	end,
+	google = function(opts) return { opts.google, opts.vars }, 2 end,
+	steam = function(opts, link)
+		if link then
+			return { { token = opts.steam, vars = opts.vars }, opts.sync }, 2
+		end
+		return { opts.steam, opts.vars }, 2
+	end,
+}
+
+-- call the link or unlink function for the type of account in the options
+local function account_link(client, action, opts, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(opts) == "table", "Argument 'opts' must be of type 'table'")
+	assert(client.config.bearer_token, ("You must have a session to %s an account"):format(action))
+	local account_type = nil
+	for name,_ in pairs(account_link_args) do
+		if opts[name] ~= nil then
+			assert(not account_type, ("Only one account can be %sed at a time, got '%s' and '%s'"):format(action, tostring(account_type), name))
+			account_type = name
+		end
+	end
+	assert(account_type, ("You must provide an account to %s"):format(action))
+	local args, count = account_link_args[account_type](opts, action == "link")
+	args[count + 1] = callback
+	args[count + 2] = retry_policy
+	args[count + 3] = cancellation_token
+	return M[action .. "_" .. account_type](client, unpack(args, 1, count + 3))
+end
+
+--- link
+-- Link an account to the account of the current user. The type of account is
+-- selected using the options, eg { device = id } or { email = email, password = password }.
+-- @param client Nakama client.
+-- @param opts (table) The account to link, with one of 'apple', 'custom',
+-- 'device', 'email' (and 'password'), 'facebook', 'facebook_instant_game',
+-- 'game_center' (table with 'bundle_id', 'player_id', 'public_key_url',
+-- 'salt', 'signature' and 'timestamp_seconds'), 'google' or 'steam', and
+-- optional 'vars' and 'sync' (import friends for facebook and steam).
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.link(client, opts, callback, retry_policy, cancellation_token)
+	return account_link(client, "link", opts, callback, retry_policy, cancellation_token)
+end
+
+--- unlink
+-- Unlink an account from the account of the current user. The type of account
+-- is selected using the options, see M.link().
+-- @param client Nakama client.
+-- @param opts (table) The account to unlink, see M.link().
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.unlink(client, opts, callback, retry_policy, cancellation_token)
+	return account_link(client, "unlink", opts, callback, retry_policy, cancellation_token)
+end
+
+--- import_friends
+-- Import the friends of the user on a social platform and list the friends of
+-- the user, including the imported friends.
+-- @param client Nakama client.
+-- @param provider (string) The social platform, "facebook" or "steam".
+-- @param token (string) The platform token, the Facebook access token or the
+-- Steam session ticket.
+-- @param reset (boolean) Optional. Reset the friends of the user, replacing
+-- them with the imported friends.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The friends of the user, see M.list_friends(), or an error result.
+function M.import_friends(client, provider, token, reset, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(provider == "facebook" or provider == "steam", "Argument 'provider' must be 'facebook' or 'steam'")
+	assert(type(token) == "string" and token ~= "", "You must provide a platform token")
+	assert(reset == nil or type(reset) == "boolean", "Argument 'reset' must be 'nil' or of type 'boolean'")
+
+	local function import()
+		local result = M["import_" .. provider .. "_friends"](client, token, nil, reset, nil, retry_policy, cancellation_token)
+		if not result or result.error then
+			return result
+		end
+		return M.list_friends(client, nil, nil, nil, nil, retry_policy, cancellation_token)
+	end
+
+	if callback then
+		coroutine.wrap(function()
+			callback(import())
+		end)()
+		return
+	end
+	return import()
+end
+
+--- warm_up
+-- Establish the connection to the server ahead of the first request, for
+-- instance on a login screen, to resolve the host and make the TCP and TLS
+-- handshakes before they are needed. The engine warms up the connection if it
+-- provides engine.warm_up(), otherwise a request is made to the healthcheck
+-- endpoint. Errors are ignored. Calls made while a warm-up is in progress
+-- wait for it instead of starting another one.
+-- @param client Nakama client.
+-- @param callback Optional callback function, called with true if the
+-- connection has been established and false otherwise.
+function M.warm_up(client, callback)
+	assert(client, "You must provide a client")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+	callback = callback or function() end
+	if client.warm_up_callbacks then
+		table.insert(client.warm_up_callbacks, callback)
+		return
+	end
+	client.warm_up_callbacks = { callback }
+
+	local function done(connected)
+		local callbacks = client.warm_up_callbacks
+		client.warm_up_callbacks = nil
+		log("warm_up()", connected and "connected" or "failed")
+		for _,fn in ipairs(callbacks) do
+			fn(connected)
+		end
+	end
+
+	if client.engine.warm_up then
+		client.engine.warm_up(client.config, function(connected)
+			done(connected == true)
+		end)
+		return
+	end
+	-- any response from the server, including an error response, means that
+	-- the connection has been established
+	local status
+	http(client, "warm_up", function()
+		done(status ~= nil)
+	end, "/healthcheck", {}, "GET", nil, retries.none(), nil, { log = false }, function(result, response_info)
+		status = response_info and response_info.status
+		return result
+	end)
+end
+
+-- get the major, minor and patch numbers of a version such as "3.17.1",
+-- "v3.17.1+7a3b2e4" or "3"
+local function parse_version(version)
+	local major, minor, patch = tostring(version or ""):match("^v?(%d+)%.?(%d*)%.?(%d*)")
+	if not major then
+		return nil
+	end
+	return tonumber(major), tonumber(minor) or 0, tonumber(patch) or 0
+end
+
+--- check_compatibility
+-- Check if the version of the server is compatible with the version the client
+-- was generated for (M.SERVER_VERSION). The versions are compatible if the
+-- major versions are the same. The minor and patch versions may differ.
+--
+-- Nakama doesn't report its version by default. The version is read from the
+-- JSON payload ({ version }) of the rpc config.version_rpc if it is set, or else
+-- from the 'version' of the healthcheck response or its X-Nakama-Version header,
+-- which can be added by a proxy.
+--
+-- An incompatible server is logged. If config.compatibility is "refuse" the
+-- client is also suspended and new requests fail, see M.suspend().
+-- @param client Nakama client.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @return Table with 'compatible' (true, false or nil if the server version is
+-- unknown), the 'server_version' and the 'client_version'.
+function M.check_compatibility(client, callback)
+	assert(client, "You must provide a client")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+
+	local function check(result, response_info)
+		local server_version
+		if client.config.version_rpc then
+			local ok, payload = pcall(json.decode, result and not result.error and result.payload or "")
+			server_version = ok and type(payload) == "table" and payload.version or nil
+		else
+			server_version = result and not result.error and result.version
+			for name,value in pairs(response_info and response_info.headers or {}) do
+				if not server_version and name:lower() == "x-nakama-version" then
+					server_version = value
+				end
+			end
+		end
+		local compatibility = { server_version = server_version, client_version = M.SERVER_VERSION }
+		local server_major = parse_version(server_version)
+		if not server_major then
+			log("check_compatibility() unable to get the server version")
+			return compatibility
+		end
+		compatibility.compatible = server_major == parse_version(M.SERVER_VERSION)
+		if not compatibility.compatible then
+			log("check_compatibility() the server version", server_version, "is incompatible with the client version", M.SERVER_VERSION)
+			if client.config.compatibility == "refuse" then
+				M.suspend(client, { fail_requests = true, allow = { "check_compatibility" } })
+			end
+		end
+		return compatibility
+	end
+
+	local url_path, query_params, method, post_data = "/healthcheck", {}, "GET", nil
+	if client.config.version_rpc then
+		url_path = replace_path_param("/v2/rpc/{id}", "id", client.config.version_rpc)
+		method, post_data = "POST", json.encode("{}")
+	end
+	-- the version rpc may be called before authenticating
+	local opts = { log = false, http_key_auth = client.config.version_rpc ~= nil }
+	return http(client, "check_compatibility", callback, url_path, query_params, method, post_data, retries.none(), nil, opts, check)
+end
+
+--- The states of an email or multi-factor verification, see send_verification()
+-- and verify_code().
+M.VERIFICATION_SENT = "sent"
+M.VERIFICATION_VERIFIED = "verified"
+M.VERIFICATION_INVALID = "invalid"
+M.VERIFICATION_EXPIRED = "expired"
+M.VERIFICATION_RATE_LIMITED = "rate_limited"
+M.VERIFICATION_ERROR = "error"
+
+local verification_states = {
+	[M.VERIFICATION_SENT] = true,
+	[M.VERIFICATION_VERIFIED] = true,
+	[M.VERIFICATION_INVALID] = true,
+	[M.VERIFICATION_EXPIRED] = true,
+}
+
+-- call a verification rpc and map the result to a verification state
+local function verification_rpc(client, rpc_id, payload, success_state, callback, retry_policy, cancellation_token)
+	local function verify()
+		-- an empty table would be encoded as a JSON array
+		local data = next(payload) == nil and "{}" or json.encode(payload)
+		local result = M.rpc_func(client, rpc_id, data, nil, nil, retry_policy, cancellation_token)
+		if not result then
+			return result
+		end
+		if result.error then
+			if result.code == M.codes.RESOURCE_EXHAUSTED or result.code == "rate_limited_local" then
+				return { error = true, state = M.VERIFICATION_RATE_LIMITED, code = "rate_limited", message = result.message }
+			elseif result.code == M.codes.INVALID_ARGUMENT then
+				return { state = M.VERIFICATION_INVALID, message = result.message }
+			elseif result.code == M.codes.FAILED_PRECONDITION then
+				return { state = M.VERIFICATION_EXPIRED, message = result.message }
+			end
+			result.state = M.VERIFICATION_ERROR
+			return result
+		end
+		local ok, decoded = pcall(json.decode, result.payload or "")
+		decoded = ok and type(decoded) == "table" and decoded or {}
+		local state = verification_states[decoded.state] and decoded.state or success_state
+		return { state = state, payload = decoded }
+	end
+
+	if callback then
+		coroutine.wrap(function()
+			callback(verify())
+		end)()
+		return
+	end
+	return verify()
+end
+
+--- send_verification
+-- Send a verification code to the user, eg by email, using the rpc
+-- config.verification_rpcs.send (default "send_verification"). The rpc is
+-- called with the http key if there is no session (see config.http_key).
+--
+-- Nakama doesn't provide verification, the rpc is implemented by the server of
+-- the game. The states are mapped from the result of the rpc:
+--
+-- * The 'state' of the JSON payload of the response if it is one of "sent",
+-- "verified", "invalid" or "expired", or "sent" for other successful responses
+-- * "invalid" for an INVALID_ARGUMENT error
+-- * "expired" for a FAILED_PRECONDITION error
+-- * "rate_limited" for a RESOURCE_EXHAUSTED error, as verification rpcs are
+-- commonly throttled, or if the request was rate limited by the client (see
+-- config.rate_limits)
+-- * "error" for other errors
+-- @param client Nakama client.
+-- @param payload (table) Optional payload of the rpc, eg { email = "..." }.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return Table with the 'state' and the decoded 'payload' of the response, or
+-- an error result with the 'state' "rate_limited" or "error".
+function M.send_verification(client, payload, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(not payload or type(payload) == "table", "Argument 'payload' must be 'nil' or of type 'table'")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+	return verification_rpc(client, client.config.verification_rpcs.send, payload or {}, M.VERIFICATION_SENT, callback, retry_policy, cancellation_token)
+end
+
+--- verify_code
+-- Verify a code sent to the user by send_verification(), using the rpc
+-- config.verification_rpcs.verify (default "verify_code") called with the
+-- payload { code }. The states are mapped from the result of the rpc in the
+-- same way as for send_verification(), with "verified" for successful
+-- responses without a state.
+-- @param client Nakama client.
+-- @param code (string|number) The verification code.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return Table with the 'state' and the decoded 'payload' of the response, or
+-- an error result with the 'state' "rate_limited" or "error".
+function M.verify_code(client, code, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(code) == "string" or type(code) == "number", "Argument 'code' must be of type 'string' or 'number'")
+	code = tostring(code):match("^%s*(.-)%s*$")
+	assert(code ~= "", "Argument 'code' must not be empty")
+	assert(not callback or type(callback) == "function", "Argument 'callback' must be 'nil' or of type 'function'")
+	return verification_rpc(client, client.config.verification_rpcs.verify, { code = code }, M.VERIFICATION_VERIFIED, callback, retry_policy, cancellation_token)
+end
+
+--- friends_with_status
+-- List the friends of the current user with their online status and keep the
+-- status updated. The statuses of the friends are followed using the socket,
+-- if it is connected. Friends have the online status of the listed users
+-- otherwise, which isn't updated.
+-- @param client Nakama client.
+-- @param socket Nakama socket or nil.
+-- @param limit (number) Optional max number of friends.
+-- @param on_change Optional function called with the friends when the status
+-- of a friend has changed.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return A table with a list of 'friends', each with the 'user', the friend
+-- 'state', an 'online' flag and the 'status' of the user if it is followed,
+-- and a 'stop' function which stops following the statuses, or an error result.
+function M.friends_with_status(client, socket, limit, on_change, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not on_change or type(on_change) == "function", "Argument 'on_change' must be 'nil' or of type 'function'")
+
+	local function list()
+		local result = M.list_friends(client, limit, nil, nil, nil, retry_policy, cancellation_token)
+		if not result or result.error then
+			return result
+		end
+		local view = { friends = {}, stop = function() end }
+		local by_user_id = {}
+		local user_ids = {}
+		for _,friend in ipairs(result.friends or {}) do
+			local user = friend.user or {}
+			local item = { user = user, state = friend.state, online = user.online == true }
+			table.insert(view.friends, item)
+			if user.id then
+				by_user_id[user.id] = item
+				table.insert(user_ids, user.id)
+			end
+		end
+		-- the statuses can't be followed without a connected socket
+		if not socket or not socket.has_connected or socket.reconnecting or #user_ids == 0 then
+			return view
+		end
+
+		local function update(presences, online)
+			for _,presence in ipairs(presences or {}) do
+				local item = by_user_id[presence.user_id]
+				if item then
+					item.online = online
+					item.status = online and presence.status or nil
+				end
+			end
+		end
+		local remove_handler = socket.on("status_presence_event", function(message)
+			local event = message.status_presence_event
+			-- a changed status is a leave followed by a join
+			update(event.leaves, false)
+			update(event.joins, true)
+			if on_change then
+				on_change(view.friends)
+			end
+		end)
+		view.stop = function()
+			remove_handler()
+			socket.status_unfollow(user_ids, function() end)
+		end
+
+		local follow = socket.status_follow(user_ids)
+		if follow and follow.status then
+			-- friends without a presence are offline
+			for _,item in pairs(by_user_id) do
+				item.online = false
+			end
+			update(follow.status.presences, true)
+		end
+		return view
+	end
+
+	if callback then
+		coroutine.wrap(function()
+			callback(list())
+		end)()
+		return
+	end
+	return list()
+end
+
+-- names of the states of a user in a group
+local group_state_names = {
+	[M.GROUP_STATE_SUPERADMIN] = "superadmin",
+	[M.GROUP_STATE_ADMIN] = "admin",
+	[M.GROUP_STATE_MEMBER] = "member",
+	[M.GROUP_STATE_JOIN_REQUEST] = "join_request",
+}
+
+-- get the state of a user in a group from a state or the name of a state
+local function group_state(state)
+	if type(state) == "string" then
+		for value,name in pairs(group_state_names) do
+			if name == state then
+				return value
+			end
+		end
+		error(("Unknown group state '%s'"):format(state))
+	end
+	return state
+end
+
+-- decode the JSON metadata of the groups of a user group list and add the
+-- name of the state of the user in each group
+local function decode_user_group_list(result)
+	if result and not result.error then
+		for _,user_group in ipairs(result.user_groups or {}) do
+			local group = user_group.group
+			if group and type(group.metadata) == "string" and group.metadata ~= "" then
+				local ok, metadata = pcall(json.decode, group.metadata)
+				if ok then
+					group.metadata = metadata
+				end
+			end
+			user_group.state = tonumber(user_group.state)
+			user_group.state_name = group_state_names[user_group.state]
+		end
+	end
+	return result
+end
+
+--- user_groups
+-- List the groups of a user with the metadata of each group decoded and the
+-- name of the state of the user in each group (eg "member") as state_name.
+-- Use the cursor of the result to get the next page. Defaults to a limit of
+-- 100 groups in any state.
+-- @param client Nakama client.
+-- @param user_id (string) The ID of the user.
+-- @param state (number|string) Optional state of the user in the groups, eg
+-- M.GROUP_STATE_MEMBER or "member".
+-- @param limit (number) Optional max number of groups to return. Between 1 and 100.
+-- @param cursor (string) Optional next page cursor.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.user_groups(client, user_id, state, limit, cursor, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(user_id) == "string" and user_id ~= "", "Argument 'user_id' must be a non-empty string")
+	assert(not state or type(state) == "number" or type(state) == "string", "Argument 'state' must be 'nil' or of type 'number' or 'string'")
+	assert(not limit or type(limit) == "number", "Argument 'limit' must be 'nil' or of type 'number'")
+	assert(not cursor or type(cursor) == "string", "Argument 'cursor' must be 'nil' or of type 'string'")
+	return call_and_transform(M.list_user_groups, decode_user_group_list, callback, retry_policy, cancellation_token,
+		client, user_id, limit or 100, group_state(state), cursor)
+end
+
+--- group_join
+-- Join a group, or request to join it if the group is private.
+-- @param client Nakama client.
+-- @param group_id (string) The ID of the group to join.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.group_join(client, group_id, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(group_id) == "string" and group_id ~= "", "Argument 'group_id' must be a non-empty string")
+	return M.join_group(client, group_id, callback, retry_policy, cancellation_token)
+end
+
+--- group_leave
+-- Leave a group.
+-- @param client Nakama client.
+-- @param group_id (string) The ID of the group to leave.
+-- @param callback Optional callback function
+-- A coroutine is used and the result is returned if no callback function is provided.
+-- @param retry_policy Optional retry policy used specifically for this call or nil
+-- @param cancellation_token Optional cancellation token for this call
+-- @return The result.
+function M.group_leave(client, group_id, callback, retry_policy, cancellation_token)
+	assert(client, "You must provide a client")
+	assert(type(group_id) == "string" and group_id ~= "", "Argument 'group_id' must be a non-empty string")
+	return M.leave_group(client, group_id, callback, retry_policy, cancellation_token)
+end
+
 return M
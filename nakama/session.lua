@@ -8,26 +8,88 @@ Create and check Nakama sessions.
 local b64 = require "nakama.util.b64"
 local json = require "nakama.util.json"
 local log = require "nakama.util.log"
+local time = require "nakama.util.time"
 
 local M = {}
 
 local JWT_TOKEN = "^(.-)%.(.-)%.(.-)$"
 
+local HTTP_DATE = "^%a+, (%d+) (%a+) (%d+) (%d+):(%d+):(%d+) GMT$"
+local MONTHS = { Jan = 1, Feb = 2, Mar = 3, Apr = 4, May = 5, Jun = 6, Jul = 7, Aug = 8, Sep = 9, Oct = 10, Nov = 11, Dec = 12 }
+
+--- The default clock skew tolerance in seconds.
+M.DEFAULT_CLOCK_SKEW = 0
+
+-- the default clock, used when checking if a token has expired without the
+-- clock of a client
+local default_clock = {
+	-- tokens expiring within this many seconds are considered expired
+	clock_skew = M.DEFAULT_CLOCK_SKEW,
+	-- difference in seconds between the server clock and the device clock
+	server_time_offset = 0,
+}
+
+-- the current time, corrected using the server time if it is known, plus the
+-- clock skew tolerance
+local function now(clock)
+	local clock_skew = clock and clock.clock_skew or default_clock.clock_skew
+	local server_time_offset = clock and clock.server_time_offset or default_clock.server_time_offset
+	return os.time() + server_time_offset + clock_skew
+end
+
+--- Create a clock used when checking if a token has expired, with its own
+-- clock skew tolerance and server time, eg for each client. The default
+-- clock skew tolerance and server time are used until they are set.
+-- @param clock_skew Optional clock skew tolerance in seconds.
+-- @return The clock.
+function M.create_clock(clock_skew)
+	assert(not clock_skew or type(clock_skew) == "number", "The clock skew must be a number")
+	return { clock_skew = clock_skew }
+end
+
+--- Set the default clock skew tolerance used when checking if a token has
+-- expired. Tokens which expire within the tolerance are considered expired.
+-- @param seconds The tolerance in seconds. Defaults to session.DEFAULT_CLOCK_SKEW.
+function M.set_clock_skew(seconds)
+	assert(not seconds or type(seconds) == "number", "The clock skew must be a number")
+	default_clock.clock_skew = seconds or M.DEFAULT_CLOCK_SKEW
+end
+
+--- Set the current server time, used to correct the device clock when
+-- checking if a token has expired.
+-- @param server_time Seconds since epoch or a HTTP date (eg from a Date header)
+-- @param clock Optional clock to set the server time of, see session.create_clock().
+-- Defaults to the default clock.
+function M.set_server_time(server_time, clock)
+	if type(server_time) == "string" then
+		local day, month, year, hour, min, sec = server_time:match(HTTP_DATE)
+		if not day or not MONTHS[month] then
+			log("Unable to parse server time", server_time)
+			return
+		end
+		server_time = time.utc_to_epoch(tonumber(year), MONTHS[month], tonumber(day), tonumber(hour), tonumber(min), tonumber(sec))
+	end
+	assert(type(server_time) == "number", "The server time must be a number or a HTTP date")
+	clock = clock or default_clock
+	clock.server_time_offset = server_time - os.time()
+end
 
 --- Check whether a Nakama session token is about to expire (within 24 hours)
 -- @param session The session object created with session.create().
+-- @param clock Optional clock, see session.create_clock().
 -- @return A boolean if the token is about to expire or not.
-function M.is_token_expired_soon(session)
+function M.is_token_expired_soon(session, clock)
 	assert(session and session.expires, "You must provide a session")
-	return os.time() + (60 * 60 * 24) > session.expires
+	return now(clock) + (60 * 60 * 24) > session.expires
 end
 
 --- Check whether a Nakama session token has expired or not.
 -- @param session The session object created with session.create().
+-- @param clock Optional clock, see session.create_clock().
 -- @return A boolean if the token has expired or not.
-function M.is_token_expired(session)
+function M.is_token_expired(session, clock)
 	assert(session and session.expires, "You must provide a session")
-	return os.time() > session.expires
+	return now(clock) > session.expires
 end
 -- for backwards compatibility
 function M.expired(session)
@@ -36,13 +98,14 @@ end
 
 --- Check whether a Nakama session refresh token has expired or not.
 -- @param session The session object created with session.create().
+-- @param clock Optional clock, see session.create_clock().
 -- @return A boolean if the refresh token has expired or not.
-function M.is_refresh_token_expired(session)
+function M.is_refresh_token_expired(session, clock)
 	assert(session, "You must provide a session")
 	if not session.refresh_token_expires then
 		return true
 	end
-	return os.time() > session.refresh_token_expires
+	return now(clock) > session.refresh_token_expires
 end
 
 --- Decode JWT token
@@ -54,6 +117,44 @@ local function decode_token(token)
 	return json.decode(b64.decode(p2))
 end
 
+-- decode a base64url encoded JWT part into a table or return nil if it isn't
+-- a valid JSON object
+local function decode_part(part)
+	part = part:gsub("-", "+"):gsub("_", "/")
+	local ok, decoded = pcall(json.decode, b64.decode(part))
+	if not ok or type(decoded) ~= "table" then
+		return nil
+	end
+	return decoded
+end
+
+--- Check that a token is a well formed JWT which hasn't expired, without
+-- making a request. The signature of the token isn't verified. The clock skew
+-- tolerance and the server time are used when checking if the token has
+-- expired, the same as for session.is_token_expired().
+-- @param token The token, eg session.token.
+-- @param clock Optional clock, see session.create_clock().
+-- @return true if the token is valid, otherwise false and the reason
+-- ("malformed" or "expired").
+function M.validate(token, clock)
+	if type(token) ~= "string" then
+		return false, "malformed"
+	end
+	local header, payload, signature = token:match("^([%w%-_]+)%.([%w%-_]+)%.([%w%-_]+)$")
+	if not header then
+		return false, "malformed"
+	end
+	header = decode_part(header)
+	payload = decode_part(payload)
+	if not header or not payload or type(payload.exp) ~= "number" then
+		return false, "malformed"
+	end
+	if now(clock) > payload.exp then
+		return false, "expired"
+	end
+	return true
+end
+
 --- Create a session object with the given data and included token.
 -- @param data A data table containing a "token", "refresh_token" and other additional information.
 -- @return The session object.
@@ -109,4 +210,11 @@ function M.restore()
 	return session
 end
 
+--- Remove a session stored using session.store(), eg when logging out
+-- @return success
+function M.clear()
+	local filename = get_session_save_filename()
+	return sys.save(filename, {})
+end
+
 return M
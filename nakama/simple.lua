@@ -0,0 +1,389 @@
+--[[--
+A simplified Nakama client with a small set of high level functions.
+
+All functions take plain arguments and an optional callback function which
+is called with the result and an error message if the call failed. Results
+are simplified, with JSON encoded values decoded. Use the full client
+(nakama.nakama) for anything not covered here. The two can be used together
+using simple.get_client() and simple.get_socket().
+
+	local simple = require "nakama.simple"
+	simple.init(config)
+	simple.login_device(nil, function(user, err)
+		simple.write_score("weekly", 100)
+	end)
+
+@module nakama.simple
+]]
+
+local nakama = require "nakama.nakama"
+local json = require "nakama.util.json"
+
+local M = {}
+
+local client = nil
+local session = nil
+local socket = nil
+
+-- decode a JSON string, returning nil if it isn't valid JSON
+local function decode(s)
+	if type(s) ~= "string" or s == "" then
+		return nil
+	end
+	local ok, value = pcall(json.decode, s)
+	return ok and value or nil
+end
+
+-- get an error message from a result
+local function error_message(result)
+	if result == nil then
+		return "No result"
+	end
+	if result.error then
+		return result.message or tostring(result.error)
+	end
+	return nil
+end
+
+-- run a function in a coroutine and pass the result to a callback
+-- the function must return a result or nil and an error message
+local function run(callback, fn)
+	assert(client, "You must call simple.init() first")
+	assert(not callback or type(callback) == "function", "The callback must be a function")
+	nakama.sync(function()
+		local result, err = fn()
+		if callback then
+			callback(result, err)
+		end
+	end)
+end
+
+-- simplify a user
+local function simplify_user(user)
+	user = user or {}
+	return {
+		user_id = user.id,
+		username = user.username,
+		display_name = user.display_name,
+		avatar_url = user.avatar_url,
+		online = user.online,
+		metadata = decode(user.metadata),
+	}
+end
+
+-- set the session after logging in
+local function login(result)
+	local err = error_message(result)
+	if err then
+		return nil, err
+	end
+	session = result
+	nakama.set_bearer_token(client, session.token)
+	return { user_id = session.user_id, username = session.username }
+end
+
+
+--- Initialise the simplified client.
+-- @param config The client config, see nakama.create_client().
+function M.init(config)
+	client = nakama.create_client(config)
+	session = nil
+	socket = nil
+end
+
+--- Get the full client used by the simplified client.
+-- @return Nakama client.
+function M.get_client()
+	return client
+end
+
+--- Get the session of the logged in user.
+-- @return The session or nil if not logged in.
+function M.get_session()
+	return session
+end
+
+--- Get the socket, see simple.connect().
+-- @return The socket or nil if not connected.
+function M.get_socket()
+	return socket
+end
+
+--- Log in using a device id, creating the account if needed.
+-- @param device_id Optional device id. Defaults to the engine uuid.
+-- @param callback Optional callback function, called with { user_id, username }.
+function M.login_device(device_id, callback)
+	run(callback, function()
+		device_id = device_id or client.engine.uuid()
+		return login(nakama.authenticate_device(client, device_id, nil, true))
+	end)
+end
+
+--- Log in using an email and password, creating the account if needed.
+-- @param email The email.
+-- @param password The password.
+-- @param callback Optional callback function, called with { user_id, username }.
+function M.login_email(email, password, callback)
+	run(callback, function()
+		return login(nakama.authenticate_email(client, email, password, nil, true))
+	end)
+end
+
+--- Log in using a custom id, creating the account if needed.
+-- @param id The custom id.
+-- @param callback Optional callback function, called with { user_id, username }.
+function M.login_custom(id, callback)
+	run(callback, function()
+		return login(nakama.authenticate_custom(client, id, nil, true))
+	end)
+end
+
+--- Log out the current user.
+-- @param callback Optional callback function, called with true.
+function M.logout(callback)
+	run(callback, function()
+		if not session then
+			return true
+		end
+		local result = nakama.session_logout(client, session.refresh_token, session.token)
+		session = nil
+		nakama.set_bearer_token(client, nil)
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		return true
+	end)
+end
+
+--- Get the profile of the current user.
+-- @param callback Optional callback function, called with { user_id,
+-- username, display_name, avatar_url, online, metadata, wallet }.
+function M.get_profile(callback)
+	run(callback, function()
+		local result = nakama.get_account(client)
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		local profile = simplify_user(result.user)
+		profile.wallet = decode(result.wallet) or {}
+		return profile
+	end)
+end
+
+--- Update the profile of the current user.
+-- @param profile Table with any of username, display_name, avatar_url,
+-- lang_tag, location and timezone.
+-- @param callback Optional callback function, called with true.
+function M.update_profile(profile, callback)
+	assert(type(profile) == "table", "You must provide a profile")
+	run(callback, function()
+		local result = nakama.update_account(client, profile.avatar_url, profile.display_name, profile.lang_tag, profile.location, profile.timezone, profile.username)
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		return true
+	end)
+end
+
+--- List the friends of the current user.
+-- @param callback Optional callback function, called with a list of
+-- { user_id, username, display_name, avatar_url, online, metadata, state }.
+function M.list_friends(callback)
+	run(callback, function()
+		local result = nakama.list_friends(client, 100)
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		local friends = {}
+		for _,friend in ipairs(result.friends or {}) do
+			local user = simplify_user(friend.user)
+			user.state = friend.state
+			table.insert(friends, user)
+		end
+		return friends
+	end)
+end
+
+--- Add a friend, or accept a friend request.
+-- @param username The username of the friend.
+-- @param callback Optional callback function, called with true.
+function M.add_friend(username, callback)
+	assert(type(username) == "string", "You must provide a username")
+	run(callback, function()
+		local result = nakama.add_friends(client, nil, { username })
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		return true
+	end)
+end
+
+--- Write a score to a leaderboard.
+-- @param leaderboard_id The leaderboard id.
+-- @param score The score (number).
+-- @param callback Optional callback function, called with { rank, score }.
+function M.write_score(leaderboard_id, score, callback)
+	assert(type(leaderboard_id) == "string", "You must provide a leaderboard id")
+	assert(type(score) == "number", "You must provide a score")
+	run(callback, function()
+		local result = nakama.write_leaderboard_record(client, leaderboard_id, nil, nil, tostring(score))
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		return { rank = tonumber(result.rank), score = tonumber(result.score) }
+	end)
+end
+
+--- List the top scores of a leaderboard.
+-- @param leaderboard_id The leaderboard id.
+-- @param limit Optional max number of scores. Defaults to 10.
+-- @param callback Optional callback function, called with a list of
+-- { rank, user_id, username, score, subscore }.
+function M.list_scores(leaderboard_id, limit, callback)
+	assert(type(leaderboard_id) == "string", "You must provide a leaderboard id")
+	run(callback, function()
+		local result = nakama.list_leaderboard_records(client, leaderboard_id, nil, limit or 10)
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		local scores = {}
+		for _,record in ipairs(result.records or {}) do
+			table.insert(scores, {
+				rank = tonumber(record.rank),
+				user_id = record.owner_id,
+				username = record.username,
+				score = tonumber(record.score),
+				subscore = tonumber(record.subscore),
+			})
+		end
+		return scores
+	end)
+end
+
+--- Save a value in storage for the current user.
+-- @param collection The storage collection.
+-- @param key The storage key.
+-- @param value The value (table).
+-- @param callback Optional callback function, called with true.
+function M.save(collection, key, value, callback)
+	assert(type(value) == "table", "You must provide a value")
+	run(callback, function()
+		local result = nakama.storage_write_many(client, { { collection = collection, key = key, value = value } })
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		return true
+	end)
+end
+
+--- Load a value saved in storage by the current user.
+-- @param collection The storage collection.
+-- @param key The storage key.
+-- @param callback Optional callback function, called with the value or nil
+-- if nothing has been saved.
+function M.load(collection, key, callback)
+	run(callback, function()
+		local object_ids = { { collection = collection, key = key, userId = session and session.user_id } }
+		local result = nakama.read_storage_objects(client, object_ids)
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		local object = result.objects and result.objects[1]
+		return object and decode(object.value) or nil
+	end)
+end
+
+--- Call a server function.
+-- @param id The function id.
+-- @param payload Optional payload (table).
+-- @param callback Optional callback function, called with the decoded payload
+-- returned by the function.
+function M.rpc(id, payload, callback)
+	assert(type(id) == "string", "You must provide a function id")
+	run(callback, function()
+		local result = nakama.rpc_func2(client, id, payload and json.encode(payload) or nil)
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		return decode(result.payload)
+	end)
+end
+
+--- Connect to the server to be able to join matches.
+-- @param callback Optional callback function, called with true.
+function M.connect(callback)
+	run(callback, function()
+		socket = socket or nakama.create_socket(client)
+		local ok, err = socket.connect()
+		if not ok then
+			return nil, err or "Unable to connect"
+		end
+		return true
+	end)
+end
+
+--- Join a match. Requires a connection, see simple.connect().
+-- @param match_id The match id.
+-- @param callback Optional callback function, called with { match_id, presences }.
+function M.join_match(match_id, callback)
+	assert(type(match_id) == "string", "You must provide a match id")
+	assert(socket, "You must call simple.connect() first")
+	run(callback, function()
+		local result = socket.match_join(match_id)
+		local err = error_message(result)
+		if err or not result.match then
+			return nil, err or "Unable to join match"
+		end
+		return { match_id = result.match.match_id, presences = result.match.presences or {} }
+	end)
+end
+
+--- Leave a match.
+-- @param match_id The match id.
+-- @param callback Optional callback function, called with true.
+function M.leave_match(match_id, callback)
+	assert(socket, "You must call simple.connect() first")
+	run(callback, function()
+		local result = socket.match_leave(match_id)
+		local err = error_message(result)
+		if err then
+			return nil, err
+		end
+		return true
+	end)
+end
+
+--- Send data to the other players in a match.
+-- @param match_id The match id.
+-- @param op_code The op code (number).
+-- @param data The data (table).
+function M.send_match_data(match_id, op_code, data)
+	assert(socket, "You must call simple.connect() first")
+	assert(type(data) == "table", "You must provide data")
+	socket.match_data_send(match_id, op_code, json.encode(data), nil, nil, function() end)
+end
+
+--- Set the function to call when match data is received.
+-- @param fn Function called with the decoded data, the op code and the
+-- user id of the sender.
+function M.on_match_data(fn)
+	assert(socket, "You must call simple.connect() first")
+	socket.on_match_data(function(message)
+		local match_data = message.match_data
+		local presence = match_data.presence or {}
+		fn(decode(match_data.data), tonumber(match_data.op_code), presence.user_id)
+	end)
+end
+
+
+return M
@@ -2,37 +2,640 @@
 local M = {}
 
 local b64 = require "nakama.util.b64"
+local json = require "nakama.util.json"
 local async = require "nakama.util.async"
 local log = require "nakama.util.log"
+local messages = require "nakama.socket_messages"
+
+local unpack = _G.unpack or table.unpack
+
+-- resume coroutines waiting for an event (see socket.wait_for)
+-- @return true if there were any coroutines waiting for the event
+local function notify_waiters(socket, event_id, message)
+	local waiters = socket.waiters[event_id]
+	if not waiters or #waiters == 0 then
+		return false
+	end
+	for _,waiter in ipairs({ unpack(waiters) }) do
+		if not waiter.predicate or waiter.predicate(message) then
+			waiter.finish(message)
+		end
+	end
+	return true
+end
+
+-- add a handler for an event
+-- @return Function which removes the handler
+local function add_handler(socket, event_id, fn, once)
+	local handler = { fn = fn, once = once }
+	socket.events[event_id] = socket.events[event_id] or {}
+	table.insert(socket.events[event_id], handler)
+	return function()
+		for i,h in ipairs(socket.events[event_id]) do
+			if h == handler then
+				table.remove(socket.events[event_id], i)
+				return
+			end
+		end
+	end
+end
+
+-- set the handler of an event registered using an on_* function, replacing
+-- the previous one but not the handlers added using socket.on() and socket.once()
+-- @return Function which removes the handler
+local function set_handler(socket, event_id, fn)
+	if socket.set_handlers[event_id] then
+		socket.set_handlers[event_id]()
+		socket.set_handlers[event_id] = nil
+	end
+	if not fn then
+		return function() end
+	end
+	local remove = add_handler(socket, event_id, fn)
+	socket.set_handlers[event_id] = remove
+	return remove
+end
+
+-- call the handlers of an event
+-- @return true if there were any handlers for the event
+local function emit(socket, event_id, ...)
+	local handlers = socket.events[event_id]
+	if not handlers or #handlers == 0 then
+		return false
+	end
+	for _,handler in ipairs({ unpack(handlers) }) do
+		if handler.once then
+			for i,h in ipairs(handlers) do
+				if h == handler then
+					table.remove(handlers, i)
+					break
+				end
+			end
+		end
+		handler.fn(...)
+	end
+	return true
+end
+
+-- get the presences of a match or channel as a list
+local function presence_list(socket, id)
+	local list = {}
+	for _,presence in pairs(socket.presences[id] or {}) do
+		table.insert(list, presence)
+	end
+	return list
+end
+
+-- add and remove presences of a match or channel and notify the presence
+-- change handler
+local function update_presences(socket, id, joins, leaves)
+	socket.presences[id] = socket.presences[id] or {}
+	local presences = socket.presences[id]
+	for _,presence in ipairs(joins or {}) do
+		presences[presence.session_id] = presence
+	end
+	for _,presence in ipairs(leaves or {}) do
+		presences[presence.session_id] = nil
+	end
+	emit(socket, "presence_change", id, presence_list(socket, id), joins or {}, leaves or {})
+end
+
+-- keep track of the current presences of joined matches and channels from the
+-- initial presences when joining and the presence events
+local function track_presences(socket, message, result)
+	if result and not result.error then
+		if message.match_join or message.match_create then
+			local match = result.match
+			if match and match.match_id then
+				local joins = { unpack(match.presences or {}) }
+				table.insert(joins, match.self)
+				socket.presences[match.match_id] = {}
+				update_presences(socket, match.match_id, joins, {})
+			end
+		elseif message.match_leave then
+			socket.presences[message.match_leave.match_id] = nil
+		elseif message.channel_join then
+			local channel = result.channel
+			if channel and channel.id then
+				local joins = { unpack(channel.presences or {}) }
+				table.insert(joins, channel.self)
+				socket.presences[channel.id] = {}
+				update_presences(socket, channel.id, joins, {})
+			end
+		elseif message.channel_leave then
+			socket.presences[message.channel_leave.channel_id] = nil
+		end
+	elseif not result then
+		local event = message.match_presence_event or message.channel_presence_event
+		if event then
+			local id = event.match_id or event.channel_id
+			if id and socket.presences[id] then
+				update_presences(socket, id, event.joins, event.leaves)
+			end
+		end
+	end
+end
+
+-- detect gaps and out of order messages in a sequence and notify the
+-- sequence gap handler
+local function check_sequence(socket, key, seq, event)
+	local last = socket.sequences[key]
+	if last and seq ~= last + 1 then
+		event.expected = last + 1
+		event.received = seq
+		event.out_of_order = seq <= last
+		event.missing = math.max(0, seq - last - 1)
+		emit(socket, "sequence_gap", event)
+	end
+	if not last or seq > last then
+		socket.sequences[key] = seq
+	end
+end
+
+-- keep track of the sequence numbers of received messages and of the match
+-- data sent by each presence in a match (see config.track_sequence)
+local function track_sequence(socket, message)
+	local seq = tonumber(message.seq or message.sequence)
+	if seq then
+		check_sequence(socket, "socket", seq, {})
+	end
+	local match_data = message.match_data
+	seq = match_data and tonumber(match_data.seq or match_data.sequence)
+	if seq then
+		local presence = match_data.presence
+		local key = ("%s:%s"):format(tostring(match_data.match_id), presence and presence.session_id or "")
+		check_sequence(socket, key, seq, { match_id = match_data.match_id, presence = presence })
+	end
+end
+
+-- pass a message through the interceptors added using socket.use()
+-- outgoing messages are passed to the interceptors in the order they were
+-- added and incoming messages in the reverse order
+-- @return The message or nil if it was dropped
+local function intercept(socket, direction, message)
+	local interceptors = socket.interceptors
+	local first, last, step = 1, #interceptors, 1
+	if direction == "incoming" then
+		first, last, step = #interceptors, 1, -1
+	end
+	for i=first,last,step do
+		local result = interceptors[i](direction, message)
+		if result == false then
+			log("Socket message dropped by an interceptor", direction)
+			return nil
+		elseif result ~= nil then
+			message = result
+		end
+	end
+	return message
+end
+
+-- get the type of a value used to find its codec, the type of the value or
+-- the name of a Defold vmath type, eg "vmath.vector3"
+local function codec_type(value)
+	local value_type = type(value)
+	if value_type == "userdata" then
+		return tostring(value):match("^([%w_%.]+)%(") or value_type
+	end
+	return value_type
+end
+
+-- encode the values with a codec (see socket.register_codec())
+local function encode_values(socket, value)
+	local codec = socket.codecs[codec_type(value)]
+	if codec then
+		return { __type = codec_type(value), value = codec.encode(value) }
+	end
+	if type(value) ~= "table" or value == json.null then
+		return value
+	end
+	local encoded = {}
+	for k,v in pairs(value) do
+		encoded[k] = encode_values(socket, v)
+	end
+	return encoded
+end
+
+-- decode the values encoded with a codec (see socket.register_codec())
+local function decode_values(socket, value)
+	if type(value) ~= "table" or value == json.null then
+		return value
+	end
+	local codec = value.__type and socket.codecs[value.__type]
+	if codec then
+		return codec.decode(value.value)
+	end
+	for k,v in pairs(value) do
+		value[k] = decode_values(socket, v)
+	end
+	return value
+end
 
 local function on_socket_message(socket, message)
+	message = intercept(socket, "incoming", message)
+	if not message then
+		return
+	end
 	if message.match_data then
 		message.match_data.data = b64.decode(message.match_data.data)
+		-- decode JSON match data when codecs have been registered
+		local data = message.match_data.data
+		if next(socket.codecs) and data and data:match("^%s*[%[{]") then
+			local ok, value = pcall(json.decode, data)
+			if ok then
+				message.match_data.value = decode_values(socket, value)
+			end
+		end
+	end
+	track_presences(socket, message)
+	if socket.client.config.track_sequence then
+		track_sequence(socket, message)
 	end
 	for event_id,_ in pairs(message) do
-		if socket.events[event_id] then
-			socket.events[event_id](message)
+		local waited_for = notify_waiters(socket, event_id, message)
+		if emit(socket, event_id, message) then
+			return
+		end
+		if waited_for then
 			return
 		end
 	end
 	log("Unhandled message")
 end
 
-local function socket_send(socket, message, callback)
+-- check that a list of presences contains only valid user presences
+local function assert_presences(presences)
+	for i,presence in ipairs(presences) do
+		assert(type(presence) == "table", ("Presence %d must be a table"):format(i))
+		assert(type(presence.user_id) == "string", ("Presence %d must have a 'user_id' of type 'string'"):format(i))
+		assert(type(presence.session_id) == "string", ("Presence %d must have a 'session_id' of type 'string'"):format(i))
+	end
+end
+
+-- keep track of joined channels, matches and parties and followed users
+-- so that they can be restored after a reconnect (see config.auto_resubscribe)
+local function track_subscriptions(socket, message, result)
+	if not result or result.error then
+		return
+	end
+	local subscriptions = socket.subscriptions
+	if message.channel_join then
+		local channel_id = result.channel and result.channel.id or message.channel_join.target
+		subscriptions.channels[channel_id] = message
+	elseif message.channel_leave then
+		subscriptions.channels[message.channel_leave.channel_id] = nil
+	elseif message.match_join or message.match_create then
+		local match_id = result.match and result.match.match_id or (message.match_join and message.match_join.match_id)
+		if match_id then
+			subscriptions.matches[match_id] = { match_join = { match_id = match_id } }
+		end
+	elseif message.match_leave then
+		subscriptions.matches[message.match_leave.match_id] = nil
+	elseif message.party_join then
+		subscriptions.parties[message.party_join.party_id] = message
+	elseif message.party_leave then
+		subscriptions.parties[message.party_leave.party_id] = nil
+	elseif message.status_follow then
+		for _,user_id in ipairs(message.status_follow.user_ids or {}) do
+			subscriptions.follows[user_id] = true
+		end
+		for _,username in ipairs(message.status_follow.usernames or {}) do
+			subscriptions.follows_by_username[username] = true
+		end
+	elseif message.status_unfollow then
+		for _,user_id in ipairs(message.status_unfollow.user_ids or {}) do
+			subscriptions.follows[user_id] = nil
+		end
+	elseif message.status_update then
+		subscriptions.status = message
+	end
+end
+
+-- send a message, passed through the interceptors of the socket
+local function send_message(socket, message, callback)
+	local intercepted = intercept(socket, "outgoing", message)
+	if not intercepted then
+		callback({ error = true, code = "dropped", message = "The message was dropped by an interceptor" })
+		return
+	end
+	socket.engine.socket_send(socket, intercepted, function(result)
+		if result ~= nil then
+			result = intercept(socket, "incoming", result)
+			if not result then
+				callback({ error = true, code = "dropped", message = "The response was dropped by an interceptor" })
+				return
+			end
+		end
+		track_subscriptions(socket, message, result)
+		track_presences(socket, message, result)
+		callback(result)
+	end)
+end
+
+-- notify the backpressure handler when the number of pending sends reaches
+-- the threshold and the drain handler when there are no pending sends left
+-- (see config.socket_backpressure_threshold)
+local function check_pending_sends(socket, previous)
+	local pending = #socket.parked
+	local threshold = socket.client.config.socket_backpressure_threshold
+	if previous < threshold and pending >= threshold then
+		emit(socket, "backpressure", { pending = pending, threshold = threshold })
+	elseif previous > 0 and pending == 0 then
+		emit(socket, "drain")
+	end
+end
+
+-- keep a message until the socket has reconnected or until the client
+-- timeout has passed (requires engine support for timers)
+local function park_message(socket, message, callback)
+	local parked = { message = message, callback = callback }
+	table.insert(socket.parked, parked)
+	check_pending_sends(socket, #socket.parked - 1)
+	local timeout = socket.client.config.timeout
+	if timeout and socket.engine.timer_delay then
+		parked.timer_handle = socket.engine.timer_delay(timeout, function()
+			for i,p in ipairs(socket.parked) do
+				if p == parked then
+					table.remove(socket.parked, i)
+					check_pending_sends(socket, #socket.parked + 1)
+					callback({ error = true, message = "Timed out waiting for the socket to reconnect" })
+					return
+				end
+			end
+		end)
+	end
+end
+
+-- send all parked messages
+local function send_parked_messages(socket)
+	local parked = socket.parked
+	socket.parked = {}
+	for _,p in ipairs(parked) do
+		if p.timer_handle then
+			socket.engine.timer_cancel(p.timer_handle)
+		end
+		send_message(socket, p.message, p.callback)
+	end
+	check_pending_sends(socket, #parked)
+end
+
+-- connect the socket again after the next delay of the reconnect policy,
+-- until connected or out of attempts (see config.socket_reconnect)
+local function schedule_reconnect(socket)
+	local attempt = socket.reconnect_attempt + 1
+	local delay = socket.client.config.socket_reconnect[attempt]
+	if not delay then
+		log("Unable to reconnect the socket after", attempt - 1, "attempts")
+		emit(socket, "lost", { reason = "reconnect_failed", reconnecting = false, attempts = attempt - 1 })
+		return
+	end
+	socket.reconnect_attempt = attempt
+	socket.reconnect_timer = socket.engine.timer_delay(delay, function()
+		socket.reconnect_timer = nil
+		M.connect(socket, function(result, err)
+			if not result then
+				log("Unable to reconnect the socket", err)
+				schedule_reconnect(socket)
+			end
+		end)
+	end)
+end
+
+-- called by the engine when the socket has been disconnected
+-- check if the reason the socket was closed by the server means that the
+-- user has been banned or the session has been kicked (see config.on_banned)
+local function detect_kick(socket, close_reason)
+	local reason = close_reason and tostring(close_reason):lower()
+	if not reason or not (reason:find("banned") or reason:find("kicked")) then
+		return false
+	end
+	local info = { reason = reason:find("banned") and "banned" or "kicked", source = "socket", message = close_reason }
+	if info.reason == "banned" then
+		socket.client.config.banned = info
+	end
+	if socket.client.config.on_banned then
+		socket.client.config.on_banned(info)
+	end
+	return true
+end
+
+-- stop sending pings when the socket is disconnected
+local function stop_heartbeat(socket)
+	if socket.heartbeat_timer then
+		socket.engine.timer_cancel(socket.heartbeat_timer)
+		socket.heartbeat_timer = nil
+	end
+end
+
+local function on_socket_disconnect(socket, close_reason)
+	stop_heartbeat(socket)
+	-- a banned user or kicked session can't reconnect
+	local kicked = detect_kick(socket, close_reason)
+	if socket.has_connected and not kicked then
+		socket.reconnecting = true
+		if socket.client.config.socket_reconnect and not socket.reconnect_timer then
+			schedule_reconnect(socket)
+		end
+	end
+	emit(socket, "disconnect")
+	emit(socket, "lost", { reason = close_reason, reconnecting = socket.reconnect_timer ~= nil })
+end
+
+-- send a ping at each interval of the heartbeat and consider the connection
+-- lost if the previous ping hasn't been answered (see config.socket_heartbeat)
+local function start_heartbeat(socket)
+	local interval = socket.client.config.socket_heartbeat
+	if not interval or socket.heartbeat_timer then
+		return
+	end
+	local answered = true
+	local function beat()
+		socket.heartbeat_timer = socket.engine.timer_delay(interval, function()
+			socket.heartbeat_timer = nil
+			if not answered then
+				log("No answer to the socket heartbeat, the connection is lost")
+				if socket.engine.socket_disconnect then
+					socket.engine.socket_disconnect(socket)
+				end
+				on_socket_disconnect(socket, "heartbeat_timeout")
+				return
+			end
+			answered = false
+			beat()
+			send_message(socket, { ping = {} }, function()
+				answered = true
+			end)
+		end)
+	end
+	beat()
+end
+
+local function encode_and_send(socket, message, callback)
 	if message.match_data_send and message.match_data_send.data then
 		message.match_data_send.data = b64.encode(message.match_data_send.data)
 	end
+	if message.match_data_send and message.match_data_send.presences then
+		assert_presences(message.match_data_send.presences)
+	end
 
+	-- park the message until the socket has reconnected (see config.socket_buffer_on_reconnect)
+	if socket.reconnecting and socket.client.config.socket_buffer_on_reconnect then
+		park_message(socket, message, callback)
+	else
+		send_message(socket, message, callback)
+	end
+end
+
+-- send the match data which was throttled during the current interval of a
+-- send rate
+-- @return true if any match data was sent
+local function send_throttled(socket, rate)
+	local pending, order = rate.pending, rate.order
+	rate.pending, rate.order = {}, {}
+	for _,match_id in ipairs(order) do
+		local throttled = pending[match_id]
+		encode_and_send(socket, throttled.message, function(result)
+			for _,callback in ipairs(throttled.callbacks) do
+				callback(result)
+			end
+		end)
+	end
+	return #order > 0
+end
+
+-- start an interval of a send rate, at the end of which the throttled match
+-- data is sent and another interval is started, if there was any
+local function start_send_interval(socket, rate)
+	rate.timer_handle = socket.engine.timer_delay(rate.interval, function()
+		rate.timer_handle = nil
+		if send_throttled(socket, rate) then
+			start_send_interval(socket, rate)
+		end
+	end)
+end
+
+-- send match data right away if no match data with the op code has been sent
+-- during the current interval of the send rate, or else keep it until the end
+-- of the interval, replacing or merged with other match data to the same match
+local function throttle(socket, rate, message, callback)
+	if not rate.timer_handle then
+		encode_and_send(socket, message, callback)
+		start_send_interval(socket, rate)
+		return
+	end
+	local match_id = message.match_data_send.match_id
+	local throttled = rate.pending[match_id]
+	if not throttled then
+		rate.pending[match_id] = { message = message, callbacks = { callback } }
+		table.insert(rate.order, match_id)
+		return
+	end
+	if rate.merge then
+		message.match_data_send.data = rate.merge(throttled.message.match_data_send.data, message.match_data_send.data)
+	end
+	throttled.message = message
+	table.insert(throttled.callbacks, callback)
+end
+
+-- send the latest status of the status updates made during the debounce
+-- interval and pass the result to the callbacks of all of them
+local function send_pending_status(socket)
+	local pending = socket.pending_status
+	socket.pending_status = nil
+	encode_and_send(socket, pending.message, function(result)
+		for _,callback in ipairs(pending.callbacks) do
+			callback(result)
+		end
+	end)
+end
+
+-- keep a status update until the end of the debounce interval, replacing
+-- the status of any status update made earlier during the interval
+-- (see config.status_update_debounce)
+local function debounce_status(socket, message, callback)
+	local pending = socket.pending_status
+	if pending then
+		pending.message = message
+		table.insert(pending.callbacks, callback)
+		return
+	end
+	pending = { message = message, callbacks = { callback } }
+	socket.pending_status = pending
+	pending.timer_handle = socket.engine.timer_delay(socket.client.config.status_update_debounce, function()
+		if socket.pending_status == pending then
+			send_pending_status(socket)
+		end
+	end)
+end
+
+local function socket_send(socket, message, callback)
+	local send = encode_and_send
+	local rate = message.match_data_send and socket.send_rates[tostring(message.match_data_send.op_code)]
+	if rate then
+		send = function(socket, message, callback)
+			throttle(socket, rate, message, callback)
+		end
+	elseif message.status_update and socket.client.config.status_update_debounce then
+		send = debounce_status
+	end
 	if callback then
-		socket.engine.socket_send(socket, message, callback)
+		send(socket, message, callback)
 	else
 		return async(function(done)
-			socket.engine.socket_send(socket, message, done)
+			send(socket, message, done)
+		end)
+	end
+end
+
+-- send the messages needed to restore all tracked subscriptions and notify
+-- the resubscribe handler of the result of each one
+local function resubscribe(socket)
+	local subscriptions = socket.subscriptions
+	local messages = {}
+	for _,message in pairs(subscriptions.channels) do
+		table.insert(messages, message)
+	end
+	for _,message in pairs(subscriptions.matches) do
+		table.insert(messages, message)
+	end
+	for _,message in pairs(subscriptions.parties) do
+		table.insert(messages, message)
+	end
+	local follow = { status_follow = { user_ids = {}, usernames = {} } }
+	for user_id,_ in pairs(subscriptions.follows) do
+		table.insert(follow.status_follow.user_ids, user_id)
+	end
+	for username,_ in pairs(subscriptions.follows_by_username) do
+		table.insert(follow.status_follow.usernames, username)
+	end
+	if #follow.status_follow.user_ids > 0 or #follow.status_follow.usernames > 0 then
+		table.insert(messages, follow)
+	end
+	if subscriptions.status then
+		table.insert(messages, subscriptions.status)
+	end
+
+	for _,message in ipairs(messages) do
+		local message_type = next(message)
+		socket_send(socket, message, function(result)
+			local event = {
+				type = message_type,
+				message = message,
+				result = result,
+				success = result ~= nil and not result.error,
+			}
+			if message.match_join and not event.success then
+				-- the match has most likely ended and can't be rejoined
+				subscriptions.matches[message.match_join.match_id] = nil
+				event.match_ended = result ~= nil and result.error ~= nil and result.error.code == M.ERROR_MATCH_NOT_FOUND
+			end
+			emit(socket, "resubscribe", event)
 		end)
 	end
 end
 
 
+
 function M.create(client)
 	local socket = client.engine.socket_create(client.config, on_socket_message)
 	assert(socket, "No socket created")
@@ -40,9 +643,57 @@ function M.create(client)
 	socket.client = client
 	socket.engine = client.engine
 
+	-- the engine calls this when the socket is disconnected, with the close reason if there is one
+	socket.handle_disconnect = function(close_reason)
+		on_socket_disconnect(socket, close_reason)
+	end
+
 	-- event handlers are registered here
 	socket.events = {}
 
+	-- functions removing the handlers set using the on_* functions
+	socket.set_handlers = {}
+
+	-- functions intercepting sent and received messages (see socket.use())
+	socket.interceptors = {}
+
+	-- coroutines waiting for events are registered here
+	socket.waiters = {}
+
+	-- current presences per joined match and channel
+	socket.presences = {}
+
+	-- last received sequence numbers (see config.track_sequence)
+	socket.sequences = {}
+
+	-- messages sent while reconnecting (see config.socket_buffer_on_reconnect)
+	socket.parked = {}
+
+	-- codecs of values in match data per type (see socket.register_codec())
+	socket.codecs = {}
+
+	-- send rates of match data per op code (see socket.set_send_rate())
+	socket.send_rates = {}
+
+	-- status update kept until the end of the debounce interval (see config.status_update_debounce)
+	socket.pending_status = nil
+
+	-- number of reconnect attempts since the socket was connected (see config.socket_reconnect)
+	socket.reconnect_attempt = 0
+
+	-- timer of the next ping (see config.socket_heartbeat)
+	socket.heartbeat_timer = nil
+
+	-- subscriptions to restore after a reconnect
+	socket.subscriptions = {
+		channels = {},
+		matches = {},
+		parties = {},
+		follows = {},
+		follows_by_username = {},
+		status = nil,
+	}
+
 	-- set up function mappings on the socket instance itself
 	for name,fn in pairs(M) do
 		if name ~= "create" and type(fn) == "function" then
@@ -59,12 +710,90 @@ end
 -- @return If no callback is provided the function returns the result.
 function M.connect(socket, callback)
 	assert(socket, "You must provide a socket")
+	local function on_connect(result, err)
+		if result then
+			local reconnected = socket.has_connected
+			local attempts = socket.reconnect_attempt
+			socket.sequences = {}
+			socket.reconnecting = false
+			socket.reconnect_attempt = 0
+			if reconnected and socket.client.config.auto_resubscribe then
+				resubscribe(socket)
+			end
+			socket.has_connected = true
+			send_parked_messages(socket)
+			start_heartbeat(socket)
+			if reconnected then
+				emit(socket, "reconnected", { attempts = attempts })
+			end
+		end
+	end
 	if callback then
-		socket.engine.socket_connect(socket, callback)
+		socket.engine.socket_connect(socket, function(result, err)
+			on_connect(result, err)
+			callback(result, err)
+		end)
 	else
-		return async(function(done)
+		local result, err = async(function(done)
 			socket.engine.socket_connect(socket, done)
 		end)
+		on_connect(result, err)
+		return result, err
+	end
+end
+
+
+--- Disconnect a Nakama socket.
+-- The socket isn't connected again (see config.socket_reconnect) and isn't
+-- resubscribed when it is connected again (see config.auto_resubscribe).
+-- Messages waiting to be sent fail with an error result. Requires an engine
+-- providing socket_disconnect() to close the connection.
+-- @param socket The client socket to disconnect.
+function M.disconnect(socket)
+	assert(socket, "You must provide a socket")
+	local connected = socket.has_connected
+	stop_heartbeat(socket)
+	if socket.reconnect_timer then
+		socket.engine.timer_cancel(socket.reconnect_timer)
+		socket.reconnect_timer = nil
+	end
+	socket.has_connected = false
+	socket.reconnecting = false
+	socket.reconnect_attempt = 0
+	socket.presences = {}
+	socket.subscriptions = {
+		channels = {},
+		matches = {},
+		parties = {},
+		follows = {},
+		follows_by_username = {},
+		status = nil,
+	}
+
+	local failed = { error = true, message = "The socket was disconnected" }
+	local parked = socket.parked
+	socket.parked = {}
+	for _,p in ipairs(parked) do
+		if p.timer_handle then
+			socket.engine.timer_cancel(p.timer_handle)
+		end
+		p.callback(failed)
+	end
+	check_pending_sends(socket, #parked)
+	local pending = socket.pending_status
+	if pending then
+		socket.pending_status = nil
+		socket.engine.timer_cancel(pending.timer_handle)
+		for _,callback in ipairs(pending.callbacks) do
+			callback(failed)
+		end
+	end
+
+	if socket.engine.socket_disconnect then
+		socket.engine.socket_disconnect(socket)
+	end
+	if connected then
+		emit(socket, "disconnect")
 	end
 end
 
@@ -81,12 +810,586 @@ function M.send(socket, message, callback)
 end
 
 
+--- Get the number of pending sends.
+-- Messages sent while the socket is reconnecting are pending until the socket
+-- is connected again (see config.socket_buffer_on_reconnect).
+-- @param socket Nakama Client Socket.
+-- @return The number of messages which have been queued but not sent.
+function M.pending_sends(socket)
+	assert(socket, "You must provide a socket")
+	return #socket.parked
+end
+
+
+--- Add an interceptor of sent and received messages.
+-- The interceptor is called with the direction ("outgoing" or "incoming")
+-- and the message, including responses to sent messages. It can change the
+-- message, return a new message to use instead, return false to drop the
+-- message or return nothing to keep it. Outgoing messages are passed to the
+-- interceptors in the order they were added and incoming messages in the
+-- reverse order. Sending a dropped message or receiving a dropped response
+-- gives an error result with code "dropped". Outgoing messages are intercepted
+-- before the engine adds the id used to match the response.
+-- @param socket Nakama Client Socket.
+-- @param interceptor The interceptor function.
+-- @return Function which removes the interceptor.
+function M.use(socket, interceptor)
+	assert(socket, "You must provide a socket")
+	assert(type(interceptor) == "function", "You must provide an interceptor function")
+	table.insert(socket.interceptors, interceptor)
+	return function()
+		for i,fn in ipairs(socket.interceptors) do
+			if fn == interceptor then
+				table.remove(socket.interceptors, i)
+				return
+			end
+		end
+	end
+end
+
+
+--- Register a codec of a type of value in match data.
+-- Values of the type are encoded by encode_match_data() as a table with the
+-- type and the value returned by the encode function, and decoded by
+-- decode_match_data() using the decode function. Received JSON match data is
+-- also decoded, as 'value' of the match data, when codecs have been registered.
+-- @param socket Nakama Client Socket.
+-- @param type_name The type of the values, a Lua type or the name of a Defold
+-- vmath type, eg "vmath.vector3" or "vmath.quat".
+-- @param encode Function called with a value, returning a JSON encodable value.
+-- @param decode Function called with an encoded value, returning the value.
+function M.register_codec(socket, type_name, encode, decode)
+	assert(socket, "You must provide a socket")
+	assert(type(type_name) == "string", "You must provide a type name")
+	assert(type(encode) == "function", "You must provide an encode function")
+	assert(type(decode) == "function", "You must provide a decode function")
+	socket.codecs[type_name] = { encode = encode, decode = decode }
+end
+
+
+--- Encode a value as JSON match data, using the registered codecs.
+-- @param socket Nakama Client Socket.
+-- @param value The value, eg a table with vmath vectors.
+-- @return The match data.
+function M.encode_match_data(socket, value)
+	assert(socket, "You must provide a socket")
+	return json.encode(encode_values(socket, value))
+end
+
+
+--- Decode JSON match data, using the registered codecs.
+-- @param socket Nakama Client Socket.
+-- @param data The match data.
+-- @return The value.
+function M.decode_match_data(socket, data)
+	assert(socket, "You must provide a socket")
+	assert(type(data) == "string", "You must provide the match data")
+	return decode_values(socket, json.decode(data))
+end
+
+
+-- check that a value has the fields of a match data schema
+-- @return true or false and the reason the value is invalid
+local function validate_schema(value, schema, path)
+	if type(value) ~= "table" or value == json.null then
+		return false, ("%s must be a table"):format(path ~= "" and path or "the data")
+	end
+	for field,field_type in pairs(schema) do
+		local field_path = path .. field
+		local field_value = value[field]
+		if field_value == json.null then
+			field_value = nil
+		end
+		if field == "?" then
+			-- optional nested schema, checked by the parent schema
+		elseif type(field_type) == "table" then
+			if field_value ~= nil or not field_type["?"] then
+				local ok, err = validate_schema(field_value, field_type, field_path .. ".")
+				if not ok then
+					return false, err
+				end
+			end
+		else
+			local optional = field_type:sub(-1) == "?"
+			field_type = optional and field_type:sub(1, -2) or field_type
+			if field_value == nil then
+				if not optional then
+					return false, ("%s is missing"):format(field_path)
+				end
+			elseif field_type ~= "any" and type(field_value) ~= field_type then
+				return false, ("%s must be of type '%s'"):format(field_path, field_type)
+			end
+		end
+	end
+	return true
+end
+
+--- Set the handler of match data, or of the match data with an op code.
+-- The JSON data of match data with an op code is decoded as the value of the
+-- match data and validated against the schema if one is given. Match data
+-- which can't be decoded or which doesn't match the schema is logged and
+-- dropped. The schema is a table of fields and types ("string", "number",
+-- "boolean", "table" or "any"), with "?" added to the type of optional fields,
+-- eg { x = "number", y = "number", name = "string?" }, and tables for nested
+-- schemas, with ["?"] = true for optional nested tables. Other fields are
+-- allowed.
+-- @param socket Nakama Client Socket.
+-- @param op_code The op code of the match data, or the handler of all match data.
+-- @param fn The handler function, called with the message.
+-- @param schema Optional schema of the decoded data of the match data.
+-- @return Function which removes the handler.
+function M.on_match_data(socket, op_code, fn, schema)
+	assert(socket, "You must provide a socket")
+	if type(op_code) == "function" or op_code == nil then
+		return set_handler(socket, "match_data", op_code)
+	end
+	assert(type(op_code) == "number" or type(op_code) == "string", "The op code must be a number or a string")
+	assert(schema == nil or type(schema) == "table", "The schema must be nil or a table")
+	local key = "match_data:" .. tostring(op_code)
+	if socket.set_handlers[key] then
+		socket.set_handlers[key]()
+		socket.set_handlers[key] = nil
+	end
+	if not fn then
+		return function() end
+	end
+	local remove = add_handler(socket, "match_data", function(message)
+		local match_data = message.match_data
+		if tostring(match_data.op_code) ~= tostring(op_code) then
+			return
+		end
+		if schema then
+			local value = match_data.value
+			if value == nil then
+				local ok, decoded = pcall(json.decode, match_data.data or "")
+				if not ok then
+					log("Dropped match data with op code", op_code, "which isn't JSON")
+					return
+				end
+				value = decoded
+			end
+			local ok, err = validate_schema(value, schema, "")
+			if not ok then
+				log("Dropped match data with op code", op_code, "which doesn't match the schema:", err)
+				return
+			end
+			match_data.value = value
+		end
+		fn(message)
+	end)
+	socket.set_handlers[key] = remove
+	return remove
+end
+
+
+--- Set the send rate of match data with an op code.
+-- Match data with the op code is sent right away if no match data with the
+-- op code has been sent during the last interval (1 / hz seconds), or else at
+-- the end of the interval. Only the most recent match data to each match is
+-- sent at the end of the interval, unless a merge function is given, which is
+-- called with the data of the match data to send and of the most recent match
+-- data and returns the data to send instead. The callbacks of all the match
+-- data are called with the result of the sent match data. Requires engine
+-- support for timers.
+-- @param socket Nakama Client Socket.
+-- @param op_code The op code of the match data.
+-- @param hz Max number of match data sends per second, or nil to stop
+-- throttling, which sends the throttled match data right away.
+-- @param merge Optional function to merge match data instead of only sending
+-- the most recent match data.
+function M.set_send_rate(socket, op_code, hz, merge)
+	assert(socket, "You must provide a socket")
+	assert(op_code, "You must provide an op code")
+	assert(not hz or (type(hz) == "number" and hz > 0), "The send rate must be nil or a positive number")
+	assert(not merge or type(merge) == "function", "The merge function must be nil or a function")
+	assert(socket.engine.timer_delay, "The engine must provide the 'timer_delay' function to use a send rate")
+	local key = tostring(op_code)
+	local rate = socket.send_rates[key]
+	if rate then
+		socket.send_rates[key] = nil
+		if rate.timer_handle and socket.engine.timer_cancel then
+			socket.engine.timer_cancel(rate.timer_handle)
+		end
+		send_throttled(socket, rate)
+	end
+	if hz then
+		socket.send_rates[key] = { interval = 1 / hz, merge = merge, pending = {}, order = {} }
+	end
+end
+
+
+--- Update the status of the user right away.
+-- Unlike status_update(), the status is sent without waiting for the end of
+-- the debounce interval when config.status_update_debounce is set, for
+-- important transitions such as going away. A status update waiting for the
+-- end of the interval is dropped and its callbacks get the result of this one.
+-- @param socket Nakama Client Socket.
+-- @param status The status, or nil to appear offline.
+-- @param callback Optional callback function.
+-- @return The result.
+function M.status_update_now(socket, status, callback)
+	assert(socket, "You must provide a socket")
+	assert(status == nil or type(status) == "string", "Argument 'status' must be 'nil' or of type 'string'")
+	local pending = socket.pending_status
+	if pending then
+		socket.pending_status = nil
+		if socket.engine.timer_cancel then
+			socket.engine.timer_cancel(pending.timer_handle)
+		end
+	end
+	local function send(done)
+		encode_and_send(socket, { status_update = { status = status } }, function(result)
+			for _,pending_callback in ipairs(pending and pending.callbacks or {}) do
+				pending_callback(result)
+			end
+			done(result)
+		end)
+	end
+	if callback then
+		send(callback)
+	else
+		return async(send)
+	end
+end
+
+
+-- wait for a socket event, see M.wait_for()
+-- @return The event message or nil and an error message ("timeout" or "cancelled").
+local function wait_for_event(socket, event_id, predicate, timeout, cancellation_token)
+	cancellation_token = cancellation_token or async.cancellation_tokens[coroutine.running()]
+	if cancellation_token and cancellation_token.cancelled then
+		return nil, "cancelled"
+	end
+
+	return async(function(done)
+		local waiter = { predicate = predicate }
+		local timer_handle = nil
+		local on_cancel = nil
+		local finished = false
+		function waiter.finish(message, err)
+			if finished then return end
+			finished = true
+			for i,w in ipairs(socket.waiters[event_id]) do
+				if w == waiter then
+					table.remove(socket.waiters[event_id], i)
+					break
+				end
+			end
+			if timer_handle and socket.engine.timer_cancel then
+				socket.engine.timer_cancel(timer_handle)
+			end
+			if on_cancel then
+				for i,fn in ipairs(cancellation_token.on_cancel) do
+					if fn == on_cancel then
+						table.remove(cancellation_token.on_cancel, i)
+						break
+					end
+				end
+			end
+			done(message, err)
+		end
+
+		socket.waiters[event_id] = socket.waiters[event_id] or {}
+		table.insert(socket.waiters[event_id], waiter)
+		if timeout then
+			timer_handle = socket.engine.timer_delay(timeout, function()
+				waiter.finish(nil, "timeout")
+			end)
+		end
+		if cancellation_token then
+			on_cancel = function() waiter.finish(nil, "cancelled") end
+			cancellation_token.on_cancel = cancellation_token.on_cancel or {}
+			table.insert(cancellation_token.on_cancel, on_cancel)
+		end
+	end)
+end
+
+--- Wait for a socket event.
+-- This will block the current coroutine until the event is received. An error
+-- is raised if the event isn't received before the timeout.
+-- @param socket Nakama Client Socket.
+-- @param event_id The event to wait for, for instance "matchmaker_matched".
+-- @param predicate Optional function which must return true when passed the
+-- event for the wait to finish.
+-- @param timeout Optional timeout (seconds). Requires engine support for timers.
+-- @param cancellation_token Optional cancellation token to stop waiting.
+-- Defaults to the cancellation token of nakama.sync().
+-- @return The event message or nil and "cancelled" if the wait was cancelled.
+function M.wait_for(socket, event_id, predicate, timeout, cancellation_token)
+	assert(socket, "You must provide a socket")
+	assert(type(event_id) == "string", "You must provide an event id")
+	assert(not predicate or type(predicate) == "function", "The predicate must be a function")
+	assert(not timeout or type(timeout) == "number", "The timeout must be a number")
+	assert(not timeout or socket.engine.timer_delay, "The engine must provide the 'timer_delay' function to use a timeout")
+	assert(coroutine.running(), "You must be running this from within a coroutine")
+	local message, err = wait_for_event(socket, event_id, predicate, timeout, cancellation_token)
+	if err == "timeout" then
+		error(("Timed out waiting for the '%s' event"):format(event_id))
+	end
+	return message, err
+end
+
+
+-- check if a value is a match id, a uuid followed by a dot and the name of the
+-- node of authoritative matches, eg "b4a2e6a4-9a10-4a8f-8a57-5f3c2a8e9d11.nakama1"
+local function is_match_id(value)
+	return type(value) == "string" and value:match("^%x%x%x%x%x%x%x%x%-%x%x%x%x%-%x%x%x%x%-%x%x%x%x%-%x%x%x%x%x%x%x%x%x%x%x%x%.[^%s]*$") ~= nil
+end
+
+-- check if a value which isn't a match id looks like one, eg a uuid missing
+-- the dot or a character, so that it isn't joined as a name by mistake
+local function looks_like_match_id(value)
+	local head = value:match("^[^%.]*")
+	return head:match("^%x%x%x%x%x%x%x%x%-") ~= nil or (#head >= 32 and head:match("^[%x%-]+$") ~= nil)
+end
+
+--- Join a match by match id.
+-- @param socket Nakama Client Socket.
+-- @param match_id The id of the match.
+-- @param metadata Optional metadata (table) passed to the match handler.
+-- @param callback Optional callback function.
+-- @return The result, with the joined match and its presences as match.
+function M.match_join_by_id(socket, match_id, metadata, callback)
+	assert(socket, "You must provide a socket")
+	assert(is_match_id(match_id), "Argument 'match_id' must be a match id")
+	assert(metadata == nil or type(metadata) == "table", "Argument 'metadata' must be 'nil' or of type 'table'")
+	return socket_send(socket, messages.match_join(match_id, nil, metadata), callback)
+end
+
+--- Join a match by name. The match is created if there is no match with the
+-- name. Only relayed matches can be joined by name.
+-- @param socket Nakama Client Socket.
+-- @param name The name of the match.
+-- @param callback Optional callback function.
+-- @return The result, with the joined match and its presences as match.
+function M.match_join_by_name(socket, name, callback)
+	assert(socket, "You must provide a socket")
+	assert(type(name) == "string" and name ~= "", "Argument 'name' must be a non-empty string")
+	return socket_send(socket, messages.match_create(name), callback)
+end
+
+--- Join a match by match id, by matchmaker token or by name.
+-- The match is joined by name using match_join_by_name() if the match id
+-- isn't a match id and doesn't look like one either, eg "lobby". A malformed
+-- match id, eg a uuid without the dot, is an error.
+-- @param socket Nakama Client Socket.
+-- @param match_id The id or the name of the match, or nil to join using a token.
+-- @param token Optional matchmaker token.
+-- @param metadata Optional metadata (table) passed to the match handler.
+-- @param callback Optional callback function.
+-- @return The result, with the joined match and its presences as match.
+function M.match_join(socket, match_id, token, metadata, callback)
+	assert(socket, "You must provide a socket")
+	assert(match_id == nil or type(match_id) == "string", "Argument 'match_id' must be 'nil' or of type 'string'")
+	assert(token == nil or type(token) == "string", "Argument 'token' must be 'nil' or of type 'string'")
+	assert(match_id or token, "You must provide a match id, a match name or a token")
+	if token then
+		assert(metadata == nil or type(metadata) == "table", "Argument 'metadata' must be 'nil' or of type 'table'")
+		return socket_send(socket, messages.match_join(match_id, token, metadata), callback)
+	elseif is_match_id(match_id) then
+		return M.match_join_by_id(socket, match_id, metadata, callback)
+	end
+	assert(not looks_like_match_id(match_id), ("'%s' is not a valid match id, a match id is a uuid followed by a dot and a node name, eg 'b4a2e6a4-9a10-4a8f-8a57-5f3c2a8e9d11.'"):format(match_id))
+	assert(metadata == nil, "Metadata can't be passed when joining a match by name")
+	return M.match_join_by_name(socket, match_id, callback)
+end
+
+
+--- Find a match using the matchmaker and join it.
+-- This will block the current coroutine until the match has been joined.
+-- The matchmaker ticket is removed if no match has been found when the
+-- timeout has passed or the cancellation token is cancelled.
+-- @param socket Nakama Client Socket.
+-- @param query The matchmaker query, eg "*".
+-- @param min_count The min number of players.
+-- @param max_count The max number of players.
+-- @param timeout Optional timeout (seconds) for finding a match. Requires engine support for timers.
+-- @param cancellation_token Optional cancellation token to stop waiting for a
+-- match. Defaults to the cancellation token of nakama.sync().
+-- @return The joined match or nil and an error message ("timeout",
+-- "cancelled" or the message of a failed request).
+function M.quick_match(socket, query, min_count, max_count, timeout, cancellation_token)
+	assert(socket, "You must provide a socket")
+	assert(type(query) == "string", "You must provide a query")
+	assert(type(min_count) == "number" and type(max_count) == "number" and min_count <= max_count, "You must provide a min and max count")
+	assert(coroutine.running(), "You must be running this from within a coroutine")
+
+	local function error_message(result)
+		if not result then
+			return "No result"
+		end
+		return type(result.error) == "table" and result.error.message or tostring(result.error)
+	end
+
+	local result = M.matchmaker_add(socket, min_count, max_count, query)
+	if not result or result.error then
+		return nil, error_message(result)
+	end
+	local ticket = result.matchmaker_ticket.ticket
+
+	local matched, err = wait_for_event(socket, "matchmaker_matched", function(message)
+		return message.matchmaker_matched.ticket == ticket
+	end, timeout, cancellation_token)
+	if not matched then
+		M.matchmaker_remove(socket, ticket, function() end)
+		return nil, err
+	end
+
+	matched = matched.matchmaker_matched
+	local match_id = matched.match_id ~= "" and matched.match_id or nil
+	result = M.match_join(socket, match_id, matched.token)
+	if not result or result.error then
+		return nil, error_message(result)
+	end
+	return result.match
+end
+
+
+--- Add a handler for an event.
+-- Any number of handlers can be added for each event, in addition to the
+-- handler set using the on_* function of the event (eg on_match_data).
+-- @param socket Nakama Client Socket.
+-- @param event_id The event, for instance "match_data" or "disconnect".
+-- @param fn The callback function.
+-- @return Function which removes the handler.
+function M.on(socket, event_id, fn)
+	assert(socket, "You must provide a socket")
+	assert(type(event_id) == "string", "You must provide an event id")
+	assert(type(fn) == "function", "You must provide a function")
+	return add_handler(socket, event_id, fn)
+end
+
+
+--- Add a handler for an event which is removed after it has been called once.
+-- @param socket Nakama Client Socket.
+-- @param event_id The event, for instance "match_data" or "disconnect".
+-- @param fn The callback function.
+-- @return Function which removes the handler.
+function M.once(socket, event_id, fn)
+	assert(socket, "You must provide a socket")
+	assert(type(event_id) == "string", "You must provide an event id")
+	assert(type(fn) == "function", "You must provide a function")
+	return add_handler(socket, event_id, fn, true)
+end
+
+
 --- On disconnect hook.
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_disconnect(socket, fn)
 	assert(socket, "You must provide a socket")
-	socket.on_disconnect = fn
+	return set_handler(socket, "disconnect", fn)
+end
+
+
+--- Get the current presences of a joined match or channel.
+-- @param socket Nakama Client Socket.
+-- @param id The match or channel id.
+-- @return List of presences, including the presence of the current user.
+function M.get_presences(socket, id)
+	assert(socket, "You must provide a socket")
+	assert(type(id) == "string", "You must provide a match or channel id")
+	return presence_list(socket, id)
+end
+
+
+--- On presence change hook.
+-- Called with the match or channel id, the list of current presences and
+-- the lists of joined and left presences when joining a match or channel and
+-- when receiving a presence event for a joined match or channel.
+-- @param socket Nakama Client Socket.
+-- @param fn The callback function.
+-- @return Function which removes the callback function.
+function M.on_presence_change(socket, fn)
+	assert(socket, "You must provide a socket")
+	return set_handler(socket, "presence_change", fn)
+end
+
+
+--- On sequence gap hook.
+-- Called when config.track_sequence is enabled and a received message has a
+-- sequence number ('seq' or 'sequence') which doesn't follow the previous one.
+-- Messages are tracked per socket and match data is tracked per match and
+-- sender. The event contains the 'expected' and 'received' sequence numbers,
+-- the number of 'missing' messages and an 'out_of_order' flag. Events for
+-- match data also contain the 'match_id' and the 'presence' of the sender.
+-- @param socket Nakama Client Socket.
+-- @param fn The callback function.
+-- @return Function which removes the callback function.
+function M.on_sequence_gap(socket, fn)
+	assert(socket, "You must provide a socket")
+	return set_handler(socket, "sequence_gap", fn)
+end
+
+
+--- On resubscribe hook.
+-- Called once for each subscription restored after a reconnect when
+-- config.auto_resubscribe is enabled. The event contains the type of
+-- subscription (eg "channel_join" or "match_join"), the sent message, the
+-- result and a success flag. Matches which could not be rejoined are not
+-- restored again and have 'match_ended' set if the match no longer exists.
+-- @param socket Nakama Client Socket.
+-- @param fn The callback function.
+-- @return Function which removes the callback function.
+function M.on_resubscribe(socket, fn)
+	assert(socket, "You must provide a socket")
+	return set_handler(socket, "resubscribe", fn)
+end
+
+
+--- On lost hook.
+-- Called when the connection of the socket is lost, with a table with the
+-- 'reason' (the close reason, "heartbeat_timeout" if a ping wasn't answered
+-- (see config.socket_heartbeat), or "reconnect_failed" when out of reconnect
+-- attempts) and a 'reconnecting' flag which is true when the socket will be
+-- connected again automatically (see config.socket_reconnect).
+-- @param socket Nakama Client Socket.
+-- @param fn The callback function.
+-- @return Function which removes the callback function.
+function M.on_lost(socket, fn)
+	assert(socket, "You must provide a socket")
+	return set_handler(socket, "lost", fn)
+end
+
+
+--- On reconnected hook.
+-- Called when the socket has been connected again after it was disconnected,
+-- with a table with the number of reconnect 'attempts'. The messages
+-- restoring the subscriptions (see config.auto_resubscribe) and the pending
+-- sends have been sent when it is called.
+-- @param socket Nakama Client Socket.
+-- @param fn The callback function.
+-- @return Function which removes the callback function.
+function M.on_reconnected(socket, fn)
+	assert(socket, "You must provide a socket")
+	return set_handler(socket, "reconnected", fn)
+end
+
+
+--- On backpressure hook.
+-- Called when the number of pending sends reaches
+-- config.socket_backpressure_threshold, with a table with the number of
+-- 'pending' sends and the 'threshold'. Called again only after the number of
+-- pending sends has dropped below the threshold. Use it to throttle frequent
+-- messages such as position updates.
+-- @param socket Nakama Client Socket.
+-- @param fn The callback function.
+-- @return Function which removes the callback function.
+function M.on_backpressure(socket, fn)
+	assert(socket, "You must provide a socket")
+	return set_handler(socket, "backpressure", fn)
+end
+
+
+--- On drain hook.
+-- Called when all pending sends have been sent or have timed out.
+-- @param socket Nakama Client Socket.
+-- @param fn The callback function.
+-- @return Function which removes the callback function.
+function M.on_drain(socket, fn)
+	assert(socket, "You must provide a socket")
+	return set_handler(socket, "drain", fn)
 end
 
 
@@ -103,18 +1406,7 @@ end
 -- @param callback
 function M.channel_join(socket, target, type, persistence, hidden, callback)
 	assert(socket)
-	assert(target == nil or _G.type(target) == 'string')
-	assert(type == nil or _G.type(type) == 'number')
-	assert(persistence == nil or _G.type(persistence) == 'boolean')
-	assert(hidden == nil or _G.type(hidden) == 'boolean')
-	local message = {
-		channel_join = {
-			target = target,
-			type = type,
-			persistence = persistence,
-			hidden = hidden,
-		}
-	}
+	local message = messages.channel_join(target, type, persistence, hidden)
 	return socket_send(socket, message, callback)
 end
 
@@ -124,12 +1416,7 @@ end
 -- @param callback
 function M.channel_leave(socket, channel_id, callback)
 	assert(socket)
-	assert(channel_id == nil or _G.type(channel_id) == 'string')
-	local message = {
-		channel_leave = {
-			channel_id = channel_id,
-		}
-	}
+	local message = messages.channel_leave(channel_id)
 	return socket_send(socket, message, callback)
 end
 
@@ -140,14 +1427,7 @@ end
 -- @param callback
 function M.channel_message_send(socket, channel_id, content, callback)
 	assert(socket)
-	assert(channel_id == nil or _G.type(channel_id) == 'string')
-	assert(content == nil or _G.type(content) == 'string')
-	local message = {
-		channel_message_send = {
-			channel_id = channel_id,
-			content = content,
-		}
-	}
+	local message = messages.channel_message_send(channel_id, content)
 	return socket_send(socket, message, callback)
 end
 
@@ -158,14 +1438,7 @@ end
 -- @param callback
 function M.channel_message_remove(socket, channel_id, message_id, callback)
 	assert(socket)
-	assert(channel_id == nil or _G.type(channel_id) == 'string')
-	assert(message_id == nil or _G.type(message_id) == 'string')
-	local message = {
-		channel_message_remove = {
-			channel_id = channel_id,
-			message_id = message_id,
-		}
-	}
+	local message = messages.channel_message_remove(channel_id, message_id)
 	return socket_send(socket, message, callback)
 end
 
@@ -177,16 +1450,7 @@ end
 -- @param callback
 function M.channel_message_update(socket, channel_id, message_id, content, callback)
 	assert(socket)
-	assert(channel_id == nil or _G.type(channel_id) == 'string')
-	assert(message_id == nil or _G.type(message_id) == 'string')
-	assert(content == nil or _G.type(content) == 'string')
-	local message = {
-		channel_message_update = {
-			channel_id = channel_id,
-			message_id = message_id,
-			content = content,
-		}
-	}
+	local message = messages.channel_message_update(channel_id, message_id, content)
 	return socket_send(socket, message, callback)
 end
 
@@ -200,20 +1464,7 @@ end
 -- @param callback
 function M.match_data_send(socket, match_id, op_code, data, presences, reliable, callback)
 	assert(socket)
-	assert(match_id == nil or _G.type(match_id) == 'string')
-	assert(op_code == nil or _G.type(op_code) == 'number')
-	assert(data == nil or _G.type(data) == 'string')
-	assert(presences == nil or _G.type(presences) == 'table')
-	assert(reliable == nil or _G.type(reliable) == 'boolean')
-	local message = {
-		match_data_send = {
-			match_id = match_id,
-			op_code = op_code,
-			data = data,
-			presences = presences,
-			reliable = reliable,
-		}
-	}
+	local message = messages.match_data_send(match_id, op_code, data, presences, reliable)
 	return socket_send(socket, message, callback)
 end
 
@@ -223,33 +1474,7 @@ end
 -- @param callback
 function M.match_create(socket, name, callback)
 	assert(socket)
-	assert(name == nil or _G.type(name) == 'string')
-	local message = {
-		match_create = {
-			name = name,
-		}
-	}
-	return socket_send(socket, message, callback)
-end
-
---- match_join
--- @param socket
--- @param match_id
--- @param token
--- @param metadata
--- @param callback
-function M.match_join(socket, match_id, token, metadata, callback)
-	assert(socket)
-	assert(match_id == nil or _G.type(match_id) == 'string')
-	assert(token == nil or _G.type(token) == 'string')
-	assert(metadata == nil or _G.type(metadata) == 'table')
-	local message = {
-		match_join = {
-			match_id = match_id,
-			token = token,
-			metadata = metadata,
-		}
-	}
+	local message = messages.match_create(name)
 	return socket_send(socket, message, callback)
 end
 
@@ -259,12 +1484,7 @@ end
 -- @param callback
 function M.match_leave(socket, match_id, callback)
 	assert(socket)
-	assert(match_id == nil or _G.type(match_id) == 'string')
-	local message = {
-		match_leave = {
-			match_id = match_id,
-		}
-	}
+	local message = messages.match_leave(match_id)
 	return socket_send(socket, message, callback)
 end
 
@@ -279,22 +1499,7 @@ end
 -- @param callback
 function M.matchmaker_add(socket, min_count, max_count, query, string_properties, numeric_properties, count_multiple, callback)
 	assert(socket)
-	assert(min_count == nil or _G.type(min_count) == 'number')
-	assert(max_count == nil or _G.type(max_count) == 'number')
-	assert(query == nil or _G.type(query) == 'string')
-	assert(string_properties == nil or _G.type(string_properties) == 'table')
-	assert(numeric_properties == nil or _G.type(numeric_properties) == 'table')
-	assert(count_multiple == nil or _G.type(count_multiple) == 'number')
-	local message = {
-		matchmaker_add = {
-			min_count = min_count,
-			max_count = max_count,
-			query = query,
-			string_properties = string_properties,
-			numeric_properties = numeric_properties,
-			count_multiple = count_multiple,
-		}
-	}
+	local message = messages.matchmaker_add(min_count, max_count, query, string_properties, numeric_properties, count_multiple)
 	return socket_send(socket, message, callback)
 end
 
@@ -304,12 +1509,7 @@ end
 -- @param callback
 function M.matchmaker_remove(socket, ticket, callback)
 	assert(socket)
-	assert(ticket == nil or _G.type(ticket) == 'string')
-	local message = {
-		matchmaker_remove = {
-			ticket = ticket,
-		}
-	}
+	local message = messages.matchmaker_remove(ticket)
 	return socket_send(socket, message, callback)
 end
 
@@ -320,14 +1520,7 @@ end
 -- @param callback
 function M.party_create(socket, open, max_size, callback)
 	assert(socket)
-	assert(open == nil or _G.type(open) == 'boolean')
-	assert(max_size == nil or _G.type(max_size) == 'number')
-	local message = {
-		party_create = {
-			open = open,
-			max_size = max_size,
-		}
-	}
+	local message = messages.party_create(open, max_size)
 	return socket_send(socket, message, callback)
 end
 
@@ -337,12 +1530,7 @@ end
 -- @param callback
 function M.party_join(socket, party_id, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	local message = {
-		party_join = {
-			party_id = party_id,
-		}
-	}
+	local message = messages.party_join(party_id)
 	return socket_send(socket, message, callback)
 end
 
@@ -352,12 +1540,7 @@ end
 -- @param callback
 function M.party_leave(socket, party_id, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	local message = {
-		party_leave = {
-			party_id = party_id,
-		}
-	}
+	local message = messages.party_leave(party_id)
 	return socket_send(socket, message, callback)
 end
 
@@ -368,14 +1551,7 @@ end
 -- @param callback
 function M.party_promote(socket, party_id, presence, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	assert(presence == nil or _G.type(presence) == 'table')
-	local message = {
-		party_promote = {
-			party_id = party_id,
-			presence = presence,
-		}
-	}
+	local message = messages.party_promote(party_id, presence)
 	return socket_send(socket, message, callback)
 end
 
@@ -386,14 +1562,7 @@ end
 -- @param callback
 function M.party_accept(socket, party_id, presence, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	assert(presence == nil or _G.type(presence) == 'table')
-	local message = {
-		party_accept = {
-			party_id = party_id,
-			presence = presence,
-		}
-	}
+	local message = messages.party_accept(party_id, presence)
 	return socket_send(socket, message, callback)
 end
 
@@ -404,14 +1573,7 @@ end
 -- @param callback
 function M.party_remove(socket, party_id, presence, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	assert(presence == nil or _G.type(presence) == 'table')
-	local message = {
-		party_remove = {
-			party_id = party_id,
-			presence = presence,
-		}
-	}
+	local message = messages.party_remove(party_id, presence)
 	return socket_send(socket, message, callback)
 end
 
@@ -421,12 +1583,7 @@ end
 -- @param callback
 function M.party_close(socket, party_id, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	local message = {
-		party_close = {
-			party_id = party_id,
-		}
-	}
+	local message = messages.party_close(party_id)
 	return socket_send(socket, message, callback)
 end
 
@@ -436,12 +1593,7 @@ end
 -- @param callback
 function M.party_join_request_list(socket, party_id, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	local message = {
-		party_join_request_list = {
-			party_id = party_id,
-		}
-	}
+	local message = messages.party_join_request_list(party_id)
 	return socket_send(socket, message, callback)
 end
 
@@ -457,24 +1609,7 @@ end
 -- @param callback
 function M.party_matchmaker_add(socket, party_id, min_count, max_count, query, string_properties, numeric_properties, count_multiple, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	assert(min_count == nil or _G.type(min_count) == 'number')
-	assert(max_count == nil or _G.type(max_count) == 'number')
-	assert(query == nil or _G.type(query) == 'string')
-	assert(string_properties == nil or _G.type(string_properties) == 'table')
-	assert(numeric_properties == nil or _G.type(numeric_properties) == 'table')
-	assert(count_multiple == nil or _G.type(count_multiple) == 'number')
-	local message = {
-		party_matchmaker_add = {
-			party_id = party_id,
-			min_count = min_count,
-			max_count = max_count,
-			query = query,
-			string_properties = string_properties,
-			numeric_properties = numeric_properties,
-			count_multiple = count_multiple,
-		}
-	}
+	local message = messages.party_matchmaker_add(party_id, min_count, max_count, query, string_properties, numeric_properties, count_multiple)
 	return socket_send(socket, message, callback)
 end
 
@@ -485,14 +1620,7 @@ end
 -- @param callback
 function M.party_matchmaker_remove(socket, party_id, ticket, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	assert(ticket == nil or _G.type(ticket) == 'string')
-	local message = {
-		party_matchmaker_remove = {
-			party_id = party_id,
-			ticket = ticket,
-		}
-	}
+	local message = messages.party_matchmaker_remove(party_id, ticket)
 	return socket_send(socket, message, callback)
 end
 
@@ -504,16 +1632,7 @@ end
 -- @param callback
 function M.party_data_send(socket, party_id, op_code, data, callback)
 	assert(socket)
-	assert(party_id == nil or _G.type(party_id) == 'string')
-	assert(op_code == nil or _G.type(op_code) == 'number')
-	assert(data == nil or _G.type(data) == 'string')
-	local message = {
-		party_data_send = {
-			party_id = party_id,
-			op_code = op_code,
-			data = data,
-		}
-	}
+	local message = messages.party_data_send(party_id, op_code, data)
 	return socket_send(socket, message, callback)
 end
 
@@ -524,14 +1643,7 @@ end
 -- @param callback
 function M.status_follow(socket, user_ids, usernames, callback)
 	assert(socket)
-	assert(user_ids == nil or _G.type(user_ids) == 'string')
-	assert(usernames == nil or _G.type(usernames) == 'string')
-	local message = {
-		status_follow = {
-			user_ids = user_ids,
-			usernames = usernames,
-		}
-	}
+	local message = messages.status_follow(user_ids, usernames)
 	return socket_send(socket, message, callback)
 end
 
@@ -541,12 +1653,7 @@ end
 -- @param callback
 function M.status_unfollow(socket, user_ids, callback)
 	assert(socket)
-	assert(user_ids == nil or _G.type(user_ids) == 'string')
-	local message = {
-		status_unfollow = {
-			user_ids = user_ids,
-		}
-	}
+	local message = messages.status_unfollow(user_ids)
 	return socket_send(socket, message, callback)
 end
 
@@ -556,12 +1663,7 @@ end
 -- @param callback
 function M.status_update(socket, status, callback)
 	assert(socket)
-	assert(status == nil or _G.type(status) == 'string')
-	local message = {
-		status_update = {
-			status = status,
-		}
-	}
+	local message = messages.status_update(status)
 	return socket_send(socket, message, callback)
 end
 
@@ -590,145 +1692,151 @@ end
 --- on_channel_presence_event
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_channel_presence_event(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.channel_presence_event = fn
+	return set_handler(socket, "channel_presence_event", fn)
 end
 
 --- on_match_presence_event
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_match_presence_event(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.match_presence_event = fn
-end
-
---- on_match_data
--- @param socket Nakama Client Socket.
--- @param fn The callback function.
-function M.on_match_data(socket, fn)
-	assert(socket, "You must provide a socket")
-	assert(fn, "You must provide a function")
-	socket.events.match_data = fn
+	return set_handler(socket, "match_presence_event", fn)
 end
 
 --- on_match
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_match(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.match = fn
+	return set_handler(socket, "match", fn)
 end
 
 --- on_matchmaker_matched
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_matchmaker_matched(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.matchmaker_matched = fn
+	return set_handler(socket, "matchmaker_matched", fn)
 end
 
 --- on_notifications
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_notifications(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.notifications = fn
+	return set_handler(socket, "notifications", fn)
 end
 
 --- on_party_presence_event
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_party_presence_event(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.party_presence_event = fn
+	return set_handler(socket, "party_presence_event", fn)
 end
 
 --- on_party
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_party(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.party = fn
+	return set_handler(socket, "party", fn)
 end
 
 --- on_party_data
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_party_data(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.party_data = fn
+	return set_handler(socket, "party_data", fn)
 end
 
 --- on_party_join_request
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_party_join_request(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.party_join_request = fn
+	return set_handler(socket, "party_join_request", fn)
 end
 
 --- on_party_leader
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_party_leader(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.party_leader = fn
+	return set_handler(socket, "party_leader", fn)
 end
 
 --- on_status_presence_event
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_status_presence_event(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.status_presence_event = fn
+	return set_handler(socket, "status_presence_event", fn)
 end
 
 --- on_status
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_status(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.status = fn
+	return set_handler(socket, "status", fn)
 end
 
 --- on_stream_data
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_stream_data(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.stream_data = fn
+	return set_handler(socket, "stream_data", fn)
 end
 
 --- on_error
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_error(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.error = fn
+	return set_handler(socket, "error", fn)
 end
 
 --- on_channel_message
 -- @param socket Nakama Client Socket.
 -- @param fn The callback function.
+-- @return Function which removes the callback function.
 function M.on_channel_message(socket, fn)
 	assert(socket, "You must provide a socket")
 	assert(fn, "You must provide a function")
-	socket.events.channel_message = fn
+	return set_handler(socket, "channel_message", fn)
 end
 
 
@@ -0,0 +1,405 @@
+--[[--
+Create Nakama realtime socket messages.
+
+@module nakama.socket_messages
+]]
+
+local M = {}
+
+--- Create a channel_join message.
+-- @param target (string)
+-- @param type (number)
+-- @param persistence (boolean)
+-- @param hidden (boolean)
+-- @return The message.
+function M.channel_join(target, type, persistence, hidden)
+	assert(target == nil or _G.type(target) == 'string', "Argument 'target' must be 'nil' or of type 'string'")
+	assert(type == nil or _G.type(type) == 'number', "Argument 'type' must be 'nil' or of type 'number'")
+	assert(persistence == nil or _G.type(persistence) == 'boolean', "Argument 'persistence' must be 'nil' or of type 'boolean'")
+	assert(hidden == nil or _G.type(hidden) == 'boolean', "Argument 'hidden' must be 'nil' or of type 'boolean'")
+	return {
+		channel_join = {
+			target = target,
+			type = type,
+			persistence = persistence,
+			hidden = hidden,
+		}
+	}
+end
+
+--- Create a channel_leave message.
+-- @param channel_id (string)
+-- @return The message.
+function M.channel_leave(channel_id)
+	assert(channel_id == nil or _G.type(channel_id) == 'string', "Argument 'channel_id' must be 'nil' or of type 'string'")
+	return {
+		channel_leave = {
+			channel_id = channel_id,
+		}
+	}
+end
+
+--- Create a channel_message_send message.
+-- @param channel_id (string)
+-- @param content (string)
+-- @return The message.
+function M.channel_message_send(channel_id, content)
+	assert(channel_id == nil or _G.type(channel_id) == 'string', "Argument 'channel_id' must be 'nil' or of type 'string'")
+	assert(content == nil or _G.type(content) == 'string', "Argument 'content' must be 'nil' or of type 'string'")
+	return {
+		channel_message_send = {
+			channel_id = channel_id,
+			content = content,
+		}
+	}
+end
+
+--- Create a channel_message_remove message.
+-- @param channel_id (string)
+-- @param message_id (string)
+-- @return The message.
+function M.channel_message_remove(channel_id, message_id)
+	assert(channel_id == nil or _G.type(channel_id) == 'string', "Argument 'channel_id' must be 'nil' or of type 'string'")
+	assert(message_id == nil or _G.type(message_id) == 'string', "Argument 'message_id' must be 'nil' or of type 'string'")
+	return {
+		channel_message_remove = {
+			channel_id = channel_id,
+			message_id = message_id,
+		}
+	}
+end
+
+--- Create a channel_message_update message.
+-- @param channel_id (string)
+-- @param message_id (string)
+-- @param content (string)
+-- @return The message.
+function M.channel_message_update(channel_id, message_id, content)
+	assert(channel_id == nil or _G.type(channel_id) == 'string', "Argument 'channel_id' must be 'nil' or of type 'string'")
+	assert(message_id == nil or _G.type(message_id) == 'string', "Argument 'message_id' must be 'nil' or of type 'string'")
+	assert(content == nil or _G.type(content) == 'string', "Argument 'content' must be 'nil' or of type 'string'")
+	return {
+		channel_message_update = {
+			channel_id = channel_id,
+			message_id = message_id,
+			content = content,
+		}
+	}
+end
+
+--- Create a match_data_send message.
+-- @param match_id (string)
+-- @param op_code (number)
+-- @param data (string)
+-- @param presences (table)
+-- @param reliable (boolean)
+-- @return The message.
+function M.match_data_send(match_id, op_code, data, presences, reliable)
+	assert(match_id == nil or _G.type(match_id) == 'string', "Argument 'match_id' must be 'nil' or of type 'string'")
+	assert(op_code == nil or _G.type(op_code) == 'number', "Argument 'op_code' must be 'nil' or of type 'number'")
+	assert(data == nil or _G.type(data) == 'string', "Argument 'data' must be 'nil' or of type 'string'")
+	assert(presences == nil or _G.type(presences) == 'table', "Argument 'presences' must be 'nil' or of type 'table'")
+	assert(reliable == nil or _G.type(reliable) == 'boolean', "Argument 'reliable' must be 'nil' or of type 'boolean'")
+	return {
+		match_data_send = {
+			match_id = match_id,
+			op_code = op_code,
+			data = data,
+			presences = presences,
+			reliable = reliable,
+		}
+	}
+end
+
+--- Create a match_create message.
+-- @param name (string)
+-- @return The message.
+function M.match_create(name)
+	assert(name == nil or _G.type(name) == 'string', "Argument 'name' must be 'nil' or of type 'string'")
+	return {
+		match_create = {
+			name = name,
+		}
+	}
+end
+
+--- Create a match_join message.
+-- @param match_id (string)
+-- @param token (string)
+-- @param metadata (table)
+-- @return The message.
+function M.match_join(match_id, token, metadata)
+	assert(match_id == nil or _G.type(match_id) == 'string', "Argument 'match_id' must be 'nil' or of type 'string'")
+	assert(token == nil or _G.type(token) == 'string', "Argument 'token' must be 'nil' or of type 'string'")
+	assert(metadata == nil or _G.type(metadata) == 'table', "Argument 'metadata' must be 'nil' or of type 'table'")
+	return {
+		match_join = {
+			match_id = match_id,
+			token = token,
+			metadata = metadata,
+		}
+	}
+end
+
+--- Create a match_leave message.
+-- @param match_id (string)
+-- @return The message.
+function M.match_leave(match_id)
+	assert(match_id == nil or _G.type(match_id) == 'string', "Argument 'match_id' must be 'nil' or of type 'string'")
+	return {
+		match_leave = {
+			match_id = match_id,
+		}
+	}
+end
+
+--- Create a matchmaker_add message.
+-- @param min_count (number)
+-- @param max_count (number)
+-- @param query (string)
+-- @param string_properties (table)
+-- @param numeric_properties (table)
+-- @param count_multiple (number)
+-- @return The message.
+function M.matchmaker_add(min_count, max_count, query, string_properties, numeric_properties, count_multiple)
+	assert(min_count == nil or _G.type(min_count) == 'number', "Argument 'min_count' must be 'nil' or of type 'number'")
+	assert(max_count == nil or _G.type(max_count) == 'number', "Argument 'max_count' must be 'nil' or of type 'number'")
+	assert(query == nil or _G.type(query) == 'string', "Argument 'query' must be 'nil' or of type 'string'")
+	assert(string_properties == nil or _G.type(string_properties) == 'table', "Argument 'string_properties' must be 'nil' or of type 'table'")
+	assert(numeric_properties == nil or _G.type(numeric_properties) == 'table', "Argument 'numeric_properties' must be 'nil' or of type 'table'")
+	assert(count_multiple == nil or _G.type(count_multiple) == 'number', "Argument 'count_multiple' must be 'nil' or of type 'number'")
+	return {
+		matchmaker_add = {
+			min_count = min_count,
+			max_count = max_count,
+			query = query,
+			string_properties = string_properties,
+			numeric_properties = numeric_properties,
+			count_multiple = count_multiple,
+		}
+	}
+end
+
+--- Create a matchmaker_remove message.
+-- @param ticket (string)
+-- @return The message.
+function M.matchmaker_remove(ticket)
+	assert(ticket == nil or _G.type(ticket) == 'string', "Argument 'ticket' must be 'nil' or of type 'string'")
+	return {
+		matchmaker_remove = {
+			ticket = ticket,
+		}
+	}
+end
+
+--- Create a party_create message.
+-- @param open (boolean)
+-- @param max_size (number)
+-- @return The message.
+function M.party_create(open, max_size)
+	assert(open == nil or _G.type(open) == 'boolean', "Argument 'open' must be 'nil' or of type 'boolean'")
+	assert(max_size == nil or _G.type(max_size) == 'number', "Argument 'max_size' must be 'nil' or of type 'number'")
+	return {
+		party_create = {
+			open = open,
+			max_size = max_size,
+		}
+	}
+end
+
+--- Create a party_join message.
+-- @param party_id (string)
+-- @return The message.
+function M.party_join(party_id)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	return {
+		party_join = {
+			party_id = party_id,
+		}
+	}
+end
+
+--- Create a party_leave message.
+-- @param party_id (string)
+-- @return The message.
+function M.party_leave(party_id)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	return {
+		party_leave = {
+			party_id = party_id,
+		}
+	}
+end
+
+--- Create a party_promote message.
+-- @param party_id (string)
+-- @param presence (table)
+-- @return The message.
+function M.party_promote(party_id, presence)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	assert(presence == nil or _G.type(presence) == 'table', "Argument 'presence' must be 'nil' or of type 'table'")
+	return {
+		party_promote = {
+			party_id = party_id,
+			presence = presence,
+		}
+	}
+end
+
+--- Create a party_accept message.
+-- @param party_id (string)
+-- @param presence (table)
+-- @return The message.
+function M.party_accept(party_id, presence)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	assert(presence == nil or _G.type(presence) == 'table', "Argument 'presence' must be 'nil' or of type 'table'")
+	return {
+		party_accept = {
+			party_id = party_id,
+			presence = presence,
+		}
+	}
+end
+
+--- Create a party_remove message.
+-- @param party_id (string)
+-- @param presence (table)
+-- @return The message.
+function M.party_remove(party_id, presence)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	assert(presence == nil or _G.type(presence) == 'table', "Argument 'presence' must be 'nil' or of type 'table'")
+	return {
+		party_remove = {
+			party_id = party_id,
+			presence = presence,
+		}
+	}
+end
+
+--- Create a party_close message.
+-- @param party_id (string)
+-- @return The message.
+function M.party_close(party_id)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	return {
+		party_close = {
+			party_id = party_id,
+		}
+	}
+end
+
+--- Create a party_join_request_list message.
+-- @param party_id (string)
+-- @return The message.
+function M.party_join_request_list(party_id)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	return {
+		party_join_request_list = {
+			party_id = party_id,
+		}
+	}
+end
+
+--- Create a party_matchmaker_add message.
+-- @param party_id (string)
+-- @param min_count (number)
+-- @param max_count (number)
+-- @param query (string)
+-- @param string_properties (table)
+-- @param numeric_properties (table)
+-- @param count_multiple (number)
+-- @return The message.
+function M.party_matchmaker_add(party_id, min_count, max_count, query, string_properties, numeric_properties, count_multiple)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	assert(min_count == nil or _G.type(min_count) == 'number', "Argument 'min_count' must be 'nil' or of type 'number'")
+	assert(max_count == nil or _G.type(max_count) == 'number', "Argument 'max_count' must be 'nil' or of type 'number'")
+	assert(query == nil or _G.type(query) == 'string', "Argument 'query' must be 'nil' or of type 'string'")
+	assert(string_properties == nil or _G.type(string_properties) == 'table', "Argument 'string_properties' must be 'nil' or of type 'table'")
+	assert(numeric_properties == nil or _G.type(numeric_properties) == 'table', "Argument 'numeric_properties' must be 'nil' or of type 'table'")
+	assert(count_multiple == nil or _G.type(count_multiple) == 'number', "Argument 'count_multiple' must be 'nil' or of type 'number'")
+	return {
+		party_matchmaker_add = {
+			party_id = party_id,
+			min_count = min_count,
+			max_count = max_count,
+			query = query,
+			string_properties = string_properties,
+			numeric_properties = numeric_properties,
+			count_multiple = count_multiple,
+		}
+	}
+end
+
+--- Create a party_matchmaker_remove message.
+-- @param party_id (string)
+-- @param ticket (string)
+-- @return The message.
+function M.party_matchmaker_remove(party_id, ticket)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	assert(ticket == nil or _G.type(ticket) == 'string', "Argument 'ticket' must be 'nil' or of type 'string'")
+	return {
+		party_matchmaker_remove = {
+			party_id = party_id,
+			ticket = ticket,
+		}
+	}
+end
+
+--- Create a party_data_send message.
+-- @param party_id (string)
+-- @param op_code (number)
+-- @param data (string)
+-- @return The message.
+function M.party_data_send(party_id, op_code, data)
+	assert(party_id == nil or _G.type(party_id) == 'string', "Argument 'party_id' must be 'nil' or of type 'string'")
+	assert(op_code == nil or _G.type(op_code) == 'number', "Argument 'op_code' must be 'nil' or of type 'number'")
+	assert(data == nil or _G.type(data) == 'string', "Argument 'data' must be 'nil' or of type 'string'")
+	return {
+		party_data_send = {
+			party_id = party_id,
+			op_code = op_code,
+			data = data,
+		}
+	}
+end
+
+--- Create a status_follow message.
+-- @param user_ids (table)
+-- @param usernames (table)
+-- @return The message.
+function M.status_follow(user_ids, usernames)
+	assert(user_ids == nil or _G.type(user_ids) == 'table', "Argument 'user_ids' must be 'nil' or of type 'table'")
+	assert(usernames == nil or _G.type(usernames) == 'table', "Argument 'usernames' must be 'nil' or of type 'table'")
+	return {
+		status_follow = {
+			user_ids = user_ids,
+			usernames = usernames,
+		}
+	}
+end
+
+--- Create a status_unfollow message.
+-- @param user_ids (table)
+-- @return The message.
+function M.status_unfollow(user_ids)
+	assert(user_ids == nil or _G.type(user_ids) == 'table', "Argument 'user_ids' must be 'nil' or of type 'table'")
+	return {
+		status_unfollow = {
+			user_ids = user_ids,
+		}
+	}
+end
+
+--- Create a status_update message.
+-- @param status (string)
+-- @return The message.
+function M.status_update(status)
+	assert(status == nil or _G.type(status) == 'string', "Argument 'status' must be 'nil' or of type 'string'")
+	return {
+		status_update = {
+			status = status,
+		}
+	}
+end
+
+return M
@@ -8,6 +8,28 @@ local M = {}
 
 local unpack = _G.unpack or table.unpack
 
+local function pack(...)
+	return { n = select("#", ...), ... }
+end
+
+-- functions called when a coroutine fails after being resumed by async()
+local error_handlers = setmetatable({}, { __mode = "k" })
+
+--- The cancellation tokens of coroutines, eg of a coroutine run using
+-- nakama.sync() with a cancellation token, keyed by coroutine.
+M.cancellation_tokens = setmetatable({}, { __mode = "k" })
+
+
+--- Set a function to call when a coroutine fails after it has been resumed
+-- by the callback of async(), eg when a response has been received, to
+-- release what the coroutine was using.
+-- @param co The coroutine.
+-- @param fn Function called with the coroutine and the error, or nil to remove it.
+function M.on_error(co, fn)
+	assert(type(co) == "thread", "You must provide a coroutine")
+	error_handlers[co] = fn
+end
+
 
 --- Execute a function asynchronously as a coroutines and return the result.
 -- @param fn The function to execute.
@@ -23,7 +45,14 @@ function M.async(fn, ...)
 		results = { ... }
 		if state == "YIELDED" then
 			local ok, err = coroutine.resume(co)
-			if not ok then print(err) end
+			if not ok then
+				print(err)
+				local handler = error_handlers[co]
+				if handler then
+					error_handlers[co] = nil
+					handler(co, err)
+				end
+			end
 		else
 			state = "DONE"
 		end
@@ -37,6 +66,128 @@ function M.async(fn, ...)
 end
 
 
+--- Wrap a callback style function so that it can be called from a coroutine,
+-- for instance from within nakama.sync(). The callback is added as the last
+-- argument when the function is called, so any optional arguments before the
+-- callback must be passed (as nil), eg promisify(client.get_users)(ids, nil, nil).
+--
+-- The call can't be cancelled using the cancellation token of nakama.sync().
+-- If a cancellation token is provided the coroutine is resumed without any
+-- result when the token is cancelled, and a later call of the callback is
+-- ignored. The token isn't passed to the wrapped function.
+-- @param callback_fn The callback style function.
+-- @param cancellation_token Optional cancellation token (see nakama.cancellation_token()).
+-- @return Function returning the values passed to the callback.
+function M.promisify(callback_fn, cancellation_token)
+	assert(type(callback_fn) == "function", "You must provide a function")
+	return function(...)
+		local args = { ... }
+		local count = select("#", ...)
+		return M.async(function(done)
+			if cancellation_token then
+				if cancellation_token.cancelled then
+					done()
+					return
+				end
+				local resumed = false
+				local function resume(...)
+					if not resumed then
+						resumed = true
+						done(...)
+					end
+				end
+				table.insert(cancellation_token.on_cancel, function() resume() end)
+				args[count + 1] = resume
+			else
+				args[count + 1] = done
+			end
+			callback_fn(unpack(args, 1, count + 1))
+		end)
+	end
+end
+
+--- Wrap a function using coroutine style calls so that it can be called with
+-- a callback instead. The callback is passed as the last argument and is called
+-- with the values returned by the function, which is run in a new coroutine.
+--
+-- Calls made in the coroutine are not cancelled by a cancellation token
+-- unless the token is passed to the calls. Use nakama.sync() with a
+-- cancellation token instead to cancel all calls. If a cancellation token is
+-- provided the callback isn't called if the token has been cancelled when the
+-- function returns.
+-- @param coroutine_fn The coroutine style function.
+-- @param cancellation_token Optional cancellation token (see nakama.cancellation_token()).
+-- @return Function taking the arguments of coroutine_fn followed by a callback.
+function M.callbackify(coroutine_fn, cancellation_token)
+	assert(type(coroutine_fn) == "function", "You must provide a function")
+	return function(...)
+		local count = select("#", ...)
+		local args = { ... }
+		local callback = args[count]
+		assert(type(callback) == "function", "You must provide a callback as the last argument")
+		local co = coroutine.create(function()
+			local results = pack(coroutine_fn(unpack(args, 1, count - 1)))
+			if not cancellation_token or not cancellation_token.cancelled then
+				callback(unpack(results, 1, results.n))
+			end
+		end)
+		local ok, err = coroutine.resume(co)
+		if not ok then print(err) end
+	end
+end
+
+
+--- Run callback style functions concurrently and return their results once
+-- all of them have completed. Must be called from a coroutine.
+-- @param fns List of functions, each called with a callback to call with its result.
+-- @param concurrency Optional max number of functions running at the same
+-- time. All functions are started at once by default.
+-- @return List with the result of each function, in the order of the functions.
+function M.all(fns, concurrency)
+	assert(type(fns) == "table", "You must provide a list of functions")
+	assert(not concurrency or (type(concurrency) == "number" and concurrency >= 1), "The concurrency must be nil or a positive number")
+	local results = {}
+	if #fns == 0 then
+		return results
+	end
+	concurrency = math.min(concurrency or #fns, #fns)
+	return M.async(function(done)
+		local started = 0
+		local finished = 0
+		local starting = false
+		-- start functions until the max concurrency is reached. Functions
+		-- calling the callback right away let the loop start more functions.
+		local function start()
+			if starting then
+				return
+			end
+			starting = true
+			while started < #fns and started - finished < concurrency do
+				started = started + 1
+				local i = started
+				local called = false
+				fns[i](function(result)
+					-- ignore the callback being called more than once
+					if called then
+						return
+					end
+					called = true
+					results[i] = result
+					finished = finished + 1
+					if finished == #fns then
+						done(results)
+					else
+						start()
+					end
+				end)
+			end
+			starting = false
+		end
+		start()
+	end)
+end
+
+
 setmetatable(M, {
 	__call = function(t, ...)
 		return M.async(...)
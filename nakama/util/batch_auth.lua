@@ -0,0 +1,91 @@
+--[[--
+Authenticate or refresh the sessions of many clients concurrently.
+
+This is meant for load testing and tooling which use many clients. Each
+client is authenticated with its own options and the bearer token of the
+client is set when it has been authenticated. A failure doesn't stop the
+other clients from being authenticated.
+
+@module nakama.util.batch_auth
+]]
+
+local async = require "nakama.util.async"
+
+local M = {}
+
+-- authenticate a client using the type of account in the options, or refresh
+-- its session if a refresh token is provided. Options without any of them
+-- fail with an error result.
+local function authenticate(client, opts, callback)
+	if opts.refresh_token then
+		client.session_refresh(opts.refresh_token, opts.vars, callback)
+	elseif opts.device then
+		client.authenticate_device(opts.device, opts.vars, opts.create, opts.username, callback)
+	elseif opts.custom then
+		client.authenticate_custom(opts.custom, opts.vars, opts.create, opts.username, callback)
+	elseif opts.email then
+		client.authenticate_email(opts.email, opts.password, opts.vars, opts.create, opts.username, callback)
+	else
+		callback({ error = true, message = "The options must have a 'refresh_token', 'device', 'custom' or 'email'" })
+	end
+end
+
+
+--- Authenticate or refresh the sessions of clients.
+-- Must be called from a coroutine, eg using nakama.sync().
+-- @param clients List of clients.
+-- @param auth_opts Options of each client, or function called with a client
+-- and its index returning the options. The options have either a
+-- 'refresh_token' to refresh the session, or a 'device', 'custom' or 'email'
+-- (and 'password') to authenticate with, and optional 'vars', and 'create'
+-- and 'username' when authenticating.
+-- @param concurrency Optional max number of clients to authenticate at the
+-- same time (default 10).
+-- @return Table with a list of 'results', one per client in the order of the
+-- clients, each with the 'client' and the 'session' or the 'error' (error
+-- result or message), the number of clients which 'succeeded' and 'failed',
+-- and a list of the 'errors', each with the 'index' of the client and the 'error'.
+function M.run(clients, auth_opts, concurrency)
+	assert(type(clients) == "table", "You must provide a list of clients")
+	assert(type(auth_opts) == "table" or type(auth_opts) == "function", "You must provide the options or a function returning them")
+
+	local fns = {}
+	for i,client in ipairs(clients) do
+		fns[i] = function(done)
+			local ok, err = pcall(function()
+				local opts = type(auth_opts) == "function" and auth_opts(client, i) or auth_opts
+				authenticate(client, opts, done)
+			end)
+			if not ok then
+				done({ error = true, message = tostring(err) })
+			end
+		end
+	end
+	local results = async.all(fns, concurrency or 10)
+
+	local batch = { results = {}, succeeded = 0, failed = 0, errors = {} }
+	for i,client in ipairs(clients) do
+		local result = results[i]
+		if result and not result.error and result.token then
+			client.set_bearer_token(result.token)
+			batch.results[i] = { client = client, session = result }
+			batch.succeeded = batch.succeeded + 1
+		else
+			local err = result or { error = true, message = "No result" }
+			batch.results[i] = { client = client, error = err }
+			batch.failed = batch.failed + 1
+			table.insert(batch.errors, { index = i, error = err })
+		end
+	end
+	return batch
+end
+
+
+setmetatable(M, {
+	__call = function(t, ...)
+		return M.run(...)
+	end
+})
+
+
+return M
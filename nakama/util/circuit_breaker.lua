@@ -0,0 +1,86 @@
+local M = {}
+
+M.CLOSED = "closed"
+M.OPEN = "open"
+M.HALF_OPEN = "half_open"
+
+
+--- Create a circuit breaker
+-- The circuit is closed and lets requests through until a number of requests
+-- in a row have failed. The circuit is then open and requests fail without
+-- being made until the cooldown has passed. The circuit is then half open and
+-- lets a single request through to test if the server has recovered, closing
+-- the circuit if it succeeds and opening it again if it fails.
+-- @param failure_threshold The number of failed requests in a row which opens the circuit
+-- @param cooldown The number of seconds the circuit stays open
+-- @param on_state_change Optional function called with the new state and the previous state
+-- @param clock Optional function returning the current time in seconds (defaults to os.time)
+-- @return Circuit breaker
+function M.create(failure_threshold, cooldown, on_state_change, clock)
+	assert(type(failure_threshold) == "number" and failure_threshold >= 1, "You must provide the failure threshold")
+	assert(type(cooldown) == "number" and cooldown >= 0, "You must provide the cooldown")
+	clock = clock or os.time
+
+	local breaker = {
+		state = M.CLOSED,
+		failures = 0,
+		opened = nil,
+		testing = false,
+	}
+
+	local function set_state(state)
+		local previous = breaker.state
+		if previous == state then
+			return
+		end
+		breaker.state = state
+		if on_state_change then
+			on_state_change(state, previous)
+		end
+	end
+
+	--- Check if a request can be made
+	-- @return true if the request can be made, false if it should fail fast
+	function breaker.allow()
+		if breaker.state == M.OPEN and clock() - breaker.opened >= cooldown then
+			breaker.testing = false
+			set_state(M.HALF_OPEN)
+		end
+		if breaker.state == M.CLOSED then
+			return true
+		end
+		if breaker.state == M.HALF_OPEN and not breaker.testing then
+			breaker.testing = true
+			return true
+		end
+		return false
+	end
+
+	--- Record a successful request
+	function breaker.success()
+		breaker.failures = 0
+		breaker.testing = false
+		set_state(M.CLOSED)
+	end
+
+	--- Record a failed request
+	function breaker.failure()
+		breaker.failures = breaker.failures + 1
+		breaker.testing = false
+		if breaker.state == M.HALF_OPEN or (breaker.state == M.CLOSED and breaker.failures >= failure_threshold) then
+			breaker.opened = clock()
+			set_state(M.OPEN)
+		end
+	end
+
+	--- Record a request which completed without a result, eg when it was
+	-- cancelled, to let another request test the server when half open
+	function breaker.cancel()
+		breaker.testing = false
+	end
+
+	return breaker
+end
+
+
+return M
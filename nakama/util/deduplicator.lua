@@ -0,0 +1,95 @@
+--[[--
+Deduplicate requests with the same key.
+
+A request is started using a key, and other requests with the same key get
+the result of the started request instead of being made, both while the
+request is in flight and for a time after it has completed.
+
+@module nakama.util.deduplicator
+]]
+
+local M = {}
+
+local function copy(value)
+	if type(value) ~= "table" then
+		return value
+	end
+	local c = {}
+	for k,v in pairs(value) do
+		c[k] = copy(v)
+	end
+	return c
+end
+
+
+--- Create a deduplicator
+-- @param clock Optional function returning the current time in seconds (defaults to os.time)
+-- @return The deduplicator.
+function M.create(clock)
+	clock = clock or os.time
+
+	local deduplicator = {}
+	local entries = {}
+
+	local function get_entry(key)
+		local entry = entries[key]
+		if entry and entry.expires and entry.expires <= clock() then
+			entries[key] = nil
+			return nil
+		end
+		return entry
+	end
+
+	--- Check if a request has been started
+	-- @param key The key of the request.
+	-- @return true if a request with the key is in flight or has recently completed.
+	function deduplicator.started(key)
+		return get_entry(key) ~= nil
+	end
+
+	--- Start a request
+	-- @param key The key of the request.
+	function deduplicator.start(key)
+		entries[key] = { waiting = {} }
+	end
+
+	--- Wait for the result of a started request
+	-- @param key The key of the request.
+	-- @param fn Function to call with a copy of the result. Called immediately
+	-- if the request has completed.
+	function deduplicator.wait(key, fn)
+		local entry = get_entry(key)
+		assert(entry, "No request has been started for the key")
+		if entry.completed then
+			fn(copy(entry.result))
+		else
+			table.insert(entry.waiting, fn)
+		end
+	end
+
+	--- Complete a started request
+	-- Requests waiting for the result get a copy of it. Failed requests are
+	-- not kept, to let the request be made again.
+	-- @param key The key of the request.
+	-- @param result The result of the request.
+	-- @param window Seconds to keep the result for other requests with the key.
+	function deduplicator.finish(key, result, window)
+		local entry = entries[key]
+		if not entry then
+			return
+		end
+		if window > 0 and result and not result.error then
+			entries[key] = { completed = true, result = copy(result), expires = clock() + window }
+		else
+			entries[key] = nil
+		end
+		for _,fn in ipairs(entry.waiting) do
+			fn(copy(result))
+		end
+	end
+
+	return deduplicator
+end
+
+
+return M
@@ -0,0 +1,66 @@
+--[[--
+Codecs used to encode and decode the frames of the realtime socket.
+
+The format of the frames is selected using config.socket_format and defaults
+to "json". Other formats, such as the protobuf wire format of Nakama, are
+used by registering a codec for the format, for instance one using a
+protobuf library of the engine.
+
+A codec is a table with the following fields:
+
+* encode - Function taking a message (table) and returning the frame data (string)
+* decode - Function taking the frame data (string) and returning the message (table)
+* binary - True if the frames are sent as binary instead of text
+
+The messages are the same tables regardless of the format, eg
+{ cid = "1", match_data_send = { match_id = "...", op_code = 1, data = "..." } },
+with the fields named as in the realtime protocol of Nakama.
+
+@module nakama.util.frame_codec
+]]
+
+local json = require "nakama.util.json"
+
+local M = {}
+
+local codecs = {}
+
+--- Register a codec for a format
+-- @param format The format, eg "protobuf".
+-- @param codec The codec, see above.
+function M.register(format, codec)
+	assert(type(format) == "string", "You must provide a format")
+	assert(type(codec) == "table", "You must provide a codec")
+	assert(type(codec.encode) == "function", "The codec must have an encode function")
+	assert(type(codec.decode) == "function", "The codec must have a decode function")
+	codecs[format] = codec
+end
+
+--- Get the codec of a format
+-- @param format The format, or nil for "json".
+-- @return The codec.
+function M.get(format)
+	format = format or "json"
+	local codec = codecs[format]
+	assert(codec, ("No codec registered for the socket format '%s'"):format(format))
+	return codec
+end
+
+
+M.register("json", {
+	encode = function(message)
+		local data = json.encode(message)
+		-- Fix encoding of match_create, status_update and ping messages to send {} instead of []
+		if message.match_create ~= nil or message.status_update ~= nil or message.ping ~= nil then
+			data = string.gsub(data, "%[%]", "{}")
+		end
+		return data
+	end,
+	decode = function(data)
+		return json.decode(data)
+	end,
+	binary = false,
+})
+
+
+return M
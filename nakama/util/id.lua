@@ -0,0 +1,88 @@
+--[[--
+Convert the string ids of Nakama (user, session, match ids etc) to hashes and
+back, to compare ids using hashes in Defold code.
+
+The ids are hashed using the hash() function of an engine, which must be set
+using id.set_engine(), eg id.set_engine(require "nakama.engine.defold").
+
+Each id which is hashed is kept in a registry to convert the hash back to the
+id. The registry isn't cleared automatically, since the hashes can be kept by
+game code. Remove ids when they are no longer used, eg the users of a match
+when leaving the match, using id.forget(), or all ids using id.clear(), eg
+when logging out, to avoid the registry growing for the lifetime of the game.
+
+@module nakama.util.id
+]]
+
+local M = {}
+
+local hash_fn = nil
+
+-- ids by hash
+local ids = {}
+local count = 0
+
+
+--- Set the engine used to hash ids
+-- @param engine The engine, which must provide the hash() function.
+function M.set_engine(engine)
+	assert(engine and type(engine.hash) == "function", "The engine must provide the 'hash' function")
+	hash_fn = engine.hash
+end
+
+--- Get the hash of an id and keep the id to convert the hash back
+-- @param id The id (string).
+-- @return The hash.
+function M.to_hash(id)
+	assert(type(id) == "string", "You must provide an id")
+	assert(hash_fn, "You must set the engine using id.set_engine()")
+	local h = hash_fn(id)
+	if ids[h] == nil then
+		ids[h] = id
+		count = count + 1
+	end
+	return h
+end
+
+--- Get the id of a hash
+-- @param h The hash returned by to_hash().
+-- @return The id, or nil if the id of the hash isn't known.
+function M.to_string(h)
+	return ids[h]
+end
+
+--- Check if a hash is the hash of an id, without hashing the id
+-- @param h The hash returned by to_hash().
+-- @param id The id (string).
+-- @return true if the hash is the hash of the id.
+function M.equals(h, id)
+	return h ~= nil and ids[h] == id
+end
+
+--- Remove an id from the registry
+-- @param id The id (string) or its hash.
+function M.forget(id)
+	local h = id
+	if ids[h] == nil and type(id) == "string" and hash_fn then
+		h = hash_fn(id)
+	end
+	if ids[h] ~= nil then
+		ids[h] = nil
+		count = count - 1
+	end
+end
+
+--- Remove all ids from the registry
+function M.clear()
+	ids = {}
+	count = 0
+end
+
+--- Get the number of ids in the registry
+-- @return The number of ids.
+function M.count()
+	return count
+end
+
+
+return M
@@ -26,6 +26,123 @@
 
 local json = { _version = "0.1.2" }
 
+--- Value encoded as JSON null, eg to send null for a nullable field.
+-- JSON null is decoded as nil.
+json.null = setmetatable({}, { __tostring = function() return "null" end })
+
+-- metatable of tables with integer keys which are encoded as JSON objects
+local integer_keys_mt = {}
+
+-- tables with the integer keys metatable, to skip looking for them when
+-- encoding if there are none
+local integer_key_tables = setmetatable({}, { __mode = "k" })
+
+--- Mark a table with integer keys, eg items by id, to be encoded as a JSON
+-- object with the keys as strings instead of as an array. Tables decoded
+-- with integer_keys set to "array" are marked already.
+-- @param t The table.
+-- @return The table.
+function json.object(t)
+  integer_key_tables[t] = true
+  return setmetatable(t, integer_keys_mt)
+end
+
+
+local function is_integer_key(k)
+  return type(k) == "string" and (k == "0" or k:find("^%-?[1-9]%d*$") ~= nil)
+end
+
+
+--- Convert the keys of all JSON objects of a decoded value which only have
+-- integer keys, eg { ["1"] = ..., ["3"] = ... }, into numbers. The tables
+-- are marked to be encoded as objects again (see json.object()).
+-- @param value The decoded value.
+-- @return The value.
+function json.integer_keys_to_numbers(value)
+  if type(value) ~= "table" or value == json.null then
+    return value
+  end
+  local integer_keys = next(value) ~= nil
+  for k,v in pairs(value) do
+    json.integer_keys_to_numbers(v)
+    if not is_integer_key(k) then
+      integer_keys = false
+    end
+  end
+  if integer_keys then
+    local keys = {}
+    for k in pairs(value) do
+      keys[#keys + 1] = k
+    end
+    for _,k in ipairs(keys) do
+      value[tonumber(k)] = value[k]
+      value[k] = nil
+    end
+    json.object(value)
+  end
+  return value
+end
+
+
+--- Get a copy of a value where the tables marked using json.object() have
+-- strings keys, eg for JSON encoders which don't support marked tables.
+-- The value is returned unchanged if there are no marked tables.
+-- @param value The value.
+-- @return The value or a copy of the value.
+function json.integer_keys_to_strings(value)
+  if next(integer_key_tables) == nil or type(value) ~= "table" or value == json.null then
+    return value
+  end
+  local copy = {}
+  local marked = getmetatable(value) == integer_keys_mt
+  for k,v in pairs(value) do
+    copy[marked and tostring(k) or k] = json.integer_keys_to_strings(v)
+  end
+  return copy
+end
+
+
+--- Check if a value is or contains json.null.
+-- @param value The value.
+-- @return True if the value contains json.null.
+function json.contains_null(value)
+  if value == json.null then
+    return true
+  end
+  if type(value) ~= "table" then
+    return false
+  end
+  for _,v in pairs(value) do
+    if json.contains_null(v) then
+      return true
+    end
+  end
+  return false
+end
+
+
+--- Get a copy of a value where json.null is replaced by the null value of
+-- another JSON encoder, eg for JSON encoders which don't know json.null.
+-- The value is returned unchanged if it doesn't contain json.null. Tables
+-- marked using json.object() must be converted first, see
+-- json.integer_keys_to_strings().
+-- @param value The value.
+-- @param null The null value of the other encoder.
+-- @return The value or a copy of the value.
+function json.replace_null(value, null)
+  if value == json.null then
+    return null
+  end
+  if not json.contains_null(value) then
+    return value
+  end
+  local copy = {}
+  for k,v in pairs(value) do
+    copy[k] = json.replace_null(v, null)
+  end
+  return copy
+end
+
 -------------------------------------------------------------------------------
 -- Encode
 -------------------------------------------------------------------------------
@@ -67,7 +184,18 @@ local function encode_table(val, stack)
 
   stack[val] = true
 
-  if rawget(val, 1) ~= nil or next(val) == nil then
+  if getmetatable(val) == integer_keys_mt then
+    -- Integer keys encoded as an object
+    for k, v in pairs(val) do
+      if type(k) ~= "number" and type(k) ~= "string" then
+        error("invalid table: mixed or invalid key types")
+      end
+      table.insert(res, encode(tostring(k), stack) .. ":" .. encode(v, stack))
+    end
+    stack[val] = nil
+    return "{" .. table.concat(res, ",") .. "}"
+
+  elseif rawget(val, 1) ~= nil or next(val) == nil then
     -- Treat as array -- check keys are valid and it is not sparse
     local n = 0
     for k in pairs(val) do
@@ -124,6 +252,9 @@ local type_func_map = {
 
 
 encode = function(val, stack)
+  if val == json.null then
+    return "null"
+  end
   local t = type(val)
   local f = type_func_map[t]
   if f then
@@ -391,8 +522,13 @@ end
 
 --- Decode a JSON string and return the Lua data.
 -- @param str The encoded JSON string to decode.
+-- @param opts Optional options. Set opts.integer_keys to "array" to decode
+-- objects which only have integer keys, eg items by id, into tables with
+-- number keys which are encoded as objects again (see
+-- json.integer_keys_to_numbers()). The default, "map", keeps the keys as
+-- strings.
 -- @return The decoded Lua data.
-function json.decode(str)
+function json.decode(str, opts)
   if type(str) ~= "string" then
     error("expected argument of type string, got " .. type(str))
   end
@@ -401,6 +537,9 @@ function json.decode(str)
   if idx <= #str then
     decode_error(str, idx, "trailing garbage")
   end
+  if opts and opts.integer_keys == "array" then
+    return json.integer_keys_to_numbers(res)
+  end
   return res
 end
 
@@ -0,0 +1,124 @@
+--[[--
+Incrementally decode the items of an array in a JSON response.
+
+The response is fed to the decoder in chunks. Each item of the array field is
+decoded and passed to a callback as soon as it has been received, instead of
+decoding the entire response at once. The rest of the response is decoded
+when the decoder is finished, with the array field left empty.
+
+@module nakama.util.json_stream
+]]
+
+local json = require "nakama.util.json"
+
+local M = {}
+
+
+--- Create a decoder
+-- @param field Name of the top level array field to stream, eg "objects".
+-- @param on_item Function to call with each decoded array item.
+-- @return The decoder.
+function M.create(field, on_item)
+	assert(type(field) == "string", "You must provide a field")
+	assert(type(on_item) == "function", "You must provide an item callback")
+
+	local decoder = {}
+
+	local outside = {}		-- the response excluding the streamed array items
+	local item = {}			-- characters of the current array item
+	local depth = 0
+	local array_depth = nil	-- depth of the streamed array, nil when not in it
+	local in_string = false
+	local escape = false
+	local string_start = nil
+	local last_string = nil	-- last string at the top level, ie a key
+	local current_string = {}
+
+	local function flush_item()
+		local text = table.concat(item)
+		item = {}
+		if text:match("%S") then
+			on_item(json.decode(text))
+		end
+	end
+
+	local function feed_char(c)
+		if in_string then
+			if array_depth then
+				table.insert(item, c)
+			else
+				table.insert(outside, c)
+				if depth == 1 then
+					table.insert(current_string, c)
+				end
+			end
+			if escape then
+				escape = false
+			elseif c == "\\" then
+				escape = true
+			elseif c == "\"" then
+				in_string = false
+				if not array_depth and depth == 1 then
+					-- remove the closing quote
+					current_string[#current_string] = nil
+					last_string = table.concat(current_string)
+				end
+			end
+			return
+		end
+
+		if c == "\"" then
+			in_string = true
+			current_string = {}
+		elseif c == "{" or c == "[" then
+			depth = depth + 1
+			if c == "[" and not array_depth and depth == 2 and last_string == field then
+				array_depth = depth
+				table.insert(outside, c)
+				return
+			end
+		elseif c == "}" or c == "]" then
+			if array_depth and depth == array_depth then
+				flush_item()
+				array_depth = nil
+				depth = depth - 1
+				table.insert(outside, c)
+				return
+			end
+			depth = depth - 1
+		elseif c == "," and array_depth and depth == array_depth then
+			flush_item()
+			return
+		end
+
+		if array_depth then
+			table.insert(item, c)
+		else
+			table.insert(outside, c)
+		end
+	end
+
+	--- Feed a chunk of the response to the decoder
+	-- @param chunk String with the next part of the response.
+	function decoder.feed(chunk)
+		for i=1,#chunk do
+			feed_char(chunk:sub(i, i))
+		end
+	end
+
+	--- Finish decoding
+	-- @return The decoded response, excluding the streamed array items.
+	function decoder.finish()
+		local text = table.concat(outside)
+		outside = {}
+		if not text:match("%S") then
+			return {}
+		end
+		return json.decode(text)
+	end
+
+	return decoder
+end
+
+
+return M
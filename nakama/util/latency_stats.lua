@@ -0,0 +1,74 @@
+--[[--
+Rolling latency stats per operation.
+
+The durations of the most recent requests of each operation are kept in a
+fixed size window, so memory use is bounded regardless of the number of
+requests.
+
+@module nakama.util.latency_stats
+]]
+
+local M = {}
+
+-- get the value at a percentile of a sorted list using the nearest rank
+local function percentile(sorted, p)
+	return sorted[math.max(1, math.ceil(p * #sorted))]
+end
+
+
+--- Create latency stats
+-- @param window_size The number of durations to keep per operation.
+-- @return The latency stats.
+function M.create(window_size)
+	assert(type(window_size) == "number" and window_size >= 1, "You must provide the window size")
+
+	local stats = {}
+	local windows = {}
+
+	--- Add the duration of a request
+	-- The oldest duration of the operation is replaced when the window is full.
+	-- @param operation The operation, eg "get_account".
+	-- @param duration The duration of the request in seconds.
+	function stats.add(operation, duration)
+		local window = windows[operation]
+		if not window then
+			window = { durations = {}, next = 1, count = 0 }
+			windows[operation] = window
+		end
+		window.durations[window.next] = duration
+		window.next = window.next % window_size + 1
+		window.count = window.count + 1
+	end
+
+	--- Get the stats of each operation
+	-- @return Table with the stats of each operation with requests, eg
+	-- { get_account = { count, p50, p95, max } }, where count is the total
+	-- number of requests and the durations are in seconds over the window.
+	function stats.get()
+		local result = {}
+		for operation,window in pairs(windows) do
+			local sorted = {}
+			for i,duration in ipairs(window.durations) do
+				sorted[i] = duration
+			end
+			table.sort(sorted)
+			result[operation] = {
+				count = window.count,
+				p50 = percentile(sorted, 0.5),
+				p95 = percentile(sorted, 0.95),
+				max = sorted[#sorted],
+			}
+		end
+		return result
+	end
+
+	--- Remove all durations
+	function stats.reset()
+		windows = {}
+	end
+
+	return stats
+end
+
+
+return M
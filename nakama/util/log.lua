@@ -9,31 +9,130 @@ local M = {}
 
 local function noop() end
 
+-- join the arguments of a log call into a message, the same way as print()
+local function join(...)
+	local parts = {}
+	for i=1,select("#", ...) do
+		parts[i] = tostring((select(i, ...)))
+	end
+	return table.concat(parts, "\t")
+end
+
+-- the log function of the current mode, the function converting the
+-- arguments of a log call into a message and the function writing a message
+local output = noop
+local to_message = join
+local write = noop
+
+-- throttling of repeated messages, see M.throttle()
+local throttle = nil
+
+local function set_output(fn, message_fn, write_fn)
+	output = fn
+	to_message = message_fn
+	write = write_fn
+	M.log = throttle and throttle.log or output
+end
+
 
 --- Silence all logging.
 function M.silent()
-	M.log = noop
+	set_output(noop, join, noop)
 end
 
 
 --- Print all log messages to the default system output.
 function M.print()
-	M.log = print
+	set_output(print, join, print)
 end
 
 
 -- Format all log message before print to the default system output.
 function M.format()
-	M.log = function(fmt, ...)
+	set_output(function(fmt, ...)
 		print(string.format(fmt, ...))
-	end
+	end, string.format, print)
 end
 
 
 --- Set a custom log function.
 -- @param fn The custom log function.
 function M.custom(fn)
-	M.log = fn
+	set_output(fn, join, fn)
+end
+
+
+--- Collapse identical log messages, eg from retries during an outage.
+-- A message is logged the first time and then not logged again while it is
+-- repeated within the window. The number of times it was repeated is logged
+-- as "<message> (xN)" when the window has passed, which is checked when
+-- something is logged, when M.flush() is called and, if a timer function is
+-- provided, after the window. Custom log functions are called with the
+-- collapsed message as a single string.
+-- @param window Seconds to collapse identical messages for (default 5), or false to stop throttling.
+-- @param opts Optional table of options:
+-- opts.clock - Function returning the current time in seconds (defaults to os.time).
+-- opts.timer_delay - Function called with a delay and a function to call after the delay, eg the timer_delay() of an engine, to log the number of repeated messages without waiting for something else to be logged.
+function M.throttle(window, opts)
+	if throttle then
+		throttle.flush(true)
+		throttle = nil
+	end
+	if window == false then
+		M.log = output
+		return
+	end
+	window = window or 5
+	assert(type(window) == "number" and window > 0, "The window must be a positive number")
+	opts = opts or {}
+	local clock = opts.clock or os.time
+
+	-- the time each message was first logged and the number of repeats since
+	local entries = {}
+
+	throttle = {}
+
+	function throttle.flush(all)
+		local now = clock()
+		for message,entry in pairs(entries) do
+			if all or now - entry.time >= window then
+				entries[message] = nil
+				if entry.repeats > 0 then
+					write(("%s (x%d)"):format(message, entry.repeats))
+				end
+			end
+		end
+	end
+
+	function throttle.log(...)
+		throttle.flush()
+		local message = to_message(...)
+		local entry = entries[message]
+		if not entry then
+			entries[message] = { time = clock(), repeats = 0 }
+			output(...)
+			return
+		end
+		entry.repeats = entry.repeats + 1
+		if entry.repeats == 1 and opts.timer_delay then
+			opts.timer_delay(math.max(0, window - (clock() - entry.time)), function()
+				if throttle then
+					throttle.flush()
+				end
+			end)
+		end
+	end
+
+	M.log = throttle.log
+end
+
+
+--- Log the number of times messages were repeated while throttled (see
+-- M.throttle()), without waiting for the window to pass.
+function M.flush()
+	if throttle then
+		throttle.flush(true)
+	end
 end
 
 
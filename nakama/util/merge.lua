@@ -0,0 +1,57 @@
+--[[--
+Merge partial updates (patches) into JSON values.
+
+Merge rules:
+
+* Keys of the patch which are tables with string keys are merged recursively
+into the value of the same key, or into an empty table if the value isn't a
+table with string keys
+* Keys of the patch set to json.null are removed
+* Other keys of the patch, including lists, replace the value of the same key
+* The value and the patch are not changed, a new table is returned
+
+@module nakama.util.merge
+]]
+
+local json = require "nakama.util.json"
+
+local M = {}
+
+local function copy(value)
+	if type(value) ~= "table" or value == json.null then
+		return value
+	end
+	local c = {}
+	for k,v in pairs(value) do
+		c[k] = copy(v)
+	end
+	return c
+end
+
+-- check if a value is a table with string keys (a JSON object)
+local function is_object(value)
+	return type(value) == "table" and value ~= json.null and next(value) ~= nil and rawget(value, 1) == nil
+end
+
+
+--- Merge a patch into a value
+-- @param value The current value (table) or nil.
+-- @param patch The patch (table).
+-- @return The merged value.
+function M.merge(value, patch)
+	assert(type(patch) == "table", "You must provide a patch")
+	local merged = copy(value) or {}
+	for k,v in pairs(patch) do
+		if v == json.null then
+			merged[k] = nil
+		elseif is_object(v) then
+			merged[k] = M.merge(is_object(merged[k]) and merged[k] or nil, v)
+		else
+			merged[k] = copy(v)
+		end
+	end
+	return merged
+end
+
+
+return M
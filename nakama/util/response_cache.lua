@@ -0,0 +1,117 @@
+--[[--
+Cache of responses with a time to live.
+
+@module nakama.util.response_cache
+]]
+
+local M = {}
+
+local function copy(value)
+	if type(value) ~= "table" then
+		return value
+	end
+	local c = {}
+	for k,v in pairs(value) do
+		c[k] = copy(v)
+	end
+	return c
+end
+
+
+--- Create a cache key for a request
+-- @param url_path The url path of the request.
+-- @param query_params The query params of the request.
+-- @return The key.
+function M.key(url_path, query_params)
+	local names = {}
+	for name,_ in pairs(query_params or {}) do
+		table.insert(names, name)
+	end
+	table.sort(names)
+	local query = {}
+	for _,name in ipairs(names) do
+		local value = query_params[name]
+		if type(value) == "table" then
+			value = table.concat(value, ",")
+		end
+		table.insert(query, name .. "=" .. tostring(value))
+	end
+	if #query == 0 then
+		return url_path
+	end
+	return url_path .. "?" .. table.concat(query, "&")
+end
+
+--- Get the time to live of a response from its Cache-Control header
+-- @param headers The response headers.
+-- @return The max-age in seconds, 0 if the response must not be cached or nil
+-- if there is no Cache-Control header.
+function M.max_age(headers)
+	if not headers then
+		return nil
+	end
+	local cache_control = headers["cache-control"] or headers["Cache-Control"]
+	if not cache_control then
+		return nil
+	end
+	cache_control = cache_control:lower()
+	if cache_control:find("no%-store") or cache_control:find("no%-cache") then
+		return 0
+	end
+	return tonumber(cache_control:match("max%-age=(%d+)"))
+end
+
+--- Create a cache
+-- @param clock Optional function returning the current time in seconds (defaults to os.time)
+-- @return The cache.
+function M.create(clock)
+	clock = clock or os.time
+
+	local cache = {}
+	local entries = {}
+
+	--- Get a cached value
+	-- @param key The key, see key().
+	-- @param token The token the value was cached for.
+	-- @return A copy of the value or nil if it isn't cached or has expired.
+	function cache.get(key, token)
+		local entry = entries[key]
+		if not entry or entry.token ~= token then
+			return nil
+		end
+		if entry.expires <= clock() then
+			entries[key] = nil
+			return nil
+		end
+		return copy(entry.value)
+	end
+
+	--- Cache a value
+	-- @param key The key, see key().
+	-- @param token The token to cache the value for, eg the bearer token.
+	-- @param value The value to cache. A copy is cached.
+	-- @param ttl Time to live in seconds.
+	function cache.set(key, token, value, ttl)
+		if ttl <= 0 then
+			entries[key] = nil
+			return
+		end
+		entries[key] = { token = token, value = copy(value), expires = clock() + ttl }
+	end
+
+	--- Remove cached values
+	-- @param pattern Optional Lua pattern matched against the keys of the values
+	-- to remove. All values are removed if no pattern is provided.
+	function cache.invalidate(pattern)
+		for key,_ in pairs(entries) do
+			if not pattern or key:find(pattern) then
+				entries[key] = nil
+			end
+		end
+	end
+
+	return cache
+end
+
+
+return M
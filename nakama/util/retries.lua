@@ -1,3 +1,5 @@
+local token_bucket = require "nakama.util.token_bucket"
+
 local M = {}
 
 
@@ -14,6 +16,28 @@ function M.exponential(attempts, interval)
 	return delays
 end
 
+--- Create a retry policy where the interval between attempts is exponentially
+-- increasing up to a max interval, with a random part of each interval to
+-- spread out attempts made by many clients at the same time
+-- Example: interval = 1, max_interval = 10 and attempts = 5 gives retries
+-- between 0.5-1, 1-2, 2-4, 4-8 and 5-10
+-- @param attempts The number of retry attempts
+-- @param interval (seconds)
+-- @param max_interval The max interval (seconds)
+-- @param random Optional function returning a random number between 0 and 1 (defaults to math.random)
+-- @return Retry intervals
+function M.exponential_jitter(attempts, interval, max_interval, random)
+	assert(type(max_interval) == "number" and max_interval >= interval, "The max interval must be a number not less than the interval")
+	random = random or math.random
+	local delays = {}
+	local delay = interval
+	for i=1,attempts do
+		delays[i] = delay / 2 + random() * delay / 2
+		delay = math.min(delay * 2, max_interval)
+	end
+	return delays
+end
+
 --- Create a retry policy where the interval between attempts is increasing
 -- Example: interval = 0.5 and attempts = 5 gives retries: 0.5, 1.0, 1.5, 2.0, 2.5
 -- @param attempts The number of retry attempts
@@ -45,4 +69,19 @@ function M.none()
 	return {}
 end
 
+--- Create a retry budget to limit the total number of retries made by a client
+-- Each retry consumes one token from the budget and tokens are refilled over time.
+-- Requests fail without retrying when the budget is exhausted.
+-- Example: tokens = 10 and refill_per_second = 0.5 allows a burst of 10 retries
+-- and then one retry every other second
+-- @param tokens The max number of tokens in the budget
+-- @param refill_per_second The number of tokens added to the budget per second
+-- @param clock Optional function returning the current time in seconds (defaults to os.time)
+-- @return Retry budget
+function M.budget(tokens, refill_per_second, clock)
+	assert(type(tokens) == "number" and tokens >= 0, "You must provide the number of tokens")
+	assert(type(refill_per_second) == "number" and refill_per_second >= 0, "You must provide the refill rate")
+	return token_bucket.create(tokens, refill_per_second, clock)
+end
+
 return M
\ No newline at end of file
@@ -0,0 +1,99 @@
+--[[--
+Date and time functions.
+
+@module nakama.util.time
+]]
+
+local M = {}
+
+local RFC3339 = "^(%d%d%d%d)%-(%d%d)%-(%d%d)[Tt ](%d%d):(%d%d):(%d%d)(%.?%d*)([Zz%+%-]?)(%d?%d?):?(%d?%d?)$"
+
+
+--- Convert a UTC date and time to seconds since epoch
+-- @param year
+-- @param month (1-12)
+-- @param day (1-31)
+-- @param hour (0-23)
+-- @param min (0-59)
+-- @param sec (0-60)
+-- @return Seconds since epoch
+function M.utc_to_epoch(year, month, day, hour, min, sec)
+	-- days from civil algorithm
+	year = (month <= 2) and (year - 1) or year
+	local era = math.floor(year / 400)
+	local yoe = year - era * 400
+	local mp = (month + 9) % 12
+	local doy = math.floor((153 * mp + 2) / 5) + day - 1
+	local doe = yoe * 365 + math.floor(yoe / 4) - math.floor(yoe / 100) + doy
+	local days = era * 146097 + doe - 719468
+	return days * 86400 + hour * 3600 + min * 60 + sec
+end
+
+--- Parse an RFC3339 timestamp, eg "2023-01-02T03:04:05.123Z" or "2023-01-02T05:04:05+02:00"
+-- @param str The timestamp
+-- @return Seconds since epoch, including fractional seconds, or nil if the timestamp is invalid
+function M.parse_rfc3339(str)
+	if type(str) ~= "string" then
+		return nil
+	end
+	local year, month, day, hour, min, sec, fraction, zone, offset_hour, offset_min = str:match(RFC3339)
+	if not year then
+		return nil
+	end
+	if zone == "" or fraction == "." then
+		return nil
+	end
+	local epoch = M.utc_to_epoch(tonumber(year), tonumber(month), tonumber(day), tonumber(hour), tonumber(min), tonumber(sec))
+	if fraction ~= "" then
+		epoch = epoch + tonumber("0" .. fraction)
+	end
+	if zone == "+" or zone == "-" then
+		if offset_hour == "" then
+			return nil
+		end
+		local offset = tonumber(offset_hour) * 3600 + (tonumber(offset_min) or 0) * 60
+		epoch = (zone == "+") and (epoch - offset) or (epoch + offset)
+	end
+	return epoch
+end
+
+--- Format seconds since epoch as an RFC3339 timestamp in UTC
+-- @param epoch Seconds since epoch. Fractional seconds are included as milliseconds.
+-- @return The timestamp, eg "2023-01-02T03:04:05Z" or "2023-01-02T03:04:05.123Z"
+function M.format_rfc3339(epoch)
+	assert(type(epoch) == "number", "You must provide the seconds since epoch")
+	local seconds = math.floor(epoch)
+	local millis = math.floor((epoch - seconds) * 1000 + 0.5)
+	if millis == 1000 then
+		seconds = seconds + 1
+		millis = 0
+	end
+	local timestamp = os.date("!%Y-%m-%dT%H:%M:%S", seconds)
+	if millis > 0 then
+		timestamp = ("%s.%03d"):format(timestamp, millis)
+	end
+	return timestamp .. "Z"
+end
+
+--- Convert the timestamps of a response to seconds since epoch
+-- All string fields with names ending in "_time" (eg create_time and
+-- update_time) which are valid RFC3339 timestamps are converted, including
+-- fields in nested tables.
+-- @param t The response
+-- @return The response
+function M.convert_timestamps(t)
+	if type(t) ~= "table" then
+		return t
+	end
+	for k,v in pairs(t) do
+		if type(v) == "table" then
+			M.convert_timestamps(v)
+		elseif type(k) == "string" and k:sub(-5) == "_time" and type(v) == "string" then
+			t[k] = M.parse_rfc3339(v) or v
+		end
+	end
+	return t
+end
+
+
+return M
@@ -0,0 +1,40 @@
+local M = {}
+
+
+--- Create a token bucket
+-- The bucket starts full and tokens are added at a fixed rate until the bucket
+-- is full again.
+-- @param capacity The max number of tokens in the bucket
+-- @param refill_per_second The number of tokens added to the bucket per second
+-- @param clock Optional function returning the current time in seconds (defaults to os.time)
+-- @return Token bucket
+function M.create(capacity, refill_per_second, clock)
+	assert(type(capacity) == "number" and capacity >= 0, "You must provide the capacity")
+	assert(type(refill_per_second) == "number" and refill_per_second >= 0, "You must provide the refill rate")
+	clock = clock or os.time
+
+	local bucket = {
+		tokens = capacity,
+		max_tokens = capacity,
+		refill_per_second = refill_per_second,
+		updated = clock(),
+	}
+
+	--- Consume a token from the bucket
+	-- @return true if a token was consumed, false if the bucket is empty
+	function bucket.consume()
+		local now = clock()
+		bucket.tokens = math.min(bucket.max_tokens, bucket.tokens + (now - bucket.updated) * bucket.refill_per_second)
+		bucket.updated = now
+		if bucket.tokens < 1 then
+			return false
+		end
+		bucket.tokens = bucket.tokens - 1
+		return true
+	end
+
+	return bucket
+end
+
+
+return M
@@ -0,0 +1,563 @@
+-- generated from codegen/testdata/*.swagger.json, see .github/workflows/test.yml
+local generated = require "test.generated_required"
+local generated_client = require "test.generated_client"
+-- generated with -include get_test_item
+local generated_filtered = require "test.generated_filtered"
+-- generated from client.swagger.json and custom.swagger.json
+local generated_merged = require "test.generated_merged"
+-- generated with -clean-param-names
+local generated_clean = require "test.generated_clean"
+-- generated from bytes.swagger.json
+local generated_bytes = require "test.generated_bytes"
+-- generated with -lenient-params
+local generated_lenient = require "test.generated_lenient"
+local test_engine = require "nakama.engine.test"
+local json = require "nakama.util.json"
+local b64 = require "nakama.util.b64"
+local log = require "nakama.util.log"
+log.print()
+
+context("Code generation", function()
+
+	before(function()
+		test_engine.reset()
+	end)
+	after(function() end)
+
+	local function config()
+		return {
+			host = "127.0.0.1",
+			port = 7350,
+			use_ssl = false,
+			username = "defaultkey",
+			password = "",
+			engine = test_engine,
+			timeout = 10, -- connection timeout in seconds
+		}
+	end
+
+	test("It should assert required body fields", function()
+		test_engine.set_http_response("/v2/test/required", {})
+		local client = generated.create_client(config())
+		assert_error(function()
+			client.test_required(nil, "name", nil, function() end)
+		end)
+		assert_error(function()
+			client.test_required(123, "name", nil, function() end)
+		end)
+
+		local called = false
+		client.test_required("id", nil, nil, function() called = true end)
+		assert_true(called)
+	end)
+
+	test("It should check and encode map fields", function()
+		test_engine.set_http_response("/v2/test/required", {})
+		local client = generated.create_client(config())
+		client.test_required("id", nil, { mode = "ranked" }, function() end)
+		local request = test_engine.get_http_request()
+		assert_equal(json.decode(request.post_data).tags.mode, "ranked")
+
+		-- an empty map is omitted instead of being encoded as a JSON array
+		client.test_required("id", nil, {}, function() end)
+		request = test_engine.get_http_request()
+		assert_nil(json.decode(request.post_data).tags)
+
+		-- keys must be strings and values must be of the type of the map
+		assert_error(function()
+			client.test_required("id", nil, { mode = 1 }, function() end)
+		end)
+		assert_error(function()
+			client.test_required("id", nil, { "ranked" }, function() end)
+		end)
+	end)
+
+	test("It should describe the generated operations in a manifest", function()
+		local f = assert(io.open("test/generated_required.json", "rb"))
+		local manifest = json.decode(f:read("*a"))
+		f:close()
+
+		assert_equal(#manifest.operations, 1)
+		local operation = manifest.operations[1]
+		assert_equal(operation.name, "test_required")
+		assert_equal(operation.method, "POST")
+		assert_equal(operation.path, "/v2/test/required")
+		assert_equal(operation.body, "body_test_required")
+		assert_equal(#operation.parameters, 3)
+		assert_equal(operation.parameters[1].name, "id")
+		assert_true(operation.parameters[1].required)
+		assert_equal(operation.parameters[2].name, "name")
+		assert_false(operation.parameters[2].required)
+		assert_equal(operation.parameters[3].name, "tags")
+		assert_false(operation.parameters[3].required)
+		assert_equal(manifest.definitions[1].name, "body_test_required")
+	end)
+
+	test("It should substitute and encode path params", function()
+		test_engine.set_http_response("/v2/test/item/item%201", {})
+		local client = generated_client.create_client(config())
+		client.get_test_item("item 1", nil, nil, nil, function() end)
+		local request = test_engine.get_http_request()
+		assert_equal(request.method, "GET")
+		assert_equal(request.url_path, "/v2/test/item/item%201")
+
+		test_engine.set_http_response("/v2/test/group/group%25/item/item1", {})
+		client.delete_test_group_item("group%", "item1", "reason1", function() end)
+		request = test_engine.get_http_request()
+		assert_equal(request.method, "DELETE")
+		assert_equal(request.url_path, "/v2/test/group/group%25/item/item1")
+	end)
+
+	test("It should add provided query params and omit the others", function()
+		test_engine.set_http_response("/v2/test/item/item1", {})
+		local client = generated_client.create_client(config())
+		client.get_test_item("item1", 10, "cursor1", { "a", "b" }, function() end)
+		local request = test_engine.get_http_request()
+		assert_equal(request.query_params.limit, 10)
+		assert_equal(request.query_params.cursor, "cursor1")
+		assert_equal(#request.query_params.tags, 2)
+		assert_nil(request.post_data)
+
+		-- omitted optional params are not added
+		client.get_test_item("item1", nil, "cursor1", nil, function() end)
+		request = test_engine.get_http_request()
+		assert_equal(request.query_params.cursor, "cursor1")
+		local count = 0
+		for _ in pairs(request.query_params) do count = count + 1 end
+		assert_equal(count, 1)
+
+		client.get_test_item("item1", nil, nil, nil, function() end)
+		request = test_engine.get_http_request()
+		assert_nil(next(request.query_params))
+
+		-- required params are asserted
+		assert_error(function()
+			client.delete_test_group_item("group1", "item1", nil, function() end)
+		end)
+	end)
+
+	test("It should encode the body", function()
+		test_engine.set_http_response("/v2/test/item/item1", {})
+		local client = generated_client.create_client(config())
+		client.update_test_item("item1", 3, { color = "red" }, "name1", function() end)
+		local request = test_engine.get_http_request()
+		assert_equal(request.method, "PUT")
+		local pd = json.decode(request.post_data)
+		assert_equal(pd.count, 3)
+		assert_equal(pd.labels.color, "red")
+		assert_equal(pd.name, "name1")
+
+		-- omitted body fields
+		client.update_test_item("item1", nil, nil, "name1", function() end)
+		request = test_engine.get_http_request()
+		pd = json.decode(request.post_data)
+		assert_nil(pd.count)
+		assert_nil(pd.labels)
+
+		test_engine.set_http_response("/v2/test/payload/payload1", {})
+		client.send_test_payload("payload1", "hello", function() end)
+		request = test_engine.get_http_request()
+		assert_equal(request.method, "POST")
+		assert_equal(json.decode(request.post_data), "hello")
+	end)
+
+	test("It should use the schema of the returned status code", function()
+		-- the generated functions use the create functions of the response definitions
+		_G.api_test_item = { create = function(result) result.schema = "api_test_item" return result end }
+		_G.api_test_item_created = { create = function(result) result.schema = "api_test_item_created" return result end }
+		local client = generated_client.create_client(config())
+
+		local result
+		test_engine.set_http_response("/v2/test/item", { created = true }, nil, 201)
+		client.create_test_item(nil, nil, "name1", function(r) result = r end)
+		assert_equal(result.schema, "api_test_item_created")
+
+		test_engine.set_http_response("/v2/test/item", { id = "item1" }, nil, 200)
+		client.create_test_item(nil, nil, "name1", function(r) result = r end)
+		assert_equal(result.schema, "api_test_item")
+
+		-- unknown status codes use the schema of status code 200
+		test_engine.set_http_response("/v2/test/item", { id = "item1" }, nil, 202)
+		client.create_test_item(nil, nil, "name1", function(r) result = r end)
+		assert_equal(result.schema, "api_test_item")
+
+		_G.api_test_item = nil
+		_G.api_test_item_created = nil
+	end)
+
+	test("It should only generate definitions referenced by the included operations", function()
+		assert_not_nil(generated_filtered.get_test_item)
+		assert_nil(generated_filtered.create_test_item)
+		-- referenced by apiTestItem
+		assert_equal(generated_filtered.TESTITEMSTATE_ACTIVE, "ACTIVE")
+		-- only referenced by apiTestItemCreated
+		assert_nil(generated_filtered.TESTITEMORIGIN_USER)
+		assert_equal(generated_client.TESTITEMORIGIN_USER, "USER")
+	end)
+
+	test("It should generate a list of the values of each enum", function()
+		local values = generated_client.TESTITEMSTATE_VALUES
+		assert_equal(#values, 2)
+		assert_equal(values[1], generated_client.TESTITEMSTATE_ACTIVE)
+		assert_equal(values[2], generated_client.TESTITEMSTATE_ARCHIVED)
+	end)
+
+	test("It should generate aliases of renamed functions", function()
+		local messages = {}
+		log.custom(function(...) table.insert(messages, table.concat({ ... }, " ")) end)
+		test_engine.set_http_response("/v2/test/item/item1", { id = "item1" })
+		local client = generated_client.create_client(config())
+		local result
+		client.fetch_test_item("item1", nil, nil, nil, function(r) result = r end)
+		client.fetch_test_item("item1", nil, nil, nil, function(r) result = r end)
+		-- generated functions take precedence over aliases
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		log.print()
+		assert_equal(result.id, "item1")
+		assert_equal(test_engine.get_http_request().method, "GET")
+
+		-- the deprecation is only logged once
+		local deprecations = 0
+		for _,message in ipairs(messages) do
+			if message:find("fetch_test_item() is deprecated", 1, true) then
+				deprecations = deprecations + 1
+			end
+		end
+		assert_equal(deprecations, 1)
+		assert_nil(generated_client.fetch_removed_item)
+	end)
+
+	test("It should accept json.null only for nullable fields", function()
+		test_engine.set_http_response("/v2/test/item/item1/note", {})
+		local client = generated_client.create_client(config())
+		client.update_test_item_note("item1", nil, nil, json.null, json.null, function() end)
+		local request = test_engine.get_http_request()
+		assert_equal(request.post_data:gsub(" ", ""):match('"note":(%a+)'), "null")
+		assert_equal(request.post_data:gsub(" ", ""):match('"tags":(%a+)'), "null")
+
+		-- required nullable fields must be provided
+		assert_error(function()
+			client.update_test_item_note("item1", nil, nil, nil, nil, function() end)
+		end)
+		-- non-nullable fields reject json.null
+		assert_error(function()
+			client.update_test_item_note("item1", json.null, nil, "note", nil, function() end)
+		end)
+		assert_error(function()
+			client.update_test_item_note("item1", nil, json.null, "note", nil, function() end)
+		end)
+	end)
+
+	test("It should accept a trailing table of options", function()
+		test_engine.set_http_response("/v2/test/item/item1", { id = "item1" })
+		local client = generated_client.create_client(config())
+		local result
+		client.get_test_item("item1", nil, nil, nil, {
+			callback = function(r) result = r end,
+			headers = { ["X-Test"] = "1" },
+			timeout = 3,
+		})
+		assert_equal(result.id, "item1")
+		local request = test_engine.get_http_request()
+		assert_equal(request.headers["X-Test"], "1")
+		assert_equal(request.config.timeout, 3)
+
+		-- the positional arguments are still supported
+		result = nil
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end, nil, nil, { headers = { ["X-Test"] = "2" } })
+		assert_equal(result.id, "item1")
+		request = test_engine.get_http_request()
+		assert_equal(request.headers["X-Test"], "2")
+		assert_equal(request.config.timeout, 10)
+	end)
+
+	test("It should generate a client from several merged specs", function()
+		assert_not_nil(generated_merged.get_test_item)
+		assert_not_nil(generated_merged.score_test_item)
+		assert_nil(generated_client.score_test_item)
+		-- definitions in both specs are generated once
+		assert_equal(generated_merged.TESTITEMSTATE_ACTIVE, "ACTIVE")
+
+		test_engine.set_http_response("/v2/test/item/item1/score", { id = "item1" })
+		local client = generated_merged.create_client(config())
+		local result
+		client.score_test_item("item1", 10, function(r) result = r end)
+		assert_equal(result.id, "item1")
+		assert_equal(json.decode(test_engine.get_http_request().post_data).score, 10)
+	end)
+
+	test("It should check responses for unexpected fields in strict mode", function()
+		local client = generated_client.create_client(config())
+		local messages = {}
+		log.custom(function(...)
+			local message = table.concat({ ... }, " ")
+			if message:find("Unexpected fields") then
+				table.insert(messages, message)
+			end
+		end)
+
+		-- responses aren't checked by default
+		local result
+		test_engine.set_http_response("/v2/test/item/item1", { id = "item1", color = "red" })
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_equal(#messages, 0)
+
+		generated_client.strict = true
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_equal(result.color, "red")
+		assert_equal(#messages, 1)
+		assert_not_nil(messages[1]:find("get_test_item: color", 1, true))
+
+		-- the fields of nested definitions are checked
+		messages = {}
+		test_engine.set_http_response("/v2/test/item", { created = true, item = { id = "item1", size = 2 } }, nil, 201)
+		client.create_test_item(nil, nil, "name1", function(r) result = r end)
+		assert_not_nil(messages[1]:find("create_test_item: item.size", 1, true))
+
+		messages = {}
+		test_engine.set_http_response("/v2/test/item/item1", { id = "item1", name = "name1", state = "ACTIVE" })
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_equal(#messages, 0)
+
+		generated_client.strict = "error"
+		test_engine.set_http_response("/v2/test/item/item1", { id = "item1", color = "red" })
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_true(result.error)
+		assert_nil(result.color)
+
+		generated_client.strict = false
+		log.print()
+	end)
+
+	test("It should name params without the type suffix with -clean-param-names", function()
+		local f = assert(io.open("test/generated_clean.json", "rb"))
+		local manifest = json.decode(f:read("*a"))
+		f:close()
+		local names = {}
+		for _,operation in ipairs(manifest.operations) do
+			if operation.name == "delete_test_group_item" then
+				for _,parameter in ipairs(operation.parameters) do
+					table.insert(names, parameter.name)
+				end
+			end
+		end
+		assert_equal(table.concat(names, ","), "group_id,item_id,reason")
+
+		-- the types are still used for the asserts
+		local client = generated_clean.create_client(config())
+		local ok, err = pcall(client.delete_test_group_item, "group1", "item1", nil, function() end)
+		assert_false(ok)
+		assert_not_nil(tostring(err):find("Argument 'reason' is required", 1, true))
+
+		test_engine.set_http_response("/v2/test/group/group1/item/item1", {})
+		client.delete_test_group_item("group1", "item1", "reason1", function() end)
+		assert_equal(test_engine.get_http_request().query_params.reason, "reason1")
+	end)
+
+	test("It should describe each operation with -describe", function()
+		assert_equal(table.concat(generated_client.operations, ","), "create_test_item,delete_test_group_item,get_test_item,send_test_payload,update_test_item,update_test_item_note")
+		assert_nil(generated.operations)
+		assert_nil(generated.describe)
+
+		local description = generated_client.describe("delete_test_group_item")
+		assert_equal(description.method, "DELETE")
+		assert_equal(description.path, "/v2/test/group/{groupId}/item/{itemId}")
+		assert_equal(#description.params, 3)
+		assert_equal(description.params[3].name, "reason_str")
+		assert_equal(description.params[3]["in"], "query")
+		assert_equal(description.params[3].type, "string")
+		assert_equal(table.concat(description.required, ","), "group_id_str,item_id_str,reason_str")
+		assert_equal(#description.body_fields, 0)
+		assert_equal(description.response, "protobuf_empty")
+
+		description = generated_client.describe("create_test_item")
+		assert_equal(description.body, "body_test_item")
+		assert_equal(table.concat(description.body_fields, ","), "count,labels,name")
+
+		-- changes to a description don't affect the next one
+		description.method = "GET"
+		assert_equal(generated_client.describe("create_test_item").method, "POST")
+		assert_nil(generated_client.describe("unknown"))
+	end)
+
+	test("It should omit nil fields of the body and send null for json.null", function()
+		test_engine.set_http_response("/v2/test/item", {})
+		local client = generated_client.create_client(config())
+
+		-- an empty body is an object
+		client.create_test_item(nil, nil, nil, function() end)
+		assert_equal(test_engine.get_http_request().post_data, "{}")
+
+		-- only the provided fields are sent
+		client.create_test_item(nil, nil, "sword", function() end)
+		local body = json.decode(test_engine.get_http_request().post_data)
+		assert_equal(body.name, "sword")
+		assert_nil(body.count)
+		assert_nil(body.labels)
+
+		-- json.null is sent as null
+		test_engine.set_http_response("/v2/test/item/item1/note", {})
+		client.update_test_item_note("item1", nil, nil, "note", json.null, function() end)
+		local post_data = test_engine.get_http_request().post_data:gsub(" ", "")
+		assert_not_nil(post_data:find('"tags":null', 1, true))
+		assert_nil(post_data:find('"author"', 1, true))
+		assert_nil(post_data:find('"links"', 1, true))
+	end)
+
+	test("It should send null for json.null with the native encoder of Defold", function()
+		local lua_encode, lua_decode = json.encode, json.decode
+		-- a native encoder which only knows its own null value
+		local function load_defold_engine(native_null)
+			local function to_lua(value)
+				if value == native_null then return json.null end
+				if type(value) ~= "table" then return value end
+				local copy = {}
+				for k,v in pairs(value) do copy[k] = to_lua(v) end
+				return copy
+			end
+			_G.json = {
+				null = native_null,
+				encode = function(value)
+					assert(not json.contains_null(value), "The native encoder doesn't know json.null")
+					return lua_encode(to_lua(value))
+				end,
+			}
+			package.loaded["nakama.engine.defold"] = nil
+			require "nakama.engine.defold"
+		end
+
+		local ok, err = pcall(function()
+			test_engine.set_http_response("/v2/test/item/item1/note", {})
+			local client = generated_client.create_client(config())
+			for _,native_null in ipairs({ {}, false }) do
+				load_defold_engine(native_null or nil)
+				client.update_test_item_note("item1", nil, nil, "note", json.null, function() end)
+				local post_data = test_engine.get_http_request().post_data:gsub(" ", "")
+				assert(post_data:find('"tags":null', 1, true), post_data)
+				assert(json.encode({ json.null }) == "[null]")
+				json.encode, json.decode = lua_encode, lua_decode
+			end
+		end)
+		json.encode, json.decode = lua_encode, lua_decode
+		_G.json = nil
+		package.loaded["nakama.engine.defold"] = nil
+		assert_true(ok, err)
+	end)
+
+	test("It should alias camelCase and snake_case fields with -compat-field-aliases", function()
+		test_engine.set_http_response("/v2/test/item/item1", { id = "item1", create_time = "2024", labels = { { label_name = "a" } }, ownerId = "user1" })
+		local client = generated_merged.create_client(config())
+		local result
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_equal(result.create_time, "2024")
+		assert_equal(result.createTime, "2024")
+		assert_equal(result.labels[1].labelName, "a")
+		assert_equal(result.owner_id, "user1")
+		assert_nil(result.unknownField)
+
+		-- not generated without the flag
+		test_engine.set_http_response("/v2/test/item/item1", { id = "item1", create_time = "2024" })
+		client = generated_client.create_client(config())
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_nil(result.createTime)
+	end)
+
+	test("It should generate the same client from a YAML spec as from the JSON spec", function()
+		-- generated from client.swagger.yaml with the same flags as generated_client
+		local f = assert(io.open("test/generated_client.lua", "rb"))
+		local from_json = f:read("*a")
+		f:close()
+		f = assert(io.open("test/generated_client_yaml.lua", "rb"))
+		local from_yaml = f:read("*a")
+		f:close()
+
+		assert_true(#from_json > 0)
+		assert_true(from_yaml == from_json)
+	end)
+
+	test("It should return stubbed responses with -stubs", function()
+		local client = generated_client.create_client(config())
+		generated_client.stub.get_test_item = { id = "stubbed", labels = {} }
+		local result
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_nil(test_engine.get_http_request())
+		assert_equal(result.id, "stubbed")
+		-- the stub isn't changed by the caller
+		result.id = "changed"
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_equal(result.id, "stubbed")
+
+		local stub_request
+		generated_client.stub.get_test_item = function(request)
+			stub_request = request
+			return { error = true, message = "Not found" }
+		end
+		client.get_test_item("item2", 5, nil, nil, function(r) result = r end)
+		assert_nil(test_engine.get_http_request())
+		assert_equal(stub_request.operation, "get_test_item")
+		assert_equal(stub_request.path, "/v2/test/item/item2")
+		assert_equal(stub_request.query.limit, 5)
+		assert_true(result.error)
+
+		assert_error(function() generated_client.stub.no_such_operation = {} end)
+
+		generated_client.clear_stubs()
+		test_engine.set_http_response("/v2/test/item/item1", { id = "item1" })
+		client.get_test_item("item1", nil, nil, nil, function(r) result = r end)
+		assert_not_nil(test_engine.get_http_request())
+		assert_equal(result.id, "item1")
+	end)
+
+	test("It should generate overload annotations with -annotations", function()
+		local f = assert(io.open("test/generated_client.lua", "rb"))
+		local code = f:read("*a")
+		f:close()
+
+		local callback_form, coroutine_form = code:match("\n(%-%-%-@overload [^\n]*)\n(%-%-%-@overload [^\n]*)\nfunction M%.get_test_item%(")
+		assert_equal(callback_form, "---@overload fun(client: table, id_str: string, limit_int?: number, cursor_str?: string, tags_arr?: table, callback: fun(result: table)|table, retry_policy?: table, cancellation_token?: table, opts?: table)")
+		assert_equal(coroutine_form, "---@overload fun(client: table, id_str: string, limit_int?: number, cursor_str?: string, tags_arr?: table, callback?: nil, retry_policy?: table, cancellation_token?: table, opts?: table): table")
+	end)
+
+	test("It should base64 encode and decode fields with the format byte", function()
+		local client = generated_bytes.create_client(config())
+		local bytes = "\0\1\2\255"
+		local part = "\255part"
+		test_engine.set_http_response("/v2/test/blob", {
+			data = b64.encode(bytes),
+			name = "blob",
+			parts = { { data = b64.encode(part) } },
+		})
+
+		local result
+		client.write_test_blob(bytes, "blob", function(r) result = r end)
+		local request = test_engine.get_http_request()
+		local body = json.decode(request.post_data)
+		assert_equal(body.data, b64.encode(bytes))
+		assert_equal(body.name, "blob")
+		assert_equal(result.data, bytes)
+		assert_equal(result.name, "blob")
+		assert_equal(result.parts[1].data, part)
+
+		test_engine.set_http_response("/v2/test/blob", { data = b64.encode(bytes) })
+		client.get_test_blob(bytes, function(r) result = r end)
+		request = test_engine.get_http_request()
+		assert_equal(request.query_params.key, b64.encode(bytes))
+		assert_equal(result.data, bytes)
+	end)
+
+	test("It should convert path and query params of the other type with lenient params", function()
+		test_engine.set_http_response("/v2/test/item/42", {})
+		local client = generated_lenient.create_client(config())
+		client.get_test_item(42, "10", nil, nil, function() end)
+		local request = test_engine.get_http_request()
+		assert_equal(request.url_path, "/v2/test/item/42")
+		assert_equal(request.query_params.limit, 10)
+
+		-- params which can't be converted are passed on unchanged
+		test_engine.set_http_response("/v2/test/item/item1", {})
+		client.get_test_item("item1", "ten", nil, nil, function() end)
+		request = test_engine.get_http_request()
+		assert_equal(request.url_path, "/v2/test/item/item1")
+		assert_equal(request.query_params.limit, "ten")
+	end)
+end)
@@ -0,0 +1,41 @@
+local retries = require "nakama.util.retries"
+
+context("Retries", function()
+	before(function() end)
+	after(function() end)
+
+	test("It should create retry policies", function()
+		local fixed = retries.fixed(3, 0.5)
+		assert_equal(#fixed, 3)
+		assert_equal(fixed[3], 0.5)
+		local incremental = retries.incremental(3, 0.5)
+		assert_equal(incremental[3], 1.5)
+		assert_equal(#retries.none(), 0)
+		local jitter = retries.exponential_jitter(5, 1, 10, function() return 1 end)
+		assert_equal(#jitter, 5)
+		assert_equal(jitter[4], 8)
+		assert_equal(jitter[5], 10)
+		jitter = retries.exponential_jitter(5, 1, 10, function() return 0 end)
+		assert_equal(jitter[1], 0.5)
+		assert_equal(jitter[5], 5)
+	end)
+
+	test("It should limit retries using a retry budget", function()
+		local now = 0
+		local budget = retries.budget(2, 0.5, function() return now end)
+		assert_true(budget.consume())
+		assert_true(budget.consume())
+		assert_false(budget.consume())
+
+		now = 1
+		assert_false(budget.consume())
+		now = 2
+		assert_true(budget.consume())
+		assert_false(budget.consume())
+
+		now = 100
+		assert_true(budget.consume())
+		assert_true(budget.consume())
+		assert_false(budget.consume())
+	end)
+end)
@@ -1,6 +1,9 @@
 local nakama = require "nakama.nakama"
 local test_engine = require "nakama.engine.test"
 local b64 = require "nakama.util.b64"
+local nakama_socket = require "nakama.socket"
+local frame_codec = require "nakama.util.frame_codec"
+local json = require "nakama.util.json"
 
 
 context("Nakama socket", function()
@@ -131,6 +134,901 @@ context("Nakama socket", function()
 		end)()
 		assert_equal(count, #events, "Expected all events to be received")
 	end)
-end)
 
+	test("It should add and remove event handlers", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		socket.connect(function() end)
+
+		local calls = {}
+		local function handler(name)
+			return function(message) table.insert(calls, name) end
+		end
+		local remove_a = socket.on("notifications", handler("a"))
+		socket.on("notifications", handler("b"))
+		socket.once("notifications", handler("once"))
+		local remove_set = socket.on_notifications(handler("set1"))
+		socket.on_notifications(handler("set2"))
+
+		test_engine.receive_socket_message(socket, { notifications = {} })
+		assert_equal(table.concat(calls, ","), "a,b,once,set2")
+
+		calls = {}
+		remove_a()
+		remove_set()
+		test_engine.receive_socket_message(socket, { notifications = {} })
+		assert_equal(table.concat(calls, ","), "b,set2")
+
+		-- client side events
+		calls = {}
+		socket.once("disconnect", handler("disconnect"))
+		socket.on_disconnect(handler("on_disconnect"))
+		test_engine.disconnect_socket(socket)
+		test_engine.disconnect_socket(socket)
+		assert_equal(table.concat(calls, ","), "disconnect,on_disconnect,on_disconnect")
+	end)
+
+	test("It should send match data to specific presences", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+
+		local done = false
+		coroutine.wrap(function()
+			socket.connect()
+			local presences = {
+				{ user_id = "user1", session_id = "session1" },
+			}
+			socket.match_data_send("id1234", 1, "somedata", presences)
+
+			local message = test_engine.get_socket_message()
+			assert_not_nil(message)
+			assert_equal(message.match_data_send.presences, presences)
+			done = true
+		end)()
+		assert_true(done)
+	end)
+
+	test("It should not send match data to malformed presences", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+
+		socket.connect(function() end)
+		assert_error(function()
+			socket.match_data_send("id1234", 1, "somedata", { { user_id = "user1" } })
+		end)
+		assert_nil(test_engine.get_socket_message())
+	end)
+
+	test("It should wait for socket events", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+
+		local result = nil
+		coroutine.wrap(function()
+			socket.connect()
+			result = socket.wait_for("matchmaker_matched", function(message)
+				return message.matchmaker_matched.ticket == "ticket2"
+			end)
+		end)()
+		assert_nil(result)
+		test_engine.receive_socket_message(socket, { matchmaker_matched = { ticket = "ticket1" } })
+		assert_nil(result)
+		test_engine.receive_socket_message(socket, { matchmaker_matched = { ticket = "ticket2" } })
+		assert_not_nil(result)
+		assert_equal(result.matchmaker_matched.ticket, "ticket2")
+	end)
+
+	test("It should stop waiting for socket events on timeout", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+
+		local waiting = false
+		local done = false
+		nakama.sync(function()
+			socket.connect()
+			waiting = true
+			socket.wait_for("matchmaker_matched", nil, 5)
+			done = true
+		end)
+		test_engine.advance_time(4)
+		assert_true(waiting)
+		assert_not_nil(next(socket.waiters.matchmaker_matched))
+		-- an error is raised which stops the coroutine
+		test_engine.advance_time(1)
+		assert_false(done)
+		assert_nil(next(socket.waiters.matchmaker_matched))
+	end)
+
+	test("It should stop waiting for socket events when cancelled", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		local token = nakama.cancellation_token()
+
+		local done = false
+		coroutine.wrap(function()
+			socket.connect()
+			local result, err = socket.wait_for("matchmaker_matched", nil, nil, token)
+			assert_nil(result)
+			assert_equal(err, "cancelled")
+			done = true
+		end)()
+		assert_false(done)
+		nakama.cancel(token)
+		assert_true(done)
+
+		-- all waits using the token are cancelled, including the waits using the
+		-- token of nakama.sync()
+		token = nakama.cancellation_token()
+		local errors = {}
+		for i=1,3 do
+			nakama.sync(function()
+				local _, err = socket.wait_for("matchmaker_matched", nil, nil, i < 3 and token or nil)
+				table.insert(errors, err)
+			end, token)
+		end
+		assert_equal(#errors, 0)
+		nakama.cancel(token)
+		assert_equal(table.concat(errors, ","), "cancelled,cancelled,cancelled")
+		assert_nil(next(socket.waiters.matchmaker_matched))
+	end)
+
+	test("It should create and validate socket messages", function()
+		local socket_messages = require "nakama.socket_messages"
+		local message = socket_messages.match_join("id1234", nil, { foo = "bar" })
+		assert_equal(message.match_join.match_id, "id1234")
+		assert_equal(message.match_join.metadata.foo, "bar")
+		assert_error(function()
+			socket_messages.match_join(1234)
+		end)
+	end)
+
+	test("It should restore subscriptions after a reconnect", function()
+		local c = config()
+		c.auto_resubscribe = true
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+
+		local events = {}
+		socket.on_resubscribe(function(event)
+			events[event.type] = event
+		end)
+
+		coroutine.wrap(function()
+			socket.connect()
+			test_engine.set_socket_send_result("channel_join", { channel = { id = "channel1" } })
+			socket.channel_join("room1", nakama_socket.CHANNELTYPE_ROOM, false, false)
+			socket.match_join("00000000-0000-0000-0000-000000000001.")
+			socket.status_follow({ "user1", "user2" })
+			socket.status_unfollow({ "user2" })
+			socket.party_join("party1")
+			socket.party_leave("party1")
+			while test_engine.get_socket_message() do end
+
+			test_engine.set_socket_send_result("match_join", { error = { code = nakama_socket.ERROR_MATCH_NOT_FOUND, message = "Match not found" } })
+			socket.connect()
+		end)()
+
+		assert_true(events.channel_join.success)
+		assert_equal(events.channel_join.message.channel_join.target, "room1")
+		assert_true(events.status_follow.success)
+		assert_equal(#events.status_follow.message.status_follow.user_ids, 1)
+		assert_equal(events.status_follow.message.status_follow.user_ids[1], "user1")
+		assert_false(events.match_join.success)
+		assert_true(events.match_join.match_ended)
+		assert_nil(events.party_join)
+
+		-- the ended match should not be rejoined again
+		events = {}
+		socket.connect(function() end)
+		assert_nil(events.match_join)
+		assert_not_nil(events.channel_join)
+	end)
+
+	test("It should not restore subscriptions unless enabled", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		local resubscribed = false
+		socket.on_resubscribe(function(event) resubscribed = true end)
+		coroutine.wrap(function()
+			socket.connect()
+			socket.match_join("00000000-0000-0000-0000-000000000001.")
+			socket.connect()
+		end)()
+		assert_false(resubscribed)
+	end)
+
+	test("It should keep track of match presences", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+
+		local changes = {}
+		socket.on_presence_change(function(id, current, joins, leaves)
+			table.insert(changes, { id = id, current = current, joins = joins, leaves = leaves })
+		end)
+
+		local user1 = { user_id = "user1", session_id = "session1" }
+		local user2 = { user_id = "user2", session_id = "session2" }
+		local user3 = { user_id = "user3", session_id = "session3" }
+		test_engine.set_socket_send_result("match_join", { match = { match_id = "00000000-0000-0000-0000-000000000001.", presences = { user2 }, self = user1 } })
+		coroutine.wrap(function()
+			socket.match_join("00000000-0000-0000-0000-000000000001.")
+		end)()
+		assert_equal(#socket.get_presences("00000000-0000-0000-0000-000000000001."), 2)
+		assert_equal(changes[1].id, "00000000-0000-0000-0000-000000000001.")
+		assert_equal(#changes[1].joins, 2)
+
+		test_engine.receive_socket_message(socket, { match_presence_event = { match_id = "00000000-0000-0000-0000-000000000001.", joins = { user3 }, leaves = { user2 } } })
+		local presences = socket.get_presences("00000000-0000-0000-0000-000000000001.")
+		assert_equal(#presences, 2)
+		for _,presence in ipairs(presences) do
+			assert_true(presence.user_id ~= "user2")
+		end
+		assert_equal(#changes[2].current, 2)
+		assert_equal(changes[2].joins[1].user_id, "user3")
+		assert_equal(changes[2].leaves[1].user_id, "user2")
+
+		-- events for matches which haven't been joined are ignored
+		test_engine.receive_socket_message(socket, { match_presence_event = { match_id = "00000000-0000-0000-0000-000000000002.", joins = { user3 } } })
+		assert_equal(#socket.get_presences("00000000-0000-0000-0000-000000000002."), 0)
+		assert_equal(#changes, 2)
+
+		coroutine.wrap(function()
+			socket.match_leave("00000000-0000-0000-0000-000000000001.")
+		end)()
+		assert_equal(#socket.get_presences("00000000-0000-0000-0000-000000000001."), 0)
+	end)
+
+	test("It should cancel a sync sequence after a timeout", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+
+		local token = nakama.cancellation_token()
+		local timed_out = false
+		local wait_err = nil
+		nakama.sync(function()
+			local message, err = socket.wait_for("match_data", nil, nil, token)
+			wait_err = err
+		end, token, { timeout = 5, on_timeout = function() timed_out = true end })
+
+		test_engine.advance_time(4)
+		assert_false(timed_out)
+		test_engine.advance_time(2)
+		assert_true(timed_out)
+		assert_true(token.cancelled)
+		assert_equal(wait_err, "cancelled")
+
+		timed_out = false
+		nakama.sync(function() end, nil, { timeout = 5, on_timeout = function() timed_out = true end })
+		test_engine.advance_time(10)
+		assert_false(timed_out)
+	end)
+
+	test("It should detect gaps in message sequences", function()
+		local c = config()
+		c.track_sequence = true
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		socket.on_match_data(function() end)
+		local gaps = {}
+		socket.on_sequence_gap(function(event)
+			table.insert(gaps, event)
+		end)
+		coroutine.wrap(function()
+			socket.connect()
+		end)()
+
+		local function match_data(session_id, seq)
+			test_engine.receive_socket_message(socket, {
+				match_data = { match_id = "00000000-0000-0000-0000-000000000001.", data = b64.encode("data"), seq = seq, presence = { user_id = session_id, session_id = session_id } }
+			})
+		end
+		-- sequences are tracked per sender
+		match_data("a", 1)
+		match_data("b", 1)
+		match_data("a", 2)
+		match_data("b", 2)
+		assert_equal(#gaps, 0)
+
+		-- dropped messages
+		match_data("a", 5)
+		assert_equal(#gaps, 1)
+		assert_equal(gaps[1].expected, 3)
+		assert_equal(gaps[1].received, 5)
+		assert_equal(gaps[1].missing, 2)
+		assert_false(gaps[1].out_of_order)
+		assert_equal(gaps[1].match_id, "00000000-0000-0000-0000-000000000001.")
+		assert_equal(gaps[1].presence.session_id, "a")
+
+		-- out of order message
+		match_data("a", 4)
+		assert_equal(#gaps, 2)
+		assert_true(gaps[2].out_of_order)
+
+		-- messages without sequence numbers are ignored
+		test_engine.receive_socket_message(socket, { match_data = { match_id = "00000000-0000-0000-0000-000000000001.", data = b64.encode("data") } })
+		assert_equal(#gaps, 2)
+	end)
+
+	test("It should not track sequences unless enabled", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		socket.on_match_data(function() end)
+		local gaps = 0
+		socket.on_sequence_gap(function() gaps = gaps + 1 end)
+		test_engine.receive_socket_message(socket, { match_data = { match_id = "00000000-0000-0000-0000-000000000001.", data = b64.encode("data"), seq = 1 } })
+		test_engine.receive_socket_message(socket, { match_data = { match_id = "00000000-0000-0000-0000-000000000001.", data = b64.encode("data"), seq = 5 } })
+		assert_equal(gaps, 0)
+	end)
+
+	test("It should send messages sent while reconnecting when connected again", function()
+		local c = config()
+		c.socket_buffer_on_reconnect = true
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		local disconnected = false
+		socket.on_disconnect(function() disconnected = true end)
+		socket.connect(function() end)
+
+		test_engine.disconnect_socket(socket)
+		assert_true(disconnected)
 
+		test_engine.set_socket_send_result("match_join", { match = { match_id = "00000000-0000-0000-0000-000000000001." } })
+		local result
+		socket.match_join("00000000-0000-0000-0000-000000000001.", nil, nil, function(r) result = r end)
+		assert_nil(test_engine.get_socket_message())
+		assert_nil(result)
+
+		socket.connect(function() end)
+		assert_not_nil(test_engine.get_socket_message().match_join)
+		assert_equal(result.match.match_id, "00000000-0000-0000-0000-000000000001.")
+	end)
+
+	test("It should fail messages sent while reconnecting after the timeout", function()
+		local c = config()
+		c.socket_buffer_on_reconnect = true
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		socket.connect(function() end)
+		test_engine.disconnect_socket(socket)
+
+		local result
+		socket.match_join("00000000-0000-0000-0000-000000000001.", nil, nil, function(r) result = r end)
+		test_engine.advance_time(c.timeout)
+		assert_not_nil(result)
+		assert_true(result.error)
+
+		-- not sent when connected again
+		socket.connect(function() end)
+		assert_nil(test_engine.get_socket_message())
+	end)
+
+	test("It should signal backpressure and drain of pending sends", function()
+		local c = config()
+		c.socket_buffer_on_reconnect = true
+		c.socket_backpressure_threshold = 2
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		local events = {}
+		socket.on_backpressure(function(event) table.insert(events, "backpressure " .. event.pending) end)
+		socket.on_drain(function() table.insert(events, "drain") end)
+		socket.connect(function() end)
+		test_engine.disconnect_socket(socket)
+
+		socket.match_join("00000000-0000-0000-0000-000000000001.", nil, nil, function() end)
+		assert_equal(socket.pending_sends(), 1)
+		assert_equal(#events, 0)
+		socket.match_join("00000000-0000-0000-0000-000000000002.", nil, nil, function() end)
+		socket.match_join("00000000-0000-0000-0000-000000000003.", nil, nil, function() end)
+		assert_equal(socket.pending_sends(), 3)
+		-- only signalled when the threshold is reached
+		assert_equal(#events, 1)
+		assert_equal(events[1], "backpressure 2")
+
+		socket.connect(function() end)
+		assert_equal(socket.pending_sends(), 0)
+		assert_equal(#events, 2)
+		assert_equal(events[2], "drain")
+	end)
+
+	test("It should send messages while reconnecting unless buffering is enabled", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		socket.connect(function() end)
+		test_engine.disconnect_socket(socket)
+		socket.match_join("00000000-0000-0000-0000-000000000001.", nil, nil, function() end)
+		assert_not_nil(test_engine.get_socket_message())
+	end)
+
+	test("It should reconnect with increasing delays until connected", function()
+		local c = config()
+		c.socket_reconnect = { 1, 2, 4 }
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		local attempts = 0
+		socket.engine = setmetatable({
+			socket_connect = function(...)
+				attempts = attempts + 1
+				return test_engine.socket_connect(...)
+			end,
+		}, { __index = test_engine })
+		socket.connect(function() end)
+		assert_equal(attempts, 1)
+
+		test_engine.set_socket_connect_result(false, "unavailable")
+		test_engine.disconnect_socket(socket)
+		test_engine.advance_time(1)
+		assert_equal(attempts, 2)
+		test_engine.advance_time(1)
+		assert_equal(attempts, 2)
+		test_engine.advance_time(1)
+		assert_equal(attempts, 3)
+
+		-- reset after connecting
+		test_engine.set_socket_connect_result(true)
+		test_engine.advance_time(4)
+		assert_equal(attempts, 4)
+		assert_false(socket.reconnecting)
+		test_engine.set_socket_connect_result(false, "unavailable")
+		test_engine.disconnect_socket(socket)
+		test_engine.advance_time(1)
+		assert_equal(attempts, 5)
+
+		-- give up when out of attempts
+		test_engine.advance_time(2)
+		assert_equal(attempts, 6)
+		test_engine.advance_time(4)
+		assert_equal(attempts, 7)
+		test_engine.advance_time(100)
+		assert_equal(attempts, 7)
+	end)
+
+	test("It should find and join a match", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		test_engine.set_socket_send_result("matchmaker_add", { matchmaker_ticket = { ticket = "ticket1" } })
+		test_engine.set_socket_send_result("match_join", { match = { match_id = "00000000-0000-0000-0000-000000000001." } })
+
+		local match, err
+		coroutine.wrap(function()
+			socket.connect()
+			match, err = socket.quick_match("*", 2, 4)
+		end)()
+		assert_equal(test_engine.get_socket_message().matchmaker_add.query, "*")
+		test_engine.receive_socket_message(socket, { matchmaker_matched = { ticket = "other", token = "token0" } })
+		assert_nil(match)
+		test_engine.receive_socket_message(socket, { matchmaker_matched = { ticket = "ticket1", token = "token1" } })
+		assert_equal(test_engine.get_socket_message().match_join.token, "token1")
+		assert_equal(match.match_id, "00000000-0000-0000-0000-000000000001.")
+		assert_nil(err)
+	end)
+
+	test("It should stop finding a match on timeout", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		test_engine.set_socket_send_result("matchmaker_add", { matchmaker_ticket = { ticket = "ticket1" } })
+
+		local match, err
+		coroutine.wrap(function()
+			socket.connect()
+			match, err = socket.quick_match("*", 2, 4, 10)
+		end)()
+		test_engine.advance_time(10)
+		assert_nil(match)
+		assert_equal(err, "timeout")
+		assert_equal(test_engine.get_socket_message().matchmaker_remove.ticket, "ticket1")
+	end)
+
+	test("It should pass sent and received messages through interceptors", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		socket.connect(function() end)
+
+		local calls = {}
+		socket.use(function(direction, message)
+			table.insert(calls, "first " .. direction)
+			if direction == "outgoing" and message.match_join then
+				-- migrate the message to a new version
+				return { match_join = { match_id = message.match_join.match_id, version = 2 } }
+			end
+		end)
+		local remove = socket.use(function(direction, message)
+			table.insert(calls, "second " .. direction)
+			if direction == "incoming" and message.status_presence_event then
+				return false
+			end
+		end)
+
+		test_engine.set_socket_send_result("match_join", { match = { match_id = "00000000-0000-0000-0000-000000000001." } })
+		local result
+		socket.match_join("00000000-0000-0000-0000-000000000001.", nil, nil, function(r) result = r end)
+		assert_equal(test_engine.get_socket_message().match_join.version, 2)
+		assert_equal(result.match.match_id, "00000000-0000-0000-0000-000000000001.")
+		-- outgoing in the order added, incoming in reverse order
+		assert_equal(table.concat(calls, ","), "first outgoing,second outgoing,second incoming,first incoming")
+
+		-- dropped messages aren't handled
+		local received = false
+		socket.on_status_presence_event(function() received = true end)
+		test_engine.receive_socket_message(socket, { status_presence_event = {} })
+		assert_false(received)
+
+		remove()
+		test_engine.receive_socket_message(socket, { status_presence_event = {} })
+		assert_true(received)
+	end)
+
+	test("It should throttle match data with a send rate", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		socket.connect(function() end)
+		socket.set_send_rate(1, 2)
+
+		local results = 0
+		local function on_result() results = results + 1 end
+		socket.match_data_send("m1", 1, "a", nil, nil, on_result)
+		assert_equal(b64.decode(test_engine.get_socket_message().match_data_send.data), "a")
+		-- throttled until the end of the interval
+		socket.match_data_send("m1", 1, "b", nil, nil, on_result)
+		socket.match_data_send("m1", 1, "c", nil, nil, on_result)
+		assert_nil(test_engine.get_socket_message())
+		-- other op codes are not throttled
+		socket.match_data_send("m1", 2, "x", nil, nil, on_result)
+		assert_equal(b64.decode(test_engine.get_socket_message().match_data_send.data), "x")
+		assert_equal(results, 2)
+
+		-- only the most recent match data is sent
+		test_engine.advance_time(0.5)
+		assert_equal(b64.decode(test_engine.get_socket_message().match_data_send.data), "c")
+		assert_nil(test_engine.get_socket_message())
+		assert_equal(results, 4)
+
+		-- merge match data instead
+		socket.set_send_rate(1, 2, function(data, new_data) return data .. new_data end)
+		socket.match_data_send("m1", 1, "d", nil, nil, on_result)
+		socket.match_data_send("m1", 1, "e", nil, nil, on_result)
+		socket.match_data_send("m1", 1, "f", nil, nil, on_result)
+		assert_equal(b64.decode(test_engine.get_socket_message().match_data_send.data), "d")
+		test_engine.advance_time(0.5)
+		assert_equal(b64.decode(test_engine.get_socket_message().match_data_send.data), "ef")
+
+		-- throttled match data is sent when the send rate is removed
+		test_engine.advance_time(0.5)
+		socket.match_data_send("m1", 1, "g", nil, nil, on_result)
+		socket.match_data_send("m1", 1, "h", nil, nil, on_result)
+		socket.set_send_rate(1, nil)
+		assert_equal(b64.decode(test_engine.get_socket_message().match_data_send.data), "h")
+		socket.match_data_send("m1", 1, "i", nil, nil, on_result)
+		assert_equal(b64.decode(test_engine.get_socket_message().match_data_send.data), "i")
+	end)
+
+	test("It should not reconnect a kicked socket", function()
+		local c = config()
+		c.socket_reconnect = { 1, 2, 4 }
+		local banned = {}
+		c.on_banned = function(info) table.insert(banned, info) end
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		local attempts = 0
+		socket.engine = setmetatable({
+			socket_connect = function(...)
+				attempts = attempts + 1
+				return test_engine.socket_connect(...)
+			end,
+		}, { __index = test_engine })
+		socket.connect(function() end)
+
+		test_engine.disconnect_socket(socket, "Session kicked")
+		test_engine.advance_time(10)
+		assert_equal(attempts, 1)
+		assert_equal(#banned, 1)
+		assert_equal(banned[1].reason, "kicked")
+		assert_equal(banned[1].source, "socket")
+		assert_nil(client.config.banned)
+
+		socket.connect(function() end)
+		test_engine.disconnect_socket(socket, "User banned")
+		assert_equal(banned[2].reason, "banned")
+		assert_not_nil(client.config.banned)
+	end)
+
+	test("It should encode and decode match data with codecs", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		socket.connect(function() end)
+
+		-- a userdata like a Defold vmath.vector3
+		local components = {}
+		local function vector3(x, y, z)
+			local v = newproxy(true)
+			components[v] = { x, y, z }
+			getmetatable(v).__tostring = function() return ("vmath.vector3(%d, %d, %d)"):format(x, y, z) end
+			return v
+		end
+		socket.register_codec("vmath.vector3", function(v)
+			return components[v]
+		end, function(t)
+			return vector3(t[1], t[2], t[3])
+		end)
+
+		local data = socket.encode_match_data({ position = vector3(1, 2, 3), name = "player" })
+		local value = socket.decode_match_data(data)
+		assert_equal(tostring(value.position), "vmath.vector3(1, 2, 3)")
+		assert_equal(value.name, "player")
+
+		-- received JSON match data is decoded as the value of the match data
+		local received
+		socket.on_match_data(function(message) received = message.match_data end)
+		test_engine.receive_socket_message(socket, { match_data = { data = b64.encode(data) } })
+		assert_equal(received.data, data)
+		assert_equal(tostring(received.value.position), "vmath.vector3(1, 2, 3)")
+		test_engine.receive_socket_message(socket, { match_data = { data = b64.encode("not json") } })
+		assert_nil(received.value)
+	end)
+
+	test("It should encode and decode frames using the codec of the socket format", function()
+		-- the json codec sends {} instead of [] for match_create
+		assert_equal(frame_codec.get().encode({ match_create = {} }), '{"match_create":{}}')
+
+		-- a codec standing in for a protobuf codec
+		local frames = {}
+		frame_codec.register("test", {
+			encode = function(message)
+				local data = "frame:" .. json.encode(message)
+				table.insert(frames, data)
+				return data
+			end,
+			decode = function(data)
+				return json.decode(data:sub(7))
+			end,
+			binary = true,
+		})
+
+		local c = config()
+		c.socket_format = "test"
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		socket.connect(function() end)
+		socket.match_data_send("id1234", 1, "somedata", nil, nil, function() end)
+		assert_equal(#frames, 1)
+		assert_not_nil(frames[1]:find("id1234", 1, true))
+		local message = test_engine.get_socket_message()
+		assert_equal(message.match_data_send.match_id, "id1234")
+
+		local received
+		socket.on_match_data(function(message) received = message.match_data end)
+		test_engine.receive_socket_message(socket, { match_data = { match_id = "id1234", data = b64.encode("hello") } })
+		assert_equal(#frames, 2)
+		assert_equal(received.data, "hello")
+
+		-- a format without a codec can't be used
+		c.socket_format = "unknown"
+		client = nakama.create_client(c)
+		local ok, err = pcall(client.create_socket)
+		assert_false(ok)
+		assert_not_nil(tostring(err):find("No codec registered for the socket format 'unknown'", 1, true))
+	end)
+
+	test("It should connect to the configured socket path", function()
+		local client = nakama.create_client(config())
+		assert_equal(client.config.socket_path, "/ws")
+
+		local c = config()
+		c.socket_path = "/game/realtime"
+		client = nakama.create_client(c)
+		assert_equal(client.config.socket_path, "/game/realtime")
+
+		c.socket_path = "realtime"
+		assert_false(pcall(nakama.create_client, c))
+	end)
+
+	test("It should join matches by id, by name or by token", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		socket.connect(function() end)
+		local match_id = "b4a2e6a4-9a10-4a8f-8a57-5f3c2a8e9d11.nakama1"
+		test_engine.set_socket_send_result("match_join", { match = { match_id = match_id, presences = {} } })
+		test_engine.set_socket_send_result("match_create", { match = { match_id = "c1e5e0a8-0000-4000-8000-000000000001.", presences = {} } })
+
+		local result
+		socket.match_join(match_id, nil, { level = "1" }, function(r) result = r end)
+		local message = test_engine.get_socket_message()
+		assert_equal(message.match_join.match_id, match_id)
+		assert_equal(message.match_join.metadata.level, "1")
+		assert_equal(result.match.match_id, match_id)
+
+		-- a name isn't a match id
+		socket.match_join("lobby", nil, nil, function(r) result = r end)
+		message = test_engine.get_socket_message()
+		assert_nil(message.match_join)
+		assert_equal(message.match_create.name, "lobby")
+		assert_equal(result.match.match_id, "c1e5e0a8-0000-4000-8000-000000000001.")
+		assert_false(pcall(socket.match_join, "lobby", nil, { level = "1" }, function() end))
+
+		-- matchmaker tokens
+		socket.match_join(nil, "token1", nil, function() end)
+		assert_equal(test_engine.get_socket_message().match_join.token, "token1")
+
+		socket.match_join_by_name("lobby", function() end)
+		assert_equal(test_engine.get_socket_message().match_create.name, "lobby")
+		socket.match_join_by_id(match_id, nil, function() end)
+		assert_equal(test_engine.get_socket_message().match_join.match_id, match_id)
+		assert_false(pcall(socket.match_join_by_id, "lobby", nil, function() end))
+		assert_false(pcall(socket.match_join_by_name, "", function() end))
+		assert_false(pcall(socket.match_join, nil, nil, nil, function() end))
+
+		-- a malformed match id isn't joined as a name
+		assert_false(pcall(socket.match_join, "c1e5e0a8-0000-4000-8000-000000000001", nil, nil, function() end))
+		assert_false(pcall(socket.match_join, "c1e5e0a8-0000-4000-8000-00000000001.", nil, nil, function() end))
+		assert_false(pcall(socket.match_join, "c1e5e0a800004000800000000000000001", nil, nil, function() end))
+		assert_nil(test_engine.get_socket_message())
+	end)
+
+	test("It should validate match data with an op code against a schema", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		local positions = {}
+		local count = { all = 0, replaced = 0 }
+		socket.on_match_data(function() count.all = count.all + 1 end)
+		socket.on_match_data(1, function(message)
+			table.insert(positions, message.match_data.value)
+		end, { x = "number", y = "number", name = "string?", stats = { hp = "number", ["?"] = true } })
+		local chats = {}
+		socket.on_match_data(2, function(message)
+			table.insert(chats, message.match_data.data)
+		end)
+
+		local function receive(op_code, data)
+			test_engine.receive_socket_message(socket, { match_data = { match_id = "m", op_code = op_code, data = b64.encode(data) } })
+		end
+		receive("1", '{"x":1,"y":2}')
+		receive(1, '{"x":3,"y":4,"name":"player","stats":{"hp":10}}')
+		-- invalid match data is dropped
+		receive(1, '{"x":"1","y":2}')
+		receive(1, '{"x":1}')
+		receive(1, '{"x":1,"y":2,"name":5}')
+		receive(1, '{"x":1,"y":2,"stats":{}}')
+		receive(1, '[1,2]')
+		receive(1, 'not json')
+		-- match data with other op codes isn't validated
+		receive(2, "hello")
+		assert_equal(#positions, 2)
+		assert_equal(positions[1].y, 2)
+		assert_equal(positions[2].name, "player")
+		assert_equal(chats[1], "hello")
+		assert_equal(count.all, 9)
+
+		-- the handler of an op code is replaced
+		socket.on_match_data(1, function() count.replaced = count.replaced + 1 end)
+		receive(1, '{"x":"1"}')
+		assert_equal(#positions, 2)
+		assert_equal(count.replaced, 1)
+	end)
+
+	test("It should reconnect, resubscribe and send pending messages with a resilient socket", function()
+		local c = config()
+		c.resilient_socket = true
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		local events = {}
+		socket.on("lost", function(event) table.insert(events, event) end)
+		socket.on_reconnected(function(event) table.insert(events, event) end)
+		local resubscribed = {}
+		socket.on_resubscribe(function(event) resubscribed[event.type] = event.success end)
+
+		socket.connect(function() end)
+		test_engine.set_socket_send_result("channel_join", { channel = { id = "channel1" } })
+		socket.channel_join("room1", nakama_socket.CHANNELTYPE_ROOM, false, false, function() end)
+		while test_engine.get_socket_message() do end
+
+		-- drop
+		test_engine.set_socket_connect_result(false, "unavailable")
+		test_engine.disconnect_socket(socket, "connection reset")
+		assert_equal(#events, 1)
+		assert_equal(events[1].reason, "connection reset")
+		assert_true(events[1].reconnecting)
+
+		-- kept until reconnected
+		test_engine.set_socket_send_result("match_join", { match = { match_id = "00000000-0000-0000-0000-000000000001." } })
+		local result
+		socket.match_join("00000000-0000-0000-0000-000000000001.", nil, nil, function(r) result = r end)
+		assert_nil(test_engine.get_socket_message())
+
+		-- reconnect after a failed attempt
+		test_engine.advance_time(1)
+		assert_equal(#events, 1)
+		test_engine.set_socket_connect_result(true)
+		test_engine.advance_time(2)
+		assert_equal(#events, 2)
+		assert_equal(events[2].attempts, 2)
+
+		-- resubscribe
+		assert_true(resubscribed.channel_join)
+		assert_not_nil(test_engine.get_socket_message().match_join)
+		assert_not_nil(test_engine.get_socket_message().channel_join)
+		assert_equal(result.match.match_id, "00000000-0000-0000-0000-000000000001.")
+
+		-- answered heartbeat
+		test_engine.advance_time(15)
+		assert_not_nil(test_engine.get_socket_message().ping)
+		-- the ping must be sent as an object, the server closes the socket otherwise
+		assert_equal(test_engine.get_socket_frame(), '{"ping":{}}')
+		assert_equal(#events, 2)
+
+		-- unanswered heartbeat
+		socket.engine = setmetatable({
+			socket_send = function(socket, message, callback)
+				if not message.ping then
+					return test_engine.socket_send(socket, message, callback)
+				end
+			end,
+		}, { __index = test_engine })
+		test_engine.advance_time(15)
+		assert_equal(#events, 2)
+		test_engine.advance_time(15)
+		assert_equal(#events, 3)
+		assert_equal(events[3].reason, "heartbeat_timeout")
+		assert_true(events[3].reconnecting)
+		assert_true(socket.closed)
+		test_engine.advance_time(1)
+		assert_equal(#events, 4)
+		assert_equal(events[4].attempts, 1)
+	end)
+
+	test("It should let the options of a resilient socket be set one by one", function()
+		local c = config()
+		c.resilient_socket = true
+		c.auto_resubscribe = false
+		c.socket_heartbeat = 30
+		local client = nakama.create_client(c)
+		assert_false(client.config.auto_resubscribe)
+		assert_true(client.config.socket_buffer_on_reconnect)
+		assert_equal(#client.config.socket_reconnect, 10)
+		assert_equal(client.config.socket_heartbeat, 30)
+
+		client = nakama.create_client(config())
+		assert_nil(client.config.auto_resubscribe)
+		assert_nil(client.config.socket_reconnect)
+		assert_nil(client.config.socket_heartbeat)
+	end)
+
+	test("It should coalesce status updates made during the debounce interval", function()
+		local c = config()
+		c.status_update_debounce = 1
+		local client = nakama.create_client(c)
+		local socket = client.create_socket()
+		socket.connect(function() end)
+
+		local results = {}
+		socket.status_update("menu", function(r) table.insert(results, r) end)
+		socket.status_update("lobby", function(r) table.insert(results, r) end)
+		socket.status_update("playing", function(r) table.insert(results, r) end)
+		assert_nil(test_engine.get_socket_message())
+		assert_equal(#results, 0)
+
+		-- only the latest status is sent at the end of the interval
+		test_engine.advance_time(1)
+		assert_equal(test_engine.get_socket_message().status_update.status, "playing")
+		assert_nil(test_engine.get_socket_message())
+		assert_equal(#results, 3)
+
+		-- sent right away, dropping the status waiting for the end of the interval
+		results = {}
+		socket.status_update("menu", function(r) table.insert(results, r) end)
+		socket.status_update_now("away", function(r) table.insert(results, r) end)
+		assert_equal(test_engine.get_socket_message().status_update.status, "away")
+		assert_equal(#results, 2)
+		test_engine.advance_time(1)
+		assert_nil(test_engine.get_socket_message())
+		assert_equal(#results, 2)
+	end)
+
+	test("It should send status updates right away unless debounced", function()
+		local client = nakama.create_client(config())
+		local socket = client.create_socket()
+		socket.connect(function() end)
+		socket.status_update("menu", function() end)
+		socket.status_update("lobby", function() end)
+		assert_equal(test_engine.get_socket_message().status_update.status, "lobby")
+		assert_equal(test_engine.get_socket_message().status_update.status, "menu")
+	end)
+end)
@@ -0,0 +1,38 @@
+local time = require "nakama.util.time"
+
+context("Time", function()
+	before(function() end)
+	after(function() end)
+
+	test("It should parse RFC3339 timestamps", function()
+		assert_equal(time.parse_rfc3339("1970-01-01T00:00:00Z"), 0)
+		assert_equal(time.parse_rfc3339("2023-01-02T03:04:05Z"), 1672628645)
+		assert_equal(time.parse_rfc3339("2023-01-02T03:04:05.5Z"), 1672628645.5)
+		assert_equal(time.parse_rfc3339("2023-01-02T05:04:05+02:00"), 1672628645)
+		assert_equal(time.parse_rfc3339("2023-01-01T22:34:05-04:30"), 1672628645)
+		assert_nil(time.parse_rfc3339("2023-01-02T03:04:05"))
+		assert_nil(time.parse_rfc3339("yesterday"))
+		assert_nil(time.parse_rfc3339(nil))
+	end)
+
+	test("It should format RFC3339 timestamps", function()
+		assert_equal(time.format_rfc3339(0), "1970-01-01T00:00:00Z")
+		assert_equal(time.format_rfc3339(1672628645), "2023-01-02T03:04:05Z")
+		assert_equal(time.format_rfc3339(1672628645.25), "2023-01-02T03:04:05.250Z")
+		assert_equal(time.parse_rfc3339(time.format_rfc3339(1672628645.25)), 1672628645.25)
+	end)
+
+	test("It should convert timestamp fields", function()
+		local result = time.convert_timestamps({
+			create_time = "2023-01-02T03:04:05Z",
+			name = "2023-01-02T03:04:05Z",
+			records = {
+				{ update_time = "2023-01-02T03:04:05Z", expiry_time = "" },
+			},
+		})
+		assert_equal(result.create_time, 1672628645)
+		assert_equal(result.name, "2023-01-02T03:04:05Z")
+		assert_equal(result.records[1].update_time, 1672628645)
+		assert_equal(result.records[1].expiry_time, "")
+	end)
+end)